@@ -3,14 +3,18 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
+	Server    ServerConfig    `json:"server"`
+	Database  DatabaseConfig  `json:"database"`
+	Study     StudyConfig     `json:"study"`
+	Backplane BackplaneConfig `json:"backplane"`
+	Mail      MailConfig      `json:"mail"`
 }
 
 // ServerConfig 服务器配置
@@ -31,6 +35,30 @@ type DatabaseConfig struct {
 	SQLitePath string `json:"sqlite_path"`
 }
 
+// StudyConfig 学习时长校验配置
+type StudyConfig struct {
+	MaxSessionMinutes int `json:"max_session_minutes"` // 单次会话最多计入的分钟数
+	PingGapSeconds    int `json:"ping_gap_seconds"`    // 两次心跳间隔超过该值视为离开
+	MaxDailyMinutes   int `json:"max_daily_minutes"`   // 单日最多计入的分钟数
+}
+
+// BackplaneConfig 自习室多实例消息总线配置
+type BackplaneConfig struct {
+	Driver        string `json:"driver"` // memory, redis
+	RedisAddr     string `json:"redis_addr"`
+	RedisPassword string `json:"-"`
+	RedisDB       int    `json:"redis_db"`
+}
+
+// MailConfig 邮件发送配置，SMTPHost 为空时不发送邮件
+type MailConfig struct {
+	SMTPHost string `json:"smtp_host"`
+	SMTPPort string `json:"smtp_port"`
+	Username string `json:"username"`
+	Password string `json:"-"`
+	From     string `json:"from"`
+}
+
 var AppConfig *Config
 
 // LoadConfig 加载配置
@@ -55,6 +83,24 @@ func LoadConfig() {
 			Charset:    getEnv("DB_CHARSET", "utf8mb4"),
 			SQLitePath: getEnv("DB_SQLITE_PATH", "learning_assistant.db"),
 		},
+		Study: StudyConfig{
+			MaxSessionMinutes: getEnvInt("STUDY_MAX_SESSION_MINUTES", 240),
+			PingGapSeconds:    getEnvInt("STUDY_PING_GAP_SECONDS", 90),
+			MaxDailyMinutes:   getEnvInt("STUDY_MAX_DAILY_MINUTES", 960),
+		},
+		Backplane: BackplaneConfig{
+			Driver:        getEnv("STUDY_BACKPLANE", "memory"),
+			RedisAddr:     getEnv("REDIS_HOST", "localhost") + ":" + getEnv("REDIS_PORT", "6379"),
+			RedisPassword: getEnv("REDIS_PASSWORD", ""),
+			RedisDB:       getEnvInt("REDIS_DB", 0),
+		},
+		Mail: MailConfig{
+			SMTPHost: getEnv("SMTP_HOST", ""),
+			SMTPPort: getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", ""),
+		},
 	}
 }
 
@@ -65,3 +111,17 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt 获取整数环境变量，缺失或格式错误时返回默认值
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
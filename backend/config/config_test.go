@@ -29,3 +29,37 @@ func TestLoadConfigReadsSQLiteSettings(t *testing.T) {
 		t.Fatalf("expected configured sqlite path, got %q", AppConfig.Database.SQLitePath)
 	}
 }
+
+func TestLoadConfigReadsStudyGuardSettings(t *testing.T) {
+	t.Setenv("STUDY_MAX_SESSION_MINUTES", "180")
+	t.Setenv("STUDY_PING_GAP_SECONDS", "bad")
+	t.Setenv("STUDY_MAX_DAILY_MINUTES", "")
+
+	LoadConfig()
+
+	if AppConfig.Study.MaxSessionMinutes != 180 {
+		t.Fatalf("expected max session minutes 180, got %d", AppConfig.Study.MaxSessionMinutes)
+	}
+	if AppConfig.Study.PingGapSeconds != 90 {
+		t.Fatalf("expected invalid ping gap to fall back to 90, got %d", AppConfig.Study.PingGapSeconds)
+	}
+	if AppConfig.Study.MaxDailyMinutes != 960 {
+		t.Fatalf("expected default max daily minutes 960, got %d", AppConfig.Study.MaxDailyMinutes)
+	}
+}
+
+func TestLoadConfigReadsBackplaneSettings(t *testing.T) {
+	t.Setenv("STUDY_BACKPLANE", "redis")
+	t.Setenv("REDIS_HOST", "cache.internal")
+	t.Setenv("REDIS_PORT", "6380")
+	t.Setenv("REDIS_DB", "3")
+
+	LoadConfig()
+
+	if AppConfig.Backplane.Driver != "redis" {
+		t.Fatalf("expected redis backplane, got %q", AppConfig.Backplane.Driver)
+	}
+	if AppConfig.Backplane.RedisAddr != "cache.internal:6380" || AppConfig.Backplane.RedisDB != 3 {
+		t.Fatalf("unexpected redis settings %+v", AppConfig.Backplane)
+	}
+}
@@ -0,0 +1,32 @@
+// Package testdb 为测试提供独立的内存 SQLite 数据库
+package testdb
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+// Open 按测试名打开共享缓存的内存 SQLite，迁移给定模型（未指定时迁移全部模型），
+// 并替换全局数据库连接，供依赖 database.GetDB 的代码使用
+func Open(t testing.TB, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()) + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	database.DB = db
+	if len(tables) == 0 {
+		tables = models.GetAllModels()
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
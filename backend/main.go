@@ -1,7 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -12,6 +22,7 @@ import (
 	_ "learningAssistant-backend/docs" // 导入生成的 docs
 	"learningAssistant-backend/middleware"
 	"learningAssistant-backend/routes"
+	"learningAssistant-backend/services/achievement"
 )
 
 func main() {
@@ -21,6 +32,11 @@ func main() {
 	// 初始化数据库
 	database.InitDatabase()
 
+	// 带子命令运行时执行维护命令后退出，不启动服务
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// 设置 Gin 模式
 	gin.SetMode(config.AppConfig.Server.Mode)
 
@@ -38,12 +54,62 @@ func main() {
 	// 设置路由
 	routes.SetupRoutes(r)
 
+	// 启动后台定时任务
+	routes.StartBackgroundJobs()
+
 	// 启动服务器
 	port := ":" + config.AppConfig.Server.Port
 	log.Printf("Server starting on port %s", config.AppConfig.Server.Port)
 	log.Printf("Server mode: %s", config.AppConfig.Server.Mode)
 
-	if err := r.Run(port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{Addr: port, Handler: r}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	// 先停止接收新请求，再断开 WebSocket 连接（http.Server.Shutdown 不会等待已升级的连接）
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+	routes.ShutdownStudyHubs(shutdownCtx)
+	routes.StopBackgroundJobs()
+}
+
+// runCommand 执行维护子命令，返回进程退出码
+func runCommand(name string, args []string) int {
+	switch name {
+	case "recompute-achievements":
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		userID := fs.Uint64("user", 0, "只重算指定用户，默认重算全部有效用户")
+		dryRun := fs.Bool("dry-run", false, "只输出差异与将解锁的成就，不写入数据库")
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		opts := achievement.RecomputeOptions{DryRun: *dryRun}
+		var result interface{}
+		var err error
+		if *userID > 0 {
+			result, err = achievement.Recompute(database.GetDB(), *userID, opts)
+		} else {
+			result, err = achievement.RecomputeAll(database.GetDB(), opts)
+		}
+		if err != nil {
+			log.Printf("recompute achievements failed: %v", err)
+			return 1
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\navailable commands:\n  recompute-achievements [-user ID] [-dry-run]\n", name)
+		return 2
 	}
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// DirectConversation 两位用户之间的私信会话，UserLowID 始终小于 UserHighID
+type DirectConversation struct {
+	BaseModel
+	UserLowID     uint64     `gorm:"uniqueIndex:idx_direct_conversation_pair;not null" json:"user_low_id"`
+	UserHighID    uint64     `gorm:"uniqueIndex:idx_direct_conversation_pair;not null" json:"user_high_id"`
+	LastMessageID uint64     `json:"last_message_id"`
+	LastMessageAt *time.Time `gorm:"precision:3;index" json:"last_message_at"`
+}
+
+// TableName 指定表名
+func (DirectConversation) TableName() string { return "direct_conversations" }
+
+// DirectMessage 私信消息
+type DirectMessage struct {
+	BaseModel
+	ConversationID uint64     `gorm:"index;not null" json:"conversation_id"`
+	SenderID       uint64     `gorm:"not null" json:"sender_id"`
+	RecipientID    uint64     `gorm:"index;not null" json:"recipient_id"`
+	Content        string     `gorm:"type:text;not null" json:"content"`
+	SentAt         time.Time  `gorm:"precision:3;autoCreateTime" json:"sent_at"`
+	ReadAt         *time.Time `gorm:"precision:3" json:"read_at"`
+}
+
+// TableName 指定表名
+func (DirectMessage) TableName() string { return "direct_messages" }
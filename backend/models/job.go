@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	JobRunStatusRunning = "running"
+	JobRunStatusSuccess = "success"
+	JobRunStatusFailed  = "failed"
+	JobRunStatusSkipped = "skipped"
+
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobRun 后台任务执行记录
+type JobRun struct {
+	BaseModel
+	JobName     string  `gorm:"type:varchar(64);index;uniqueIndex:idx_job_run_slot;not null" json:"job_name"`
+	Trigger     string  `gorm:"type:varchar(16);not null" json:"trigger"`
+	TriggeredBy *uint64 `json:"triggered_by"`
+	InstanceID  string  `gorm:"type:varchar(128)" json:"instance_id"`
+	Status      string  `gorm:"type:varchar(16);index;not null" json:"status"`
+	// ScheduledAt 定时触发时对应的调度时刻，同一时刻只能被一个实例认领；手动触发为空
+	ScheduledAt *time.Time `gorm:"precision:3;uniqueIndex:idx_job_run_slot" json:"scheduled_at"`
+	StartedAt   time.Time  `gorm:"precision:3;not null" json:"started_at"`
+	FinishedAt  *time.Time `gorm:"precision:3" json:"finished_at"`
+	DurationMs  int64      `gorm:"default:0" json:"duration_ms"`
+	Output      string     `gorm:"type:varchar(512)" json:"output"`
+	Error       string     `gorm:"type:text" json:"error"`
+}
+
+func (JobRun) TableName() string { return "job_runs" }
+
+// JobLock 多实例之间的任务互斥锁
+type JobLock struct {
+	BaseModel
+	JobName     string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"job_name"`
+	Owner       string     `gorm:"type:varchar(128)" json:"owner"`
+	LockedUntil *time.Time `gorm:"precision:3" json:"locked_until"`
+}
+
+func (JobLock) TableName() string { return "job_locks" }
@@ -25,7 +25,16 @@ func GetAllModels() []interface{} {
 		&UserAchievementProgress{},
 		&UserSkill{},
 		&UserSetting{},
+		&StudyBuddy{},
 		&PointsLedger{},
+		&PointsRule{},
+		&Reward{},
+		&RewardRedemption{},
+		&TeamChallenge{},
+		&StreakRule{},
+		&StreakFreeze{},
+		&ShareCard{},
+		&WeeklyReport{},
 		&LevelRule{},
 		&Team{},
 		&TeamMember{},
@@ -36,15 +45,32 @@ func GetAllModels() []interface{} {
 		&LearningRecord{},
 		&StudyRoom{},
 		&StudyRoomMember{},
+		&StudyRoomBan{},
+		&StudyRoomCall{},
+		&StudyRoomCallParticipant{},
 		&RoomSession{},
+		&RoomSessionRSVP{},
+		&RoomSessionAttendance{},
 		&ChatMessage{},
+		&ChatMessageReaction{},
+		&ChatReadCursor{},
+		&DirectConversation{},
+		&DirectMessage{},
 		&TaskCollaborationSession{},
 		&TaskCollaborationParticipant{},
 		&StudyNote{},
+		&StudyRoomDocument{},
+		&StudyRoomDocumentOp{},
+		&StudyRoomDocumentEditor{},
 		&StudySession{},
 		&DailyStudyStat{},
+		&StudySessionAdjustment{},
+		&PomodoroSession{},
+		&PomodoroInterruption{},
 		&Notification{},
 		&TeamRequest{},
+		&JobRun{},
+		&JobLock{},
 		// 知识库相关模型
 		&KnowledgeCategory{},
 		&KnowledgeBaseEntry{},
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	PomodoroPhaseWork       = "work"
+	PomodoroPhaseShortBreak = "short_break"
+	PomodoroPhaseLongBreak  = "long_break"
+
+	PomodoroStatusRunning int8 = 0
+	PomodoroStatusEnded   int8 = 1
+)
+
+// PomodoroSession 番茄钟会话（个人会话绑定 StudySession，房间同步番茄钟绑定 RoomID）
+type PomodoroSession struct {
+	BaseModel
+	UserID             uint64     `gorm:"index;not null" json:"user_id"`
+	StudySessionID     *uint64    `gorm:"index" json:"study_session_id"`
+	RoomID             *uint64    `gorm:"index" json:"room_id"`
+	WorkMinutes        int        `gorm:"default:25" json:"work_minutes"`
+	ShortBreakMinutes  int        `gorm:"default:5" json:"short_break_minutes"`
+	LongBreakMinutes   int        `gorm:"default:15" json:"long_break_minutes"`
+	LongBreakEvery     int        `gorm:"default:4" json:"long_break_every"`
+	Phase              string     `gorm:"type:varchar(16);not null" json:"phase"`
+	PhaseStartedAt     time.Time  `gorm:"precision:3;not null" json:"phase_started_at"`
+	CompletedPomodoros int        `gorm:"default:0" json:"completed_pomodoros"`
+	FocusMinutes       int        `gorm:"default:0" json:"focus_minutes"`
+	InterruptionCount  int        `gorm:"default:0" json:"interruption_count"`
+	Status             int8       `gorm:"type:tinyint;default:0;index" json:"status"`
+	EndedAt            *time.Time `gorm:"precision:3" json:"ended_at"`
+}
+
+func (PomodoroSession) TableName() string { return "pomodoro_sessions" }
+
+// PomodoroInterruption 番茄钟中断记录
+type PomodoroInterruption struct {
+	BaseModel
+	PomodoroID     uint64    `gorm:"index;not null" json:"pomodoro_id"`
+	UserID         uint64    `gorm:"index;not null" json:"user_id"`
+	Phase          string    `gorm:"type:varchar(16)" json:"phase"`
+	OccurredAt     time.Time `gorm:"precision:3;not null" json:"occurred_at"`
+	ElapsedMinutes int       `gorm:"default:0" json:"elapsed_minutes"`
+	Reason         string    `gorm:"type:varchar(128)" json:"reason"`
+}
+
+func (PomodoroInterruption) TableName() string { return "pomodoro_interruptions" }
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Reward 可用积分兑换的奖励。TeamID 为空表示管理员发布的全站奖励，否则由团队负责人维护、仅团队成员可兑换
+type Reward struct {
+	BaseModel
+	TeamID      *uint64 `gorm:"index" json:"team_id"`
+	Name        string  `gorm:"type:varchar(64);not null" json:"name"`
+	Description string  `gorm:"type:varchar(512)" json:"description"`
+	Cost        int     `gorm:"not null" json:"cost"`
+	// Stock 剩余库存，为空表示不限量
+	Stock            *int   `json:"stock"`
+	RequiresApproval bool   `gorm:"not null" json:"requires_approval"`
+	Active           bool   `gorm:"not null" json:"active"`
+	CreatedBy        uint64 `json:"created_by"`
+}
+
+// TableName 指定表名
+func (Reward) TableName() string { return "rewards" }
+
+const (
+	RedemptionStatusPending   = "pending"
+	RedemptionStatusApproved  = "approved"
+	RedemptionStatusRejected  = "rejected"
+	RedemptionStatusCancelled = "cancelled"
+)
+
+// RewardRedemption 兑换记录。兑换时即扣除积分与库存，被驳回或取消时退回
+type RewardRedemption struct {
+	BaseModel
+	RewardID uint64  `gorm:"index" json:"reward_id"`
+	TeamID   *uint64 `gorm:"index" json:"team_id"`
+	UserID   uint64  `gorm:"index" json:"user_id"`
+	// RewardName 兑换时的奖励名称快照
+	RewardName     string     `gorm:"type:varchar(64)" json:"reward_name"`
+	Cost           int        `json:"cost"`
+	Status         string     `gorm:"type:varchar(16);index;not null" json:"status"`
+	DebitLedgerID  uint64     `json:"debit_ledger_id"`
+	RefundLedgerID *uint64    `json:"refund_ledger_id"`
+	ReviewedBy     *uint64    `json:"reviewed_by"`
+	ReviewedAt     *time.Time `gorm:"precision:3" json:"reviewed_at"`
+	ReviewNote     string     `gorm:"type:varchar(256)" json:"review_note"`
+}
+
+// TableName 指定表名
+func (RewardRedemption) TableName() string { return "reward_redemptions" }
@@ -0,0 +1,24 @@
+package models
+
+const (
+	ShareCardKindAchievement = "achievement"
+	ShareCardKindLevel       = "level"
+)
+
+// ShareCard 可分享到站外的成就/等级卡片。Token 为随机生成的公开访问凭证，
+// Snapshot 保存分享时的数据，SVG 为渲染结果缓存，渲染版本升级后按快照重新渲染
+type ShareCard struct {
+	BaseModel
+	UserID uint64 `gorm:"uniqueIndex:idx_share_card_subject;not null" json:"user_id"`
+	Kind   string `gorm:"type:varchar(16);uniqueIndex:idx_share_card_subject;not null" json:"kind"`
+	// SubjectID 成就卡为成就ID，等级卡为等级
+	SubjectID     uint64 `gorm:"uniqueIndex:idx_share_card_subject;not null" json:"subject_id"`
+	Token         string `gorm:"type:varchar(64);uniqueIndex;not null" json:"token"`
+	Snapshot      string `gorm:"type:text" json:"-"`
+	SVG           string `gorm:"column:svg;type:mediumtext" json:"-"`
+	RenderVersion int    `gorm:"default:0" json:"-"`
+	ViewCount     int    `gorm:"default:0" json:"view_count"`
+}
+
+// TableName 指定表名
+func (ShareCard) TableName() string { return "share_cards" }
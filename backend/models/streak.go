@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// StreakRule 连续活跃天数的判定规则，全站一条，未配置时使用内置默认值
+type StreakRule struct {
+	BaseModel
+	// CountCheckIn 签到是否算作活跃
+	CountCheckIn bool `gorm:"not null" json:"count_check_in"`
+	// MinStudyMinutes 当日学习时长达到该分钟数算作活跃，0 表示学习时长不计入
+	MinStudyMinutes int `gorm:"default:0" json:"min_study_minutes"`
+	// CountTaskCompletion 当日完成任务是否算作活跃
+	CountTaskCompletion bool `gorm:"not null" json:"count_task_completion"`
+	// FreezeCost 购买一张保护卡所需积分
+	FreezeCost int `gorm:"default:0" json:"freeze_cost"`
+	// MaxFreezes 最多同时持有的保护卡数量，0 表示不开放购买
+	MaxFreezes int `gorm:"default:0" json:"max_freezes"`
+}
+
+// TableName 指定表名
+func (StreakRule) TableName() string { return "streak_rules" }
+
+const (
+	StreakFreezeStatusAvailable = "available"
+	StreakFreezeStatusUsed      = "used"
+)
+
+// StreakFreeze 连续打卡保护卡：错过的日期自动使用，保持连续天数不中断（当天不计入天数）
+type StreakFreeze struct {
+	BaseModel
+	UserID uint64 `gorm:"index;not null" json:"user_id"`
+	Status string `gorm:"type:varchar(16);index;not null" json:"status"`
+	// UsedDate 保护的日期（用户时区的日历日）
+	UsedDate *time.Time `gorm:"type:date" json:"used_date"`
+	LedgerID uint64     `json:"ledger_id"`
+}
+
+// TableName 指定表名
+func (StreakFreeze) TableName() string { return "streak_freezes" }
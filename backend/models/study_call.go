@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// StudyRoomCall 学习室群组通话记录
+type StudyRoomCall struct {
+	BaseModel
+	RoomID uint64 `gorm:"index" json:"room_id"`
+	// ActiveRoomID 通话进行中时等于 RoomID，结束后置空，借唯一索引保证每个房间同时只有一个群组通话
+	ActiveRoomID     *uint64    `gorm:"uniqueIndex" json:"-"`
+	StartedBy        uint64     `json:"started_by"`
+	StartedAt        time.Time  `gorm:"precision:3" json:"started_at"`
+	EndedAt          *time.Time `gorm:"precision:3" json:"ended_at"`
+	CountAsStudy     bool       `gorm:"default:false" json:"count_as_study"`
+	PeakParticipants int        `gorm:"default:0" json:"peak_participants"`
+	DurationMinutes  int        `gorm:"default:0" json:"duration_minutes"`
+}
+
+// TableName 指定表名
+func (StudyRoomCall) TableName() string { return "study_room_calls" }
+
+// StudyRoomCallParticipant 群组通话的参与记录，每次加入对应一行
+type StudyRoomCallParticipant struct {
+	BaseModel
+	CallID         uint64     `gorm:"index" json:"call_id"`
+	UserID         uint64     `gorm:"index" json:"user_id"`
+	PeerID         string     `gorm:"type:varchar(128)" json:"peer_id"`
+	JoinedAt       time.Time  `gorm:"precision:3" json:"joined_at"`
+	LeftAt         *time.Time `gorm:"precision:3" json:"left_at"`
+	Minutes        int        `gorm:"default:0" json:"minutes"`
+	StudySessionID *uint64    `json:"study_session_id"`
+}
+
+// TableName 指定表名
+func (StudyRoomCallParticipant) TableName() string { return "study_room_call_participants" }
@@ -0,0 +1,35 @@
+package models
+
+// StudyRoomDocument 学习室共享文档的最新快照
+type StudyRoomDocument struct {
+	BaseModel
+	RoomID    uint64 `gorm:"uniqueIndex" json:"room_id"`
+	Content   string `gorm:"type:longtext" json:"content"`
+	Version   int64  `gorm:"default:0" json:"version"`
+	UpdatedBy uint64 `json:"updated_by"`
+}
+
+// TableName 指定表名
+func (StudyRoomDocument) TableName() string { return "study_room_documents" }
+
+// StudyRoomDocumentOp 共享文档的操作日志，用于变换并发编辑与断线补发
+type StudyRoomDocumentOp struct {
+	BaseModel
+	RoomID    uint64 `gorm:"uniqueIndex:idx_room_doc_op" json:"room_id"`
+	Version   int64  `gorm:"uniqueIndex:idx_room_doc_op;comment:应用该操作后的版本号" json:"version"`
+	UserID    uint64 `json:"user_id"`
+	Operation string `gorm:"type:text;not null" json:"operation"`
+}
+
+// TableName 指定表名
+func (StudyRoomDocumentOp) TableName() string { return "study_room_document_ops" }
+
+// StudyRoomDocumentEditor 编辑过共享文档的成员，操作日志会被裁剪，贡献者需要单独记录
+type StudyRoomDocumentEditor struct {
+	BaseModel
+	RoomID uint64 `gorm:"uniqueIndex:idx_room_doc_editor" json:"room_id"`
+	UserID uint64 `gorm:"uniqueIndex:idx_room_doc_editor" json:"user_id"`
+}
+
+// TableName 指定表名
+func (StudyRoomDocumentEditor) TableName() string { return "study_room_document_editors" }
@@ -1,9 +1,11 @@
 package models
 
+// StudyNote 学习笔记；RoomID 非空的笔记由自习室共享文档保存而来，每位参与者每个房间一篇，再次保存时覆盖
 type StudyNote struct {
 	BaseModel
-	UserID  uint64  `json:"user_id"`
+	UserID  uint64  `gorm:"uniqueIndex:idx_study_note_room_user" json:"user_id"`
 	TaskID  *uint64 `json:"task_id"`
+	RoomID  *uint64 `gorm:"uniqueIndex:idx_study_note_room_user" json:"room_id,omitempty"`
 	Title   string  `gorm:"type:varchar(256);not null" json:"title"`
 	Content string  `gorm:"type:longtext" json:"content"`
 }
@@ -19,41 +19,129 @@ type StudyRoom struct {
 	FocusMinutesToday  int        `gorm:"default:0" json:"focus_minutes_today"`
 }
 
+// 学习室成员角色
+const (
+	StudyRoomRoleMember    int8 = 0
+	StudyRoomRoleModerator int8 = 1
+	StudyRoomRoleOwner     int8 = 2
+)
+
 // StudyRoomMember 学习室成员模型
 type StudyRoomMember struct {
 	BaseModel
-	RoomID   uint64    `json:"room_id"`
-	UserID   uint64    `json:"user_id"`
-	Role     int8      `gorm:"default:0" json:"role"`
-	JoinedAt time.Time `gorm:"precision:3;autoCreateTime" json:"joined_at"`
+	RoomID     uint64     `json:"room_id"`
+	UserID     uint64     `json:"user_id"`
+	Role       int8       `gorm:"default:0;comment:0=member,1=moderator,2=owner" json:"role"`
+	MutedUntil *time.Time `gorm:"precision:3" json:"muted_until"`
+	JoinedAt   time.Time  `gorm:"precision:3;autoCreateTime" json:"joined_at"`
 }
 
 // TableName 指定表名
 func (StudyRoomMember) TableName() string { return "study_room_members" }
 
+// StudyRoomBan 学习室封禁记录，ExpiresAt 为空表示永久封禁
+type StudyRoomBan struct {
+	BaseModel
+	RoomID    uint64     `gorm:"uniqueIndex:idx_study_room_ban" json:"room_id"`
+	UserID    uint64     `gorm:"uniqueIndex:idx_study_room_ban" json:"user_id"`
+	BannedBy  uint64     `json:"banned_by"`
+	Reason    string     `gorm:"type:varchar(256)" json:"reason"`
+	ExpiresAt *time.Time `gorm:"precision:3" json:"expires_at"`
+}
+
+// TableName 指定表名
+func (StudyRoomBan) TableName() string { return "study_room_bans" }
+
+// 房间会话状态，0 表示未经预约流程创建的历史会话
+const (
+	RoomSessionStatusScheduled int8 = 1
+	RoomSessionStatusLive      int8 = 2
+	RoomSessionStatusEnded     int8 = 3
+	RoomSessionStatusCancelled int8 = 4
+)
+
 // RoomSession 房间会话模型
 type RoomSession struct {
 	BaseModel
-	RoomID    uint64     `json:"room_id"`
-	StartedBy uint64     `json:"started_by"`
-	StartTime time.Time  `gorm:"precision:3" json:"start_time"`
-	EndTime   *time.Time `gorm:"precision:3" json:"end_time"`
-	Topic     string     `gorm:"type:varchar(128)" json:"topic"`
+	RoomID          uint64     `gorm:"index" json:"room_id"`
+	StartedBy       uint64     `json:"started_by"`
+	StartTime       time.Time  `gorm:"precision:3" json:"start_time"`
+	EndTime         *time.Time `gorm:"precision:3" json:"end_time"`
+	Topic           string     `gorm:"type:varchar(128)" json:"topic"`
+	DurationMinutes int        `gorm:"default:0" json:"duration_minutes"`
+	Status          int8       `gorm:"default:0;index;comment:1=scheduled,2=live,3=ended,4=cancelled" json:"status"`
+	ReminderSentAt  *time.Time `gorm:"precision:3" json:"reminder_sent_at"`
 }
 
 // TableName 指定表名
 func (RoomSession) TableName() string { return "room_sessions" }
 
+// 预约回复
+const (
+	RoomSessionRSVPGoing    = "going"
+	RoomSessionRSVPMaybe    = "maybe"
+	RoomSessionRSVPDeclined = "declined"
+)
+
+// RoomSessionRSVP 预约会话的参加意向
+type RoomSessionRSVP struct {
+	BaseModel
+	SessionID uint64 `gorm:"uniqueIndex:idx_room_session_rsvp" json:"session_id"`
+	UserID    uint64 `gorm:"uniqueIndex:idx_room_session_rsvp" json:"user_id"`
+	Status    string `gorm:"type:varchar(16);not null" json:"status"`
+}
+
+// TableName 指定表名
+func (RoomSessionRSVP) TableName() string { return "room_session_rsvps" }
+
+// RoomSessionAttendance 会话结束后根据实际在线记录统计的出勤
+type RoomSessionAttendance struct {
+	BaseModel
+	SessionID     uint64    `gorm:"uniqueIndex:idx_room_session_attendance" json:"session_id"`
+	UserID        uint64    `gorm:"uniqueIndex:idx_room_session_attendance" json:"user_id"`
+	Minutes       int       `json:"minutes"`
+	FirstJoinedAt time.Time `gorm:"precision:3" json:"first_joined_at"`
+	LastLeftAt    time.Time `gorm:"precision:3" json:"last_left_at"`
+}
+
+// TableName 指定表名
+func (RoomSessionAttendance) TableName() string { return "room_session_attendances" }
+
 // ChatMessage 聊天消息模型
 type ChatMessage struct {
 	BaseModel
-	SessionID uint64    `json:"session_id"`
-	RoomID    uint64    `json:"room_id"`
-	UserID    uint64    `json:"user_id"`
-	Content   string    `gorm:"type:text;not null" json:"content"`
-	MsgType   int8      `gorm:"default:0;comment:0=text,1=image,2=file,3=system,4=knowledge_card" json:"msg_type"`
-	SentAt    time.Time `gorm:"precision:3;autoCreateTime" json:"sent_at"`
+	SessionID uint64     `json:"session_id"`
+	RoomID    uint64     `json:"room_id"`
+	UserID    uint64     `json:"user_id"`
+	Content   string     `gorm:"type:text;not null" json:"content"`
+	MsgType   int8       `gorm:"default:0;comment:0=text,1=image,2=file,3=system,4=knowledge_card" json:"msg_type"`
+	SentAt    time.Time  `gorm:"precision:3;autoCreateTime" json:"sent_at"`
+	EditedAt  *time.Time `gorm:"precision:3" json:"edited_at"`
 }
 
 // TableName 指定表名
 func (ChatMessage) TableName() string { return "chat_messages" }
+
+// ChatMessageReaction 聊天消息表情回应
+type ChatMessageReaction struct {
+	BaseModel
+	MessageID uint64 `gorm:"uniqueIndex:idx_chat_reaction" json:"message_id"`
+	RoomID    uint64 `gorm:"index" json:"room_id"`
+	UserID    uint64 `gorm:"uniqueIndex:idx_chat_reaction" json:"user_id"`
+	Emoji     string `gorm:"type:varchar(32);uniqueIndex:idx_chat_reaction" json:"emoji"`
+}
+
+// TableName 指定表名
+func (ChatMessageReaction) TableName() string { return "chat_message_reactions" }
+
+// ChatReadCursor 用户在房间内的已读位置
+type ChatReadCursor struct {
+	BaseModel
+	RoomID            uint64    `gorm:"uniqueIndex:idx_chat_read_cursor" json:"room_id"`
+	UserID            uint64    `gorm:"uniqueIndex:idx_chat_read_cursor" json:"user_id"`
+	LastReadMessageID uint64    `json:"last_read_message_id"`
+	ReadAt            time.Time `gorm:"precision:3" json:"read_at"`
+}
+
+// TableName 指定表名
+func (ChatReadCursor) TableName() string { return "chat_read_cursors" }
@@ -12,9 +12,26 @@ type StudySession struct {
 	EndTime         *time.Time `gorm:"precision:3" json:"end_time"`
 	LastPingAt      time.Time  `gorm:"precision:3;not null" json:"last_ping_at"`
 	DurationMinutes int        `gorm:"default:0" json:"duration_minutes"`
+	RawMinutes      int        `gorm:"default:0" json:"raw_minutes"`
+	IdleSeconds     int        `gorm:"default:0" json:"idle_seconds"`
+	Flagged         bool       `gorm:"default:false;index" json:"flagged"`
+	FocusMinutes    int        `gorm:"default:0" json:"focus_minutes"`
 	Note            string     `gorm:"type:varchar(256)" json:"note"`
 }
 
+// StudySessionAdjustment 学习时长校验产生的扣减记录
+type StudySessionAdjustment struct {
+	BaseModel
+	UserID          uint64    `gorm:"index:idx_adjust_user_day;not null" json:"user_id"`
+	Date            time.Time `gorm:"type:date;index:idx_adjust_user_day;not null" json:"date"`
+	SessionID       *uint64   `gorm:"index" json:"session_id"`
+	Rule            string    `gorm:"type:varchar(32);not null" json:"rule"`
+	DeductedMinutes int       `gorm:"default:0" json:"deducted_minutes"`
+	Detail          string    `gorm:"type:varchar(256)" json:"detail"`
+}
+
+func (StudySessionAdjustment) TableName() string { return "study_session_adjustments" }
+
 // DailyStudyStat 日学习聚合
 type DailyStudyStat struct {
 	BaseModel
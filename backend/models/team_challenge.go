@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	TeamChallengeMetricStudyMinutes   = "study_minutes"
+	TeamChallengeMetricTasksCompleted = "tasks_completed"
+)
+
+const (
+	TeamChallengeStatusActive    = "active"
+	TeamChallengeStatusCompleted = "completed"
+	TeamChallengeStatusExpired   = "expired"
+	TeamChallengeStatusCancelled = "cancelled"
+)
+
+// TeamChallenge 团队挑战：成员在时间窗口内共同累计某项指标达到目标，完成后向有贡献的成员发放积分
+type TeamChallenge struct {
+	BaseModel
+	TeamID      uint64 `gorm:"index;not null" json:"team_id"`
+	Title       string `gorm:"type:varchar(64);not null" json:"title"`
+	Description string `gorm:"type:varchar(512)" json:"description"`
+	Metric      string `gorm:"type:varchar(32);not null" json:"metric"`
+	// Target 目标值，学习时长以分钟计，任务以个数计
+	Target int `gorm:"not null" json:"target"`
+	// StartDate、EndDate 为闭区间的日历日，学习时长按成员各自时区的日期统计
+	StartDate time.Time `gorm:"type:date;not null" json:"start_date"`
+	EndDate   time.Time `gorm:"type:date;not null" json:"end_date"`
+	// RewardPoints 完成后每位有贡献的成员获得的积分
+	RewardPoints int        `gorm:"default:0" json:"reward_points"`
+	Status       string     `gorm:"type:varchar(16);index;not null" json:"status"`
+	CompletedAt  *time.Time `gorm:"precision:3" json:"completed_at"`
+	CreatedBy    uint64     `json:"created_by"`
+}
+
+// TableName 指定表名
+func (TeamChallenge) TableName() string { return "team_challenges" }
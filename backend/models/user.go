@@ -20,6 +20,7 @@ type User struct {
 	JoinDate          string `gorm:"type:varchar(32)" json:"join_date"`
 	PreferredLanguage string `gorm:"type:varchar(32);default:'zh-CN'" json:"preferred_language"`
 	PreferredTheme    string `gorm:"type:varchar(32);default:'light'" json:"preferred_theme"`
+	Timezone          string `gorm:"type:varchar(64)" json:"timezone"`
 }
 
 // UserProfile 用户档案模型
@@ -38,6 +39,8 @@ type UserProfile struct {
 	StreakDays         int     `gorm:"default:0" json:"streak_days"`
 	CoursesInProgress  int     `gorm:"default:0" json:"courses_in_progress"`
 	NextLevelPoints    int     `gorm:"default:200" json:"next_level_points"`
+	// LongestStreakDays 历史最长连续活跃天数
+	LongestStreakDays int `gorm:"default:0" json:"longest_streak_days"`
 }
 
 // PointsLedger 积分账本模型
@@ -47,18 +50,50 @@ const (
 	PointsSourceTaskCompletion PointsSourceType = 1
 	PointsSourceStudyRoom      PointsSourceType = 2
 	PointsSourceDailyCheckIn   PointsSourceType = 3
+	// PointsSourceRedemption 兑换奖励的扣分及驳回后的退款
+	PointsSourceRedemption PointsSourceType = 4
+	// PointsSourceTeamChallenge 团队挑战完成后发放的奖励
+	PointsSourceTeamChallenge PointsSourceType = 5
+	// PointsSourceStreakFreeze 购买连续打卡保护卡
+	PointsSourceStreakFreeze PointsSourceType = 6
 )
 
 type PointsLedger struct {
 	BaseModel
 	UserID       uint64           `gorm:"index;not null" json:"user_id"`
-	SourceType   PointsSourceType `gorm:"type:tinyint;not null;comment:1=task_completion,2=study_room_session,3=daily_check_in" json:"source_type"`
+	SourceType   PointsSourceType `gorm:"type:tinyint;not null;comment:1=task_completion,2=study_room_session,3=daily_check_in,4=redemption,5=team_challenge,6=streak_freeze" json:"source_type"`
 	SourceID     *uint64          `json:"source_id"`
 	Delta        int              `json:"delta"`
 	BalanceAfter int              `json:"balance_after"`
 	Remark       string           `gorm:"type:varchar(256)" json:"remark"`
+	// IdempotencyKey 同一来源的发放只记一次；冲正记录使用原键加 ":reversal"
+	IdempotencyKey *string `gorm:"type:varchar(128);uniqueIndex" json:"idempotency_key,omitempty"`
+	// ReversalOf 冲正记录指向被冲正的发放记录
+	ReversalOf *uint64 `gorm:"index" json:"reversal_of,omitempty"`
 }
 
+// PointsRule 积分发放规则，每种来源一条，未配置时使用内置默认值
+type PointsRule struct {
+	BaseModel
+	SourceType PointsSourceType `gorm:"type:tinyint;uniqueIndex;not null" json:"source_type"`
+	Enabled    bool             `gorm:"not null" json:"enabled"`
+	BasePoints int              `json:"base_points"`
+	// UnitMinutes 按时长发放的来源每满该分钟数发放一次 BasePoints
+	UnitMinutes int `gorm:"default:0" json:"unit_minutes"`
+	// DailyCap 每个用户每天（按用户时区）从该来源获得的积分上限，0 表示不限
+	DailyCap int `gorm:"default:0" json:"daily_cap"`
+	// PriorityBonusPct 任务每级优先级的加成百分比
+	PriorityBonusPct int `gorm:"default:0" json:"priority_bonus_pct"`
+	// EffortPointRate 任务每个工作量点数额外发放的积分
+	EffortPointRate int `gorm:"default:0" json:"effort_point_rate"`
+	// StreakBonusPct 每个连续打卡天的加成百分比，总加成不超过 StreakBonusMaxPct
+	StreakBonusPct    int `gorm:"default:0" json:"streak_bonus_pct"`
+	StreakBonusMaxPct int `gorm:"default:0" json:"streak_bonus_max_pct"`
+}
+
+// TableName 指定表名
+func (PointsRule) TableName() string { return "points_rules" }
+
 // LevelRule 等级规则模型
 type LevelRule struct {
 	BaseModel
@@ -83,8 +118,9 @@ type Achievement struct {
 	Category    string `gorm:"size:64" json:"category"`
 	Icon        string `gorm:"size:255" json:"icon"`
 
-	// JSON 形式，示例：
-	// {"type":"task_count", "value":100}
+	// JSON 形式的条件表达式，指标由 services/achievement 注册，示例：
+	// {"metric":"task_total_completed","value":100}
+	// {"all":[{"metric":"study_minutes","value":600,"window":"7d"},{"metric":"knowledge_entries","value":5,"category":"数学"}]}
 	Condition string `gorm:"type:json" json:"condition"`
 }
 
@@ -139,4 +175,7 @@ type UserSetting struct {
 	DailyGoalMinutes int    `gorm:"default:60" json:"daily_goal_minutes"`
 	PreferredPeriod  string `gorm:"type:varchar(32);default:'evening'" json:"preferred_period"`
 	FocusMode        bool   `gorm:"default:false" json:"focus_mode"`
+	Timezone         string `gorm:"type:varchar(64)" json:"timezone"`
+	// NotifyTeamMilestones 是否接收队友解锁成就、升级等里程碑通知
+	NotifyTeamMilestones bool `gorm:"default:true" json:"notify_team_milestones"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// WeeklyReport 用户的学习周报，周起始日为用户时区的周一。知识掌握分布为生成时的快照，
+// 与上一份周报的快照相减即为本周的掌握变化；Details 保存每日明细、新解锁成就与周环比
+type WeeklyReport struct {
+	BaseModel
+	UserID               uint64     `gorm:"uniqueIndex:idx_weekly_report_user_week;not null" json:"user_id"`
+	WeekStart            time.Time  `gorm:"type:date;uniqueIndex:idx_weekly_report_user_week;not null" json:"week_start"`
+	StudyMinutes         int        `gorm:"default:0" json:"study_minutes"`
+	StudyDays            int        `gorm:"default:0" json:"study_days"`
+	TasksCompleted       int        `gorm:"default:0" json:"tasks_completed"`
+	KnowledgeAdded       int        `gorm:"default:0" json:"knowledge_added"`
+	MasteredCount        int        `gorm:"default:0" json:"mastered_count"`
+	LearningCount        int        `gorm:"default:0" json:"learning_count"`
+	ToLearnCount         int        `gorm:"default:0" json:"to_learn_count"`
+	AchievementsUnlocked int        `gorm:"default:0" json:"achievements_unlocked"`
+	StreakDays           int        `gorm:"default:0" json:"streak_days"`
+	LongestStreakDays    int        `gorm:"default:0" json:"longest_streak_days"`
+	Details              string     `gorm:"type:text" json:"-"`
+	NotifiedAt           *time.Time `gorm:"precision:3" json:"notified_at"`
+	EmailedAt            *time.Time `gorm:"precision:3" json:"emailed_at"`
+}
+
+// TableName 指定表名
+func (WeeklyReport) TableName() string { return "weekly_reports" }
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/services/achievement"
+)
+
+func registerAchievementAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/achievements/metrics", handleListAchievementMetrics)
+	router.POST("/achievements/validate", handleValidateAchievementCondition)
+	router.POST("/achievements/recompute", handleRecomputeAchievements)
+}
+
+func handleListAchievementMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    achievement.Metrics(),
+	})
+}
+
+// handleValidateAchievementCondition 校验成就条件；指定 user_id 时同时返回该用户当前的求值结果
+func handleValidateAchievementCondition(c *gin.Context) {
+	var req struct {
+		Condition json.RawMessage `json:"condition"`
+		UserID    uint64          `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Condition) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少条件表达式"})
+		return
+	}
+	// 条件在数据库中以 JSON 字符串保存，也接受直接粘贴的字符串形式
+	raw := []byte(req.Condition)
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		raw = []byte(text)
+	}
+
+	cond, issues, err := achievement.ParseCondition(raw)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "条件不合法",
+			"data":    gin.H{"valid": false, "issues": issues},
+		})
+		return
+	}
+	data := gin.H{"valid": true, "issues": []achievement.ValidationIssue{}, "normalized": cond, "key": cond.Key()}
+	if req.UserID > 0 {
+		result, _, err := achievement.PreviewCondition(req.UserID, raw)
+		if err != nil && !errors.Is(err, achievement.ErrInvalidCondition) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "条件求值失败"})
+			return
+		}
+		data["preview"] = result
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": data})
+}
+
+// handleRecomputeAchievements 从源数据重建成就进度并重新评估成就；不传 user_id 时重算全部用户，
+// dry_run 为 true 时只报告差异与将解锁的成就
+func handleRecomputeAchievements(c *gin.Context) {
+	var req struct {
+		UserID uint64 `json:"user_id"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+			return
+		}
+	}
+	opts := achievement.RecomputeOptions{DryRun: req.DryRun}
+	db := database.GetDB()
+	if req.UserID > 0 {
+		report, err := achievement.Recompute(db, req.UserID, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "重算成就失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": report})
+		return
+	}
+	summary, err := achievement.RecomputeAll(db, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "重算成就失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": summary})
+}
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/middleware"
 )
 
 // registerAIRoutes 注册 AI 相关路由
@@ -32,6 +34,9 @@ func registerAIRoutes(r *gin.RouterGroup) {
 	// 学习计划生成
 	r.POST("/study-plan", GenerateStudyPlan)
 
+	// 基于真实任务的智能排程
+	r.POST("/smart-plan", middleware.AuthMiddleware(), GenerateSmartStudyPlan)
+
 	// 房间创意生成
 	r.POST("/room-idea", GenerateRoomIdea)
 }
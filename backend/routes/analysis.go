@@ -21,6 +21,7 @@ import (
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
 )
 
 // registerAnalysisRoutes 注册学习效率分析路由
@@ -60,7 +61,8 @@ func handleGetWeeklyStudyHours(c *gin.Context) {
 	}
 
 	db := database.GetDB()
-	today := startOfDay(time.Now())
+	// 统计表按日历日存储，"今天"以用户时区为准
+	today := usertime.CalendarDate(usertime.StartOfDay(time.Now(), usertime.ForUser(userID)))
 	from := today.AddDate(0, 0, -6)
 
 	var stats []models.DailyStudyStat
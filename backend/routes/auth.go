@@ -29,6 +29,7 @@ type registerRequestBody struct {
 	Email       string `json:"email"`
 	Password    string `json:"password"`
 	DisplayName string `json:"display_name"`
+	Timezone    string `json:"timezone"`
 }
 
 func handleRegister(c *gin.Context) {
@@ -41,7 +42,7 @@ func handleRegister(c *gin.Context) {
 		return
 	}
 
-	summary, err := registerUserAccount(req.Username, req.Email, req.Password, req.DisplayName)
+	summary, err := registerUserAccount(req.Username, req.Email, req.Password, req.DisplayName, req.Timezone)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
@@ -0,0 +1,232 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/middleware"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/directmsg"
+)
+
+// directMessageChannel 私信使用的 Backplane 频道。房间ID从 1 开始，0 不会与房间频道冲突
+const directMessageChannel uint64 = 0
+
+const notificationTypeDirectMessage = "DIRECT_MESSAGE"
+
+func registerDirectMessageRoutes(r *gin.RouterGroup) {
+	r.Use(middleware.AuthMiddleware())
+
+	r.GET("", handleListDirectConversations)
+	r.GET("/:peerId", handleGetDirectMessages)
+	r.POST("/:peerId", handleSendDirectMessage)
+	r.PUT("/:peerId/read", handleMarkDirectMessagesRead)
+}
+
+// ensureDirectSubscription 订阅私信频道，每个实例只订阅一次
+func (m *studyHubStore) ensureDirectSubscription() {
+	m.directOnce.Do(func() {
+		unsubscribe, err := m.backplane().Subscribe(directMessageChannel, m.deliverDirect)
+		if err != nil {
+			log.Printf("[StudyHub] subscribe direct messages failed, delivering locally only: %v", err)
+			return
+		}
+		m.directUnsubscribe = unsubscribe
+	})
+}
+
+// sendDirect 向用户的所有连接投递私信，用户可能位于任意实例的任意房间
+func (m *studyHubStore) sendDirect(msg wsEnvelope, userIDs ...uint64) {
+	m.ensureDirectSubscription()
+	payload := mustMarshal(hubRelay{Origin: m.instanceID, To: userIDs, Envelope: msg})
+	if m.directUnsubscribe == nil {
+		m.deliverDirect(payload)
+		return
+	}
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	if err := m.backplane().Publish(ctx, directMessageChannel, payload); err != nil {
+		log.Printf("[StudyHub] publish direct message failed, delivering locally: %v", err)
+		m.deliverDirect(payload)
+	}
+}
+
+func (m *studyHubStore) deliverDirect(payload []byte) {
+	var relay hubRelay
+	if err := json.Unmarshal(payload, &relay); err != nil || len(relay.To) == 0 {
+		return
+	}
+	for _, hub := range m.localHubs() {
+		hub.deliverLocal(relay.Envelope, relay.To, nil)
+	}
+	userStreams.deliver(relay.Envelope, relay.To)
+}
+
+// isOnline 用户是否在任一房间保持连接
+func (m *studyHubStore) isOnline(userID uint64) bool {
+	for _, p := range m.allPresence() {
+		if p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func directMessagePayload(msg *models.DirectMessage, senderName string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              msg.ID,
+		"conversation_id": msg.ConversationID,
+		"from_id":         msg.SenderID,
+		"to_id":           msg.RecipientID,
+		"display_name":    senderName,
+		"content":         msg.Content,
+		"sent_at":         msg.SentAt.Format(time.RFC3339),
+		"read_at":         msg.ReadAt,
+	}
+}
+
+// deliverDirectMessage 推送给双方在线连接；收件人不在线时写入通知，同一会话的未读通知合并为一条
+func deliverDirectMessage(store *studyHubStore, msg *models.DirectMessage, senderName string) {
+	envelope := wsEnvelope{Type: "direct_chat", Data: mustMarshal(directMessagePayload(msg, senderName))}
+	store.sendDirect(envelope, msg.SenderID, msg.RecipientID)
+	if store.isOnline(msg.RecipientID) {
+		return
+	}
+
+	db := database.GetDB()
+	name := firstNonEmpty(senderName, fmt.Sprintf("用户 %d", msg.SenderID))
+	content := name + "：" + truncateRunes(msg.Content, 60)
+	relatedData := string(mustMarshal(map[string]uint64{"sender_id": msg.SenderID, "message_id": msg.ID}))
+	result := db.Model(&models.Notification{}).
+		Where("user_id = ? AND type = ? AND related_id = ? AND is_read = ?", msg.RecipientID, notificationTypeDirectMessage, msg.ConversationID, false).
+		Updates(map[string]interface{}{"content": content, "related_data": relatedData})
+	if result.Error == nil && result.RowsAffected > 0 {
+		return
+	}
+	notification := models.Notification{
+		UserID:       msg.RecipientID,
+		Title:        "新的私信",
+		Content:      content,
+		Type:         notificationTypeDirectMessage,
+		RelatedID:    msg.ConversationID,
+		RelatedData:  relatedData,
+		ActionStatus: "NONE",
+	}
+	if err := db.Create(&notification).Error; err != nil {
+		log.Printf("[DirectMessage] create notification for user %d failed: %v", msg.RecipientID, err)
+	}
+}
+
+func directMessageErrorMessage(err error) (int, string) {
+	switch {
+	case errors.Is(err, directmsg.ErrEmptyContent):
+		return http.StatusBadRequest, "消息内容不能为空"
+	case errors.Is(err, directmsg.ErrContentTooLong):
+		return http.StatusBadRequest, "消息内容不能超过2000个字符"
+	case errors.Is(err, directmsg.ErrSelfMessage):
+		return http.StatusBadRequest, "不能给自己发送私信"
+	case errors.Is(err, directmsg.ErrNotAllowed):
+		return http.StatusForbidden, "只能给学习伙伴或同团队成员发送私信"
+	default:
+		return http.StatusInternalServerError, "发送私信失败"
+	}
+}
+
+func directMessagePeer(c *gin.Context) (uint64, uint64, bool) {
+	userID, _ := currentUserID(c)
+	peerID, err := strconv.ParseUint(c.Param("peerId"), 10, 64)
+	if err != nil || peerID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "用户ID无效"})
+		return 0, 0, false
+	}
+	return userID, peerID, true
+}
+
+func handleListDirectConversations(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	conversations, err := directmsg.ListConversations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取私信会话失败"})
+		return
+	}
+	peerIDs := make([]uint64, 0, len(conversations))
+	for _, conv := range conversations {
+		peerIDs = append(peerIDs, conv.PeerID)
+	}
+	names := loadUserNames(peerIDs)
+	items := make([]gin.H, 0, len(conversations))
+	for _, conv := range conversations {
+		items = append(items, gin.H{
+			"conversation_id":   conv.ConversationID,
+			"peer_id":           conv.PeerID,
+			"peer_display_name": names[conv.PeerID],
+			"last_message":      conv.LastMessage,
+			"last_message_at":   conv.LastMessageAt,
+			"unread_count":      conv.UnreadCount,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"conversations": items}})
+}
+
+func handleGetDirectMessages(c *gin.Context) {
+	userID, peerID, ok := directMessagePeer(c)
+	if !ok {
+		return
+	}
+	before, _ := strconv.ParseUint(c.Query("before_id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	page, err := directmsg.History(userID, peerID, before, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取私信失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": page})
+}
+
+func handleSendDirectMessage(c *gin.Context) {
+	userID, peerID, ok := directMessagePeer(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数格式不正确"})
+		return
+	}
+	msg, err := directmsg.Send(userID, peerID, req.Content, time.Now())
+	if err != nil {
+		status, message := directMessageErrorMessage(err)
+		c.JSON(status, gin.H{"code": status, "message": message})
+		return
+	}
+	deliverDirectMessage(studyHubRegistry, msg, loadUserNames([]uint64{userID})[userID])
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"message": msg}})
+}
+
+func handleMarkDirectMessagesRead(c *gin.Context) {
+	userID, peerID, ok := directMessagePeer(c)
+	if !ok {
+		return
+	}
+	conversationID, marked, err := directmsg.MarkRead(userID, peerID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "标记已读失败"})
+		return
+	}
+	if conversationID != 0 {
+		_ = database.GetDB().Model(&models.Notification{}).
+			Where("user_id = ? AND type = ? AND related_id = ?", userID, notificationTypeDirectMessage, conversationID).
+			Update("is_read", true).Error
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"marked": marked}})
+}
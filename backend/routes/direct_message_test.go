@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+)
+
+func TestDirectMessagesPersistAndPage(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	registerDirectMessageRoutes(r.Group("/api/direct-messages"))
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	db.Create(&models.StudyBuddy{UserID: 1, BuddyID: 2})
+
+	if w := serve(authRequest(http.MethodPost, "/api/direct-messages/4", 1, map[string]string{"content": "hi"})); w.Code != http.StatusForbidden {
+		t.Fatalf("expected message to a stranger to be rejected, got %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := serve(authRequest(http.MethodPost, "/api/direct-messages/2", 1, map[string]string{"content": "msg-" + strconv.Itoa(i)})); w.Code != http.StatusOK {
+			t.Fatalf("send: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// 收件人不在线：多条私信合并为一条未读通知
+	var notifications []models.Notification
+	db.Where("user_id = ? AND type = ?", 2, notificationTypeDirectMessage).Find(&notifications)
+	if len(notifications) != 1 || !strings.Contains(notifications[0].Content, "msg-4") {
+		t.Fatalf("expected one coalesced notification, got %+v", notifications)
+	}
+
+	// 游标分页取回全部消息，且顺序从新到旧
+	var contents []string
+	before := uint64(0)
+	for page := 0; page < 5; page++ {
+		path := "/api/direct-messages/1?limit=2"
+		if before != 0 {
+			path += "&before_id=" + jsonNumber(before)
+		}
+		var body struct {
+			Data struct {
+				Messages   []models.DirectMessage `json:"messages"`
+				NextCursor uint64                 `json:"next_cursor"`
+				HasMore    bool                   `json:"has_more"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(serve(authRequest(http.MethodGet, path, 2, nil)).Body.Bytes(), &body)
+		for _, msg := range body.Data.Messages {
+			contents = append(contents, msg.Content)
+		}
+		if !body.Data.HasMore {
+			break
+		}
+		before = body.Data.NextCursor
+	}
+	if strings.Join(contents, ",") != "msg-4,msg-3,msg-2,msg-1,msg-0" {
+		t.Fatalf("unexpected paged history %v", contents)
+	}
+
+	listUnread := func() int64 {
+		var body struct {
+			Data struct {
+				Conversations []struct {
+					PeerID      uint64 `json:"peer_id"`
+					UnreadCount int64  `json:"unread_count"`
+				} `json:"conversations"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(serve(authRequest(http.MethodGet, "/api/direct-messages", 2, nil)).Body.Bytes(), &body)
+		if len(body.Data.Conversations) != 1 || body.Data.Conversations[0].PeerID != 1 {
+			t.Fatalf("expected a single conversation with user 1, got %+v", body.Data.Conversations)
+		}
+		return body.Data.Conversations[0].UnreadCount
+	}
+	if unread := listUnread(); unread != 5 {
+		t.Fatalf("expected 5 unread, got %d", unread)
+	}
+	serve(authRequest(http.MethodPut, "/api/direct-messages/1/read", 2, nil))
+	if unread := listUnread(); unread != 0 {
+		t.Fatalf("expected conversation read, got %d unread", unread)
+	}
+	var unreadNotifications int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND is_read = ?", 2, false).Count(&unreadNotifications)
+	if unreadNotifications != 0 {
+		t.Fatalf("expected direct message notification cleared, got %d", unreadNotifications)
+	}
+}
+
+func TestDirectChatReachesTeammateInAnotherRoom(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	team := models.Team{Name: "学习小组", OwnerUserID: 3}
+	db.Create(&team)
+	db.Create(&models.TeamMember{TeamID: team.ID, UserID: 1})
+
+	bp := backplane.NewMemory()
+	_, srvA := startHubInstance(t, bp)
+	_, srvB := startHubInstance(t, bp)
+	alice := dialRoom(t, srvA, 10, 1)
+	waitForEvent(t, alice, "state")
+	carol := dialRoom(t, srvB, 11, 3)
+	waitForEvent(t, carol, "state")
+
+	sendEvent(t, alice, "direct_chat", map[string]interface{}{"target_id": 3, "content": "在吗"})
+	received := waitForEvent(t, carol, "direct_chat")
+	if !strings.Contains(string(received.Data), "在吗") {
+		t.Fatalf("unexpected direct chat payload %s", received.Data)
+	}
+	waitForEvent(t, alice, "direct_chat")
+
+	var stored int64
+	db.Model(&models.DirectMessage{}).Where("sender_id = ? AND recipient_id = ?", 1, 3).Count(&stored)
+	if stored != 1 {
+		t.Fatalf("expected direct message persisted, got %d", stored)
+	}
+	var notified int64
+	db.Model(&models.Notification{}).Where("user_id = ?", 3).Count(&notified)
+	if notified != 0 {
+		t.Fatalf("online recipient should not get a notification, got %d", notified)
+	}
+
+	sendEvent(t, alice, "direct_chat", map[string]interface{}{"target_id": 4, "content": "hello"})
+	rejected := waitForEvent(t, alice, "error")
+	if !strings.Contains(string(rejected.Data), "学习伙伴") {
+		t.Fatalf("expected relationship error, got %s", rejected.Data)
+	}
+}
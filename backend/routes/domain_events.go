@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/services/events"
+	"learningAssistant-backend/services/milestone"
+)
+
+const (
+	// userStreamBuffer 单个 SSE 连接的待发送事件上限，客户端读取过慢时丢弃
+	userStreamBuffer = 32
+	// userStreamHeartbeat SSE 心跳间隔，防止代理因空闲断开连接
+	userStreamHeartbeat = 25 * time.Second
+)
+
+var domainEventsOnce sync.Once
+
+// startDomainEventDelivery 订阅领域事件，实时推送给用户的房间 WebSocket 连接与通知 SSE 连接，
+// 成就与升级同时推送给开启了里程碑提醒的队友。通知记录已由发放方在事务中写入，这里只做尽力而为的推送
+func startDomainEventDelivery() {
+	domainEventsOnce.Do(func() {
+		events.Subscribe("notifications", deliverDomainEvent)
+	})
+}
+
+func deliverDomainEvent(evt events.Event) {
+	studyHubRegistry.sendDirect(wsEnvelope{Type: string(evt.Type), Data: mustMarshal(evt)}, evt.UserID)
+
+	switch evt.Data.(type) {
+	case events.AchievementUnlocked, events.LevelUp:
+	default:
+		return
+	}
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+	teammateIDs, _, err := milestone.Teammates(db, evt.UserID)
+	if err != nil {
+		log.Printf("[Events] load teammates of user %d failed: %v", evt.UserID, err)
+		return
+	}
+	if len(teammateIDs) > 0 {
+		studyHubRegistry.sendDirect(wsEnvelope{Type: "team_milestone", Data: mustMarshal(evt)}, teammateIDs...)
+	}
+}
+
+// userStreamRegistry 本实例上各用户的通知 SSE 连接
+type userStreamRegistry struct {
+	mu      sync.Mutex
+	streams map[uint64]map[chan wsEnvelope]struct{}
+}
+
+var userStreams = &userStreamRegistry{streams: make(map[uint64]map[chan wsEnvelope]struct{})}
+
+func (r *userStreamRegistry) add(userID uint64) chan wsEnvelope {
+	ch := make(chan wsEnvelope, userStreamBuffer)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.streams[userID] == nil {
+		r.streams[userID] = make(map[chan wsEnvelope]struct{})
+	}
+	r.streams[userID][ch] = struct{}{}
+	return ch
+}
+
+func (r *userStreamRegistry) remove(userID uint64, ch chan wsEnvelope) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.streams[userID], ch)
+	if len(r.streams[userID]) == 0 {
+		delete(r.streams, userID)
+	}
+}
+
+// deliver 非阻塞地投递给目标用户的全部 SSE 连接
+func (r *userStreamRegistry) deliver(msg wsEnvelope, userIDs []uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, userID := range userIDs {
+		for ch := range r.streams[userID] {
+			select {
+			case ch <- msg:
+			default:
+				log.Printf("[Events] stream of user %d is full, dropping %s", userID, msg.Type)
+			}
+		}
+	}
+}
+
+// handleNotificationStream 通知 SSE 通道：推送成就、升级、积分、队友里程碑与私信等实时事件。
+// EventSource 无法设置请求头，也接受 token 查询参数
+func handleNotificationStream(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" && c.Query("token") != "" {
+		c.Request.Header.Set("Authorization", "Bearer "+c.Query("token"))
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return
+	}
+	// 确保跨实例的私信频道已订阅，其他实例发布的事件才能送达本机连接
+	studyHubRegistry.ensureDirectSubscription()
+
+	ch := userStreams.add(userID)
+	defer userStreams.remove(userID, ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(userStreamHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case msg := <-ch:
+			c.SSEvent(msg.Type, msg.Data)
+			return true
+		case <-heartbeat.C:
+			_, _ = io.WriteString(w, ": ping\n\n")
+			return true
+		}
+	})
+}
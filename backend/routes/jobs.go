@@ -0,0 +1,264 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/middleware"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/jobs"
+	"learningAssistant-backend/services/leaderboard"
+	"learningAssistant-backend/services/rag"
+)
+
+var (
+	backgroundJobs     *jobs.Scheduler
+	backgroundJobsOnce sync.Once
+)
+
+// getBackgroundJobs 返回注册好内置任务的调度器
+func getBackgroundJobs() *jobs.Scheduler {
+	backgroundJobsOnce.Do(func() {
+		backgroundJobs = jobs.NewScheduler()
+		for _, job := range builtinJobs() {
+			if err := backgroundJobs.Register(job); err != nil {
+				log.Printf("[Jobs] register %s failed: %v", job.Name, err)
+			}
+		}
+	})
+	return backgroundJobs
+}
+
+// StartBackgroundJobs 启动后台定时任务
+func StartBackgroundJobs() {
+	getBackgroundJobs().Start()
+}
+
+// StopBackgroundJobs 停止后台定时任务
+func StopBackgroundJobs() {
+	getBackgroundJobs().Stop()
+}
+
+func builtinJobs() []jobs.Job {
+	return []jobs.Job{
+		{
+			Name:        "close_expired_sessions",
+			Schedule:    "* * * * *",
+			Description: "关闭超时未心跳的学习会话",
+			Timeout:     time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				closed, err := autoCloseExpiredSessions(database.GetDB(), time.Now())
+				return fmt.Sprintf("closed=%d", closed), err
+			},
+		},
+		{
+			Name:        "advance_room_sessions",
+			Schedule:    "* * * * *",
+			Description: "预约学习会的开始提醒、到点开场与结束出勤统计",
+			Timeout:     time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				reminded, opened, closed, err := advanceRoomSessions(database.GetDB(), time.Now())
+				return fmt.Sprintf("reminded=%d opened=%d closed=%d", reminded, opened, closed), err
+			},
+		},
+		{
+			Name:        "aggregate_daily_stats",
+			Schedule:    "*/30 * * * *",
+			Description: "聚合昨日、今日与明日的学习时长统计（覆盖各用户时区的当前日期）",
+			Run: func(ctx context.Context) (string, error) {
+				db := database.GetDB()
+				today := time.Now()
+				counts := make([]int, 0, 3)
+				for _, offset := range []int{-1, 0, 1} {
+					updated, err := aggregateDailyStats(db, today.AddDate(0, 0, offset), 0)
+					if err != nil {
+						return "", err
+					}
+					counts = append(counts, updated)
+				}
+				return fmt.Sprintf("yesterday=%d today=%d tomorrow=%d", counts[0], counts[1], counts[2]), nil
+			},
+		},
+		{
+			Name:        "reset_room_focus_minutes",
+			Schedule:    "0 0 * * *",
+			Description: "每日零点清零自习室今日专注分钟",
+			Timeout:     time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				res := database.GetDB().Model(&models.StudyRoom{}).
+					Where("focus_minutes_today <> 0").
+					UpdateColumn("focus_minutes_today", 0)
+				return fmt.Sprintf("rooms=%d", res.RowsAffected), res.Error
+			},
+		},
+		{
+			Name:        "update_rank_labels",
+			Schedule:    "10 * * * *",
+			Description: "按累计积分重算用户档案的排名百分位",
+			Timeout:     10 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				updated, err := leaderboard.UpdateRankLabels(database.GetDB())
+				return fmt.Sprintf("updated=%d", updated), err
+			},
+		},
+		{
+			Name:        "refresh_streaks",
+			Schedule:    "5 * * * *",
+			Description: "重算连续活跃天数，中断的归零并按需使用保护卡",
+			Timeout:     10 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				refreshed, err := refreshStreaks(database.GetDB(), time.Now())
+				return fmt.Sprintf("refreshed=%d", refreshed), err
+			},
+		},
+		{
+			Name:        "settle_team_challenges",
+			Schedule:    "*/10 * * * *",
+			Description: "结算达标或到期的团队挑战并发放完成奖励",
+			Timeout:     5 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				completed, expired, err := settleTeamChallenges(database.GetDB(), time.Now())
+				return fmt.Sprintf("completed=%d expired=%d", completed, expired), err
+			},
+		},
+		{
+			Name:        "generate_weekly_reports",
+			Schedule:    "20 * * * *",
+			Description: "按用户时区在每周一生成上周学习周报，发送站内通知与邮件",
+			Timeout:     30 * time.Minute,
+			Run: func(ctx context.Context) (string, error) {
+				delivered, emailed, err := generateWeeklyReports(database.GetDB(), time.Now(), weeklyReportMailer())
+				return fmt.Sprintf("delivered=%d emailed=%d", delivered, emailed), err
+			},
+		},
+		{
+			Name:        "mine_knowledge_relations",
+			Schedule:    "0 3 * * *",
+			Description: "为近一天有新增知识点的用户挖掘知识关系",
+			Timeout:     time.Hour,
+			Run:         runKnowledgeRelationMining,
+		},
+	}
+}
+
+func runKnowledgeRelationMining(ctx context.Context) (string, error) {
+	apiKey := os.Getenv("QWEN_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("DASHSCOPE_API_KEY")
+	}
+	if apiKey == "" {
+		return "skipped: missing api key", nil
+	}
+
+	var userIDs []uint64
+	if err := database.GetDB().Model(&models.KnowledgeBaseEntry{}).
+		Where("updated_at >= ?", time.Now().Add(-24*time.Hour)).
+		Distinct().
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return "", err
+	}
+
+	miningService := rag.NewRelationMiningService(rag.NewQwenEmbeddingService(apiKey))
+	total, failed := 0, 0
+	for _, uid := range userIDs {
+		if ctx.Err() != nil {
+			return fmt.Sprintf("users=%d relations=%d failed=%d", len(userIDs), total, failed), ctx.Err()
+		}
+		found, err := miningService.MineAllRelations(uid)
+		if err != nil {
+			failed++
+			log.Printf("[RelationMining] 用户 %d 挖掘失败: %v", uid, err)
+			continue
+		}
+		total += found
+	}
+	return fmt.Sprintf("users=%d relations=%d failed=%d", len(userIDs), total, failed), nil
+}
+
+// requireAdmin 仅允许管理员访问，需配合 AuthMiddleware 使用
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := currentUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+			c.Abort()
+			return
+		}
+		var user models.User
+		if err := database.GetDB().Select("id", "role").First(&user, userID).Error; err != nil || user.Role != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "需要管理员权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func registerAdminRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.AuthMiddleware(), requireAdmin())
+	router.GET("/jobs", handleListJobs)
+	router.GET("/jobs/:name/runs", handleListJobRuns)
+	router.POST("/jobs/:name/trigger", handleTriggerJob)
+	router.GET("/study-hub/metrics", handleStudyHubMetrics)
+	registerAchievementAdminRoutes(router)
+	registerPointsAdminRoutes(router)
+	registerStreakAdminRoutes(router)
+}
+
+func handleListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    getBackgroundJobs().List(),
+	})
+}
+
+func handleListJobRuns(c *gin.Context) {
+	name := c.Param("name")
+	if !getBackgroundJobs().Has(name) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "任务不存在"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	runs, err := jobs.ListRuns(name, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载执行记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    runs,
+	})
+}
+
+func handleTriggerJob(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	run, err := getBackgroundJobs().Trigger(c.Param("name"), &userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "任务不存在"})
+		case errors.Is(err, jobs.ErrJobLocked):
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "任务正在执行中", "data": run})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "触发任务失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    run,
+	})
+}
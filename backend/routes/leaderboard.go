@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/services/leaderboard"
+)
+
+func registerLeaderboardRoutes(router *gin.RouterGroup) {
+	router.GET("", handleGetLeaderboard)
+}
+
+// handleGetLeaderboard 排行榜：metric=points|study_minutes|streak，
+// scope=global|team|school|buddies（team 需 team_id），period=daily|weekly|monthly|all
+func handleGetLeaderboard(c *gin.Context) {
+	// 团队榜按查看者的成员身份授权，查看者只取登录身份
+	viewerID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return
+	}
+	teamID, _ := strconv.ParseUint(c.Query("team_id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	query := leaderboard.Query{
+		Metric:   leaderboard.Metric(strings.ToLower(c.DefaultQuery("metric", string(leaderboard.MetricPoints)))),
+		Scope:    leaderboard.Scope(strings.ToLower(c.DefaultQuery("scope", string(leaderboard.ScopeGlobal)))),
+		Period:   leaderboard.Period(strings.ToLower(c.DefaultQuery("period", string(leaderboard.PeriodWeekly)))),
+		TeamID:   teamID,
+		ViewerID: viewerID,
+		Limit:    limit,
+	}
+
+	board, err := leaderboard.Build(database.GetDB(), query)
+	switch {
+	case err == nil:
+	case errors.Is(err, leaderboard.ErrInvalidQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "排行榜参数不正确"})
+		return
+	case errors.Is(err, leaderboard.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅团队成员可以查看团队排行榜"})
+		return
+	case errors.Is(err, leaderboard.ErrNoSchool):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请先在个人资料中填写学校"})
+		return
+	case errorsIsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "用户不存在"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取排行榜失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    board,
+	})
+}
@@ -12,6 +12,8 @@ import (
 )
 
 func registerNotificationRoutes(r *gin.RouterGroup) {
+	// SSE 通道自行校验身份（支持 token 查询参数），需注册在鉴权中间件之前
+	r.GET("/stream", handleNotificationStream)
 	r.Use(middleware.AuthMiddleware())
 
 	r.GET("", listNotifications)
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+)
+
+func registerPointsAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/points/rules", handleListPointsRules)
+	router.PUT("/points/rules/:sourceType", handleUpdatePointsRule)
+}
+
+func handleListPointsRules(c *gin.Context) {
+	rules, err := points.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载积分规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    rules,
+	})
+}
+
+// handleUpdatePointsRule 修改来源的积分规则，未传的字段保持当前生效值
+func handleUpdatePointsRule(c *gin.Context) {
+	sourceType, err := strconv.ParseInt(c.Param("sourceType"), 10, 8)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的积分来源"})
+		return
+	}
+	var req struct {
+		Enabled           *bool `json:"enabled"`
+		BasePoints        *int  `json:"base_points"`
+		UnitMinutes       *int  `json:"unit_minutes"`
+		DailyCap          *int  `json:"daily_cap"`
+		PriorityBonusPct  *int  `json:"priority_bonus_pct"`
+		EffortPointRate   *int  `json:"effort_point_rate"`
+		StreakBonusPct    *int  `json:"streak_bonus_pct"`
+		StreakBonusMaxPct *int  `json:"streak_bonus_max_pct"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	rule, err := points.LoadRule(database.GetDB(), models.PointsSourceType(sourceType))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载积分规则失败"})
+		return
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	for _, field := range []struct {
+		value  *int
+		target *int
+	}{
+		{req.BasePoints, &rule.BasePoints},
+		{req.UnitMinutes, &rule.UnitMinutes},
+		{req.DailyCap, &rule.DailyCap},
+		{req.PriorityBonusPct, &rule.PriorityBonusPct},
+		{req.EffortPointRate, &rule.EffortPointRate},
+		{req.StreakBonusPct, &rule.StreakBonusPct},
+		{req.StreakBonusMaxPct, &rule.StreakBonusMaxPct},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+
+	saved, err := points.SaveRule(rule)
+	if errors.Is(err, points.ErrInvalidRule) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "积分规则不合法"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存积分规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "积分规则已更新",
+		"data":    saved,
+	})
+}
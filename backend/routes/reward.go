@@ -0,0 +1,261 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/middleware"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+	"learningAssistant-backend/services/rewards"
+)
+
+const notificationTypeRewardRedemption = "REWARD_REDEMPTION"
+
+func registerRewardRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.AuthMiddleware())
+	router.GET("", handleListRewards)
+	router.POST("", handleCreateReward)
+	router.GET("/redemptions", handleListRedemptions)
+	router.POST("/redemptions/:redemptionId/approve", handleReviewRedemption(true))
+	router.POST("/redemptions/:redemptionId/reject", handleReviewRedemption(false))
+	router.POST("/redemptions/:redemptionId/cancel", handleCancelRedemption)
+	router.PUT("/:rewardId", handleUpdateReward)
+	router.POST("/:rewardId/redeem", handleRedeemReward)
+}
+
+// rewardActor 当前登录用户及其是否为管理员
+func rewardActor(c *gin.Context) (rewards.Actor, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return rewards.Actor{}, false
+	}
+	var user models.User
+	if err := database.GetDB().Select("id", "role").First(&user, userID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载用户失败"})
+		return rewards.Actor{}, false
+	}
+	return rewards.Actor{UserID: userID, IsAdmin: user.Role == 1}, true
+}
+
+// respondRewardError 将奖励服务的错误映射为响应，fallback 为未知错误时的提示
+func respondRewardError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, rewards.ErrInvalidReward):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "奖励参数不正确"})
+	case errors.Is(err, rewards.ErrRewardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "奖励不存在"})
+	case errors.Is(err, rewards.ErrRedemptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "兑换记录不存在"})
+	case errors.Is(err, rewards.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "无权管理该奖励"})
+	case errors.Is(err, rewards.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅团队成员可以兑换团队奖励"})
+	case errors.Is(err, rewards.ErrRewardUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "奖励已下架"})
+	case errors.Is(err, rewards.ErrOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "奖励库存不足"})
+	case errors.Is(err, points.ErrInsufficientPoints):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "积分不足"})
+	case errors.Is(err, rewards.ErrRedemptionFinalized):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "该兑换已处理"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": fallback})
+	}
+}
+
+// handleListRewards 奖励列表：默认返回全站奖励与所在团队的奖励，team_id 只看某个团队；
+// include_inactive=true 时维护者可以看到已下架的奖励
+func handleListRewards(c *gin.Context) {
+	actor, ok := rewardActor(c)
+	if !ok {
+		return
+	}
+	teamID, _ := strconv.ParseUint(c.Query("team_id"), 10, 64)
+	list, err := rewards.ListRewards(database.GetDB(), actor, teamID, c.Query("include_inactive") == "true")
+	if err != nil {
+		respondRewardError(c, err, "获取奖励失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": list})
+}
+
+// handleCreateReward 发布奖励：指定 team_id 时需为团队负责人，否则需为管理员
+func handleCreateReward(c *gin.Context) {
+	actor, ok := rewardActor(c)
+	if !ok {
+		return
+	}
+	var req rewards.RewardInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	if req.TeamID != nil && *req.TeamID == 0 {
+		req.TeamID = nil
+	}
+	reward, err := rewards.CreateReward(database.GetDB(), actor, req)
+	if err != nil {
+		respondRewardError(c, err, "发布奖励失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "奖励已发布", "data": reward})
+}
+
+// handleUpdateReward 修改奖励信息、库存或上下架
+func handleUpdateReward(c *gin.Context) {
+	actor, ok := rewardActor(c)
+	if !ok {
+		return
+	}
+	rewardID, err := strconv.ParseUint(c.Param("rewardId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的奖励ID"})
+		return
+	}
+	var req rewards.RewardInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	reward, err := rewards.UpdateReward(database.GetDB(), actor, rewardID, req)
+	if err != nil {
+		respondRewardError(c, err, "更新奖励失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "奖励已更新", "data": reward})
+}
+
+func handleRedeemReward(c *gin.Context) {
+	actor, ok := rewardActor(c)
+	if !ok {
+		return
+	}
+	rewardID, err := strconv.ParseUint(c.Param("rewardId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的奖励ID"})
+		return
+	}
+	db := database.GetDB()
+	redemption, err := rewards.Redeem(db, actor.UserID, rewardID)
+	if err != nil {
+		respondRewardError(c, err, "兑换失败")
+		return
+	}
+
+	message := "兑换成功"
+	if redemption.Status == models.RedemptionStatusPending {
+		message = "兑换申请已提交，等待审核"
+		reviewers, err := rewards.Reviewers(db, redemption)
+		if err != nil {
+			log.Printf("[Rewards] load reviewers of redemption %d failed: %v", redemption.ID, err)
+		}
+		for _, reviewerID := range reviewers {
+			notifyRedemption(db, reviewerID, redemption, "新的奖励兑换申请",
+				fmt.Sprintf("有成员申请兑换「%s」（%d 积分），请及时审核", redemption.RewardName, redemption.Cost), "PENDING")
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": message, "data": redemption})
+}
+
+// handleReviewRedemption 团队负责人（全站奖励为管理员）审核兑换申请，驳回时退回积分
+func handleReviewRedemption(approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor, ok := rewardActor(c)
+		if !ok {
+			return
+		}
+		redemptionID, err := strconv.ParseUint(c.Param("redemptionId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的兑换ID"})
+			return
+		}
+		var req struct {
+			Note string `json:"note"`
+		}
+		_ = c.ShouldBindJSON(&req)
+
+		db := database.GetDB()
+		redemption, err := rewards.Review(db, actor, redemptionID, approve, req.Note)
+		if err != nil {
+			respondRewardError(c, err, "审核兑换失败")
+			return
+		}
+		title, content := "兑换申请已通过", fmt.Sprintf("你兑换的「%s」已通过审核", redemption.RewardName)
+		if !approve {
+			title, content = "兑换申请被驳回", fmt.Sprintf("你兑换的「%s」被驳回，%d 积分已退回", redemption.RewardName, redemption.Cost)
+		}
+		notifyRedemption(db, redemption.UserID, redemption, title, content, "NONE")
+		c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": redemption})
+	}
+}
+
+func handleCancelRedemption(c *gin.Context) {
+	actor, ok := rewardActor(c)
+	if !ok {
+		return
+	}
+	redemptionID, err := strconv.ParseUint(c.Param("redemptionId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的兑换ID"})
+		return
+	}
+	redemption, err := rewards.Cancel(database.GetDB(), actor.UserID, redemptionID)
+	if err != nil {
+		respondRewardError(c, err, "撤回兑换失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "已撤回，积分已退回", "data": redemption})
+}
+
+// handleListRedemptions 兑换记录：默认为本人的记录；指定 team_id 时返回团队全部记录（仅团队负责人或管理员），
+// status 可按状态过滤
+func handleListRedemptions(c *gin.Context) {
+	actor, ok := rewardActor(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	filter := rewards.RedemptionFilter{UserID: actor.UserID, Status: c.Query("status"), Limit: limit}
+	db := database.GetDB()
+	if teamID, _ := strconv.ParseUint(c.Query("team_id"), 10, 64); teamID > 0 {
+		manager, err := rewards.CanManage(db, actor, &teamID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取兑换记录失败"})
+			return
+		}
+		filter.TeamID = teamID
+		if manager {
+			filter.UserID = 0
+		}
+	}
+	list, err := rewards.ListRedemptions(db, filter)
+	if err != nil {
+		respondRewardError(c, err, "获取兑换记录失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": list})
+}
+
+func notifyRedemption(db *gorm.DB, userID uint64, redemption *models.RewardRedemption, title, content, actionStatus string) {
+	notification := models.Notification{
+		UserID:       userID,
+		Title:        title,
+		Content:      content,
+		Type:         notificationTypeRewardRedemption,
+		RelatedID:    redemption.ID,
+		RelatedData:  string(mustMarshal(map[string]uint64{"reward_id": redemption.RewardID, "redemption_id": redemption.ID})),
+		ActionStatus: actionStatus,
+	}
+	if err := db.Create(&notification).Error; err != nil {
+		log.Printf("[Rewards] notify user %d of redemption %d failed: %v", userID, redemption.ID, err)
+	}
+}
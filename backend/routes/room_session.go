@@ -0,0 +1,611 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+const (
+	roomSessionReminderLead      = 15 * time.Minute
+	roomSessionMinDuration       = 15
+	roomSessionMaxDuration       = 8 * 60
+	roomSessionMaxLeadDays       = 90
+	roomSessionAttendanceMinutes = 5
+
+	notificationTypeRoomSession = "ROOM_SESSION"
+)
+
+var errRoomSessionOverlap = errors.New("room-session-overlap")
+
+func registerRoomSessionRoutes(rooms *gin.RouterGroup) {
+	rooms.GET("/:roomId/sessions", handleListRoomSessions)
+	rooms.POST("/:roomId/sessions", handleScheduleRoomSession)
+	rooms.DELETE("/:roomId/sessions/:sessionId", handleCancelRoomSession)
+	rooms.PUT("/:roomId/sessions/:sessionId/rsvp", handleRSVPRoomSession)
+	rooms.GET("/:roomId/sessions/:sessionId/report", handleRoomSessionReport)
+}
+
+// resolveStudyActor 学习室接口的操作用户：已登录时一律取登录身份，
+// 请求体或查询参数中的 user_id 仅用于兼容未登录的旧客户端
+func resolveStudyActor(c *gin.Context, bodyUserID uint64) uint64 {
+	if uid, ok := currentUserID(c); ok {
+		return uid
+	}
+	if bodyUserID != 0 {
+		return bodyUserID
+	}
+	uid, _ := strconv.ParseUint(c.Query("user_id"), 10, 64)
+	return uid
+}
+
+func loadRoomForSession(c *gin.Context) (*models.StudyRoom, bool) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return nil, false
+	}
+	var room models.StudyRoom
+	if err := database.GetDB().First(&room, roomID).Error; err != nil {
+		status, msg := http.StatusInternalServerError, "加载房间失败"
+		if errorsIsNotFound(err) {
+			status, msg = http.StatusNotFound, "房间不存在"
+		}
+		c.JSON(status, gin.H{"code": status, "message": msg})
+		return nil, false
+	}
+	return &room, true
+}
+
+func loadRoomSession(c *gin.Context, roomID uint64) (*models.RoomSession, bool) {
+	sessionID, err := strconv.ParseUint(c.Param("sessionId"), 10, 64)
+	if err != nil || sessionID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "会话ID不正确"})
+		return nil, false
+	}
+	var session models.RoomSession
+	if err := database.GetDB().Where("id = ? AND room_id = ?", sessionID, roomID).First(&session).Error; err != nil {
+		status, msg := http.StatusInternalServerError, "加载会话失败"
+		if errorsIsNotFound(err) {
+			status, msg = http.StatusNotFound, "会话不存在"
+		}
+		c.JSON(status, gin.H{"code": status, "message": msg})
+		return nil, false
+	}
+	return &session, true
+}
+
+// canUseStudyRoom 未被封禁且（团队聊天室时）属于该团队
+func canUseStudyRoom(db *gorm.DB, room *models.StudyRoom, userID uint64) bool {
+	if _, banned := activeStudyRoomBan(db, room.ID, userID, time.Now()); banned {
+		return false
+	}
+	if room.RoomKind == "team" && room.TeamID != nil {
+		return canAccessTeam(db, *room.TeamID, userID)
+	}
+	return true
+}
+
+func roomSessionStatusName(status int8) string {
+	switch status {
+	case models.RoomSessionStatusScheduled:
+		return "scheduled"
+	case models.RoomSessionStatusLive:
+		return "live"
+	case models.RoomSessionStatusEnded:
+		return "ended"
+	case models.RoomSessionStatusCancelled:
+		return "cancelled"
+	default:
+		return "legacy"
+	}
+}
+
+func roomSessionEnd(session *models.RoomSession) time.Time {
+	if session.EndTime != nil {
+		return *session.EndTime
+	}
+	return session.StartTime.Add(time.Duration(session.DurationMinutes) * time.Minute)
+}
+
+// scheduleRoomSession 创建预约会话，同一房间的预约与进行中会话时间不能重叠
+func scheduleRoomSession(db *gorm.DB, roomID, userID uint64, topic string, start time.Time, duration int) (*models.RoomSession, error) {
+	end := start.Add(time.Duration(duration) * time.Minute)
+	session := &models.RoomSession{
+		RoomID:          roomID,
+		StartedBy:       userID,
+		StartTime:       start,
+		EndTime:         &end,
+		Topic:           topic,
+		DurationMinutes: duration,
+		Status:          models.RoomSessionStatusScheduled,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var overlapping int64
+		if err := tx.Model(&models.RoomSession{}).
+			Where("room_id = ? AND status IN ? AND start_time < ? AND end_time > ?",
+				roomID, []int8{models.RoomSessionStatusScheduled, models.RoomSessionStatusLive}, end, start).
+			Count(&overlapping).Error; err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return errRoomSessionOverlap
+		}
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		// 发起人默认参加
+		return tx.Create(&models.RoomSessionRSVP{SessionID: session.ID, UserID: userID, Status: models.RoomSessionRSVPGoing}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func handleScheduleRoomSession(c *gin.Context) {
+	var req struct {
+		UserID          uint64 `json:"user_id"`
+		Topic           string `json:"topic"`
+		StartTime       string `json:"start_time"`
+		DurationMinutes int    `json:"duration_minutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数格式不正确"})
+		return
+	}
+	room, ok := loadRoomForSession(c)
+	if !ok {
+		return
+	}
+	userID := resolveStudyActor(c, req.UserID)
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少用户ID"})
+		return
+	}
+	topic := strings.TrimSpace(req.Topic)
+	if topic == "" || len([]rune(topic)) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "主题不能为空且不超过64个字符"})
+		return
+	}
+	start, err := time.Parse(time.RFC3339, strings.TrimSpace(req.StartTime))
+	now := time.Now()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始时间格式不正确，请使用 RFC3339 格式"})
+		return
+	}
+	if !start.After(now) || start.After(now.AddDate(0, 0, roomSessionMaxLeadDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始时间需在未来90天内"})
+		return
+	}
+	if req.DurationMinutes < roomSessionMinDuration || req.DurationMinutes > roomSessionMaxDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "时长需在15-480分钟之间"})
+		return
+	}
+
+	db := database.GetDB()
+	if !canUseStudyRoom(db, room, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "无权限在该房间预约"})
+		return
+	}
+	session, err := scheduleRoomSession(db, room.ID, userID, topic, start, req.DurationMinutes)
+	if err != nil {
+		if errors.Is(err, errRoomSessionOverlap) {
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "该时间段已有其他预约"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "预约失败"})
+		return
+	}
+
+	local := start.In(usertime.ForUser(userID)).Format("01-02 15:04")
+	postStudyRoomSystemMessage(db, room.ID, userID, fmt.Sprintf("%s 预约了学习会「%s」，%s 开始，时长 %d 分钟", studyRoomDisplayName(userID), topic, local, req.DurationMinutes))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "预约成功",
+		"data":    gin.H{"session": buildRoomSessionItem(db, session, userID)},
+	})
+}
+
+func buildRoomSessionItem(db *gorm.DB, session *models.RoomSession, viewerID uint64) gin.H {
+	var rsvps []models.RoomSessionRSVP
+	_ = db.Where("session_id = ?", session.ID).Find(&rsvps).Error
+	counts := map[string]int{models.RoomSessionRSVPGoing: 0, models.RoomSessionRSVPMaybe: 0, models.RoomSessionRSVPDeclined: 0}
+	myRSVP := ""
+	for _, rsvp := range rsvps {
+		counts[rsvp.Status]++
+		if rsvp.UserID == viewerID {
+			myRSVP = rsvp.Status
+		}
+	}
+	return gin.H{
+		"id":               session.ID,
+		"room_id":          session.RoomID,
+		"topic":            session.Topic,
+		"started_by":       session.StartedBy,
+		"start_time":       session.StartTime,
+		"end_time":         roomSessionEnd(session),
+		"duration_minutes": session.DurationMinutes,
+		"status":           roomSessionStatusName(session.Status),
+		"rsvp_counts":      counts,
+		"my_rsvp":          myRSVP,
+	}
+}
+
+func handleListRoomSessions(c *gin.Context) {
+	room, ok := loadRoomForSession(c)
+	if !ok {
+		return
+	}
+	viewerID := resolveStudyActor(c, 0)
+	db := database.GetDB()
+	query := db.Where("room_id = ? AND status <> 0", room.ID)
+	if c.DefaultQuery("scope", "upcoming") == "past" {
+		query = query.Where("status IN ?", []int8{models.RoomSessionStatusEnded, models.RoomSessionStatusCancelled}).Order("start_time DESC")
+	} else {
+		query = query.Where("status IN ?", []int8{models.RoomSessionStatusScheduled, models.RoomSessionStatusLive}).Order("start_time ASC")
+	}
+	var sessions []models.RoomSession
+	if err := query.Limit(50).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取会话失败"})
+		return
+	}
+	items := make([]gin.H, 0, len(sessions))
+	for i := range sessions {
+		items = append(items, buildRoomSessionItem(db, &sessions[i], viewerID))
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"sessions": items}})
+}
+
+func handleRSVPRoomSession(c *gin.Context) {
+	var req struct {
+		UserID uint64 `json:"user_id"`
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数格式不正确"})
+		return
+	}
+	status := strings.ToLower(strings.TrimSpace(req.Status))
+	if status != models.RoomSessionRSVPGoing && status != models.RoomSessionRSVPMaybe && status != models.RoomSessionRSVPDeclined {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "回复仅支持 going、maybe 或 declined"})
+		return
+	}
+	room, ok := loadRoomForSession(c)
+	if !ok {
+		return
+	}
+	session, ok := loadRoomSession(c, room.ID)
+	if !ok {
+		return
+	}
+	userID := resolveStudyActor(c, req.UserID)
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少用户ID"})
+		return
+	}
+	if session.Status != models.RoomSessionStatusScheduled && session.Status != models.RoomSessionStatusLive {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "会话已结束或已取消"})
+		return
+	}
+	db := database.GetDB()
+	if !canUseStudyRoom(db, room, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "无权限参加该会话"})
+		return
+	}
+
+	rsvp := models.RoomSessionRSVP{SessionID: session.ID, UserID: userID}
+	if err := db.Where("session_id = ? AND user_id = ?", session.ID, userID).
+		Assign(models.RoomSessionRSVP{Status: status}).
+		FirstOrCreate(&rsvp).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "回复失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"session": buildRoomSessionItem(db, session, userID)}})
+}
+
+func handleCancelRoomSession(c *gin.Context) {
+	room, ok := loadRoomForSession(c)
+	if !ok {
+		return
+	}
+	session, ok := loadRoomSession(c, room.ID)
+	if !ok {
+		return
+	}
+	userID := resolveStudyActor(c, 0)
+	db := database.GetDB()
+	if userID == 0 || (session.StartedBy != userID && studyRoomRole(db, room, userID) < models.StudyRoomRoleModerator) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅发起人或房间管理员可以取消"})
+		return
+	}
+	res := db.Model(&models.RoomSession{}).
+		Where("id = ? AND status = ?", session.ID, models.RoomSessionStatusScheduled).
+		Update("status", models.RoomSessionStatusCancelled)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "取消失败"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "只能取消尚未开始的会话"})
+		return
+	}
+
+	notifyRoomSessionParticipants(db, session, "学习会已取消", fmt.Sprintf("「%s」已被取消", session.Topic), userID)
+	postStudyRoomSystemMessage(db, room.ID, userID, fmt.Sprintf("学习会「%s」已取消", session.Topic))
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"id": session.ID}})
+}
+
+// notifyRoomSessionParticipants 通知回复参加或待定的成员，skipUserID 为操作者本人
+func notifyRoomSessionParticipants(db *gorm.DB, session *models.RoomSession, title, content string, skipUserID uint64) int {
+	var userIDs []uint64
+	if err := db.Model(&models.RoomSessionRSVP{}).
+		Where("session_id = ? AND status IN ?", session.ID, []string{models.RoomSessionRSVPGoing, models.RoomSessionRSVPMaybe}).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		log.Printf("[RoomSession] load rsvps of session %d failed: %v", session.ID, err)
+		return 0
+	}
+	relatedData := string(mustMarshal(map[string]uint64{"room_id": session.RoomID, "session_id": session.ID}))
+	sent := 0
+	for _, uid := range userIDs {
+		if uid == skipUserID {
+			continue
+		}
+		notification := models.Notification{
+			UserID:       uid,
+			Title:        title,
+			Content:      content,
+			Type:         notificationTypeRoomSession,
+			RelatedID:    session.ID,
+			RelatedData:  relatedData,
+			ActionStatus: "NONE",
+		}
+		if err := db.Create(&notification).Error; err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// advanceRoomSessions 推进预约会话的生命周期：开始前提醒、到点开场、结束后统计出勤。
+// 每一步都以状态作为条件更新，多实例或重复执行时不会重复处理。
+func advanceRoomSessions(db *gorm.DB, now time.Time) (reminded, opened, closed int, err error) {
+	var upcoming []models.RoomSession
+	if err = db.Where("status = ? AND reminder_sent_at IS NULL AND start_time <= ?", models.RoomSessionStatusScheduled, now.Add(roomSessionReminderLead)).
+		Find(&upcoming).Error; err != nil {
+		return
+	}
+	for i := range upcoming {
+		session := &upcoming[i]
+		res := db.Model(&models.RoomSession{}).Where("id = ? AND reminder_sent_at IS NULL", session.ID).Update("reminder_sent_at", now)
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		minutes := int(session.StartTime.Sub(now).Minutes())
+		if minutes < 0 {
+			minutes = 0
+		}
+		notifyRoomSessionParticipants(db, session, "学习会即将开始", fmt.Sprintf("「%s」将在 %d 分钟后开始", session.Topic, minutes), 0)
+		reminded++
+	}
+
+	var due []models.RoomSession
+	if err = db.Where("status = ? AND start_time <= ?", models.RoomSessionStatusScheduled, now).Find(&due).Error; err != nil {
+		return
+	}
+	for i := range due {
+		session := &due[i]
+		res := db.Model(&models.RoomSession{}).Where("id = ? AND status = ?", session.ID, models.RoomSessionStatusScheduled).Update("status", models.RoomSessionStatusLive)
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		_ = db.Model(&models.StudyRoom{}).Where("id = ?", session.RoomID).Update("last_session_started", session.StartTime).Error
+		session.Status = models.RoomSessionStatusLive
+		hub := studyHubRegistry.getHub(session.RoomID)
+		hub.broadcast(wsEnvelope{Type: "room_session_started", Data: mustMarshal(buildRoomSessionItem(db, session, 0))})
+		postStudyRoomSystemMessage(db, session.RoomID, session.StartedBy, fmt.Sprintf("学习会「%s」开始了，预计 %d 分钟", session.Topic, session.DurationMinutes))
+		opened++
+	}
+
+	var finished []models.RoomSession
+	if err = db.Where("status = ? AND end_time <= ?", models.RoomSessionStatusLive, now).Find(&finished).Error; err != nil {
+		return
+	}
+	for i := range finished {
+		session := &finished[i]
+		res := db.Model(&models.RoomSession{}).Where("id = ? AND status = ?", session.ID, models.RoomSessionStatusLive).Update("status", models.RoomSessionStatusEnded)
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		attendees, attErr := recordRoomSessionAttendance(db, session, now)
+		if attErr != nil {
+			log.Printf("[RoomSession] record attendance of session %d failed: %v", session.ID, attErr)
+		}
+		session.Status = models.RoomSessionStatusEnded
+		hub := studyHubRegistry.getHub(session.RoomID)
+		hub.broadcast(wsEnvelope{Type: "room_session_ended", Data: mustMarshal(buildRoomSessionItem(db, session, 0))})
+		postStudyRoomSystemMessage(db, session.RoomID, session.StartedBy, fmt.Sprintf("学习会「%s」结束，共 %d 人出席", session.Topic, attendees))
+		closed++
+	}
+	return
+}
+
+type attendanceInterval struct {
+	start, end time.Time
+}
+
+// computeRoomSessionAttendance 以房间内的 WebSocket 连接记录（LearningRecord）与会话时间求交，
+// 同一用户的多段连接合并后累计在线分钟
+func computeRoomSessionAttendance(db *gorm.DB, session *models.RoomSession, now time.Time) ([]models.RoomSessionAttendance, error) {
+	start, end := session.StartTime, roomSessionEnd(session)
+	if now.Before(end) {
+		end = now
+	}
+	var records []models.LearningRecord
+	if err := db.Where("note = ? AND session_start < ? AND session_start > ?", fmt.Sprintf("room:%d", session.RoomID), end, start.Add(-24*time.Hour)).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	intervals := make(map[uint64][]attendanceInterval)
+	for _, record := range records {
+		recordEnd := record.SessionEnd
+		if recordEnd.IsZero() || recordEnd.Before(record.SessionStart) {
+			// 仍在连接中
+			recordEnd = now
+		}
+		from, to := record.SessionStart, recordEnd
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			intervals[record.UserID] = append(intervals[record.UserID], attendanceInterval{from, to})
+		}
+	}
+
+	result := make([]models.RoomSessionAttendance, 0, len(intervals))
+	for userID, list := range intervals {
+		sort.Slice(list, func(i, j int) bool { return list[i].start.Before(list[j].start) })
+		var total time.Duration
+		cur := list[0]
+		for _, next := range list[1:] {
+			if !next.start.After(cur.end) {
+				if next.end.After(cur.end) {
+					cur.end = next.end
+				}
+				continue
+			}
+			total += cur.end.Sub(cur.start)
+			cur = next
+		}
+		total += cur.end.Sub(cur.start)
+		result = append(result, models.RoomSessionAttendance{
+			SessionID:     session.ID,
+			UserID:        userID,
+			Minutes:       int(total.Minutes()),
+			FirstJoinedAt: list[0].start,
+			LastLeftAt:    cur.end,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return result, nil
+}
+
+// recordRoomSessionAttendance 写入出勤记录，返回达到出勤标准的人数
+func recordRoomSessionAttendance(db *gorm.DB, session *models.RoomSession, now time.Time) (int, error) {
+	rows, err := computeRoomSessionAttendance(db, session, now)
+	if err != nil {
+		return 0, err
+	}
+	attended := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("session_id = ?", session.ID).Delete(&models.RoomSessionAttendance{}).Error; err != nil {
+			return err
+		}
+		for i := range rows {
+			if rows[i].Minutes >= roomSessionAttendanceMinutes {
+				attended++
+			}
+			if err := tx.Create(&rows[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return attended, err
+}
+
+func handleRoomSessionReport(c *gin.Context) {
+	room, ok := loadRoomForSession(c)
+	if !ok {
+		return
+	}
+	session, ok := loadRoomSession(c, room.ID)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	var attendance []models.RoomSessionAttendance
+	switch session.Status {
+	case models.RoomSessionStatusEnded:
+		if err := db.Where("session_id = ?", session.ID).Order("user_id ASC").Find(&attendance).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取出勤失败"})
+			return
+		}
+	case models.RoomSessionStatusLive:
+		var err error
+		if attendance, err = computeRoomSessionAttendance(db, session, time.Now()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取出勤失败"})
+			return
+		}
+	default:
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "会话尚未开始"})
+		return
+	}
+
+	var rsvps []models.RoomSessionRSVP
+	_ = db.Where("session_id = ?", session.ID).Find(&rsvps).Error
+	rsvpByUser := make(map[uint64]string, len(rsvps))
+	userIDs := make([]uint64, 0, len(rsvps)+len(attendance))
+	for _, rsvp := range rsvps {
+		rsvpByUser[rsvp.UserID] = rsvp.Status
+		userIDs = append(userIDs, rsvp.UserID)
+	}
+	for _, row := range attendance {
+		userIDs = append(userIDs, row.UserID)
+	}
+	names := loadUserNames(userIDs)
+
+	attendees := make([]gin.H, 0, len(attendance))
+	attendedUsers := make(map[uint64]bool, len(attendance))
+	walkIns := 0
+	for _, row := range attendance {
+		attended := row.Minutes >= roomSessionAttendanceMinutes
+		attendedUsers[row.UserID] = attended
+		if attended && rsvpByUser[row.UserID] != models.RoomSessionRSVPGoing && rsvpByUser[row.UserID] != models.RoomSessionRSVPMaybe {
+			walkIns++
+		}
+		attendees = append(attendees, gin.H{
+			"user_id":         row.UserID,
+			"display_name":    names[row.UserID],
+			"minutes":         row.Minutes,
+			"attended":        attended,
+			"rsvp":            rsvpByUser[row.UserID],
+			"first_joined_at": row.FirstJoinedAt,
+			"last_left_at":    row.LastLeftAt,
+		})
+	}
+	noShows := make([]uint64, 0)
+	for _, rsvp := range rsvps {
+		if rsvp.Status == models.RoomSessionRSVPGoing && !attendedUsers[rsvp.UserID] {
+			noShows = append(noShows, rsvp.UserID)
+		}
+	}
+	sort.Slice(noShows, func(i, j int) bool { return noShows[i] < noShows[j] })
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"session":   buildRoomSessionItem(db, session, resolveStudyActor(c, 0)),
+			"attendees": attendees,
+			"no_shows":  noShows,
+			"walk_ins":  walkIns,
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/models"
+)
+
+func TestRoomSessionScheduleRSVPAndAttendance(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	room := models.StudyRoom{Name: "晚自习", OwnerUserID: 1}
+	db.Create(&room)
+	roomPath := "/api/study/rooms/" + jsonNumber(room.ID)
+
+	start := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	w := serve(authRequest(http.MethodPost, roomPath+"/sessions", 1, map[string]interface{}{
+		"topic": "线代复习", "start_time": start.Format(time.RFC3339), "duration_minutes": 60,
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("schedule: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			Session struct {
+				ID uint64 `json:"id"`
+			} `json:"session"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	sessionPath := roomPath + "/sessions/" + jsonNumber(created.Data.Session.ID)
+
+	overlap := serve(authRequest(http.MethodPost, roomPath+"/sessions", 2, map[string]interface{}{
+		"topic": "撞车", "start_time": start.Add(30 * time.Minute).Format(time.RFC3339), "duration_minutes": 30,
+	}))
+	if overlap.Code != http.StatusConflict {
+		t.Fatalf("expected overlapping session rejected, got %d", overlap.Code)
+	}
+	// 已登录用户不能通过 user_id 参数冒充发起人取消会话
+	if w := serve(authRequest(http.MethodDelete, sessionPath+"?user_id=1", 2, nil)); w.Code != http.StatusForbidden {
+		t.Fatalf("expected spoofed cancel to be forbidden, got %d", w.Code)
+	}
+	serve(authRequest(http.MethodPut, sessionPath+"/rsvp", 2, map[string]string{"status": "going"}))
+	serve(authRequest(http.MethodPut, sessionPath+"/rsvp", 4, map[string]string{"status": "declined"}))
+
+	// 开始前15分钟提醒，重复执行不会重复提醒
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := advanceRoomSessions(db, start.Add(-10*time.Minute)); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+	}
+	var reminders int64
+	db.Model(&models.Notification{}).Where("type = ?", notificationTypeRoomSession).Count(&reminders)
+	if reminders != 2 {
+		t.Fatalf("expected reminders for creator and going user only, got %d", reminders)
+	}
+
+	if _, opened, _, _ := advanceRoomSessions(db, start.Add(time.Second)); opened != 1 {
+		t.Fatalf("expected session opened, got %d", opened)
+	}
+
+	// 用户1全程在线（中途断线重连），用户3未回复但到场，用户2缺席
+	note := "room:" + jsonNumber(room.ID)
+	db.Create(&models.LearningRecord{UserID: 1, Note: note, SessionStart: start.Add(-5 * time.Minute), SessionEnd: start.Add(20 * time.Minute)})
+	db.Create(&models.LearningRecord{UserID: 1, Note: note, SessionStart: start.Add(15 * time.Minute), SessionEnd: start.Add(40 * time.Minute)})
+	db.Create(&models.LearningRecord{UserID: 3, Note: note, SessionStart: start.Add(30 * time.Minute)})
+
+	if _, _, closed, _ := advanceRoomSessions(db, start.Add(61*time.Minute)); closed != 1 {
+		t.Fatalf("expected session closed, got %d", closed)
+	}
+
+	var report struct {
+		Data struct {
+			Attendees []struct {
+				UserID   uint64 `json:"user_id"`
+				Minutes  int    `json:"minutes"`
+				Attended bool   `json:"attended"`
+			} `json:"attendees"`
+			NoShows []uint64 `json:"no_shows"`
+			WalkIns int      `json:"walk_ins"`
+		} `json:"data"`
+	}
+	w = serve(authRequest(http.MethodGet, sessionPath+"/report", 1, nil))
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+	if len(report.Data.Attendees) != 2 ||
+		report.Data.Attendees[0].UserID != 1 || report.Data.Attendees[0].Minutes != 40 ||
+		report.Data.Attendees[1].UserID != 3 || report.Data.Attendees[1].Minutes != 30 {
+		t.Fatalf("unexpected attendance %s", w.Body.String())
+	}
+	if len(report.Data.NoShows) != 1 || report.Data.NoShows[0] != 2 || report.Data.WalkIns != 1 {
+		t.Fatalf("unexpected no-shows/walk-ins %s", w.Body.String())
+	}
+
+	var system int64
+	db.Model(&models.ChatMessage{}).Where("room_id = ? AND msg_type = ?", room.ID, models.ChatMessageTypeSystem).Count(&system)
+	if system != 3 {
+		t.Fatalf("expected scheduled/started/ended system messages, got %d", system)
+	}
+}
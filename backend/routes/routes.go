@@ -11,6 +11,9 @@ func SetupRoutes(r *gin.Engine) {
 	// 初始化RAG服务（确保在任务路由使用前初始化）
 	initRAGServices()
 
+	// 领域事件（成就解锁、升级、积分到账）转为通知并实时推送
+	startDomainEventDelivery()
+
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -43,6 +46,10 @@ func SetupRoutes(r *gin.Engine) {
 		notifications := v1.Group("/notifications")
 		registerNotificationRoutes(notifications)
 
+		// 私信相关路由
+		directMessages := v1.Group("/direct-messages")
+		registerDirectMessageRoutes(directMessages)
+
 		// 学习室相关路由
 		study := v1.Group("/study")
 		registerStudyRoutes(study)
@@ -51,8 +58,7 @@ func SetupRoutes(r *gin.Engine) {
 		registerStudyNotesRoutes(study)
 		{
 			rooms := study.Group("/rooms")
-			rooms.GET("/:roomId/chat/history", handleGetRoomChatHistory)
-			rooms.POST("/:roomId/chat", handlePostRoomChat)
+			registerStudyChatRoutes(rooms)
 		}
 
 		analysis := v1.Group("/analysis")
@@ -70,6 +76,22 @@ func SetupRoutes(r *gin.Engine) {
 		knowledge := v1.Group("")
 		registerKnowledgeBaseRoutes(knowledge)
 		registerKnowledgeSyncRoutes(knowledge)
+
+		// 排行榜
+		leaderboards := v1.Group("/leaderboards")
+		registerLeaderboardRoutes(leaderboards)
+
+		// 积分兑换
+		rewardsGroup := v1.Group("/rewards")
+		registerRewardRoutes(rewardsGroup)
+
+		// 公开分享资源
+		share := v1.Group("/share")
+		registerShareRoutes(share)
+
+		// 管理后台路由
+		admin := v1.Group("/admin")
+		registerAdminRoutes(admin)
 	}
 
 	// 兼容旧版未带版本号的前缀 /api/**
@@ -88,9 +110,21 @@ func SetupRoutes(r *gin.Engine) {
 		teamsLegacy := legacy.Group("/teams")
 		registerTeamRoutes(teamsLegacy)
 
+		leaderboardsLegacy := legacy.Group("/leaderboards")
+		registerLeaderboardRoutes(leaderboardsLegacy)
+
+		rewardsLegacy := legacy.Group("/rewards")
+		registerRewardRoutes(rewardsLegacy)
+
+		shareLegacy := legacy.Group("/share")
+		registerShareRoutes(shareLegacy)
+
 		notificationsLegacy := legacy.Group("/notifications")
 		registerNotificationRoutes(notificationsLegacy)
 
+		directMessagesLegacy := legacy.Group("/direct-messages")
+		registerDirectMessageRoutes(directMessagesLegacy)
+
 		studyLegacy := legacy.Group("/study")
 		registerStudyRoutes(studyLegacy)
 		registerStudyWebsocketRoutes(studyLegacy)
@@ -98,8 +132,7 @@ func SetupRoutes(r *gin.Engine) {
 		registerStudyNotesRoutes(studyLegacy)
 		{
 			roomsLegacy := studyLegacy.Group("/rooms")
-			roomsLegacy.GET("/:roomId/chat/history", handleGetRoomChatHistory)
-			roomsLegacy.POST("/:roomId/chat", handlePostRoomChat)
+			registerStudyChatRoutes(roomsLegacy)
 		}
 
 		analysisLegacy := legacy.Group("/analysis")
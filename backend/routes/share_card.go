@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/sharecard"
+)
+
+// registerShareRoutes 公开的分享资源，凭随机链接访问，无需登录
+func registerShareRoutes(router *gin.RouterGroup) {
+	router.GET("/cards/:file", handleGetShareCardImage)
+}
+
+// ensureSelf 要求当前登录用户即路径中的用户，需配合 AuthMiddleware 使用
+func ensureSelf(c *gin.Context, userID uint64) bool {
+	actorID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return false
+	}
+	if actorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "只能操作自己的数据"})
+		return false
+	}
+	return true
+}
+
+// shareCardResponse 卡片信息与公开访问地址
+func shareCardResponse(c *gin.Context, card *models.ShareCard) gin.H {
+	path := c.Request.URL.Path
+	prefix := "/api/v1"
+	if !strings.HasPrefix(path, prefix+"/") {
+		prefix = "/api"
+	}
+	cardPath := prefix + "/share/cards/" + card.Token + ".svg"
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return gin.H{
+		"card": card,
+		"path": cardPath,
+		"url":  scheme + "://" + c.Request.Host + cardPath,
+	}
+}
+
+// handleCreateShareCard 生成成就卡（kind=achievement，需指定 achievement_id）或当前等级的等级卡（kind=level）
+func handleCreateShareCard(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok || !ensureSelf(c, userID) {
+		return
+	}
+	var req struct {
+		Kind          string `json:"kind"`
+		AchievementID uint64 `json:"achievement_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	card, err := sharecard.Issue(database.GetDB(), userID, req.Kind, req.AchievementID, time.Now())
+	switch {
+	case errors.Is(err, sharecard.ErrInvalidKind):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "不支持的卡片类型"})
+		return
+	case errors.Is(err, sharecard.ErrNotUnlocked):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "尚未解锁该成就"})
+		return
+	case errors.Is(err, sharecard.ErrProfileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "用户不存在"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "生成分享卡片失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": shareCardResponse(c, card)})
+}
+
+func handleListShareCards(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok || !ensureSelf(c, userID) {
+		return
+	}
+	cards, err := sharecard.List(database.GetDB(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取分享卡片失败"})
+		return
+	}
+	list := make([]gin.H, 0, len(cards))
+	for i := range cards {
+		list = append(list, shareCardResponse(c, &cards[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": list})
+}
+
+// handleRevokeShareCard 撤销分享，公开链接随即失效
+func handleRevokeShareCard(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok || !ensureSelf(c, userID) {
+		return
+	}
+	err := sharecard.Revoke(database.GetDB(), userID, c.Param("token"))
+	if errors.Is(err, sharecard.ErrCardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "分享卡片不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "撤销分享失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "已撤销分享"})
+}
+
+// handleGetShareCardImage 输出卡片 SVG，支持 ETag 协商缓存
+func handleGetShareCardImage(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("file"), ".svg")
+	card, err := sharecard.Load(database.GetDB(), token)
+	if errors.Is(err, sharecard.ErrCardNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256([]byte(card.SVG))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	c.Header("ETag", etag)
+	// 撤销后链接需要立即失效，缓存每次都要回源用 ETag 校验，未变化时仍返回 304
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if err := sharecard.RecordView(database.GetDB(), card); err != nil {
+		log.Printf("[ShareCard] record view of card %d failed: %v", card.ID, err)
+	}
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(card.SVG))
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/sharecard"
+)
+
+func TestShareCardImageCountsOnlyServedViews(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	registerShareRoutes(r.Group("/api/share"))
+	card := models.ShareCard{UserID: 1, Kind: "level", SubjectID: 3, Token: "abc123", SVG: "<svg/>", RenderVersion: sharecard.RenderVersion}
+	db.Create(&card)
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/share/cards/abc123.svg", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	first := get("")
+	if first.Code != http.StatusOK || first.Header().Get("ETag") == "" {
+		t.Fatalf("expected card image, got %d", first.Code)
+	}
+	// 撤销要立即生效，共享缓存不能在有效期内直接复用
+	if cc := first.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("expected cards to be revalidated on every request, got %q", cc)
+	}
+	for i := 0; i < 3; i++ {
+		if w := get(first.Header().Get("ETag")); w.Code != http.StatusNotModified {
+			t.Fatalf("expected cached response, got %d", w.Code)
+		}
+	}
+	get("")
+
+	db.First(&card, card.ID)
+	if card.ViewCount != 2 {
+		t.Fatalf("expected only the two served responses to be counted, got %d", card.ViewCount)
+	}
+}
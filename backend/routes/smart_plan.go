@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"learningAssistant-backend/services/planner"
+	"learningAssistant-backend/services/usertime"
+)
+
+// SmartPlanRequest 智能排程请求
+type SmartPlanRequest struct {
+	Range        string `json:"range"` // day / week
+	FocusMinutes int    `json:"focus_minutes"`
+	BreakMinutes int    `json:"break_minutes"`
+	Polish       *bool  `json:"polish"`
+}
+
+// SmartPlanResponse 智能排程响应
+type SmartPlanResponse struct {
+	Range          string   `json:"range"`
+	GeneratedAt    string   `json:"generated_at"`
+	Summary        string   `json:"summary"`
+	Recommendation string   `json:"recommendation"`
+	Tips           []string `json:"tips"`
+	Source         string   `json:"source"` // rule / ai
+	planner.Plan
+}
+
+type smartPlanPolish struct {
+	Summary        string   `json:"summary"`
+	Recommendation string   `json:"recommendation"`
+	Tips           []string `json:"tips"`
+}
+
+// GenerateSmartStudyPlan 基于用户真实任务与学习习惯生成时间块计划
+func GenerateSmartStudyPlan(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+
+	var req SmartPlanRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+			return
+		}
+	}
+	if req.Range == "" {
+		req.Range = c.DefaultQuery("range", "day")
+	}
+	days := 1
+	switch req.Range {
+	case "day":
+	case "week":
+		days = 7
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "range 仅支持 day 或 week"})
+		return
+	}
+
+	now := time.Now().In(usertime.ForUser(userID))
+	userCtx, err := planner.LoadUserContext(userID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取学习数据失败"})
+		return
+	}
+
+	plan := planner.Build(userCtx.Tasks, planner.Options{
+		Now:              now,
+		Days:             days,
+		DailyGoalMinutes: userCtx.DailyGoalMinutes,
+		PreferredPeriod:  userCtx.PreferredPeriod,
+		PeriodWeights:    userCtx.PeriodWeights,
+		FocusMinutes:     req.FocusMinutes,
+		BreakMinutes:     req.BreakMinutes,
+	})
+
+	resp := SmartPlanResponse{
+		Range:       req.Range,
+		GeneratedAt: now.Format(time.RFC3339),
+		Source:      "rule",
+		Plan:        plan,
+	}
+	polish := mockSmartPlanPolish(plan, userCtx.DailyGoalMinutes)
+
+	apiKey := getQwenAPIKey()
+	if apiKey != "" && (req.Polish == nil || *req.Polish) && len(plan.Days) > 0 {
+		if aiPolish, err := callQwenForSmartPlanPolish(apiKey, plan, userCtx.DailyGoalMinutes); err == nil {
+			polish = aiPolish
+			resp.Source = "ai"
+		}
+	}
+	resp.Summary = polish.Summary
+	resp.Recommendation = polish.Recommendation
+	resp.Tips = polish.Tips
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": resp})
+}
+
+func describeSmartPlan(plan planner.Plan) string {
+	lines := make([]string, 0)
+	for _, day := range plan.Days {
+		lines = append(lines, fmt.Sprintf("%s（计划 %d / 目标 %d 分钟）:", day.Date, day.PlannedMinutes, day.GoalMinutes))
+		for _, block := range day.Blocks {
+			if block.Type != planner.BlockTypeStudy {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("- %s-%s %s", block.Start.Format("15:04"), block.End.Format("15:04"), block.TaskTitle))
+		}
+	}
+	for _, task := range plan.Unscheduled {
+		lines = append(lines, fmt.Sprintf("未排入: %s（剩余约 %d 分钟）", task.Title, task.RemainingMinutes))
+	}
+	for _, warning := range plan.Warnings {
+		lines = append(lines, "风险: "+warning)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// callQwenForSmartPlanPolish 让大模型为已排好的计划补充说明，不改动时间块本身
+func callQwenForSmartPlanPolish(apiKey string, plan planner.Plan, dailyGoal int) (*smartPlanPolish, error) {
+	prompt := strings.Join([]string{
+		"你是一个学习规划助手。下面是系统根据用户真实任务、截止时间和学习习惯排好的学习计划，请不要修改时间安排，只需给出整体点评、最优先事项和执行建议。",
+		"",
+		fmt.Sprintf("每日学习目标: %d 分钟", dailyGoal),
+		describeSmartPlan(plan),
+		"",
+		"输出要求: 严格返回 JSON，不能有多余文字、不能使用 Markdown 代码块。",
+		"JSON 格式:",
+		"{\"summary\":\"整体点评\",\"recommendation\":\"最优先做什么及原因\",\"tips\":[\"建议1\",\"建议2\"]}",
+	}, "\n")
+
+	content, err := callQwenForNoteEnhance(apiKey, prompt)
+	if err != nil {
+		return nil, err
+	}
+	var polish smartPlanPolish
+	if err := json.Unmarshal([]byte(content), &polish); err != nil {
+		return nil, fmt.Errorf("解析 JSON 失败: %v, 内容: %s", err, content)
+	}
+	if strings.TrimSpace(polish.Summary) == "" {
+		return nil, fmt.Errorf("AI 返回内容为空")
+	}
+	if polish.Tips == nil {
+		polish.Tips = []string{}
+	}
+	return &polish, nil
+}
+
+func mockSmartPlanPolish(plan planner.Plan, dailyGoal int) *smartPlanPolish {
+	planned := 0
+	var first *planner.Block
+	for i := range plan.Days {
+		planned += plan.Days[i].PlannedMinutes
+		for j := range plan.Days[i].Blocks {
+			if first == nil && plan.Days[i].Blocks[j].Type == planner.BlockTypeStudy {
+				first = &plan.Days[i].Blocks[j]
+			}
+		}
+	}
+
+	polish := &smartPlanPolish{
+		Summary:        fmt.Sprintf("已为你安排 %d 分钟学习，每日目标 %d 分钟。", planned, dailyGoal),
+		Recommendation: "当前没有未完成的任务，可以复习笔记或预习新内容。",
+		Tips:           []string{"每个专注块结束后起身活动一下", "完成任务后及时在任务列表中打勾"},
+	}
+	if first != nil {
+		polish.Recommendation = fmt.Sprintf("%s 开始先做「%s」，它的截止时间和优先级最靠前。", first.Start.Format("15:04"), first.TaskTitle)
+	}
+	if len(plan.Unscheduled) > 0 {
+		polish.Tips = append(polish.Tips, fmt.Sprintf("还有 %d 项任务没有排进计划，可以考虑提高每日学习目标", len(plan.Unscheduled)))
+	}
+	if len(plan.Warnings) > 0 {
+		polish.Tips = append(polish.Tips, "部分任务可能赶不上截止时间，建议先和老师或队友沟通")
+	}
+	return polish
+}
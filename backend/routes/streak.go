@@ -0,0 +1,192 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/achievement"
+	"learningAssistant-backend/services/points"
+	"learningAssistant-backend/services/streak"
+	"learningAssistant-backend/services/usertime"
+)
+
+func registerStreakAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/streak/rule", handleGetStreakRule)
+	router.PUT("/streak/rule", handleUpdateStreakRule)
+}
+
+// handleGetUserStreak 连续活跃天数、保护卡与历史最长记录。只读查询，不消耗保护卡；
+// 保护卡只在签到与 refresh_streaks 任务中按需使用
+func handleGetUserStreak(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	if !ensureUserExists(c, userID) {
+		return
+	}
+	db := database.GetDB()
+	summary, err := streak.Compute(db, userID, usertime.ForUser(userID), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取连续天数失败"})
+		return
+	}
+	rule, err := streak.LoadRule(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取连续天数失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"streak":      summary,
+			"freeze_cost": rule.FreezeCost,
+			"max_freezes": rule.MaxFreezes,
+		},
+	})
+}
+
+// handlePurchaseStreakFreeze 用积分购买保护卡，只能为自己购买
+func handlePurchaseStreakFreeze(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok || !ensureSelf(c, userID) {
+		return
+	}
+	freeze, spent, err := streak.PurchaseFreeze(database.GetDB(), userID)
+	switch {
+	case errors.Is(err, streak.ErrFreezeDisabled):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "暂未开放保护卡"})
+		return
+	case errors.Is(err, streak.ErrFreezeLimit):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "持有的保护卡已达上限"})
+		return
+	case errors.Is(err, points.ErrInsufficientPoints):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "积分不足"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "购买保护卡失败"})
+		return
+	}
+	data := gin.H{"freeze": freeze}
+	if spent != nil {
+		data["total_points"] = spent.Profile.TotalPoints
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "购买成功", "data": data})
+}
+
+func handleGetStreakRule(c *gin.Context) {
+	rule, err := streak.LoadRule(database.GetDB())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载连续天数规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": rule})
+}
+
+// handleUpdateStreakRule 修改活跃日判定与保护卡规则，未传的字段保持当前生效值
+func handleUpdateStreakRule(c *gin.Context) {
+	var req struct {
+		CountCheckIn        *bool `json:"count_check_in"`
+		MinStudyMinutes     *int  `json:"min_study_minutes"`
+		CountTaskCompletion *bool `json:"count_task_completion"`
+		FreezeCost          *int  `json:"freeze_cost"`
+		MaxFreezes          *int  `json:"max_freezes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	db := database.GetDB()
+	rule, err := streak.LoadRule(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载连续天数规则失败"})
+		return
+	}
+	if req.CountCheckIn != nil {
+		rule.CountCheckIn = *req.CountCheckIn
+	}
+	if req.MinStudyMinutes != nil {
+		rule.MinStudyMinutes = *req.MinStudyMinutes
+	}
+	if req.CountTaskCompletion != nil {
+		rule.CountTaskCompletion = *req.CountTaskCompletion
+	}
+	if req.FreezeCost != nil {
+		rule.FreezeCost = *req.FreezeCost
+	}
+	if req.MaxFreezes != nil {
+		rule.MaxFreezes = *req.MaxFreezes
+	}
+	saved, err := streak.SaveRule(db, rule)
+	if errors.Is(err, streak.ErrInvalidRule) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "规则参数不正确"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存连续天数规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "规则已更新", "data": saved})
+}
+
+// refreshStreaks 为仍在连续中或近两天有活跃的用户重算连续天数：中断的记录归零，
+// 空档按需使用保护卡，学习或完成任务带来的增长同步到档案与成就
+func refreshStreaks(db *gorm.DB, now time.Time) (refreshed int, err error) {
+	since := now.Add(-48 * time.Hour)
+	candidates := make(map[uint64]struct{})
+	var ids []uint64
+	if err := db.Model(&models.UserProfile{}).Where("streak_days > 0").Pluck("user_id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		candidates[id] = struct{}{}
+	}
+	ids = nil
+	if err := db.Model(&models.DailyStudyStat{}).Where("date >= ? AND minutes > 0", usertime.CalendarDate(since)).
+		Distinct().Pluck("user_id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		candidates[id] = struct{}{}
+	}
+	ids = nil
+	if err := db.Model(&models.Task{}).Where("status = ? AND completed_at >= ?", 2, since).
+		Distinct().Pluck("COALESCE(owner_user_id, created_by)", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		candidates[id] = struct{}{}
+	}
+
+	for userID := range candidates {
+		var before int
+		db.Model(&models.UserProfile{}).Where("user_id = ?", userID).Select("streak_days").Scan(&before)
+		summary, err := streak.Refresh(db, userID, now)
+		if errors.Is(err, streak.ErrProfileNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[Streak] refresh user %d failed: %v", userID, err)
+			continue
+		}
+		refreshed++
+		if summary.Current > before {
+			if err := achievement.ProcessEvent(achievement.Event{
+				Type:   achievement.EventStreakUpdated,
+				UserID: userID,
+				Value:  summary.Current,
+			}); err != nil {
+				log.Printf("[Streak] achievement event for user %d failed: %v", userID, err)
+			}
+		}
+	}
+	return refreshed, nil
+}
@@ -25,9 +25,14 @@ func registerStudyRoutes(router *gin.RouterGroup) {
 	rooms := router.Group("/rooms")
 	{
 		rooms.GET("", handleListStudyRooms)
+		rooms.GET("/recommended", handleRecommendedStudyRooms)
 		rooms.GET("/:roomId", handleGetStudyRoomDetail)
 		rooms.POST("", handleCreateStudyRoom)
 		rooms.POST("/:roomId/join", handleJoinStudyRoom)
+		registerStudyModerationRoutes(rooms)
+		registerRoomSessionRoutes(rooms)
+		registerStudyDocumentRoutes(rooms)
+		registerStudyGroupCallRoutes(rooms)
 	}
 
 	router.GET("/summary", handleStudySummary)
@@ -75,14 +80,68 @@ type studyRoomListItem struct {
 	StudyTime          string   `json:"study_time"`
 	FocusMinutesToday  int      `json:"focus_minutes_today"`
 	LastSessionStarted *string  `json:"last_session_started"`
+	OnlineUsers        int      `json:"online_users"`
+	LastActiveAt       *string  `json:"last_active_at"`
 }
 
+// handleListStudyRooms 房间列表，支持按名称/描述/标签搜索、按类型筛选，
+// 以及按创建时间（newest）、实时在线人数（online）或最近活跃（active）排序
 func handleListStudyRooms(c *gin.Context) {
 	db := database.GetDB()
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(studyRoomDefaultPageSize)))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > studyRoomMaxPageSize {
+		pageSize = studyRoomDefaultPageSize
+	}
+	sortBy := strings.ToLower(strings.TrimSpace(c.DefaultQuery("sort", "newest")))
+	if sortBy != "online" && sortBy != "active" {
+		sortBy = "newest"
+	}
+
+	query := db.Model(&models.StudyRoom{})
+	switch kind := strings.ToLower(strings.TrimSpace(c.DefaultQuery("kind", "study"))); kind {
+	case "all":
+	case "study":
+		query = query.Where("room_kind = '' OR room_kind = ? OR room_kind IS NULL", "study")
+	default:
+		query = query.Where("room_kind = ?", kind)
+	}
+	if keyword := strings.TrimSpace(c.Query("q")); keyword != "" {
+		like := "%" + chatSearchEscape(strings.ToLower(keyword)) + "%"
+		query = query.Where("LOWER(name) LIKE ? ESCAPE '!' OR LOWER(description) LIKE ? ESCAPE '!' OR LOWER(tags) LIKE ? ESCAPE '!'", like, like, like)
+	}
+	if tag := strings.ToLower(strings.TrimSpace(c.Query("tag"))); tag != "" {
+		// 标签以逗号分隔存储，按整段匹配，避免 "go" 命中 "golang"
+		escaped := chatSearchEscape(tag)
+		query = query.Where("LOWER(tags) = ? OR LOWER(tags) LIKE ? ESCAPE '!' OR LOWER(tags) LIKE ? ESCAPE '!' OR LOWER(tags) LIKE ? ESCAPE '!'",
+			tag, escaped+",%", "%,"+escaped, "%,"+escaped+",%")
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "获取学习房间列表失败",
+		})
+		return
+	}
+
 	var rooms []models.StudyRoom
-	if err := db.Where("room_kind = '' OR room_kind = ? OR room_kind IS NULL", "study").
-		Order("created_at DESC").
-		Find(&rooms).Error; err != nil {
+	listQuery := query.Session(&gorm.Session{}).Order("created_at DESC")
+	if sortBy == "newest" {
+		listQuery = listQuery.Offset((page - 1) * pageSize).Limit(pageSize)
+	} else {
+		// 在线人数与活跃时间不在房间表中，取最近的房间与当前有人在线的房间在内存中排序
+		listQuery = listQuery.Limit(studyRoomScanLimit)
+	}
+	err := listQuery.Find(&rooms).Error
+	if err == nil && sortBy != "newest" {
+		rooms, err = appendLiveStudyRooms(query, rooms)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
 			"message": "获取学习房间列表失败",
@@ -99,16 +158,39 @@ func handleListStudyRooms(c *gin.Context) {
 		return
 	}
 
+	if sortBy != "newest" && total > int64(len(rooms)) {
+		// 只有扫描到的房间参与排序，总数与可翻页的范围保持一致
+		total = int64(len(rooms))
+	}
+
+	activity := loadStudyRoomActivity(db, rooms)
+	if sortBy != "newest" {
+		sortStudyRooms(rooms, activity, sortBy)
+		start := (page - 1) * pageSize
+		if start > len(rooms) {
+			start = len(rooms)
+		}
+		end := start + pageSize
+		if end > len(rooms) {
+			end = len(rooms)
+		}
+		rooms = rooms[start:end]
+	}
+
 	response := make([]studyRoomListItem, 0, len(rooms))
-	for _, room := range rooms {
-		response = append(response, buildStudyRoomListItem(&room, memberCounts[room.ID]))
+	for i := range rooms {
+		response = append(response, studyRoomListItemWithActivity(&rooms[i], memberCounts[rooms[i].ID], activity[rooms[i].ID]))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"rooms": response,
+			"rooms":     response,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+			"sort":      sortBy,
 		},
 	})
 }
@@ -433,7 +515,12 @@ func handleJoinStudyRoom(c *gin.Context) {
 		}
 	}
 
+	online := studyHubRegistry.getHub(room.ID)
 	if payload.UserID != 0 {
+		if err := checkStudyRoomAdmission(db, room.ID, payload.UserID, online); err != nil {
+			respondStudyRoomAdmission(c, err)
+			return
+		}
 		member := models.StudyRoomMember{
 			RoomID: room.ID,
 			UserID: payload.UserID,
@@ -442,7 +529,6 @@ func handleJoinStudyRoom(c *gin.Context) {
 			FirstOrCreate(&member).Error
 	}
 
-	online := studyHubRegistry.getHub(room.ID)
 	memberCount, _ := countStudyRoomMembers(db, room.ID)
 	response := buildStudyRoomListItem(&room, memberCount)
 	response.CurrentUsers = int(memberCount)
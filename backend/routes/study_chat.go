@@ -7,62 +7,293 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
 )
 
-func handleGetRoomChatHistory(c *gin.Context) {
-	roomIDParam := c.Param("roomId")
-	roomID, err := strconv.ParseUint(roomIDParam, 10, 64)
+const (
+	defaultChatPageSize = 100
+	maxChatPageSize     = 200
+	maxChatContextSize  = 50
+)
+
+// chatHistoryScope 房间聊天记录的读取范围，协作房间只读取当前协作会话的消息
+type chatHistoryScope struct {
+	roomID    uint64
+	sessionID uint64
+}
+
+func (s chatHistoryScope) query(db *gorm.DB) *gorm.DB {
+	query := db.Model(&models.ChatMessage{}).Where("room_id = ?", s.roomID)
+	if s.sessionID != 0 {
+		query = query.Where("session_id = ?", s.sessionID)
+	}
+	return query
+}
+
+// resolveChatHistoryScope 解析房间ID并校验团队聊天室的访问权限
+func resolveChatHistoryScope(c *gin.Context) (chatHistoryScope, bool) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
 	if err != nil || roomID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
-		return
+		return chatHistoryScope{}, false
 	}
-	limitParam := c.DefaultQuery("limit", "100")
-	limit, err := strconv.Atoi(limitParam)
-	if err != nil || limit <= 0 {
-		limit = 100
-	}
-	if limit > 200 {
-		limit = 200
-	}
-
 	db := database.GetDB()
-	session, hasCollaborationSession := getCollaborationSessionByRoom(db, roomID)
+	scope := chatHistoryScope{roomID: roomID}
+	if session, ok := getCollaborationSessionByRoom(db, roomID); ok {
+		scope.sessionID = session.ID
+	}
 	if teamRoom, hasTeamRoom := getTeamChatRoomByRoom(db, roomID); hasTeamRoom {
 		userID, ok := currentUserID(c)
 		if !ok || teamRoom.TeamID == nil || !canAccessTeam(db, *teamRoom.TeamID, userID) {
 			c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "无权限访问团队聊天室"})
-			return
+			return scope, false
 		}
 	}
-	var chats []models.ChatMessage
-	query := db.Where("room_id = ?", roomID)
-	if hasCollaborationSession {
-		query = query.Where("session_id = ?", session.ID)
+	return scope, true
+}
+
+func parseChatPageSize(raw string, def, max int) int {
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return def
 	}
-	if err := query.
-		Order("sent_at DESC").
-		Limit(limit).
-		Find(&chats).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取聊天记录失败"})
-		return
+	if limit > max {
+		return max
 	}
+	return limit
+}
 
+// buildChatMessageList 补齐发送者昵称与表情回应
+func buildChatMessageList(db *gorm.DB, chats []models.ChatMessage) ([]map[string]interface{}, error) {
 	userIDs := make([]uint64, 0, len(chats))
+	messageIDs := make([]uint64, 0, len(chats))
 	for _, msg := range chats {
 		userIDs = append(userIDs, msg.UserID)
+		messageIDs = append(messageIDs, msg.ID)
 	}
 	nameMap := loadUserNames(userIDs)
-
+	reactions, err := loadChatReactions(db, messageIDs)
+	if err != nil {
+		return nil, err
+	}
 	result := make([]map[string]interface{}, 0, len(chats))
 	for _, msg := range chats {
-		result = append(result, buildChatMessageResponse(msg, nameMap[msg.UserID]))
+		item := buildChatMessageResponse(msg, nameMap[msg.UserID])
+		item["reactions"] = reactionsOrEmpty(reactions[msg.ID])
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// chatPageCursors 返回一页消息（按ID倒序）两端的游标
+func chatPageCursors(chats []models.ChatMessage) gin.H {
+	cursors := gin.H{"before_id": nil, "after_id": nil}
+	if len(chats) > 0 {
+		cursors["before_id"] = chats[len(chats)-1].ID
+		cursors["after_id"] = chats[0].ID
+	}
+	return cursors
+}
+
+func reverseChatMessages(chats []models.ChatMessage) {
+	for i, j := 0, len(chats)-1; i < j; i, j = i+1, j-1 {
+		chats[i], chats[j] = chats[j], chats[i]
+	}
+}
+
+// handleGetRoomChatHistory 按消息ID游标分页：before_id 向更早翻页，after_id 拉取更新的消息，
+// 结果统一按ID倒序返回
+func handleGetRoomChatHistory(c *gin.Context) {
+	scope, ok := resolveChatHistoryScope(c)
+	if !ok {
+		return
+	}
+	limit := parseChatPageSize(c.Query("limit"), defaultChatPageSize, maxChatPageSize)
+	beforeID, _ := strconv.ParseUint(c.Query("before_id"), 10, 64)
+	afterID, _ := strconv.ParseUint(c.Query("after_id"), 10, 64)
+	if beforeID != 0 && afterID != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "before_id 与 after_id 不能同时使用"})
+		return
+	}
+
+	db := database.GetDB()
+	query := scope.query(db)
+	order := "id DESC"
+	switch {
+	case beforeID != 0:
+		query = query.Where("id < ?", beforeID)
+	case afterID != 0:
+		query = query.Where("id > ?", afterID)
+		order = "id ASC"
+	}
+	var chats []models.ChatMessage
+	if err := query.Order(order).Limit(limit + 1).Find(&chats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取聊天记录失败"})
+		return
+	}
+	hasMore := len(chats) > limit
+	if hasMore {
+		chats = chats[:limit]
+	}
+	if afterID != 0 {
+		reverseChatMessages(chats)
+	}
+
+	result, err := buildChatMessageList(db, chats)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取聊天记录失败"})
+		return
+	}
+	data := gin.H{
+		"messages": result,
+		"has_more": hasMore,
+		"cursors":  chatPageCursors(chats),
+	}
+	readerID, _ := currentUserID(c)
+	if readerID == 0 {
+		readerID, _ = strconv.ParseUint(c.Query("user_id"), 10, 64)
+	}
+	if readerID != 0 {
+		readState, err := loadChatReadState(db, scope.roomID, readerID, scope.sessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取聊天记录失败"})
+			return
+		}
+		data["read_state"] = readState
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": data,
+	})
+}
+
+// chatSearchEscape 转义 LIKE 通配符。使用 ! 作为转义符，MySQL 与 SQLite 对其处理一致，
+// 反斜杠在 MySQL 字符串字面量中本身需要转义，无法两边通用
+func chatSearchEscape(term string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(term)
+}
+
+// handleSearchRoomChat 在房间聊天记录中按关键字（空格分隔，需全部命中）与发送者检索，
+// 不区分大小写，支持 before_id 翻页
+func handleSearchRoomChat(c *gin.Context) {
+	scope, ok := resolveChatHistoryScope(c)
+	if !ok {
+		return
+	}
+	keyword := strings.TrimSpace(c.Query("q"))
+	senderID, _ := strconv.ParseUint(c.Query("sender_id"), 10, 64)
+	if keyword == "" && senderID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请输入关键字或发送者"})
+		return
+	}
+	terms := strings.Fields(keyword)
+	if len(terms) > 5 || len([]rune(keyword)) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "关键字过长"})
+		return
+	}
+	limit := parseChatPageSize(c.Query("limit"), 20, 100)
+	beforeID, _ := strconv.ParseUint(c.Query("before_id"), 10, 64)
+
+	db := database.GetDB()
+	query := scope.query(db).Where("msg_type <> ?", models.ChatMessageTypeKnowledgeCard)
+	for _, term := range terms {
+		query = query.Where("LOWER(content) LIKE ? ESCAPE '!'", "%"+chatSearchEscape(strings.ToLower(term))+"%")
+	}
+	if senderID != 0 {
+		query = query.Where("user_id = ? AND msg_type <> ?", senderID, models.ChatMessageTypeSystem)
+	}
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var chats []models.ChatMessage
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&chats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索聊天记录失败"})
+		return
+	}
+	hasMore := len(chats) > limit
+	if hasMore {
+		chats = chats[:limit]
+	}
+	result, err := buildChatMessageList(db, chats)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索聊天记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"messages": result,
+			"has_more": hasMore,
+			"cursors":  chatPageCursors(chats),
+		},
+	})
+}
+
+// handleGetRoomChatContext 返回目标消息前后若干条消息，用于从搜索结果跳转定位
+func handleGetRoomChatContext(c *gin.Context) {
+	scope, ok := resolveChatHistoryScope(c)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil || messageID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "消息ID不正确"})
+		return
+	}
+	before := parseChatPageSize(c.Query("before"), 10, maxChatContextSize)
+	after := parseChatPageSize(c.Query("after"), 10, maxChatContextSize)
+
+	db := database.GetDB()
+	var anchor models.ChatMessage
+	if err := scope.query(db).Where("id = ?", messageID).First(&anchor).Error; err != nil {
+		status, msg := http.StatusInternalServerError, "获取消息上下文失败"
+		if errorsIsNotFound(err) {
+			status, msg = http.StatusNotFound, "消息不存在"
+		}
+		c.JSON(status, gin.H{"code": status, "message": msg})
+		return
+	}
+
+	var older, newer []models.ChatMessage
+	if err := scope.query(db).Where("id < ?", anchor.ID).Order("id DESC").Limit(before + 1).Find(&older).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取消息上下文失败"})
+		return
+	}
+	if err := scope.query(db).Where("id > ?", anchor.ID).Order("id ASC").Limit(after + 1).Find(&newer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取消息上下文失败"})
+		return
+	}
+	hasMoreBefore := len(older) > before
+	if hasMoreBefore {
+		older = older[:before]
+	}
+	hasMoreAfter := len(newer) > after
+	if hasMoreAfter {
+		newer = newer[:after]
+	}
+	reverseChatMessages(newer)
+	chats := make([]models.ChatMessage, 0, len(newer)+1+len(older))
+	chats = append(chats, newer...)
+	chats = append(chats, anchor)
+	chats = append(chats, older...)
+
+	result, err := buildChatMessageList(db, chats)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取消息上下文失败"})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
-		"data": gin.H{"messages": result},
+		"data": gin.H{
+			"anchor_id":       anchor.ID,
+			"messages":        result,
+			"has_more_before": hasMoreBefore,
+			"has_more_after":  hasMoreAfter,
+			"cursors":         chatPageCursors(chats),
+		},
 	})
 }
 
@@ -94,6 +325,10 @@ func handlePostRoomChat(c *gin.Context) {
 	}
 
 	db := database.GetDB()
+	if until, muted := studyRoomMutedUntil(db, roomID, req.UserID, time.Now()); muted {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": mutedChatMessage(req.UserID, until)})
+		return
+	}
 	session, hasCollaborationSession := getCollaborationSessionByRoom(db, roomID)
 	sessionID := uint64(0)
 	if teamRoom, hasTeamRoom := getTeamChatRoomByRoom(db, roomID); hasTeamRoom {
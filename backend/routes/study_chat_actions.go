@@ -0,0 +1,436 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/achievement"
+)
+
+const maxChatReactionRunes = 8
+
+var (
+	errChatMessageNotFound    = errors.New("chat-message-not-found")
+	errChatMessageForbidden   = errors.New("chat-message-forbidden")
+	errChatMessageNotEditable = errors.New("chat-message-not-editable")
+	errChatMessageEmpty       = errors.New("chat-message-empty")
+	errChatUserMuted          = errors.New("chat-user-muted")
+	errInvalidChatReaction    = errors.New("invalid-chat-reaction")
+)
+
+// chatReactionSummary 同一表情的回应汇总
+type chatReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []uint64 `json:"user_ids"`
+}
+
+func registerStudyChatRoutes(rooms *gin.RouterGroup) {
+	rooms.GET("/:roomId/chat/history", handleGetRoomChatHistory)
+	rooms.GET("/:roomId/chat/search", handleSearchRoomChat)
+	rooms.GET("/:roomId/chat/:messageId/context", handleGetRoomChatContext)
+	rooms.POST("/:roomId/chat", handlePostRoomChat)
+	rooms.POST("/:roomId/chat/read", handleMarkRoomChatRead)
+	rooms.PUT("/:roomId/chat/:messageId", handleEditRoomChat)
+	rooms.DELETE("/:roomId/chat/:messageId", handleDeleteRoomChat)
+	rooms.POST("/:roomId/chat/:messageId/reactions", handleAddRoomChatReaction)
+	rooms.DELETE("/:roomId/chat/:messageId/reactions", handleRemoveRoomChatReaction)
+}
+
+func findRoomChatMessage(db *gorm.DB, roomID, messageID uint64) (models.ChatMessage, error) {
+	var msg models.ChatMessage
+	if err := db.Where("id = ? AND room_id = ?", messageID, roomID).First(&msg).Error; err != nil {
+		if errorsIsNotFound(err) {
+			return msg, errChatMessageNotFound
+		}
+		return msg, err
+	}
+	return msg, nil
+}
+
+// editChatMessage 修改自己发送的文本消息
+func editChatMessage(db *gorm.DB, roomID, messageID, userID uint64, content string) (models.ChatMessage, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return models.ChatMessage{}, errChatMessageEmpty
+	}
+	msg, err := findRoomChatMessage(db, roomID, messageID)
+	if err != nil {
+		return msg, err
+	}
+	if msg.UserID != userID {
+		return msg, errChatMessageForbidden
+	}
+	if msg.MsgType != models.ChatMessageTypeText {
+		return msg, errChatMessageNotEditable
+	}
+	if _, muted := studyRoomMutedUntil(db, roomID, userID, time.Now()); muted {
+		return msg, errChatUserMuted
+	}
+	now := time.Now()
+	if err := db.Model(&msg).Updates(map[string]interface{}{"content": content, "edited_at": now}).Error; err != nil {
+		return msg, err
+	}
+	msg.Content = content
+	msg.EditedAt = &now
+	return msg, nil
+}
+
+// deleteChatMessage 删除消息，发送者本人或房间管理员可操作
+func deleteChatMessage(db *gorm.DB, roomID, messageID, userID uint64) error {
+	msg, err := findRoomChatMessage(db, roomID, messageID)
+	if err != nil {
+		return err
+	}
+	if msg.UserID != userID {
+		var room models.StudyRoom
+		if err := db.First(&room, roomID).Error; err != nil || studyRoomRole(db, &room, userID) < models.StudyRoomRoleModerator {
+			return errChatMessageForbidden
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", msg.ID).Delete(&models.ChatMessageReaction{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&msg).Error
+	})
+}
+
+func normalizeChatReaction(raw string) (string, error) {
+	emoji := strings.TrimSpace(raw)
+	runes := []rune(emoji)
+	if len(runes) == 0 || len(runes) > maxChatReactionRunes {
+		return "", errInvalidChatReaction
+	}
+	for _, r := range runes {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return "", errInvalidChatReaction
+		}
+	}
+	return emoji, nil
+}
+
+// setChatReaction 添加或取消表情回应。同一用户对同一消息的同一表情只在首次添加时
+// 计入成就，取消后再添加会恢复原记录，避免反复点按刷点赞数。
+func setChatReaction(db *gorm.DB, roomID, messageID, userID uint64, rawEmoji string, add bool) ([]chatReactionSummary, error) {
+	emoji, err := normalizeChatReaction(rawEmoji)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := findRoomChatMessage(db, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.MsgType == models.ChatMessageTypeSystem {
+		return nil, errChatMessageNotEditable
+	}
+
+	firstReaction := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing models.ChatMessageReaction
+		findErr := tx.Unscoped().Where("message_id = ? AND user_id = ? AND emoji = ?", msg.ID, userID, emoji).First(&existing).Error
+		if findErr != nil && !errorsIsNotFound(findErr) {
+			return findErr
+		}
+		found := findErr == nil
+		switch {
+		case !add && found:
+			return tx.Delete(&existing).Error
+		case !add:
+			return nil
+		case !found:
+			firstReaction = true
+			return tx.Create(&models.ChatMessageReaction{MessageID: msg.ID, RoomID: roomID, UserID: userID, Emoji: emoji}).Error
+		case existing.DeletedAt.Valid:
+			return tx.Unscoped().Model(&existing).Update("deleted_at", nil).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if firstReaction && msg.UserID != userID {
+		recordChatReactionAchievements(userID, msg.UserID)
+	}
+	summaries, err := loadChatReactions(db, []uint64{msg.ID})
+	if err != nil {
+		return nil, err
+	}
+	return reactionsOrEmpty(summaries[msg.ID]), nil
+}
+
+func recordChatReactionAchievements(giverID, receiverID uint64) {
+	events := []achievement.Event{
+		{Type: achievement.EventStudyRoomReaction, UserID: giverID, Metadata: map[string]interface{}{"likes_given": 1}},
+		{Type: achievement.EventStudyRoomReaction, UserID: receiverID, Metadata: map[string]interface{}{"likes_received": 1}},
+	}
+	for _, evt := range events {
+		if err := achievement.ProcessEvent(evt); err != nil {
+			log.Printf("[StudyChat] record reaction achievement for user %d failed: %v", evt.UserID, err)
+		}
+	}
+}
+
+// loadChatReactions 按消息汇总表情回应，表情按首次出现顺序排列
+func loadChatReactions(db *gorm.DB, messageIDs []uint64) (map[uint64][]chatReactionSummary, error) {
+	result := make(map[uint64][]chatReactionSummary)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+	var reactions []models.ChatMessageReaction
+	if err := db.Where("message_id IN ?", messageIDs).Order("id ASC").Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+	for _, reaction := range reactions {
+		list := result[reaction.MessageID]
+		idx := -1
+		for i := range list {
+			if list[i].Emoji == reaction.Emoji {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			list = append(list, chatReactionSummary{Emoji: reaction.Emoji})
+			idx = len(list) - 1
+		}
+		list[idx].Count++
+		list[idx].UserIDs = append(list[idx].UserIDs, reaction.UserID)
+		result[reaction.MessageID] = list
+	}
+	return result, nil
+}
+
+func reactionsOrEmpty(list []chatReactionSummary) []chatReactionSummary {
+	if list == nil {
+		return []chatReactionSummary{}
+	}
+	return list
+}
+
+// markChatRead 推进用户的已读位置，已读位置只前进不后退
+func markChatRead(db *gorm.DB, roomID, userID, messageID uint64) (models.ChatReadCursor, error) {
+	cursor := models.ChatReadCursor{RoomID: roomID, UserID: userID}
+	if messageID == 0 {
+		var latest models.ChatMessage
+		if err := db.Where("room_id = ?", roomID).Order("id DESC").First(&latest).Error; err != nil && !errorsIsNotFound(err) {
+			return cursor, err
+		}
+		messageID = latest.ID
+	} else if _, err := findRoomChatMessage(db, roomID, messageID); err != nil {
+		return cursor, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("room_id = ? AND user_id = ?", roomID, userID).FirstOrCreate(&cursor).Error; err != nil {
+			return err
+		}
+		if messageID <= cursor.LastReadMessageID {
+			return nil
+		}
+		cursor.LastReadMessageID = messageID
+		cursor.ReadAt = time.Now()
+		return tx.Save(&cursor).Error
+	})
+	return cursor, err
+}
+
+// loadChatReadState 返回用户的已读位置、未读数量以及房间内其他成员的已读位置
+func loadChatReadState(db *gorm.DB, roomID, userID, sessionID uint64) (gin.H, error) {
+	var cursors []models.ChatReadCursor
+	if err := db.Where("room_id = ?", roomID).Find(&cursors).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(cursors, func(i, j int) bool { return cursors[i].UserID < cursors[j].UserID })
+
+	lastRead := uint64(0)
+	receipts := make([]gin.H, 0, len(cursors))
+	for _, cursor := range cursors {
+		if cursor.UserID == userID {
+			lastRead = cursor.LastReadMessageID
+			continue
+		}
+		receipts = append(receipts, gin.H{
+			"user_id":              cursor.UserID,
+			"last_read_message_id": cursor.LastReadMessageID,
+			"read_at":              cursor.ReadAt,
+		})
+	}
+
+	var unread int64
+	if userID != 0 {
+		query := db.Model(&models.ChatMessage{}).Where("room_id = ? AND id > ? AND user_id <> ?", roomID, lastRead, userID)
+		if sessionID != 0 {
+			query = query.Where("session_id = ?", sessionID)
+		}
+		if err := query.Count(&unread).Error; err != nil {
+			return nil, err
+		}
+	}
+	return gin.H{
+		"last_read_message_id": lastRead,
+		"unread_count":         unread,
+		"read_receipts":        receipts,
+	}, nil
+}
+
+func chatReadPayload(cursor models.ChatReadCursor) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":              cursor.UserID,
+		"last_read_message_id": cursor.LastReadMessageID,
+		"read_at":              cursor.ReadAt,
+	}
+}
+
+func chatActionErrorMessage(err error) (int, string) {
+	switch {
+	case errors.Is(err, errChatMessageNotFound):
+		return http.StatusNotFound, "消息不存在"
+	case errors.Is(err, errChatMessageForbidden):
+		return http.StatusForbidden, "只能操作自己发送的消息"
+	case errors.Is(err, errChatMessageNotEditable):
+		return http.StatusBadRequest, "该消息不支持此操作"
+	case errors.Is(err, errChatMessageEmpty):
+		return http.StatusBadRequest, "消息内容不能为空"
+	case errors.Is(err, errChatUserMuted):
+		return http.StatusForbidden, "你已被禁言"
+	case errors.Is(err, errInvalidChatReaction):
+		return http.StatusBadRequest, "表情不正确"
+	default:
+		return http.StatusInternalServerError, "操作失败"
+	}
+}
+
+func respondChatActionError(c *gin.Context, err error) {
+	status, msg := chatActionErrorMessage(err)
+	c.JSON(status, gin.H{"code": status, "message": msg})
+}
+
+// chatActionContext 解析房间、消息ID与操作用户。已登录时一律以登录身份操作，
+// 请求体或查询参数中的 user_id 仅用于兼容未登录的旧客户端
+func chatActionContext(c *gin.Context, bodyUserID uint64, needMessage bool) (uint64, uint64, uint64, bool) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return 0, 0, 0, false
+	}
+	var messageID uint64
+	if needMessage {
+		messageID, err = strconv.ParseUint(c.Param("messageId"), 10, 64)
+		if err != nil || messageID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "消息ID不正确"})
+			return 0, 0, 0, false
+		}
+	}
+	userID, authenticated := currentUserID(c)
+	if !authenticated {
+		userID = bodyUserID
+		if userID == 0 {
+			userID, _ = strconv.ParseUint(c.Query("user_id"), 10, 64)
+		}
+	}
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少用户ID"})
+		return 0, 0, 0, false
+	}
+	return roomID, messageID, userID, true
+}
+
+func handleEditRoomChat(c *gin.Context) {
+	var req struct {
+		UserID  uint64 `json:"user_id"`
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数格式不正确"})
+		return
+	}
+	roomID, messageID, userID, ok := chatActionContext(c, req.UserID, true)
+	if !ok {
+		return
+	}
+	msg, err := editChatMessage(database.GetDB(), roomID, messageID, userID, req.Content)
+	if err != nil {
+		respondChatActionError(c, err)
+		return
+	}
+	response := buildChatMessageResponse(msg, loadUserNames([]uint64{userID})[userID])
+	studyHubRegistry.getHub(roomID).broadcast(wsEnvelope{Type: "chat_edited", Data: mustMarshal(response)})
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"message": response}})
+}
+
+func handleDeleteRoomChat(c *gin.Context) {
+	roomID, messageID, userID, ok := chatActionContext(c, 0, true)
+	if !ok {
+		return
+	}
+	if err := deleteChatMessage(database.GetDB(), roomID, messageID, userID); err != nil {
+		respondChatActionError(c, err)
+		return
+	}
+	payload := map[string]uint64{"message_id": messageID, "deleted_by": userID}
+	studyHubRegistry.getHub(roomID).broadcast(wsEnvelope{Type: "chat_deleted", Data: mustMarshal(payload)})
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": payload})
+}
+
+func handleAddRoomChatReaction(c *gin.Context) {
+	handleSetRoomChatReaction(c, true)
+}
+
+func handleRemoveRoomChatReaction(c *gin.Context) {
+	handleSetRoomChatReaction(c, false)
+}
+
+func handleSetRoomChatReaction(c *gin.Context, add bool) {
+	var req struct {
+		UserID uint64 `json:"user_id"`
+		Emoji  string `json:"emoji"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	if req.Emoji == "" {
+		req.Emoji = c.Query("emoji")
+	}
+	roomID, messageID, userID, ok := chatActionContext(c, req.UserID, true)
+	if !ok {
+		return
+	}
+	reactions, err := setChatReaction(database.GetDB(), roomID, messageID, userID, req.Emoji, add)
+	if err != nil {
+		respondChatActionError(c, err)
+		return
+	}
+	payload := map[string]interface{}{"message_id": messageID, "reactions": reactions}
+	studyHubRegistry.getHub(roomID).broadcast(wsEnvelope{Type: "chat_reaction", Data: mustMarshal(payload)})
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": payload})
+}
+
+func handleMarkRoomChatRead(c *gin.Context) {
+	var req struct {
+		UserID    uint64 `json:"user_id"`
+		MessageID uint64 `json:"message_id"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	roomID, _, userID, ok := chatActionContext(c, req.UserID, false)
+	if !ok {
+		return
+	}
+	cursor, err := markChatRead(database.GetDB(), roomID, userID, req.MessageID)
+	if err != nil {
+		respondChatActionError(c, err)
+		return
+	}
+	studyHubRegistry.getHub(roomID).broadcast(wsEnvelope{Type: "chat_read", Data: mustMarshal(chatReadPayload(cursor))}, userID)
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": chatReadPayload(cursor)})
+}
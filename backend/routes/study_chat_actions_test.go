@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"learningAssistant-backend/models"
+)
+
+func TestRoomChatEditReactAndReadCursor(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	post := func(userID uint64, content string) uint64 {
+		w := serve(authRequest(http.MethodPost, "/api/study/rooms/7/chat", userID, map[string]string{"content": content}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("post chat: %d %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Data struct {
+				Message struct {
+					ID uint64 `json:"id"`
+				} `json:"message"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Data.Message.ID
+	}
+
+	first := post(1, "hello")
+	second := post(1, "typo")
+	post(2, "hi")
+
+	if w := serve(authRequest(http.MethodPut, "/api/study/rooms/7/chat/"+jsonNumber(second), 2, map[string]string{"content": "hijack"})); w.Code != http.StatusForbidden {
+		t.Fatalf("expected editing others' message to be forbidden, got %d", w.Code)
+	}
+	// 已登录时请求体中的 user_id 不能冒充他人
+	spoofed := map[string]interface{}{"user_id": 1, "content": "hijack"}
+	if w := serve(authRequest(http.MethodPut, "/api/study/rooms/7/chat/"+jsonNumber(second), 2, spoofed)); w.Code != http.StatusForbidden {
+		t.Fatalf("expected spoofed user_id to be ignored, got %d", w.Code)
+	}
+	if w := serve(authRequest(http.MethodPut, "/api/study/rooms/7/chat/"+jsonNumber(second), 1, map[string]string{"content": "fixed"})); w.Code != http.StatusOK {
+		t.Fatalf("edit: %d %s", w.Code, w.Body.String())
+	}
+
+	// 取消后重新添加同一表情不会重复计入成就
+	reactions := "/api/study/rooms/7/chat/" + jsonNumber(first) + "/reactions"
+	serve(authRequest(http.MethodPost, reactions, 2, map[string]string{"emoji": "👍"}))
+	serve(authRequest(http.MethodDelete, reactions+"?emoji="+url.QueryEscape("👍"), 2, nil))
+	if w := serve(authRequest(http.MethodPost, reactions, 2, map[string]string{"emoji": "👍"})); w.Code != http.StatusOK {
+		t.Fatalf("react: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(authRequest(http.MethodPost, reactions, 2, map[string]string{"emoji": "  "})); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected blank reaction to be rejected, got %d", w.Code)
+	}
+	var giver, receiver models.UserAchievementProgress
+	db.Where("user_id = ?", 2).First(&giver)
+	db.Where("user_id = ?", 1).First(&receiver)
+	if giver.StudyRoomLikesGiven != 1 || receiver.StudyRoomLikesReceived != 1 {
+		t.Fatalf("expected one like given/received, got %d/%d", giver.StudyRoomLikesGiven, receiver.StudyRoomLikesReceived)
+	}
+
+	if w := serve(authRequest(http.MethodDelete, "/api/study/rooms/7/chat/"+jsonNumber(first), 2, nil)); w.Code != http.StatusForbidden {
+		t.Fatalf("expected deleting others' message to be forbidden, got %d", w.Code)
+	}
+	serve(authRequest(http.MethodPost, "/api/study/rooms/7/chat/read", 2, map[string]uint64{"message_id": first}))
+
+	type historyBody struct {
+		Data struct {
+			Messages []struct {
+				ID        uint64  `json:"id"`
+				Content   string  `json:"content"`
+				EditedAt  *string `json:"edited_at"`
+				Reactions []struct {
+					Emoji string `json:"emoji"`
+					Count int    `json:"count"`
+				} `json:"reactions"`
+			} `json:"messages"`
+			ReadState struct {
+				LastReadMessageID uint64 `json:"last_read_message_id"`
+				UnreadCount       int    `json:"unread_count"`
+			} `json:"read_state"`
+		} `json:"data"`
+	}
+	var history historyBody
+	_ = json.Unmarshal(serve(authRequest(http.MethodGet, "/api/study/rooms/7/chat/history", 2, nil)).Body.Bytes(), &history)
+	if history.Data.ReadState.LastReadMessageID != first || history.Data.ReadState.UnreadCount != 1 {
+		t.Fatalf("expected one unread message after first, got %+v", history.Data.ReadState)
+	}
+	for _, msg := range history.Data.Messages {
+		switch msg.ID {
+		case first:
+			if len(msg.Reactions) != 1 || msg.Reactions[0].Count != 1 {
+				t.Fatalf("expected a single 👍 reaction, got %+v", msg.Reactions)
+			}
+		case second:
+			if msg.Content != "fixed" || msg.EditedAt == nil {
+				t.Fatalf("expected edited message, got %+v", msg)
+			}
+		}
+	}
+
+	if w := serve(authRequest(http.MethodDelete, "/api/study/rooms/7/chat/"+jsonNumber(second), 1, nil)); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	serve(authRequest(http.MethodPost, "/api/study/rooms/7/chat/read", 2, nil))
+	history = historyBody{}
+	_ = json.Unmarshal(serve(authRequest(http.MethodGet, "/api/study/rooms/7/chat/history", 2, nil)).Body.Bytes(), &history)
+	if len(history.Data.Messages) != 2 || history.Data.ReadState.UnreadCount != 0 {
+		t.Fatalf("expected deleted message hidden and nothing unread, got %d messages, %+v", len(history.Data.Messages), history.Data.ReadState)
+	}
+}
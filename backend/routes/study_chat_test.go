@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"learningAssistant-backend/models"
+)
+
+type chatPageBody struct {
+	Data struct {
+		AnchorID      uint64 `json:"anchor_id"`
+		HasMore       bool   `json:"has_more"`
+		HasMoreBefore bool   `json:"has_more_before"`
+		HasMoreAfter  bool   `json:"has_more_after"`
+		Messages      []struct {
+			ID      uint64 `json:"id"`
+			Content string `json:"content"`
+		} `json:"messages"`
+		Cursors struct {
+			BeforeID uint64 `json:"before_id"`
+			AfterID  uint64 `json:"after_id"`
+		} `json:"cursors"`
+	} `json:"data"`
+}
+
+func (b chatPageBody) contents() []string {
+	out := make([]string, 0, len(b.Data.Messages))
+	for _, msg := range b.Data.Messages {
+		out = append(out, msg.Content)
+	}
+	return out
+}
+
+func TestRoomChatHistoryCursorsSearchAndContext(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	get := func(path string) chatPageBody {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, authRequest(http.MethodGet, path, 1, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, w.Code, w.Body.String())
+		}
+		var body chatPageBody
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return body
+	}
+
+	ids := make([]uint64, 0, 10)
+	for i := 0; i < 10; i++ {
+		content := "note " + strconv.Itoa(i)
+		sender := uint64(1)
+		switch i {
+		case 3:
+			content = "Exam on Friday, 100% prep"
+		case 6:
+			content = "exam_room changed"
+			sender = 2
+		}
+		msg := models.ChatMessage{RoomID: 5, UserID: sender, Content: content}
+		db.Create(&msg)
+		ids = append(ids, msg.ID)
+	}
+
+	// 向前翻页直到取完
+	var seen []string
+	page := get("/api/study/rooms/5/chat/history?limit=4")
+	seen = append(seen, page.contents()...)
+	for page.Data.HasMore {
+		page = get("/api/study/rooms/5/chat/history?limit=4&before_id=" + jsonNumber(page.Data.Cursors.BeforeID))
+		seen = append(seen, page.contents()...)
+	}
+	if len(seen) != 10 || seen[0] != "note 9" || seen[9] != "note 0" {
+		t.Fatalf("expected all messages newest first, got %v", seen)
+	}
+	newer := get("/api/study/rooms/5/chat/history?limit=2&after_id=" + jsonNumber(ids[6]))
+	if got := newer.contents(); len(got) != 2 || got[0] != "note 8" || got[1] != "note 7" || !newer.Data.HasMore {
+		t.Fatalf("unexpected after_id page %v has_more=%v", got, newer.Data.HasMore)
+	}
+
+	// 关键字不区分大小写，通配符按字面匹配
+	if got := get("/api/study/rooms/5/chat/search?q=" + url.QueryEscape("EXAM")).contents(); len(got) != 2 {
+		t.Fatalf("expected two exam messages, got %v", got)
+	}
+	if got := get("/api/study/rooms/5/chat/search?q=" + url.QueryEscape("100%")).contents(); len(got) != 1 || got[0] != "Exam on Friday, 100% prep" {
+		t.Fatalf("expected literal percent match, got %v", got)
+	}
+	if got := get("/api/study/rooms/5/chat/search?q=" + url.QueryEscape("exa_")).contents(); len(got) != 0 {
+		t.Fatalf("underscore must not act as a wildcard, got %v", got)
+	}
+	if got := get("/api/study/rooms/5/chat/search?q=exam&sender_id=2").contents(); len(got) != 1 || got[0] != "exam_room changed" {
+		t.Fatalf("expected sender filter to apply, got %v", got)
+	}
+
+	ctx := get("/api/study/rooms/5/chat/" + jsonNumber(ids[3]) + "/context?before=2&after=1")
+	if got := ctx.contents(); len(got) != 4 || got[0] != "note 4" || got[3] != "note 1" {
+		t.Fatalf("unexpected context window %v", got)
+	}
+	if ctx.Data.AnchorID != ids[3] || !ctx.Data.HasMoreBefore || !ctx.Data.HasMoreAfter {
+		t.Fatalf("unexpected context flags %+v", ctx.Data)
+	}
+}
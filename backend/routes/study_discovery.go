@@ -0,0 +1,388 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/planner"
+	"learningAssistant-backend/services/usertime"
+)
+
+const (
+	studyRoomDefaultPageSize = 20
+	studyRoomMaxPageSize     = 100
+	// 内存排序前最多加载的房间数
+	studyRoomScanLimit = 500
+
+	roomActivityLookbackDays = 28
+	recommendedRoomLimit     = 10
+)
+
+// studyRoomActivity 房间的实时在线人数与最近活跃时间
+type studyRoomActivity struct {
+	Online       int
+	LastActiveAt *time.Time
+}
+
+// onlineByRoom 各房间在所有实例上的在线人数，一次批量读取；Backplane 不可用时只统计本机
+func (m *studyHubStore) onlineByRoom() map[uint64]int {
+	counts := make(map[uint64]int)
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	rooms, err := loadAllHubPresence(ctx, m.backplane())
+	if err != nil {
+		for _, hub := range m.localHubs() {
+			if online := len(hub.localPresence()); online > 0 {
+				counts[hub.roomID] = online
+			}
+		}
+		return counts
+	}
+	for roomID, members := range rooms {
+		counts[roomID] = len(members)
+	}
+	return counts
+}
+
+// appendLiveStudyRooms 在按创建时间截取的房间之外，补上当前有人在线且满足筛选条件的房间，
+// 让正在活跃的老房间也能参与排序
+func appendLiveStudyRooms(query *gorm.DB, rooms []models.StudyRoom) ([]models.StudyRoom, error) {
+	seen := make(map[uint64]bool, len(rooms))
+	for i := range rooms {
+		seen[rooms[i].ID] = true
+	}
+	live := make([]uint64, 0)
+	for roomID, online := range studyHubRegistry.onlineByRoom() {
+		if online > 0 && !seen[roomID] {
+			live = append(live, roomID)
+		}
+	}
+	if len(live) == 0 {
+		return rooms, nil
+	}
+	var extra []models.StudyRoom
+	if err := query.Session(&gorm.Session{}).Where("id IN ?", live).Find(&extra).Error; err != nil {
+		return nil, err
+	}
+	return append(rooms, extra...), nil
+}
+
+// loadStudyRoomActivity 汇总在线人数，以及最近一次开课、聊天或进入房间的时间
+func loadStudyRoomActivity(db *gorm.DB, rooms []models.StudyRoom) map[uint64]*studyRoomActivity {
+	activity := make(map[uint64]*studyRoomActivity, len(rooms))
+	ids := make([]uint64, 0, len(rooms))
+	notes := make([]string, 0, len(rooms))
+	for i := range rooms {
+		room := &rooms[i]
+		entry := &studyRoomActivity{}
+		if room.LastSessionStarted != nil {
+			t := *room.LastSessionStarted
+			entry.LastActiveAt = &t
+		}
+		activity[room.ID] = entry
+		ids = append(ids, room.ID)
+		notes = append(notes, fmt.Sprintf("room:%d", room.ID))
+	}
+	if len(ids) == 0 {
+		return activity
+	}
+	for roomID, online := range studyHubRegistry.onlineByRoom() {
+		if entry, ok := activity[roomID]; ok {
+			entry.Online = online
+		}
+	}
+
+	bump := func(roomID uint64, at time.Time) {
+		entry, ok := activity[roomID]
+		if !ok || at.IsZero() {
+			return
+		}
+		if entry.LastActiveAt == nil || at.After(*entry.LastActiveAt) {
+			t := at
+			entry.LastActiveAt = &t
+		}
+	}
+	// 取每个房间最新一条记录（按自增 ID），避免不同驱动对 MAX(时间) 的扫描差异
+	var chats []models.ChatMessage
+	if err := db.Select("room_id", "sent_at").
+		Where("id IN (?)", db.Model(&models.ChatMessage{}).Select("MAX(id)").Where("room_id IN ?", ids).Group("room_id")).
+		Find(&chats).Error; err == nil {
+		for _, msg := range chats {
+			bump(msg.RoomID, msg.SentAt)
+		}
+	}
+	var visits []models.LearningRecord
+	if err := db.Select("note", "session_start").
+		Where("id IN (?)", db.Model(&models.LearningRecord{}).Select("MAX(id)").Where("note IN ?", notes).Group("note")).
+		Find(&visits).Error; err == nil {
+		for _, record := range visits {
+			if roomID, ok := parseRoomRecordNote(record.Note); ok {
+				bump(roomID, record.SessionStart)
+			}
+		}
+	}
+	return activity
+}
+
+// parseRoomRecordNote 解析自习室学习记录的备注 "room:<id>"
+func parseRoomRecordNote(note string) (uint64, bool) {
+	if !strings.HasPrefix(note, "room:") {
+		return 0, false
+	}
+	roomID, err := strconv.ParseUint(strings.TrimPrefix(note, "room:"), 10, 64)
+	return roomID, err == nil && roomID > 0
+}
+
+func studyRoomListItemWithActivity(room *models.StudyRoom, memberCount int64, activity *studyRoomActivity) studyRoomListItem {
+	item := buildStudyRoomListItem(room, memberCount)
+	if activity != nil {
+		item.OnlineUsers = activity.Online
+		if activity.LastActiveAt != nil {
+			formatted := activity.LastActiveAt.Format(time.RFC3339)
+			item.LastActiveAt = &formatted
+		}
+	}
+	return item
+}
+
+func lastActiveUnix(activity *studyRoomActivity) int64 {
+	if activity == nil || activity.LastActiveAt == nil {
+		return 0
+	}
+	return activity.LastActiveAt.Unix()
+}
+
+// sortStudyRooms 按在线人数、最近活跃或创建时间排序，创建时间为最终的并列规则
+func sortStudyRooms(rooms []models.StudyRoom, activity map[uint64]*studyRoomActivity, sortBy string) {
+	sort.SliceStable(rooms, func(i, j int) bool {
+		a, b := activity[rooms[i].ID], activity[rooms[j].ID]
+		switch sortBy {
+		case "online":
+			if a.Online != b.Online {
+				return a.Online > b.Online
+			}
+			if lastActiveUnix(a) != lastActiveUnix(b) {
+				return lastActiveUnix(a) > lastActiveUnix(b)
+			}
+		case "active":
+			if lastActiveUnix(a) != lastActiveUnix(b) {
+				return lastActiveUnix(a) > lastActiveUnix(b)
+			}
+		}
+		return rooms[i].CreatedAt.After(rooms[j].CreatedAt)
+	})
+}
+
+// loadInterestProfile 用户知识库中的分类与标签权重，仍在学习的条目权重更高
+func loadInterestProfile(db *gorm.DB, userID uint64) (map[string]float64, error) {
+	var entries []models.KnowledgeBaseEntry
+	if err := db.Select("category", "sub_category", "tags", "level").
+		Where("user_id = ? AND status <> ?", userID, 2).
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	weights := make(map[string]float64)
+	add := func(term string, weight float64) {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term != "" {
+			weights[term] += weight
+		}
+	}
+	for _, entry := range entries {
+		weight := 2.0
+		if entry.Level >= 4 {
+			weight = 1.0
+		}
+		add(entry.Category, weight)
+		add(entry.SubCategory, weight/2)
+		var tags []string
+		if len(entry.Tags) > 0 && json.Unmarshal(entry.Tags, &tags) == nil {
+			for _, tag := range tags {
+				add(tag, weight/2)
+			}
+		}
+	}
+	return weights, nil
+}
+
+// loadRoomPeriodShare 近 28 天各房间进入记录落在指定时段（按用户时区）的比例，
+// 在数据库中按房间汇总总次数与落在各天该时段窗口内的次数
+func loadRoomPeriodShare(db *gorm.DB, roomIDs []uint64, period planner.Period, loc *time.Location, now time.Time) map[uint64]float64 {
+	share := make(map[uint64]float64, len(roomIDs))
+	if len(roomIDs) == 0 || period == "" {
+		return share
+	}
+	notes := make([]string, 0, len(roomIDs))
+	for _, id := range roomIDs {
+		notes = append(notes, fmt.Sprintf("room:%d", id))
+	}
+	since := now.AddDate(0, 0, -roomActivityLookbackDays)
+
+	// 每天的时段窗口拼成 OR 条件，时区与夏令时换算在这里完成，SQL 只做区间比较
+	var windows *gorm.DB
+	for day := usertime.StartOfDay(since, loc); day.Before(now); day = usertime.AddDays(day, 1) {
+		start, end, ok := planner.PeriodBounds(period, day)
+		if !ok {
+			return share
+		}
+		if windows == nil {
+			windows = db.Where("session_start >= ? AND session_start < ?", start, end)
+		} else {
+			windows = windows.Or("session_start >= ? AND session_start < ?", start, end)
+		}
+	}
+	if windows == nil {
+		return share
+	}
+
+	type noteCount struct {
+		Note  string
+		Count int
+	}
+	var totals, matched []noteCount
+	base := func() *gorm.DB {
+		return db.Model(&models.LearningRecord{}).Select("note, COUNT(*) AS count").
+			Where("note IN ? AND session_start >= ?", notes, since).Group("note")
+	}
+	if err := base().Scan(&totals).Error; err != nil {
+		return share
+	}
+	if err := base().Where(windows).Scan(&matched).Error; err != nil {
+		return share
+	}
+	matchedByNote := make(map[string]int, len(matched))
+	for _, row := range matched {
+		matchedByNote[row.Note] = row.Count
+	}
+	for _, row := range totals {
+		if roomID, ok := parseRoomRecordNote(row.Note); ok && row.Count > 0 {
+			share[roomID] = float64(matchedByNote[row.Note]) / float64(row.Count)
+		}
+	}
+	return share
+}
+
+func handleRecommendedStudyRooms(c *gin.Context) {
+	userID := resolveStudyActor(c, 0)
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少用户ID"})
+		return
+	}
+	db := database.GetDB()
+	now := time.Now()
+
+	var rooms []models.StudyRoom
+	if err := db.Where("(room_kind = '' OR room_kind = ? OR room_kind IS NULL) AND is_private = ?", "study", false).
+		Where("id NOT IN (?)", db.Model(&models.StudyRoomBan{}).Select("room_id").
+			Where("user_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, now)).
+		Order("created_at DESC").
+		Limit(studyRoomScanLimit).
+		Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取推荐房间失败"})
+		return
+	}
+	interests, err := loadInterestProfile(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载知识偏好失败"})
+		return
+	}
+	preferred := planner.PeriodEvening
+	var setting models.UserSetting
+	if err := db.Where("user_id = ?", userID).First(&setting).Error; err == nil && setting.PreferredPeriod != "" {
+		preferred = planner.Period(strings.ToLower(setting.PreferredPeriod))
+	}
+	roomIDs := make([]uint64, 0, len(rooms))
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+	periodShare := loadRoomPeriodShare(db, roomIDs, preferred, usertime.ForUser(userID), now)
+	activity := loadStudyRoomActivity(db, rooms)
+	memberCounts, _ := loadStudyRoomMemberCounts(db)
+
+	var joined []uint64
+	db.Model(&models.StudyRoomMember{}).Where("user_id = ?", userID).Pluck("room_id", &joined)
+
+	maxInterest := 0.0
+	for _, weight := range interests {
+		maxInterest = math.Max(maxInterest, weight)
+	}
+
+	type scoredRoom struct {
+		item        studyRoomListItem
+		score       float64
+		matchedTags []string
+		periodShare float64
+	}
+	scored := make([]scoredRoom, 0, len(rooms))
+	for i := range rooms {
+		room := &rooms[i]
+		if room.MaxMembers > 0 && activity[room.ID].Online >= room.MaxMembers {
+			continue
+		}
+		tagScore := 0.0
+		matched := make([]string, 0)
+		for _, tag := range parseStudyRoomTags(room.Tags) {
+			if weight, ok := interests[strings.ToLower(tag)]; ok {
+				tagScore += weight / maxInterest
+				matched = append(matched, tag)
+			}
+		}
+		if len(matched) == 0 && maxInterest > 0 {
+			// 房间未打标签时，名称包含用户常学的分类也算弱匹配
+			name := strings.ToLower(room.Name)
+			for term, weight := range interests {
+				if len([]rune(term)) >= 2 && strings.Contains(name, term) {
+					tagScore = math.Max(tagScore, weight/maxInterest/2)
+				}
+			}
+		}
+		online := activity[room.ID].Online
+		score := 3*tagScore + 1.5*periodShare[room.ID] + 0.5*math.Min(float64(online), 10)/10
+		if recent := lastActiveUnix(activity[room.ID]); recent > 0 && now.Sub(time.Unix(recent, 0)) < 24*time.Hour {
+			score += 0.25
+		}
+		if containsUint64(joined, room.ID) {
+			score -= 0.5
+		}
+		scored = append(scored, scoredRoom{
+			item:        studyRoomListItemWithActivity(room, memberCounts[room.ID], activity[room.ID]),
+			score:       score,
+			matchedTags: matched,
+			periodShare: periodShare[room.ID],
+		})
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	if len(scored) > recommendedRoomLimit {
+		scored = scored[:recommendedRoomLimit]
+	}
+
+	items := make([]gin.H, 0, len(scored))
+	for _, s := range scored {
+		items = append(items, gin.H{
+			"room":         s.item,
+			"score":        math.Round(s.score*100) / 100,
+			"matched_tags": s.matchedTags,
+			"period_share": math.Round(s.periodShare*100) / 100,
+			"joined":       containsUint64(joined, s.item.ID),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"rooms":            items,
+			"preferred_period": preferred,
+		},
+	})
+}
@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+)
+
+func TestStudyRoomSearchSortAndRecommendations(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type listResponse struct {
+		Data struct {
+			Rooms []struct {
+				ID           uint64  `json:"id"`
+				Name         string  `json:"name"`
+				LastActiveAt *string `json:"last_active_at"`
+			} `json:"rooms"`
+			Total int64 `json:"total"`
+		} `json:"data"`
+	}
+	list := func(query string) listResponse {
+		t.Helper()
+		w := serve(authRequest(http.MethodGet, "/api/study/rooms"+query, 1, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %s: %d %s", query, w.Code, w.Body.String())
+		}
+		var resp listResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	now := time.Now()
+	golang := models.StudyRoom{Name: "Go 夜读", Tags: "golang,后端", OwnerUserID: 9, RoomKind: "study"}
+	math := models.StudyRoom{Name: "高数刷题", Tags: "数学,go", OwnerUserID: 9, RoomKind: "study"}
+	quiet := models.StudyRoom{Name: "安静自习", OwnerUserID: 9, RoomKind: "study"}
+	secret := models.StudyRoom{Name: "私密 golang", Tags: "golang", OwnerUserID: 9, RoomKind: "study", IsPrivate: true}
+	task := models.StudyRoom{Name: "任务协作 golang", OwnerUserID: 9, RoomKind: "task_collaboration"}
+	for _, room := range []*models.StudyRoom{&golang, &math, &quiet, &secret, &task} {
+		db.Create(room)
+	}
+
+	if resp := list("?q=GOLANG"); resp.Data.Total != 2 {
+		t.Fatalf("expected case-insensitive keyword search over study rooms only, got %+v", resp.Data)
+	}
+	if resp := list("?tag=go"); resp.Data.Total != 1 || resp.Data.Rooms[0].ID != math.ID {
+		t.Fatalf("tag filter must match whole tags, got %+v", resp.Data)
+	}
+	if resp := list("?kind=task_collaboration"); resp.Data.Total != 1 || resp.Data.Rooms[0].ID != task.ID {
+		t.Fatalf("expected kind filter, got %+v", resp.Data)
+	}
+
+	// 高数房间最近有人聊天，Go 房间三天前有人进入
+	db.Create(&models.ChatMessage{RoomID: math.ID, UserID: 2, Content: "早", SentAt: now.Add(-time.Hour)})
+	db.Create(&models.LearningRecord{UserID: 3, Note: "room:" + jsonNumber(golang.ID), SessionStart: now.AddDate(0, 0, -3)})
+	resp := list("?sort=active&page=1&page_size=2")
+	if resp.Data.Total != 4 || len(resp.Data.Rooms) != 2 || resp.Data.Rooms[0].ID != math.ID || resp.Data.Rooms[1].ID != golang.ID {
+		t.Fatalf("unexpected active ordering: %+v", resp.Data)
+	}
+	if resp.Data.Rooms[0].LastActiveAt == nil {
+		t.Fatalf("expected last_active_at on active room")
+	}
+	if page2 := list("?sort=active&page=2&page_size=2"); len(page2.Data.Rooms) != 2 {
+		t.Fatalf("expected second page, got %+v", page2.Data)
+	}
+
+	// 用户1在学 Go，偏好晚上学习；Go 房间的活跃时段也在晚上
+	tags, _ := json.Marshal([]string{"golang"})
+	db.Create(&models.KnowledgeBaseEntry{UserID: 1, Title: "channel", Category: "编程", Tags: datatypes.JSON(tags), Level: 2, Status: 1})
+	db.Create(&models.UserSetting{UserID: 1, PreferredPeriod: "evening", Timezone: "UTC"})
+	evening := time.Date(now.Year(), now.Month(), now.Day(), 20, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	db.Create(&models.LearningRecord{UserID: 4, Note: "room:" + jsonNumber(golang.ID), SessionStart: evening})
+	db.Create(&models.LearningRecord{UserID: 4, Note: "room:" + jsonNumber(quiet.ID), SessionStart: evening.Add(-12 * time.Hour)})
+	db.Create(&models.StudyRoomBan{RoomID: math.ID, UserID: 1, BannedBy: 9})
+
+	w := serve(authRequest(http.MethodGet, "/api/study/rooms/recommended", 1, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("recommended: %d %s", w.Code, w.Body.String())
+	}
+	var rec struct {
+		Data struct {
+			Rooms []struct {
+				Room struct {
+					ID uint64 `json:"id"`
+				} `json:"room"`
+				MatchedTags []string `json:"matched_tags"`
+			} `json:"rooms"`
+			PreferredPeriod string `json:"preferred_period"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &rec)
+	if len(rec.Data.Rooms) == 0 || rec.Data.Rooms[0].Room.ID != golang.ID || len(rec.Data.Rooms[0].MatchedTags) != 1 {
+		t.Fatalf("expected Go room recommended first, got %s", w.Body.String())
+	}
+	for _, item := range rec.Data.Rooms {
+		if item.Room.ID == math.ID || item.Room.ID == secret.ID || item.Room.ID == task.ID {
+			t.Fatalf("banned, private or non-study room recommended: %s", w.Body.String())
+		}
+	}
+	if rec.Data.PreferredPeriod != "evening" {
+		t.Fatalf("unexpected preferred period %q", rec.Data.PreferredPeriod)
+	}
+}
+
+func TestRoomPeriodShareUsesViewerTimezone(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, loc)
+	at := func(daysAgo, hour int) time.Time {
+		return time.Date(2026, 3, 20-daysAgo, hour, 30, 0, 0, loc)
+	}
+	records := []models.LearningRecord{
+		{UserID: 1, Note: "room:1", SessionStart: at(1, 20)},  // 上海晚上，计入
+		{UserID: 2, Note: "room:1", SessionStart: at(2, 21)},  // 上海晚上，计入
+		{UserID: 3, Note: "room:1", SessionStart: at(3, 9)},   // 上海上午
+		{UserID: 4, Note: "room:1", SessionStart: at(40, 20)}, // 超出统计范围
+		{UserID: 1, Note: "room:2", SessionStart: at(1, 4)},   // UTC 为前一天晚上，上海是凌晨，不计入
+		{UserID: 1, Note: "room:3", SessionStart: at(1, 12)},
+	}
+	for i := range records {
+		db.Create(&records[i])
+	}
+
+	share := loadRoomPeriodShare(db, []uint64{1, 2, 3, 4}, "evening", loc, now)
+	if len(share) != 3 || share[1] < 0.66 || share[1] > 0.67 || share[2] != 0 || share[3] != 0 {
+		t.Fatalf("unexpected period share %v", share)
+	}
+}
+
+func TestStudyRoomListTotalMatchesSortedScan(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	previous := studyHubRegistry
+	bp := backplane.NewMemory()
+	studyHubRegistry = newStudyHubStore(bp)
+	t.Cleanup(func() { studyHubRegistry = previous })
+
+	rooms := make([]models.StudyRoom, 0, studyRoomScanLimit+5)
+	for i := 0; i < studyRoomScanLimit+5; i++ {
+		rooms = append(rooms, models.StudyRoom{Name: "自习室", OwnerUserID: 9, RoomKind: "study", BaseModel: models.BaseModel{CreatedAt: time.Now().Add(time.Duration(i-studyRoomScanLimit-5) * time.Minute)}})
+	}
+	db.CreateInBatches(&rooms, 100)
+	// 最早创建的房间不在最近 500 个之内，但当前有人在线，仍要参与按在线人数排序
+	oldest := rooms[0].ID
+	presence := hubPresence{wsMemberState: wsMemberState{UserID: 7}, Instance: "other", ConnID: "c1", JoinedAt: time.Now(), SeenAt: time.Now()}
+	if err := bp.SetMember(context.Background(), oldest, 7, mustMarshal(presence)); err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+
+	for query, want := range map[string]int64{"?sort=newest": studyRoomScanLimit + 5, "?sort=online": studyRoomScanLimit + 1, "?sort=active": studyRoomScanLimit + 1} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, authRequest(http.MethodGet, "/api/study/rooms"+query, 1, nil))
+		var resp struct {
+			Data struct {
+				Rooms []struct {
+					ID uint64 `json:"id"`
+				} `json:"rooms"`
+				Total int64 `json:"total"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || resp.Data.Total != want {
+			t.Fatalf("%s: expected total %d, got %d (%d)", query, want, resp.Data.Total, w.Code)
+		}
+		if query == "?sort=online" && (len(resp.Data.Rooms) == 0 || resp.Data.Rooms[0].ID != oldest) {
+			t.Fatalf("expected the old but busy room ranked first, got %+v", resp.Data.Rooms)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/collabdoc"
+	"learningAssistant-backend/services/usertime"
+)
+
+func registerStudyDocumentRoutes(rooms *gin.RouterGroup) {
+	rooms.GET("/:roomId/document", handleGetStudyDocument)
+	rooms.POST("/:roomId/document/save", handleSaveStudyDocument)
+}
+
+func studyDocumentErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, collabdoc.ErrInvalidOp), errors.Is(err, collabdoc.ErrLengthMismatch):
+		return "编辑内容与文档版本不一致，请重新同步"
+	case errors.Is(err, collabdoc.ErrVersionAhead), errors.Is(err, collabdoc.ErrHistoryPruned):
+		return "文档版本已过期，请重新同步"
+	case errors.Is(err, collabdoc.ErrContentTooLong):
+		return "共享文档不能超过50000个字符"
+	default:
+		return "保存编辑失败"
+	}
+}
+
+// sendDocumentSnapshot 向单个连接推送文档快照，用于新加入或需要重新同步的成员
+func (h *studyRoomHub) sendDocumentSnapshot(client *studyClient) {
+	snapshot, err := collabdoc.Load(h.roomID)
+	if err != nil {
+		client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "加载共享文档失败"})})
+		return
+	}
+	client.enqueue(wsEnvelope{Type: "doc_snapshot", Data: mustMarshal(snapshot)})
+}
+
+// handleDocumentEvent 处理共享文档的同步与编辑。编辑经服务端变换后广播给所有人，
+// 发送者据 client_op_id 识别自己的确认
+func (h *studyRoomHub) handleDocumentEvent(client *studyClient, env wsEnvelope) {
+	switch env.Type {
+	case "doc_sync":
+		var payload struct {
+			SinceVersion int64 `json:"since_version"`
+		}
+		_ = json.Unmarshal(env.Data, &payload)
+		if payload.SinceVersion > 0 {
+			if changes, err := collabdoc.ChangesSince(h.roomID, payload.SinceVersion); err == nil {
+				client.enqueue(wsEnvelope{Type: "doc_changes", Data: mustMarshal(map[string]interface{}{"changes": changes})})
+				return
+			}
+		}
+		h.sendDocumentSnapshot(client)
+
+	case "doc_op":
+		var payload struct {
+			Version    int64        `json:"version"`
+			Op         collabdoc.Op `json:"op"`
+			ClientOpID string       `json:"client_op_id"`
+		}
+		if err := json.Unmarshal(env.Data, &payload); err != nil {
+			client.enqueue(wsEnvelope{Type: "doc_rejected", Data: mustMarshal(map[string]string{"message": studyDocumentErrorMessage(collabdoc.ErrInvalidOp)})})
+			return
+		}
+		if until, muted := studyRoomMutedUntil(database.GetDB(), h.roomID, client.userID, time.Now()); muted {
+			client.enqueue(wsEnvelope{Type: "doc_rejected", Data: mustMarshal(map[string]string{"client_op_id": payload.ClientOpID, "message": mutedChatMessage(client.userID, until)})})
+			return
+		}
+		change, err := collabdoc.Submit(h.roomID, client.userID, payload.Version, payload.Op, time.Now())
+		if err != nil {
+			client.enqueue(wsEnvelope{Type: "doc_rejected", Data: mustMarshal(map[string]string{"client_op_id": payload.ClientOpID, "message": studyDocumentErrorMessage(err)})})
+			// 被拒绝的客户端丢弃本地未确认的编辑，以最新快照为准
+			h.sendDocumentSnapshot(client)
+			return
+		}
+		h.broadcast(wsEnvelope{Type: "doc_op", Data: mustMarshal(map[string]interface{}{
+			"version":      change.Version,
+			"user_id":      change.UserID,
+			"display_name": client.displayName,
+			"op":           change.Op,
+			"client_op_id": payload.ClientOpID,
+		})})
+	}
+}
+
+func handleGetStudyDocument(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return
+	}
+	snapshot, err := collabdoc.Load(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载共享文档失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": snapshot})
+}
+
+// studyDocumentParticipants 参与者为编辑过文档的用户与当前在线成员
+func studyDocumentParticipants(roomID uint64) ([]uint64, error) {
+	contributors, err := collabdoc.Contributors(roomID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint64]bool, len(contributors))
+	participants := make([]uint64, 0, len(contributors))
+	for _, id := range contributors {
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	for id := range studyHubRegistry.getHub(roomID).presence(ctx) {
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i] < participants[j] })
+	return participants, nil
+}
+
+// handleSaveStudyDocument 将共享文档的当前内容保存为每位参与者的学习笔记
+func handleSaveStudyDocument(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return
+	}
+	var req struct {
+		UserID uint64 `json:"user_id"`
+		Title  string `json:"title"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	userID := resolveStudyActor(c, req.UserID)
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少用户ID"})
+		return
+	}
+
+	snapshot, err := collabdoc.Load(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载共享文档失败"})
+		return
+	}
+	if strings.TrimSpace(snapshot.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "共享文档为空"})
+		return
+	}
+	participants, err := studyDocumentParticipants(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取参与者失败"})
+		return
+	}
+	if !containsUint64(participants, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅文档参与者可以保存"})
+		return
+	}
+
+	db := database.GetDB()
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		var room models.StudyRoom
+		roomName := fmt.Sprintf("学习室 %d", roomID)
+		if err := db.Select("name").First(&room, roomID).Error; err == nil && room.Name != "" {
+			roomName = room.Name
+		}
+		title = fmt.Sprintf("%s 共享笔记 %s", roomName, usertime.DayKey(time.Now(), usertime.ForUser(userID)))
+	}
+	title = truncateRunes(title, 250)
+
+	// 每位参与者在每个房间只保留一篇共享笔记，重复保存时覆盖标题与内容
+	notes := make([]models.StudyNote, 0, len(participants))
+	for _, id := range participants {
+		notes = append(notes, models.StudyNote{UserID: id, RoomID: &roomID, Title: title, Content: snapshot.Content})
+	}
+	onConflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "content", "updated_at"}),
+	}
+	if err := db.Clauses(onConflict).Create(&notes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存笔记失败"})
+		return
+	}
+	var myNote models.StudyNote
+	if err := db.Select("id").Where("user_id = ? AND room_id = ?", userID, roomID).First(&myNote).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存笔记失败"})
+		return
+	}
+	studyHubRegistry.getHub(roomID).broadcast(wsEnvelope{Type: "doc_saved", Data: mustMarshal(map[string]interface{}{
+		"version":  snapshot.Version,
+		"saved_by": userID,
+		"title":    title,
+	})})
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已保存到参与者的笔记",
+		"data": gin.H{
+			"note_id":      myNote.ID,
+			"participants": participants,
+			"version":      snapshot.Version,
+		},
+	})
+}
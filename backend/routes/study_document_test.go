@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+	"learningAssistant-backend/services/collabdoc"
+)
+
+func TestStudyDocumentConcurrentEditsAndSave(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	bp := backplane.NewMemory()
+	_, srvA := startHubInstance(t, bp)
+	_, srvB := startHubInstance(t, bp)
+
+	alice := dialRoom(t, srvA, 8, 1)
+	waitForEvent(t, alice, "doc_snapshot")
+	sendEvent(t, alice, "doc_op", map[string]interface{}{"version": 0, "op": []interface{}{"hello world"}, "client_op_id": "a1"})
+	waitForEvent(t, alice, "doc_op")
+
+	// 后加入者拿到快照，然后双方基于同一版本并发编辑
+	bob := dialRoom(t, srvB, 8, 2)
+	var snapshot collabdoc.Snapshot
+	_ = json.Unmarshal(waitForEvent(t, bob, "doc_snapshot").Data, &snapshot)
+	if snapshot.Content != "hello world" || snapshot.Version != 1 {
+		t.Fatalf("unexpected late joiner snapshot %+v", snapshot)
+	}
+	sendEvent(t, alice, "doc_op", map[string]interface{}{"version": 1, "op": []interface{}{"Say ", 11}, "client_op_id": "a2"})
+	waitForEvent(t, alice, "doc_op")
+	sendEvent(t, bob, "doc_op", map[string]interface{}{"version": 1, "op": []interface{}{5, -6, "!"}, "client_op_id": "b1"})
+
+	var ops []struct {
+		Version    int64        `json:"version"`
+		Op         collabdoc.Op `json:"op"`
+		ClientOpID string       `json:"client_op_id"`
+	}
+	for len(ops) < 2 {
+		var op struct {
+			Version    int64        `json:"version"`
+			Op         collabdoc.Op `json:"op"`
+			ClientOpID string       `json:"client_op_id"`
+		}
+		_ = json.Unmarshal(waitForEvent(t, bob, "doc_op").Data, &op)
+		ops = append(ops, op)
+	}
+	// bob 从版本1开始依次应用广播的操作，结果与服务端一致
+	content := snapshot.Content
+	for _, op := range ops {
+		next, err := collabdoc.Apply(content, op.Op)
+		if err != nil {
+			t.Fatalf("apply broadcast op %+v on %q: %v", op, content, err)
+		}
+		content = next
+	}
+	if content != "Say hello!" || ops[1].ClientOpID != "b1" || ops[1].Version != 3 {
+		t.Fatalf("unexpected converged content %q, ops %+v", content, ops)
+	}
+
+	sendEvent(t, bob, "doc_op", map[string]interface{}{"version": 1, "op": []interface{}{99}, "client_op_id": "b2"})
+	waitForEvent(t, bob, "doc_rejected")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, authRequest(http.MethodPost, "/api/study/rooms/8/document/save", 2, map[string]string{"title": "小组笔记"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body.String())
+	}
+	var notes []models.StudyNote
+	db.Order("user_id").Find(&notes)
+	if len(notes) != 2 || notes[0].UserID != 1 || notes[1].UserID != 2 || notes[0].Content != "Say hello!" {
+		t.Fatalf("expected a note per participant, got %+v", notes)
+	}
+	// 再次保存覆盖已有笔记，不再新增
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, authRequest(http.MethodPost, "/api/study/rooms/8/document/save", 1, map[string]string{"title": "小组笔记（终稿）"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("save again: %d %s", w.Code, w.Body.String())
+	}
+	var saved struct {
+		Data struct {
+			NoteID uint64 `json:"note_id"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &saved)
+	var again []models.StudyNote
+	db.Order("user_id").Find(&again)
+	if len(again) != 2 || again[0].ID != notes[0].ID || saved.Data.NoteID != notes[0].ID || again[1].Title != "小组笔记（终稿）" {
+		t.Fatalf("expected saves to update one note per participant, got %+v (note_id %d)", again, saved.Data.NoteID)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, authRequest(http.MethodPost, "/api/study/rooms/8/document/save", 5, nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected outsider save rejected, got %d", w.Code)
+	}
+}
+
+func TestStudyDocumentParticipantsSurviveHistoryPruning(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	previous := studyHubRegistry
+	studyHubRegistry = newStudyHubStore(backplane.NewMemory())
+	t.Cleanup(func() { studyHubRegistry = previous })
+
+	if _, err := collabdoc.Submit(9, 4, 0, collabdoc.Op{{Insert: "早期草稿"}}, time.Now()); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	// 模拟操作日志被裁剪到只剩其他人的编辑
+	db.Unscoped().Where("room_id = ?", 9).Delete(&models.StudyRoomDocumentOp{})
+	if _, err := collabdoc.Submit(9, 5, 1, collabdoc.Op{{Retain: 4}, {Insert: "，补充"}}, time.Now()); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	participants, err := studyDocumentParticipants(9)
+	if err != nil {
+		t.Fatalf("participants: %v", err)
+	}
+	if len(participants) != 2 || participants[0] != 4 || participants[1] != 5 {
+		t.Fatalf("expected pruned editor to stay a participant, got %v", participants)
+	}
+}
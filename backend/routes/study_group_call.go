@@ -0,0 +1,394 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+// 群组通话采用全互联（mesh），人数过多时客户端上行带宽不足
+const groupCallMaxParticipants = 8
+
+var (
+	errGroupCallMissingPeer = errors.New("missing_peer_id")
+	errGroupCallBusy        = errors.New("caller_busy")
+	errGroupCallFull        = errors.New("call_full")
+	errGroupCallNotJoined   = errors.New("not_in_call")
+)
+
+var groupCallSignalKinds = map[string]bool{"offer": true, "answer": true, "ice": true}
+
+type groupCallMember struct {
+	UserID      uint64    `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	PeerID      string    `json:"peer_id"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+func registerStudyGroupCallRoutes(rooms *gin.RouterGroup) {
+	rooms.GET("/:roomId/calls", handleListStudyRoomCalls)
+}
+
+// activeGroupCall 返回房间进行中的群组通话及当前参与者
+func activeGroupCall(db *gorm.DB, roomID uint64) (*models.StudyRoomCall, []models.StudyRoomCallParticipant, error) {
+	var call models.StudyRoomCall
+	if err := db.Where("active_room_id = ?", roomID).First(&call).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	var participants []models.StudyRoomCallParticipant
+	if err := db.Where("call_id = ? AND left_at IS NULL", call.ID).Order("joined_at ASC").Find(&participants).Error; err != nil {
+		return nil, nil, err
+	}
+	return &call, participants, nil
+}
+
+// inGroupCall 用户是否正在房间的群组通话中
+func inGroupCall(db *gorm.DB, roomID, userID uint64) bool {
+	var count int64
+	db.Model(&models.StudyRoomCallParticipant{}).
+		Joins("JOIN study_room_calls ON study_room_calls.id = study_room_call_participants.call_id").
+		Where("study_room_calls.active_room_id = ? AND study_room_call_participants.user_id = ? AND study_room_call_participants.left_at IS NULL", roomID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// startOrLoadGroupCall 取得房间进行中的通话，没有时以发起人身份创建
+func startOrLoadGroupCall(db *gorm.DB, roomID, userID uint64, countAsStudy bool, now time.Time) (*models.StudyRoomCall, bool, error) {
+	call, _, err := activeGroupCall(db, roomID)
+	if err != nil || call != nil {
+		return call, false, err
+	}
+	activeRoomID := roomID
+	call = &models.StudyRoomCall{
+		RoomID:       roomID,
+		ActiveRoomID: &activeRoomID,
+		StartedBy:    userID,
+		StartedAt:    now,
+		CountAsStudy: countAsStudy,
+	}
+	if err := db.Create(call).Error; err != nil {
+		// 另一实例同时发起，唯一索引冲突后加入对方创建的通话
+		existing, _, loadErr := activeGroupCall(db, roomID)
+		if loadErr != nil || existing == nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+	return call, true, nil
+}
+
+// closeGroupCallParticipant 结束一段参与记录；通话计入学习时长时补记一条学习会话，由学习时长校验处理与其他会话的重叠
+func closeGroupCallParticipant(db *gorm.DB, call *models.StudyRoomCall, participant *models.StudyRoomCallParticipant, now time.Time) {
+	minutes := calculateDurationMinutes(participant.JoinedAt, now)
+	res := db.Model(&models.StudyRoomCallParticipant{}).
+		Where("id = ? AND left_at IS NULL", participant.ID).
+		Updates(map[string]interface{}{"left_at": now, "minutes": minutes})
+	if res.Error != nil || res.RowsAffected == 0 || !call.CountAsStudy || minutes <= 0 {
+		return
+	}
+	callID := call.ID
+	session := models.StudySession{
+		UserID:     participant.UserID,
+		Source:     "group_call",
+		SourceID:   &callID,
+		StartTime:  participant.JoinedAt,
+		LastPingAt: now,
+		Note:       "room:" + strconv.FormatUint(call.RoomID, 10),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		log.Printf("[GroupCall] create study session for user %d failed: %v", participant.UserID, err)
+		return
+	}
+	if err := finalizeStudySession(db, &session, now); err != nil {
+		log.Printf("[GroupCall] finalize study session %d failed: %v", session.ID, err)
+		return
+	}
+	_ = db.Model(&models.StudyRoomCallParticipant{}).Where("id = ?", participant.ID).Update("study_session_id", session.ID).Error
+}
+
+// joinGroupCall 加入（必要时发起）群组通话。已不在房间内的残留参与者会先被移出
+func joinGroupCall(db *gorm.DB, roomID, userID uint64, peerID string, countAsStudy bool, present map[uint64]hubPresence, now time.Time) (*models.StudyRoomCall, []models.StudyRoomCallParticipant, error) {
+	if peerID == "" {
+		return nil, nil, errGroupCallMissingPeer
+	}
+	call, _, err := startOrLoadGroupCall(db, roomID, userID, countAsStudy, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	var participants []models.StudyRoomCallParticipant
+	if err := db.Where("call_id = ? AND left_at IS NULL", call.ID).Find(&participants).Error; err != nil {
+		return nil, nil, err
+	}
+	others := make([]models.StudyRoomCallParticipant, 0, len(participants))
+	alreadyJoined := false
+	for i := range participants {
+		p := &participants[i]
+		if p.UserID == userID {
+			alreadyJoined = true
+			if p.PeerID != peerID {
+				_ = db.Model(p).Update("peer_id", peerID).Error
+			}
+			continue
+		}
+		if _, ok := present[p.UserID]; !ok {
+			closeGroupCallParticipant(db, call, p, now)
+			continue
+		}
+		others = append(others, *p)
+	}
+	if alreadyJoined {
+		// 已在通话中（例如重新注册 peer），不重复记录
+		return call, others, nil
+	}
+	if len(others) >= groupCallMaxParticipants {
+		return nil, nil, errGroupCallFull
+	}
+	if err := db.Create(&models.StudyRoomCallParticipant{
+		CallID:   call.ID,
+		UserID:   userID,
+		PeerID:   peerID,
+		JoinedAt: now,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+	if size := len(others) + 1; size > call.PeakParticipants {
+		call.PeakParticipants = size
+		_ = db.Model(&models.StudyRoomCall{}).Where("id = ? AND peak_participants < ?", call.ID, size).Update("peak_participants", size).Error
+	}
+	return call, others, nil
+}
+
+// leaveGroupCall 离开群组通话，最后一人离开时结束通话。返回通话与是否因此结束
+func leaveGroupCall(db *gorm.DB, roomID, userID uint64, now time.Time) (*models.StudyRoomCall, bool, error) {
+	call, participants, err := activeGroupCall(db, roomID)
+	if err != nil || call == nil {
+		return nil, false, err
+	}
+	remaining := 0
+	left := false
+	for i := range participants {
+		if participants[i].UserID == userID {
+			closeGroupCallParticipant(db, call, &participants[i], now)
+			left = true
+			continue
+		}
+		remaining++
+	}
+	if !left {
+		return nil, false, errGroupCallNotJoined
+	}
+	if remaining > 0 {
+		return call, false, nil
+	}
+	duration := calculateDurationMinutes(call.StartedAt, now)
+	res := db.Model(&models.StudyRoomCall{}).
+		Where("id = ? AND active_room_id IS NOT NULL", call.ID).
+		Updates(map[string]interface{}{"active_room_id": nil, "ended_at": now, "duration_minutes": duration})
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	call.EndedAt = &now
+	call.DurationMinutes = duration
+	return call, res.RowsAffected > 0, nil
+}
+
+func groupCallMembers(participants []models.StudyRoomCallParticipant, presence map[uint64]hubPresence) []groupCallMember {
+	var missing []uint64
+	for _, p := range participants {
+		if _, ok := presence[p.UserID]; !ok {
+			missing = append(missing, p.UserID)
+		}
+	}
+	names := loadUserNames(missing)
+	members := make([]groupCallMember, 0, len(participants))
+	for _, p := range participants {
+		name := names[p.UserID]
+		if pres, ok := presence[p.UserID]; ok {
+			name = pres.DisplayName
+		}
+		members = append(members, groupCallMember{UserID: p.UserID, DisplayName: name, PeerID: p.PeerID, JoinedAt: p.JoinedAt})
+	}
+	return members
+}
+
+// groupCallState 房间群组通话概况，写入 state 消息；没有通话时为 nil
+func (h *studyRoomHub) groupCallState(presence map[uint64]hubPresence) map[string]interface{} {
+	call, participants, err := activeGroupCall(database.GetDB(), h.roomID)
+	if err != nil || call == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"call_id":        call.ID,
+		"started_by":     call.StartedBy,
+		"started_at":     call.StartedAt,
+		"count_as_study": call.CountAsStudy,
+		"participants":   groupCallMembers(participants, presence),
+	}
+}
+
+func (h *studyRoomHub) broadcastGroupCallState() {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	state := h.groupCallState(h.presence(ctx))
+	h.broadcast(wsEnvelope{Type: "group_call_state", Data: mustMarshal(map[string]interface{}{"group_call": state})})
+}
+
+func (h *studyRoomHub) handleGroupCallJoin(client *studyClient, countAsStudy bool) {
+	h.mu.Lock()
+	peerID := client.peerID
+	h.mu.Unlock()
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	if _, busy := h.busyPartners(ctx)[client.userID]; busy {
+		client.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": errGroupCallBusy.Error()})})
+		return
+	}
+	presence := h.presence(ctx)
+	call, others, err := joinGroupCall(database.GetDB(), h.roomID, client.userID, peerID, countAsStudy, presence, time.Now())
+	if err != nil {
+		reason := err.Error()
+		if !errors.Is(err, errGroupCallMissingPeer) && !errors.Is(err, errGroupCallFull) {
+			log.Printf("[GroupCall] user %d join call in room %d failed: %v", client.userID, h.roomID, err)
+			reason = "unavailable"
+		}
+		client.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": reason})})
+		return
+	}
+
+	// 新加入者向已有参与者逐一发起 offer
+	client.enqueue(wsEnvelope{Type: "group_call_joined", Data: mustMarshal(map[string]interface{}{
+		"call_id":        call.ID,
+		"count_as_study": call.CountAsStudy,
+		"participants":   groupCallMembers(others, presence),
+	})})
+	if len(others) > 0 {
+		ids := make([]uint64, 0, len(others))
+		for _, p := range others {
+			ids = append(ids, p.UserID)
+		}
+		h.sendTo(wsEnvelope{Type: "group_call_participant_joined", Data: mustMarshal(map[string]interface{}{
+			"call_id":      call.ID,
+			"user_id":      client.userID,
+			"display_name": client.displayName,
+			"peer_id":      peerID,
+		})}, ids...)
+	}
+	h.broadcastGroupCallState()
+}
+
+// handleGroupCallSignal 在两位参与者之间转发 SDP/ICE，双方都必须在房间当前的群组通话中
+func (h *studyRoomHub) handleGroupCallSignal(client *studyClient, targetID uint64, kind string, payload json.RawMessage) {
+	if !groupCallSignalKinds[kind] || targetID == 0 || targetID == client.userID || len(payload) == 0 {
+		return
+	}
+	call, participants, err := activeGroupCall(database.GetDB(), h.roomID)
+	if err != nil || call == nil {
+		client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "当前没有进行中的群组通话"})})
+		return
+	}
+	senderIn, targetIn := false, false
+	for _, p := range participants {
+		senderIn = senderIn || p.UserID == client.userID
+		targetIn = targetIn || p.UserID == targetID
+	}
+	if !senderIn || !targetIn {
+		client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "对方不在群组通话中"})})
+		return
+	}
+	h.sendTo(wsEnvelope{Type: "group_call_signal", Data: mustMarshal(map[string]interface{}{
+		"call_id": call.ID,
+		"from_id": client.userID,
+		"kind":    kind,
+		"payload": payload,
+	})}, targetID)
+}
+
+func (h *studyRoomHub) handleGroupCallLeave(userID uint64) {
+	call, ended, err := leaveGroupCall(database.GetDB(), h.roomID, userID, time.Now())
+	if err != nil {
+		if !errors.Is(err, errGroupCallNotJoined) {
+			log.Printf("[GroupCall] user %d leave call in room %d failed: %v", userID, h.roomID, err)
+		}
+		return
+	}
+	if call == nil {
+		return
+	}
+	if ended {
+		h.broadcast(wsEnvelope{Type: "group_call_ended", Data: mustMarshal(map[string]interface{}{
+			"call_id":          call.ID,
+			"duration_minutes": call.DurationMinutes,
+		})})
+	} else {
+		h.broadcast(wsEnvelope{Type: "group_call_participant_left", Data: mustMarshal(map[string]uint64{
+			"call_id": call.ID,
+			"user_id": userID,
+		})})
+	}
+	h.broadcastGroupCallState()
+}
+
+func handleListStudyRoomCalls(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	db := database.GetDB()
+	var calls []models.StudyRoomCall
+	if err := db.Where("room_id = ?", roomID).Order("started_at DESC").Limit(limit).Find(&calls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取通话记录失败"})
+		return
+	}
+	callIDs := make([]uint64, 0, len(calls))
+	for _, call := range calls {
+		callIDs = append(callIDs, call.ID)
+	}
+	var participants []models.StudyRoomCallParticipant
+	if len(callIDs) > 0 {
+		if err := db.Where("call_id IN ?", callIDs).Order("joined_at ASC").Find(&participants).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取通话记录失败"})
+			return
+		}
+	}
+	byCall := make(map[uint64][]models.StudyRoomCallParticipant, len(calls))
+	for _, p := range participants {
+		byCall[p.CallID] = append(byCall[p.CallID], p)
+	}
+	items := make([]gin.H, 0, len(calls))
+	for _, call := range calls {
+		list := byCall[call.ID]
+		if list == nil {
+			list = []models.StudyRoomCallParticipant{}
+		}
+		items = append(items, gin.H{
+			"id":                call.ID,
+			"started_by":        call.StartedBy,
+			"started_at":        call.StartedAt,
+			"ended_at":          call.EndedAt,
+			"active":            call.ActiveRoomID != nil,
+			"count_as_study":    call.CountAsStudy,
+			"peak_participants": call.PeakParticipants,
+			"duration_minutes":  call.DurationMinutes,
+			"participants":      list,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"calls": items}})
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+)
+
+func TestGroupCallSignalingAcrossInstances(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	bp := backplane.NewMemory()
+	_, srvA := startHubInstance(t, bp)
+	_, srvB := startHubInstance(t, bp)
+
+	alice := dialRoom(t, srvA, 60, 1)
+	bob := dialRoom(t, srvB, 60, 2)
+	carol := dialRoom(t, srvB, 60, 3)
+	sendEvent(t, alice, "register_peer", map[string]string{"peer_id": "peer-a"})
+	sendEvent(t, bob, "register_peer", map[string]string{"peer_id": "peer-b"})
+	sendEvent(t, carol, "register_peer", map[string]string{"peer_id": "peer-c"})
+
+	sendEvent(t, alice, "group_call_join", map[string]bool{"count_as_study": true})
+	waitForEvent(t, alice, "group_call_joined")
+	sendEvent(t, bob, "group_call_join", nil)
+	var joined struct {
+		Participants []groupCallMember `json:"participants"`
+	}
+	_ = json.Unmarshal(waitForEvent(t, bob, "group_call_joined").Data, &joined)
+	if len(joined.Participants) != 1 || joined.Participants[0].PeerID != "peer-a" {
+		t.Fatalf("expected bob to see alice in the call, got %+v", joined.Participants)
+	}
+	waitForEvent(t, alice, "group_call_participant_joined")
+
+	// 参与者之间转发 SDP，非参与者不能发信令，也不能一对一呼叫通话中的成员
+	sendEvent(t, bob, "group_call_signal", map[string]interface{}{"target_id": 1, "kind": "offer", "payload": map[string]string{"sdp": "v=0"}})
+	signal := waitForEvent(t, alice, "group_call_signal")
+	if !strings.Contains(string(signal.Data), `"from_id":2`) || !strings.Contains(string(signal.Data), "v=0") {
+		t.Fatalf("unexpected relayed signal %s", signal.Data)
+	}
+	sendEvent(t, carol, "group_call_signal", map[string]interface{}{"target_id": 1, "kind": "offer", "payload": map[string]string{"sdp": "x"}})
+	waitForEvent(t, carol, "error")
+	sendEvent(t, carol, "call_request", map[string]uint64{"target_id": 1})
+	denied := waitForEvent(t, carol, "call_denied")
+	if !strings.Contains(string(denied.Data), "target_busy") {
+		t.Fatalf("expected one-to-one call to a group participant denied, got %s", denied.Data)
+	}
+
+	// 回溯加入时间，使通话时长可计入学习时长
+	db.Model(&models.StudyRoomCallParticipant{}).Where("1 = 1").Update("joined_at", time.Now().Add(-20*time.Minute))
+	sendEvent(t, alice, "group_call_leave", nil)
+	waitForEvent(t, bob, "group_call_participant_left")
+	bob.Close()
+	waitForEvent(t, carol, "group_call_ended")
+
+	var call models.StudyRoomCall
+	db.First(&call)
+	if call.EndedAt == nil || call.ActiveRoomID != nil || call.PeakParticipants != 2 {
+		t.Fatalf("expected call recorded as ended with two peak participants, got %+v", call)
+	}
+	var sessions []models.StudySession
+	db.Where("source = ?", "group_call").Order("user_id").Find(&sessions)
+	if len(sessions) != 2 || sessions[0].DurationMinutes < 19 || sessions[0].EndTime == nil {
+		t.Fatalf("expected call minutes credited as study sessions, got %+v", sessions)
+	}
+}
@@ -0,0 +1,434 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+const (
+	defaultStudyRoomMuteMinutes = 10
+	maxStudyRoomMuteMinutes     = 7 * 24 * 60
+)
+
+var (
+	errStudyRoomFull   = errors.New("study-room-full")
+	errStudyRoomBanned = errors.New("study-room-banned")
+)
+
+func registerStudyModerationRoutes(rooms *gin.RouterGroup) {
+	rooms.PUT("/:roomId/members/:userId/role", handleSetStudyRoomMemberRole)
+	rooms.POST("/:roomId/members/:userId/kick", handleKickStudyRoomMember)
+	rooms.POST("/:roomId/members/:userId/mute", handleMuteStudyRoomMember)
+	rooms.DELETE("/:roomId/members/:userId/mute", handleUnmuteStudyRoomMember)
+	rooms.GET("/:roomId/bans", handleListStudyRoomBans)
+	rooms.POST("/:roomId/bans", handleBanStudyRoomMember)
+	rooms.DELETE("/:roomId/bans/:userId", handleUnbanStudyRoomMember)
+}
+
+// studyRoomRole 返回用户在房间中的角色，房主以 StudyRoom.OwnerUserID 为准
+func studyRoomRole(db *gorm.DB, room *models.StudyRoom, userID uint64) int8 {
+	if room.OwnerUserID == userID {
+		return models.StudyRoomRoleOwner
+	}
+	var member models.StudyRoomMember
+	if err := db.Where("room_id = ? AND user_id = ?", room.ID, userID).First(&member).Error; err != nil {
+		return models.StudyRoomRoleMember
+	}
+	if member.Role == models.StudyRoomRoleOwner {
+		// 房主转让后旧记录不再生效
+		return models.StudyRoomRoleMember
+	}
+	return member.Role
+}
+
+func studyRoomRoleName(role int8) string {
+	switch role {
+	case models.StudyRoomRoleOwner:
+		return "owner"
+	case models.StudyRoomRoleModerator:
+		return "moderator"
+	default:
+		return "member"
+	}
+}
+
+// activeStudyRoomBan 查询仍在有效期内的封禁记录
+func activeStudyRoomBan(db *gorm.DB, roomID, userID uint64, now time.Time) (models.StudyRoomBan, bool) {
+	var ban models.StudyRoomBan
+	err := db.Where("room_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", roomID, userID, now).
+		First(&ban).Error
+	return ban, err == nil
+}
+
+// studyRoomMutedUntil 返回禁言截止时间，未禁言或已过期时返回 false
+func studyRoomMutedUntil(db *gorm.DB, roomID, userID uint64, now time.Time) (time.Time, bool) {
+	var member models.StudyRoomMember
+	if err := db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error; err != nil {
+		return time.Time{}, false
+	}
+	if member.MutedUntil == nil || !member.MutedUntil.After(now) {
+		return time.Time{}, false
+	}
+	return *member.MutedUntil, true
+}
+
+// mutedChatMessage 禁言提示，截止时间按用户时区展示
+func mutedChatMessage(userID uint64, until time.Time) string {
+	return "你已被禁言，解除时间 " + until.In(usertime.ForUser(userID)).Format("2006-01-02 15:04")
+}
+
+// checkStudyRoomAdmission 校验封禁名单与人数上限。人数按全部实例的在线成员统计，
+// 已在线的用户重连不占用新名额，房主不受限制。
+func checkStudyRoomAdmission(db *gorm.DB, roomID, userID uint64, hub *studyRoomHub) error {
+	var room models.StudyRoom
+	hasRoom := db.First(&room, roomID).Error == nil
+	if hasRoom && room.OwnerUserID == userID {
+		return nil
+	}
+	if _, banned := activeStudyRoomBan(db, roomID, userID, time.Now()); banned {
+		return errStudyRoomBanned
+	}
+	if !hasRoom || room.MaxMembers <= 0 || hub == nil {
+		return nil
+	}
+	ctx, cancel := backplaneContext()
+	present := hub.presence(ctx)
+	cancel()
+	if _, online := present[userID]; online {
+		return nil
+	}
+	if len(present) >= room.MaxMembers {
+		return errStudyRoomFull
+	}
+	return nil
+}
+
+func respondStudyRoomAdmission(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errStudyRoomBanned):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "你已被禁止进入该房间"})
+	case errors.Is(err, errStudyRoomFull):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "房间人数已满"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "校验房间权限失败"})
+	}
+}
+
+// postStudyRoomSystemMessage 记录并广播房间系统消息
+func postStudyRoomSystemMessage(db *gorm.DB, roomID, actorID uint64, content string) {
+	chat := models.ChatMessage{
+		RoomID:  roomID,
+		UserID:  actorID,
+		Content: content,
+		MsgType: models.ChatMessageTypeSystem,
+		SentAt:  time.Now(),
+	}
+	if err := db.Create(&chat).Error; err != nil {
+		log.Println("store system message failed:", err)
+	}
+	name := loadUserNames([]uint64{actorID})[actorID]
+	hub := studyHubRegistry.getHub(roomID)
+	hub.broadcast(wsEnvelope{Type: "chat", Data: mustMarshal(buildChatMessageResponse(chat, name))})
+}
+
+// studyModerationTarget 解析房间、操作者与目标成员，并校验操作者权限高于目标
+func studyModerationTarget(c *gin.Context, targetParam string) (*models.StudyRoom, uint64, uint64, bool) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return nil, 0, 0, false
+	}
+	actorID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return nil, 0, 0, false
+	}
+	targetID, err := strconv.ParseUint(targetParam, 10, 64)
+	if err != nil || targetID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "用户ID无效"})
+		return nil, 0, 0, false
+	}
+	if targetID == actorID {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "不能对自己执行该操作"})
+		return nil, 0, 0, false
+	}
+
+	db := database.GetDB()
+	var room models.StudyRoom
+	if err := db.First(&room, roomID).Error; err != nil {
+		status := http.StatusInternalServerError
+		msg := "加载房间失败"
+		if errorsIsNotFound(err) {
+			status = http.StatusNotFound
+			msg = "房间不存在"
+		}
+		c.JSON(status, gin.H{"code": status, "message": msg})
+		return nil, 0, 0, false
+	}
+	actorRole := studyRoomRole(db, &room, actorID)
+	if actorRole < models.StudyRoomRoleModerator || actorRole <= studyRoomRole(db, &room, targetID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "无权限管理该成员"})
+		return nil, 0, 0, false
+	}
+	return &room, actorID, targetID, true
+}
+
+func studyRoomDisplayName(userID uint64) string {
+	return firstNonEmpty(loadUserNames([]uint64{userID})[userID], fmt.Sprintf("用户 %d", userID))
+}
+
+// ensureStudyRoomMember 返回成员记录，仅通过 WebSocket 进入的用户在此补建
+func ensureStudyRoomMember(db *gorm.DB, roomID, userID uint64) (models.StudyRoomMember, error) {
+	member := models.StudyRoomMember{RoomID: roomID, UserID: userID}
+	err := db.Where("room_id = ? AND user_id = ?", roomID, userID).FirstOrCreate(&member).Error
+	return member, err
+}
+
+func handleSetStudyRoomMemberRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数格式不正确"})
+		return
+	}
+	var role int8
+	switch strings.ToLower(strings.TrimSpace(req.Role)) {
+	case "moderator":
+		role = models.StudyRoomRoleModerator
+	case "member":
+		role = models.StudyRoomRoleMember
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "角色仅支持 moderator 或 member"})
+		return
+	}
+
+	room, actorID, targetID, ok := studyModerationTarget(c, c.Param("userId"))
+	if !ok {
+		return
+	}
+	if room.OwnerUserID != actorID {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅房主可以设置管理员"})
+		return
+	}
+
+	db := database.GetDB()
+	member, err := ensureStudyRoomMember(db, room.ID, targetID)
+	if err == nil {
+		err = db.Model(&member).Update("role", role).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "设置角色失败"})
+		return
+	}
+
+	content := studyRoomDisplayName(targetID) + " 已被设为管理员"
+	if role == models.StudyRoomRoleMember {
+		content = studyRoomDisplayName(targetID) + " 已被取消管理员"
+	}
+	postStudyRoomSystemMessage(db, room.ID, actorID, content)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    gin.H{"user_id": targetID, "role": studyRoomRoleName(role)},
+	})
+}
+
+type studyModerationRequest struct {
+	UserID  uint64 `json:"user_id"`
+	Reason  string `json:"reason"`
+	Minutes int    `json:"minutes"`
+}
+
+func (r studyModerationRequest) reasonSuffix() string {
+	reason := strings.TrimSpace(r.Reason)
+	if reason == "" {
+		return ""
+	}
+	return "，原因：" + reason
+}
+
+func handleKickStudyRoomMember(c *gin.Context) {
+	var req studyModerationRequest
+	_ = c.ShouldBindJSON(&req)
+	room, actorID, targetID, ok := studyModerationTarget(c, c.Param("userId"))
+	if !ok {
+		return
+	}
+
+	hub := studyHubRegistry.getHub(room.ID)
+	hub.kick(targetID, "你已被移出房间"+req.reasonSuffix())
+	postStudyRoomSystemMessage(database.GetDB(), room.ID, actorID, studyRoomDisplayName(targetID)+" 被移出房间"+req.reasonSuffix())
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"user_id": targetID}})
+}
+
+func handleMuteStudyRoomMember(c *gin.Context) {
+	var req studyModerationRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Minutes <= 0 {
+		req.Minutes = defaultStudyRoomMuteMinutes
+	}
+	if req.Minutes > maxStudyRoomMuteMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "禁言时长不能超过7天"})
+		return
+	}
+	room, actorID, targetID, ok := studyModerationTarget(c, c.Param("userId"))
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	member, err := ensureStudyRoomMember(db, room.ID, targetID)
+	if err == nil {
+		err = db.Model(&member).Update("muted_until", until).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "禁言失败"})
+		return
+	}
+
+	postStudyRoomSystemMessage(db, room.ID, actorID, fmt.Sprintf("%s 被禁言 %d 分钟%s", studyRoomDisplayName(targetID), req.Minutes, req.reasonSuffix()))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    gin.H{"user_id": targetID, "muted_until": until},
+	})
+}
+
+func handleUnmuteStudyRoomMember(c *gin.Context) {
+	room, actorID, targetID, ok := studyModerationTarget(c, c.Param("userId"))
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	if err := db.Model(&models.StudyRoomMember{}).
+		Where("room_id = ? AND user_id = ?", room.ID, targetID).
+		Update("muted_until", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "解除禁言失败"})
+		return
+	}
+	postStudyRoomSystemMessage(db, room.ID, actorID, studyRoomDisplayName(targetID)+" 已被解除禁言")
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"user_id": targetID}})
+}
+
+func handleBanStudyRoomMember(c *gin.Context) {
+	var req studyModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数格式不正确"})
+		return
+	}
+	if req.Minutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "封禁时长不正确"})
+		return
+	}
+	room, actorID, targetID, ok := studyModerationTarget(c, strconv.FormatUint(req.UserID, 10))
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	ban := models.StudyRoomBan{
+		RoomID:   room.ID,
+		UserID:   targetID,
+		BannedBy: actorID,
+		Reason:   strings.TrimSpace(req.Reason),
+	}
+	if req.Minutes > 0 {
+		expires := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		ban.ExpiresAt = &expires
+	}
+	// 重复封禁时覆盖原记录（包括已过期的）
+	if err := db.Unscoped().Where("room_id = ? AND user_id = ?", room.ID, targetID).Delete(&models.StudyRoomBan{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "封禁失败"})
+		return
+	}
+	if err := db.Create(&ban).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "封禁失败"})
+		return
+	}
+
+	hub := studyHubRegistry.getHub(room.ID)
+	hub.kick(targetID, "你已被禁止进入该房间"+req.reasonSuffix())
+	postStudyRoomSystemMessage(db, room.ID, actorID, studyRoomDisplayName(targetID)+" 被禁止进入房间"+req.reasonSuffix())
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"ban": ban}})
+}
+
+func handleUnbanStudyRoomMember(c *gin.Context) {
+	room, actorID, targetID, ok := studyModerationTarget(c, c.Param("userId"))
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	result := db.Unscoped().Where("room_id = ? AND user_id = ?", room.ID, targetID).Delete(&models.StudyRoomBan{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "解除封禁失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "该用户未被封禁"})
+		return
+	}
+	postStudyRoomSystemMessage(db, room.ID, actorID, studyRoomDisplayName(targetID)+" 已被解除封禁")
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"user_id": targetID}})
+}
+
+func handleListStudyRoomBans(c *gin.Context) {
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 64)
+	if err != nil || roomID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "房间ID不正确"})
+		return
+	}
+	actorID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return
+	}
+	db := database.GetDB()
+	var room models.StudyRoom
+	if err := db.First(&room, roomID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "房间不存在"})
+		return
+	}
+	if studyRoomRole(db, &room, actorID) < models.StudyRoomRoleModerator {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "无权限查看封禁名单"})
+		return
+	}
+
+	var bans []models.StudyRoomBan
+	if err := db.Where("room_id = ? AND (expires_at IS NULL OR expires_at > ?)", roomID, time.Now()).
+		Order("created_at DESC").
+		Find(&bans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取封禁名单失败"})
+		return
+	}
+	userIDs := make([]uint64, 0, len(bans))
+	for _, ban := range bans {
+		userIDs = append(userIDs, ban.UserID)
+	}
+	names := loadUserNames(userIDs)
+	items := make([]gin.H, 0, len(bans))
+	for _, ban := range bans {
+		items = append(items, gin.H{
+			"user_id":      ban.UserID,
+			"display_name": names[ban.UserID],
+			"banned_by":    ban.BannedBy,
+			"reason":       ban.Reason,
+			"expires_at":   ban.ExpiresAt,
+			"created_at":   ban.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": gin.H{"bans": items}})
+}
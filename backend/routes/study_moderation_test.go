@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+)
+
+func TestStudyRoomModeration(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	registerStudyWebsocketRoutes(r.Group("/api/study"))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	room := models.StudyRoom{Name: "自习室", OwnerUserID: 1, MaxMembers: 2, Status: 1}
+	if err := db.Create(&room).Error; err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	base := "/api/study/rooms/" + jsonNumber(room.ID)
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + base + "/ws?token=mock-token-"
+	dial := func(userID uint64) (*websocket.Conn, *http.Response, error) {
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL+jsonNumber(userID), nil)
+		if conn != nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, resp, err
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 只有房主可以任命管理员
+	if w := serve(authRequest(http.MethodPut, base+"/members/2/role", 1, map[string]string{"role": "moderator"})); w.Code != http.StatusOK {
+		t.Fatalf("expected owner to promote moderator, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(authRequest(http.MethodPut, base+"/members/3/role", 2, map[string]string{"role": "moderator"})); w.Code != http.StatusForbidden {
+		t.Fatalf("expected moderator promotion to be rejected, got %d", w.Code)
+	}
+
+	owner, _, err := dial(1)
+	if err != nil {
+		t.Fatalf("owner dial: %v", err)
+	}
+	waitForEvent(t, owner, "state")
+	member, _, err := dial(3)
+	if err != nil {
+		t.Fatalf("member dial: %v", err)
+	}
+	waitForEvent(t, member, "state")
+
+	// 房间已满：房主之外的新成员无法加入或连接
+	if w := serve(authRequest(http.MethodPost, base+"/join", 4, map[string]uint64{"user_id": 4})); w.Code != http.StatusConflict {
+		t.Fatalf("expected full room to reject join, got %d %s", w.Code, w.Body.String())
+	}
+	if _, resp, err := dial(4); err == nil || resp == nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected websocket handshake to be rejected when full, got %v", err)
+	}
+
+	// 管理员不能处置房主，可以禁言普通成员
+	if w := serve(authRequest(http.MethodPost, base+"/members/1/mute", 2, nil)); w.Code != http.StatusForbidden {
+		t.Fatalf("expected moderator to be unable to mute owner, got %d", w.Code)
+	}
+	if w := serve(authRequest(http.MethodPost, base+"/members/3/mute", 2, map[string]interface{}{"minutes": 5, "reason": "刷屏"})); w.Code != http.StatusOK {
+		t.Fatalf("mute: %d %s", w.Code, w.Body.String())
+	}
+	notice := waitForEvent(t, owner, "chat")
+	if !strings.Contains(string(notice.Data), `"message_type":"system"`) || !strings.Contains(string(notice.Data), "刷屏") {
+		t.Fatalf("expected system message for mute, got %s", notice.Data)
+	}
+	sendEvent(t, member, "chat", map[string]string{"content": "hello"})
+	rejected := waitForEvent(t, member, "error")
+	if !strings.Contains(string(rejected.Data), "禁言") {
+		t.Fatalf("expected mute error envelope, got %s", rejected.Data)
+	}
+	if w := serve(authRequest(http.MethodPost, base+"/chat", 3, map[string]string{"content": "hello"})); w.Code != http.StatusForbidden {
+		t.Fatalf("expected muted REST chat to be rejected, got %d", w.Code)
+	}
+
+	// 封禁会立即踢出连接，并在加入与握手时拦截
+	if w := serve(authRequest(http.MethodPost, base+"/bans", 1, map[string]interface{}{"user_id": 3})); w.Code != http.StatusOK {
+		t.Fatalf("ban: %d %s", w.Code, w.Body.String())
+	}
+	kicked := waitForEvent(t, member, "kicked")
+	var kickedPayload map[string]string
+	_ = json.Unmarshal(kicked.Data, &kickedPayload)
+	if !strings.Contains(kickedPayload["message"], "禁止进入") {
+		t.Fatalf("unexpected kicked payload %s", kicked.Data)
+	}
+	_ = member.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, _, err := member.ReadMessage(); err == nil {
+		t.Fatalf("expected banned connection to be closed")
+	}
+	waitForEvent(t, owner, "member_left")
+
+	if w := serve(authRequest(http.MethodPost, base+"/join", 3, map[string]uint64{"user_id": 3})); w.Code != http.StatusForbidden {
+		t.Fatalf("expected banned join to be rejected, got %d", w.Code)
+	}
+	if _, resp, err := dial(3); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected banned handshake to be rejected, got %v", err)
+	}
+	w := serve(authRequest(http.MethodGet, base+"/bans", 2, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"user_id":3`) {
+		t.Fatalf("expected ban list to include user 3, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(authRequest(http.MethodDelete, base+"/bans/3", 2, nil)); w.Code != http.StatusOK {
+		t.Fatalf("unban: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(authRequest(http.MethodPost, base+"/join", 3, map[string]uint64{"user_id": 3})); w.Code != http.StatusOK {
+		t.Fatalf("expected join after unban, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestKickClosesConnectionOnAnotherInstance(t *testing.T) {
+	setupTaskCollaborationTest(t)
+	bp := backplane.NewMemory()
+	storeA, _ := startHubInstance(t, bp)
+	_, srvB := startHubInstance(t, bp)
+	target := dialRoom(t, srvB, 20, 3)
+	waitForEvent(t, target, "state")
+
+	storeA.getHub(20).kick(3, "你已被移出房间")
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	members, err := loadHubPresence(ctx, bp, 20)
+	if err != nil {
+		t.Fatalf("load presence: %v", err)
+	}
+	if _, ok := members[3]; ok {
+		t.Fatal("expected kicked member presence removed on every instance")
+	}
+	// 客户端即使忽略 kicked 消息，连接也会被服务端关闭
+	_ = target.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		if _, _, err := target.ReadMessage(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatalf("expected server to close kicked connection, got %v", err)
+			}
+			break
+		}
+	}
+}
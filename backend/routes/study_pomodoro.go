@@ -0,0 +1,435 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/pomodoro"
+)
+
+// 房间番茄钟超过该时长无人推进时视为已废弃
+const roomPomodoroStaleAfter = 12 * time.Hour
+
+type interruptPomodoroRequest struct {
+	PomodoroID uint64 `json:"pomodoro_id"`
+	SessionID  uint64 `json:"session_id"`
+	Reason     string `json:"reason"`
+}
+
+func registerPomodoroRoutes(router *gin.RouterGroup) {
+	router.POST("/pomodoro/interrupt", handleInterruptPomodoro)
+}
+
+// shouldStartPomodoro 请求显式携带配置或用户开启了专注模式时启用番茄钟
+func shouldStartPomodoro(db *gorm.DB, userID uint64, cfg *pomodoro.Config) bool {
+	if cfg != nil {
+		return true
+	}
+	var setting models.UserSetting
+	if err := db.Where("user_id = ?", userID).First(&setting).Error; err != nil {
+		return false
+	}
+	return setting.FocusMode
+}
+
+// syncStudySessionPomodoro 推进学习会话上的番茄钟，并把完成的专注分钟累加到会话
+func syncStudySessionPomodoro(db *gorm.DB, session *models.StudySession, now time.Time) *pomodoro.State {
+	p, err := pomodoro.FindActiveByStudySession(session.ID)
+	if err != nil {
+		return nil
+	}
+	transitions, err := pomodoro.Sync(p, now)
+	if err != nil {
+		log.Printf("sync pomodoro %d failed: %v", p.ID, err)
+	}
+	addStudySessionFocusMinutes(db, session, pomodoro.CreditedMinutes(transitions))
+	state := pomodoro.Snapshot(p, now)
+	return &state
+}
+
+// finishStudySessionPomodoro 学习会话结束时同步结束番茄钟
+func finishStudySessionPomodoro(db *gorm.DB, session *models.StudySession, endTime time.Time) {
+	p, err := pomodoro.FindActiveByStudySession(session.ID)
+	if err != nil {
+		return
+	}
+	transitions, partial, err := pomodoro.Finish(p, endTime)
+	if err != nil {
+		log.Printf("finish pomodoro %d failed: %v", p.ID, err)
+		return
+	}
+	addStudySessionFocusMinutes(db, session, pomodoro.CreditedMinutes(transitions)+partial)
+}
+
+func addStudySessionFocusMinutes(db *gorm.DB, session *models.StudySession, minutes int) {
+	if minutes <= 0 {
+		return
+	}
+	var current models.StudySession
+	if err := db.First(&current, session.ID).Error; err != nil {
+		log.Printf("load session %d for focus credit failed: %v", session.ID, err)
+		return
+	}
+	creditFocusWithinCap(db, &current, minutes)
+	session.FocusMinutes = current.FocusMinutes
+}
+
+// studySessionFocusCap 会话最多可计入的专注分钟：已结束的会话以校验后的时长为准，
+// 进行中的会话以最后一次心跳扣除空闲后的时长为准，避免停机后补推的阶段超出实际学习时间
+func studySessionFocusCap(session *models.StudySession) int {
+	if session.EndTime != nil {
+		return session.DurationMinutes
+	}
+	limit := int(session.LastPingAt.Sub(session.StartTime).Minutes()) - session.IdleSeconds/60
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+func creditFocusWithinCap(db *gorm.DB, session *models.StudySession, minutes int) {
+	if remaining := studySessionFocusCap(session) - session.FocusMinutes; minutes > remaining {
+		minutes = remaining
+	}
+	if minutes <= 0 {
+		return
+	}
+	if err := db.Model(&models.StudySession{}).
+		Where("id = ?", session.ID).
+		UpdateColumn("focus_minutes", gorm.Expr("focus_minutes + ?", minutes)).Error; err != nil {
+		log.Printf("credit focus minutes to session %d failed: %v", session.ID, err)
+		return
+	}
+	session.FocusMinutes += minutes
+}
+
+func handleInterruptPomodoro(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return
+	}
+	var req interruptPomodoroRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求格式错误"})
+		return
+	}
+	if req.PomodoroID == 0 && req.SessionID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少 pomodoro_id 或 session_id"})
+		return
+	}
+
+	var (
+		p   *models.PomodoroSession
+		err error
+	)
+	if req.PomodoroID != 0 {
+		p, err = pomodoro.Load(req.PomodoroID)
+	} else {
+		p, err = pomodoro.FindActiveByStudySession(req.SessionID)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "加载番茄钟失败"
+		if errors.Is(err, pomodoro.ErrPomodoroNotFound) {
+			status = http.StatusNotFound
+			msg = "番茄钟不存在或已结束"
+		}
+		c.JSON(status, gin.H{"code": status, "message": msg})
+		return
+	}
+
+	db := database.GetDB()
+	if p.RoomID == nil && userID != p.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "番茄钟归属不匹配"})
+		return
+	}
+	if p.RoomID != nil {
+		var member int64
+		if err := db.Model(&models.StudyRoomMember{}).Where("room_id = ? AND user_id = ?", *p.RoomID, userID).Count(&member).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "记录中断失败"})
+			return
+		}
+		if member == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "不是该自习室成员"})
+			return
+		}
+	}
+
+	var (
+		record *models.PomodoroInterruption
+		state  pomodoro.State
+	)
+	if p.RoomID != nil {
+		// 房间番茄钟的状态由所在房间的 hub 持有，中断统一交给 hub 处理，避免内存状态覆盖数据库记录
+		record, state, err = studyHubRegistry.getHub(*p.RoomID).interruptRoomPomodoro(p.ID, userID, req.Reason)
+	} else {
+		now := time.Now()
+		var transitions []pomodoro.Transition
+		record, transitions, err = pomodoro.Interrupt(p, userID, req.Reason, now)
+		if err == nil && p.StudySessionID != nil {
+			addStudySessionFocusMinutes(db, &models.StudySession{BaseModel: models.BaseModel{ID: *p.StudySessionID}}, pomodoro.CreditedMinutes(transitions))
+		}
+		state = pomodoro.Snapshot(p, now)
+	}
+	if err != nil {
+		if errors.Is(err, pomodoro.ErrPomodoroEnded) {
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "番茄钟已结束"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "记录中断失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"interruption": record,
+			"pomodoro":     state,
+		},
+	})
+}
+
+// roomPomodoroState 返回房间同步番茄钟的当前状态
+func (h *studyRoomHub) roomPomodoroState() *pomodoro.State {
+	h.pomodoroMu.Lock()
+	defer h.pomodoroMu.Unlock()
+	if h.pomodoro == nil {
+		return nil
+	}
+	state := pomodoro.Snapshot(h.pomodoro, time.Now())
+	return &state
+}
+
+// restoreRoomPomodoro 服务重启后恢复房间内仍在运行的番茄钟
+func (h *studyRoomHub) restoreRoomPomodoro() {
+	p, err := pomodoro.FindActiveByRoom(h.roomID)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	h.pomodoroMu.Lock()
+	defer h.pomodoroMu.Unlock()
+	if now.Sub(p.PhaseStartedAt) > roomPomodoroStaleAfter {
+		_, _, _ = pomodoro.Finish(p, p.PhaseStartedAt)
+		return
+	}
+	if _, err := pomodoro.Sync(p, now); err != nil {
+		log.Printf("restore room %d pomodoro failed: %v", h.roomID, err)
+	}
+	h.pomodoro = p
+	h.schedulePomodoroLocked()
+}
+
+// canControlPomodoro 房间番茄钟影响所有成员，只有房主和管理员可以开启或停止
+func (h *studyRoomHub) canControlPomodoro(userID uint64) bool {
+	db := database.GetDB()
+	var room models.StudyRoom
+	if err := db.First(&room, h.roomID).Error; err != nil {
+		return false
+	}
+	return studyRoomRole(db, &room, userID) >= models.StudyRoomRoleModerator
+}
+
+func (h *studyRoomHub) startRoomPomodoro(client *studyClient, cfg pomodoro.Config) {
+	now := time.Now()
+	h.pomodoroMu.Lock()
+	if h.pomodoro != nil {
+		h.stopRoomPomodoroLocked(now)
+	}
+	roomID := h.roomID
+	p, err := pomodoro.Start(client.userID, nil, &roomID, cfg, now)
+	if err != nil {
+		h.pomodoroMu.Unlock()
+		log.Printf("start room %d pomodoro failed: %v", h.roomID, err)
+		client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "开启番茄钟失败"})})
+		return
+	}
+	h.pomodoro = p
+	h.schedulePomodoroLocked()
+	state := pomodoro.Snapshot(p, now)
+	h.pomodoroMu.Unlock()
+
+	h.broadcast(wsEnvelope{Type: "pomodoro_state", Data: mustMarshal(map[string]interface{}{
+		"started_by": client.userID,
+		"pomodoro":   state,
+	})}, 0)
+}
+
+func (h *studyRoomHub) stopRoomPomodoro(client *studyClient) {
+	now := time.Now()
+	h.pomodoroMu.Lock()
+	if h.pomodoro == nil {
+		h.pomodoroMu.Unlock()
+		return
+	}
+	state := h.stopRoomPomodoroLocked(now)
+	h.pomodoroMu.Unlock()
+
+	h.broadcast(wsEnvelope{Type: "pomodoro_stopped", Data: mustMarshal(map[string]interface{}{
+		"stopped_by": client.userID,
+		"pomodoro":   state,
+	})}, 0)
+}
+
+// interruptRoomPomodoro 记录成员对房间番茄钟的中断。pomodoroID 非零时要求与当前运行的番茄钟一致；
+// 发起人在工作阶段中断会重置房间节奏，此时重新计时并通知其他实例重新加载
+func (h *studyRoomHub) interruptRoomPomodoro(pomodoroID, userID uint64, reason string) (*models.PomodoroInterruption, pomodoro.State, error) {
+	now := time.Now()
+	h.pomodoroMu.Lock()
+	if h.pomodoro == nil || (pomodoroID != 0 && h.pomodoro.ID != pomodoroID) {
+		h.pomodoroMu.Unlock()
+		return nil, pomodoro.State{}, pomodoro.ErrPomodoroEnded
+	}
+	record, transitions, err := pomodoro.Interrupt(h.pomodoro, userID, reason, now)
+	if err != nil {
+		h.pomodoroMu.Unlock()
+		return nil, pomodoro.State{}, err
+	}
+	// 中断前到期的阶段已在此推进，计时器触发时不会再计入，需要在这里给本机成员补上
+	h.creditRoomFocus(h.localUserIDs(), pomodoro.CreditedMinutes(transitions))
+	reset := h.pomodoro.PhaseStartedAt.Equal(now)
+	h.schedulePomodoroLocked()
+	state := pomodoro.Snapshot(h.pomodoro, now)
+	h.pomodoroMu.Unlock()
+
+	if reset {
+		h.broadcast(wsEnvelope{Type: "pomodoro_state", Data: mustMarshal(map[string]interface{}{
+			"interrupted_by": userID,
+			"pomodoro":       state,
+		})}, 0)
+	}
+	return record, state, nil
+}
+
+func (h *studyRoomHub) stopRoomPomodoroLocked(now time.Time) pomodoro.State {
+	if h.pomodoroTimer != nil {
+		h.pomodoroTimer.Stop()
+		h.pomodoroTimer = nil
+	}
+	p := h.pomodoro
+	h.pomodoro = nil
+	transitions, partial, err := pomodoro.Finish(p, now)
+	if err != nil {
+		log.Printf("finish room %d pomodoro failed: %v", h.roomID, err)
+	}
+	// 手动结束只在发起的实例执行，需要为所有实例上的在线成员计入
+	h.creditRoomFocus(h.presentUserIDs(), pomodoro.CreditedMinutes(transitions)+partial)
+	return pomodoro.Snapshot(p, now)
+}
+
+func (h *studyRoomHub) schedulePomodoroLocked() {
+	if h.pomodoroTimer != nil {
+		h.pomodoroTimer.Stop()
+	}
+	wait := time.Until(pomodoro.PhaseEndsAt(h.pomodoro))
+	if wait < 0 {
+		wait = 0
+	}
+	current := h.pomodoro
+	h.pomodoroTimer = time.AfterFunc(wait, func() {
+		h.onPomodoroPhaseEnd(current)
+	})
+}
+
+// onPomodoroPhaseEnd 阶段结束时推进番茄钟、给在线成员计入专注分钟并广播新阶段
+func (h *studyRoomHub) onPomodoroPhaseEnd(expected *models.PomodoroSession) {
+	now := time.Now()
+	h.pomodoroMu.Lock()
+	if h.pomodoro == nil || h.pomodoro != expected {
+		h.pomodoroMu.Unlock()
+		return
+	}
+	transitions, err := pomodoro.Sync(h.pomodoro, now)
+	if err != nil {
+		log.Printf("advance room %d pomodoro failed: %v", h.roomID, err)
+	}
+	h.creditRoomFocus(h.localUserIDs(), pomodoro.CreditedMinutes(transitions))
+	h.schedulePomodoroLocked()
+	state := pomodoro.Snapshot(h.pomodoro, now)
+	h.pomodoroMu.Unlock()
+
+	if len(transitions) == 0 {
+		return
+	}
+	// 每个实例各自按同一份番茄钟记录推进计时，阶段变化只推送给本机连接，避免重复
+	h.deliverLocal(wsEnvelope{Type: "pomodoro_phase", Data: mustMarshal(map[string]interface{}{
+		"transitions": transitions,
+		"pomodoro":    state,
+	})}, nil, nil)
+}
+
+// applyRemoteEvent 其他实例开启或结束房间番茄钟后，同步本机的计时器
+func (h *studyRoomHub) applyRemoteEvent(env wsEnvelope) {
+	switch env.Type {
+	case "pomodoro_state":
+		h.pomodoroMu.Lock()
+		defer h.pomodoroMu.Unlock()
+		h.dropRoomPomodoroLocked()
+		p, err := pomodoro.FindActiveByRoom(h.roomID)
+		if err != nil {
+			return
+		}
+		h.pomodoro = p
+		h.schedulePomodoroLocked()
+	case "pomodoro_stopped":
+		h.pomodoroMu.Lock()
+		defer h.pomodoroMu.Unlock()
+		h.dropRoomPomodoroLocked()
+	}
+}
+
+// dropRoomPomodoroLocked 仅停止本机计时，不写入结束记录
+func (h *studyRoomHub) dropRoomPomodoroLocked() {
+	if h.pomodoroTimer != nil {
+		h.pomodoroTimer.Stop()
+		h.pomodoroTimer = nil
+	}
+	h.pomodoro = nil
+}
+
+// creditRoomFocus 为指定成员当前的自习会话累加专注分钟，不超过各自会话的可计入上限
+func (h *studyRoomHub) creditRoomFocus(userIDs []uint64, minutes int) {
+	if minutes <= 0 || len(userIDs) == 0 {
+		return
+	}
+	db := database.GetDB()
+	var sessions []models.StudySession
+	if err := db.Where("user_id IN ? AND source = ? AND source_id = ? AND end_time IS NULL", userIDs, "study_room", h.roomID).
+		Find(&sessions).Error; err != nil {
+		log.Printf("credit room %d focus minutes failed: %v", h.roomID, err)
+		return
+	}
+	for i := range sessions {
+		creditFocusWithinCap(db, &sessions[i], minutes)
+	}
+}
+
+func (h *studyRoomHub) localUserIDs() []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	userIDs := make([]uint64, 0, len(h.clients))
+	for id := range h.clients {
+		userIDs = append(userIDs, id)
+	}
+	return userIDs
+}
+
+func (h *studyRoomHub) presentUserIDs() []uint64 {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	presence := h.presence(ctx)
+	userIDs := make([]uint64, 0, len(presence))
+	for id := range presence {
+		userIDs = append(userIDs, id)
+	}
+	return userIDs
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+	"learningAssistant-backend/services/pomodoro"
+)
+
+func TestInterruptRoomPomodoroGoesThroughHub(t *testing.T) {
+	r, db := setupTaskCollaborationTest(t)
+	registerPomodoroRoutes(r.Group("/api/study"))
+	previous := studyHubRegistry
+	studyHubRegistry = newStudyHubStore(backplane.NewMemory())
+	t.Cleanup(func() { studyHubRegistry = previous })
+
+	room := models.StudyRoom{Name: "番茄自习", OwnerUserID: 1}
+	db.Create(&room)
+	db.Create(&models.StudyRoomMember{RoomID: room.ID, UserID: 1})
+	db.Create(&models.StudyRoomMember{RoomID: room.ID, UserID: 2})
+	roomID := room.ID
+	p, err := pomodoro.Start(1, nil, &roomID, pomodoro.Config{}, time.Now().Add(-10*time.Minute))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	hub := studyHubRegistry.getHub(room.ID)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	body := map[string]interface{}{"pomodoro_id": p.ID, "user_id": 1, "reason": "走神"}
+	anonymous := authRequest(http.MethodPost, "/api/study/pomodoro/interrupt", 0, body)
+	anonymous.Header.Del("Authorization")
+	if w := serve(anonymous); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected anonymous interrupt to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(authRequest(http.MethodPost, "/api/study/pomodoro/interrupt", 3, body)); w.Code != http.StatusForbidden {
+		t.Fatalf("expected non-member interrupt to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 成员中断只记录，不打断房间节奏；发起人中断时重新计时，hub 与数据库保持一致
+	if w := serve(authRequest(http.MethodPost, "/api/study/pomodoro/interrupt", 2, body)); w.Code != http.StatusOK {
+		t.Fatalf("member interrupt: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(authRequest(http.MethodPost, "/api/study/pomodoro/interrupt", 1, body)); w.Code != http.StatusOK {
+		t.Fatalf("owner interrupt: %d %s", w.Code, w.Body.String())
+	}
+	state := hub.roomPomodoroState()
+	stored, _ := pomodoro.Load(p.ID)
+	if state == nil || state.InterruptionCount != 2 || stored.InterruptionCount != 2 {
+		t.Fatalf("expected hub and database to record both interruptions, got %+v / %+v", state, stored)
+	}
+	if !stored.PhaseStartedAt.Equal(state.PhaseStartedAt) || time.Since(stored.PhaseStartedAt) > time.Minute {
+		t.Fatalf("expected owner interrupt to restart the phase everywhere, hub %v db %v", state.PhaseStartedAt, stored.PhaseStartedAt)
+	}
+	var interruptions []models.PomodoroInterruption
+	db.Where("pomodoro_id = ?", p.ID).Order("id").Find(&interruptions)
+	if len(interruptions) != 2 || interruptions[0].UserID != 2 || interruptions[1].UserID != 1 {
+		t.Fatalf("expected interruptions attributed to the authenticated users, got %+v", interruptions)
+	}
+}
+
+func TestAutoCloseEndsStalePersonalPomodoroAtLastPing(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	lastPing := start.Add(40 * time.Minute)
+	session := models.StudySession{UserID: 1, Source: "focus", StartTime: start, LastPingAt: lastPing}
+	db.Create(&session)
+	sessionID := session.ID
+	p, err := pomodoro.Start(1, &sessionID, nil, pomodoro.Config{}, start)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if closed, err := autoCloseExpiredSessions(db, time.Now()); err != nil || closed != 1 {
+		t.Fatalf("expected the stale session to be closed, got %d %v", closed, err)
+	}
+	stored, _ := pomodoro.Load(p.ID)
+	if stored.Status != models.PomodoroStatusEnded || stored.EndedAt == nil || !stored.EndedAt.Equal(lastPing) || stored.FocusMinutes != 35 {
+		t.Fatalf("expected pomodoro to end at the last ping with 35 focus minutes, got %+v", stored)
+	}
+	db.First(&session, session.ID)
+	if session.FocusMinutes != 35 {
+		t.Fatalf("expected session to be credited 35 focus minutes, got %d", session.FocusMinutes)
+	}
+}
+
+func TestRoomPomodoroControlRequiresModerator(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	room := models.StudyRoom{Name: "番茄自习", OwnerUserID: 1, Status: 1}
+	db.Create(&room)
+	_, srv := startHubInstance(t, backplane.NewMemory())
+	owner := dialRoom(t, srv, room.ID, 1)
+	waitForEvent(t, owner, "state")
+	member := dialRoom(t, srv, room.ID, 2)
+	waitForEvent(t, member, "state")
+
+	sendEvent(t, member, "pomodoro_start", map[string]int{"work_minutes": 25})
+	waitForEvent(t, member, "error")
+	if _, err := pomodoro.FindActiveByRoom(room.ID); err == nil {
+		t.Fatal("expected plain member to be unable to start the room pomodoro")
+	}
+
+	sendEvent(t, owner, "pomodoro_start", map[string]int{"work_minutes": 25})
+	waitForEvent(t, member, "pomodoro_state")
+	sendEvent(t, member, "pomodoro_stop", nil)
+	waitForEvent(t, member, "error")
+	if _, err := pomodoro.FindActiveByRoom(room.ID); err != nil {
+		t.Fatalf("expected room pomodoro to survive a member stop, got %v", err)
+	}
+}
+
+func TestRoomFocusCreditIsCappedAtLastPing(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	start := time.Now().Add(-8 * time.Hour)
+	roomID := uint64(30)
+	session := models.StudySession{UserID: 1, Source: "study_room", SourceID: &roomID, StartTime: start, LastPingAt: start.Add(50 * time.Minute)}
+	db.Create(&session)
+	hub := newStudyHubStore(backplane.NewMemory()).getHub(roomID)
+
+	// 停机后恢复时补推的阶段远超心跳覆盖的时长，只能计入到最后一次心跳
+	hub.creditRoomFocus([]uint64{1}, 8*25)
+	db.First(&session, session.ID)
+	if session.FocusMinutes != 50 {
+		t.Fatalf("expected focus capped at 50 minutes, got %d", session.FocusMinutes)
+	}
+
+	ended := time.Now()
+	closed := models.StudySession{UserID: 1, Source: "focus", StartTime: start, LastPingAt: ended, EndTime: &ended, DurationMinutes: 20}
+	db.Create(&closed)
+	addStudySessionFocusMinutes(db, &closed, 75)
+	if closed.FocusMinutes != 20 {
+		t.Fatalf("expected focus capped at credited duration 20, got %d", closed.FocusMinutes)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -13,6 +14,10 @@ import (
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+	"learningAssistant-backend/services/pomodoro"
+	"learningAssistant-backend/services/studyguard"
+	"learningAssistant-backend/services/usertime"
 )
 
 const (
@@ -24,11 +29,15 @@ type startStudySessionRequest struct {
 	Source   string  `json:"source"`
 	SourceID *uint64 `json:"source_id"`
 	Note     string  `json:"note"`
+	// Pomodoro 携带时开启番茄钟；未携带时按用户的专注模式设置决定
+	Pomodoro *pomodoro.Config `json:"pomodoro"`
 }
 
 type pingStudySessionRequest struct {
 	SessionID uint64 `json:"session_id"`
 	UserID    uint64 `json:"user_id"`
+	// Idle 前端检测到自上次心跳以来无任何操作
+	Idle bool `json:"idle"`
 }
 
 type endStudySessionRequest struct {
@@ -41,6 +50,8 @@ func registerStudySessionRoutes(router *gin.RouterGroup) {
 	router.POST("/ping", handlePingStudySession)
 	router.POST("/end", handleEndStudySession)
 	router.POST("/aggregate/daily", handleAggregateDailyStudyStats)
+	router.GET("/sessions/review", handleReviewStudySessions)
+	registerPomodoroRoutes(router)
 }
 
 func handleStartStudySession(c *gin.Context) {
@@ -72,14 +83,28 @@ func handleStartStudySession(c *gin.Context) {
 		return
 	}
 
+	data := gin.H{
+		"session_id": session.ID,
+		"start_time": session.StartTime.Format(time.RFC3339),
+		"source":     session.Source,
+	}
+	if shouldStartPomodoro(db, req.UserID, req.Pomodoro) {
+		cfg := pomodoro.Config{}
+		if req.Pomodoro != nil {
+			cfg = *req.Pomodoro
+		}
+		sessionID := session.ID
+		if p, err := pomodoro.Start(req.UserID, &sessionID, nil, cfg, now); err == nil {
+			data["pomodoro"] = pomodoro.Snapshot(p, now)
+		} else {
+			log.Printf("start pomodoro for session %d failed: %v", session.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data": gin.H{
-			"session_id": session.ID,
-			"start_time": session.StartTime.Format(time.RFC3339),
-			"source":     session.Source,
-		},
+		"data":    data,
 	})
 }
 
@@ -143,21 +168,31 @@ func handlePingStudySession(c *gin.Context) {
 		return
 	}
 
+	pingUpdate := map[string]interface{}{"last_ping_at": now}
+	if req.Idle || studyguard.IsGap(studyguard.CurrentConfig(), session.LastPingAt, now) {
+		gap := int(now.Sub(session.LastPingAt).Seconds())
+		pingUpdate["idle_seconds"] = gorm.Expr("idle_seconds + ?", gap)
+	}
 	if err := db.Model(&models.StudySession{}).
 		Where("id = ? AND end_time IS NULL", session.ID).
-		Update("last_ping_at", now).Error; err != nil {
+		Updates(pingUpdate).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新心跳失败"})
 		return
 	}
 
+	data := gin.H{
+		"session_id": session.ID,
+		"last_ping":  now.Format(time.RFC3339),
+		"ended":      false,
+	}
+	if state := syncStudySessionPomodoro(db, &session, now); state != nil {
+		data["pomodoro"] = state
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "pong",
-		"data": gin.H{
-			"session_id": session.ID,
-			"last_ping":  now.Format(time.RFC3339),
-			"ended":      false,
-		},
+		"data":    data,
 	})
 }
 
@@ -226,21 +261,64 @@ func finalizeStudySession(db *gorm.DB, session *models.StudySession, endTime tim
 		endTime = session.StartTime
 	}
 
-	duration := calculateDurationMinutes(session.StartTime, endTime)
+	others, err := studyguard.LoadOtherIntervals(db, session.UserID, session.ID, session.StartTime, endTime)
+	if err != nil {
+		return err
+	}
+	guardCfg := studyguard.CurrentConfig()
+	result := studyguard.EvaluateSession(guardCfg, studyguard.SessionInput{
+		Start:       session.StartTime,
+		End:         endTime,
+		IdleSeconds: session.IdleSeconds,
+		Others:      others,
+	})
+
 	update := map[string]interface{}{
 		"end_time":         endTime,
-		"duration_minutes": duration,
+		"duration_minutes": result.CreditedMinutes,
+		"raw_minutes":      result.RawMinutes,
+		"flagged":          len(result.Adjustments) > 0,
 		"last_ping_at":     endTime,
 	}
-	if err := db.Model(&models.StudySession{}).
+	res := db.Model(&models.StudySession{}).
 		Where("id = ? AND end_time IS NULL", session.ID).
-		Updates(update).Error; err != nil {
-		return err
+		Updates(update)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 已被其他请求结束，避免重复计分
+		return db.First(session, session.ID).Error
 	}
 
 	session.EndTime = &endTime
-	session.DurationMinutes = duration
+	session.DurationMinutes = result.CreditedMinutes
+	session.RawMinutes = result.RawMinutes
+	session.Flagged = len(result.Adjustments) > 0
 	session.LastPingAt = endTime
+	endDay := usertime.StartOfDay(endTime, usertime.ForUser(session.UserID))
+	if err := studyguard.RecordSessionAdjustments(db, session, usertime.CalendarDate(endDay), result.Adjustments); err != nil {
+		log.Printf("record adjustments for session %d failed: %v", session.ID, err)
+	}
+	finishStudySessionPomodoro(db, session, endTime)
+
+	// 自习室积分按校验后的时长同步记入积分账本，账本按会话幂等，重复结束不会重复发放；
+	// 日聚合会把超出单日上限的部分截掉，发放时同样只计入当日剩余额度
+	if session.Source == "study_room" && result.CreditedMinutes > 0 {
+		remaining, err := studyguard.DailyRemaining(db, guardCfg, session.UserID, session.ID, endDay, usertime.AddDays(endDay, 1))
+		if err != nil {
+			log.Printf("load daily remaining minutes for session %d failed: %v", session.ID, err)
+			return nil
+		}
+		awardMinutes := minInt(result.CreditedMinutes, remaining)
+		if awardMinutes <= 0 {
+			return nil
+		}
+		if _, err := points.AwardStudyRoomDuration(session.UserID, session.ID, session.SourceID, awardMinutes); err != nil &&
+			!errors.Is(err, points.ErrInsufficientDuration) && !errors.Is(err, points.ErrAlreadyAwarded) {
+			log.Printf("award study room points for session %d failed: %v", session.ID, err)
+		}
+	}
 	return nil
 }
 
@@ -266,7 +344,7 @@ func autoCloseExpiredSessions(db *gorm.DB, now time.Time) (int, error) {
 func normalizeSessionSource(source string) string {
 	val := strings.TrimSpace(strings.ToLower(source))
 	switch val {
-	case "study_room", "task", "focus", "video":
+	case "study_room", "group_call", "task", "focus", "video":
 		return val
 	default:
 		return "unknown"
@@ -298,14 +376,19 @@ func handleAggregateDailyStudyStats(c *gin.Context) {
 	var req aggregateDailyRequest
 	_ = c.ShouldBindJSON(&req)
 
-	targetDay := normalizeDay(time.Now())
+	// 未指定日期时，按目标用户（或服务器）时区的今天聚合
+	loc := time.Local
+	if req.UserID != 0 {
+		loc = usertime.ForUser(req.UserID)
+	}
+	targetDay := usertime.StartOfDay(time.Now(), loc)
 	if strings.TrimSpace(req.Date) != "" {
-		parsed, err := time.Parse("2006-01-02", strings.TrimSpace(req.Date))
+		parsed, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(req.Date), loc)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "date 格式应为 YYYY-MM-DD"})
 			return
 		}
-		targetDay = normalizeDay(parsed.In(time.Now().Location()))
+		targetDay = parsed
 	}
 
 	db := database.GetDB()
@@ -338,11 +421,14 @@ type dailyAggregation struct {
 	StudyRoomNightMinutes int
 }
 
+// aggregateDailyStats 聚合 day 所在日历日的学习统计，每个用户按自己的时区划定当天范围
 func aggregateDailyStats(db *gorm.DB, day time.Time, userFilter uint64) (int, error) {
-	dayStart := normalizeDay(day)
-	dayEnd := dayStart.Add(24 * time.Hour)
+	year, month, date := day.Date()
+	// 时区跨度为 UTC-12 ~ UTC+14，先取足够宽的 UTC 窗口再按用户时区过滤
+	probeStart := time.Date(year, month, date, 0, 0, 0, 0, time.UTC).Add(-15 * time.Hour)
+	probeEnd := time.Date(year, month, date+1, 0, 0, 0, 0, time.UTC).Add(13 * time.Hour)
 
-	query := db.Where("end_time IS NOT NULL AND end_time >= ? AND end_time < ?", dayStart, dayEnd)
+	query := db.Where("end_time IS NOT NULL AND end_time >= ? AND end_time < ?", probeStart, probeEnd)
 	if userFilter != 0 {
 		query = query.Where("user_id = ?", userFilter)
 	}
@@ -352,12 +438,21 @@ func aggregateDailyStats(db *gorm.DB, day time.Time, userFilter uint64) (int, er
 		return 0, err
 	}
 
+	dayStarts := make(map[uint64]time.Time)
 	aggMap := make(map[uint64]*dailyAggregation)
 	for i := range sessions {
 		session := sessions[i]
 		if session.EndTime == nil {
 			continue
 		}
+		dayStart, ok := dayStarts[session.UserID]
+		if !ok {
+			dayStart = time.Date(year, month, date, 0, 0, 0, 0, usertime.ForUser(session.UserID))
+			dayStarts[session.UserID] = dayStart
+		}
+		if session.EndTime.Before(dayStart) || !session.EndTime.Before(usertime.AddDays(dayStart, 1)) {
+			continue
+		}
 		agg := aggMap[session.UserID]
 		if agg == nil {
 			agg = &dailyAggregation{}
@@ -372,24 +467,47 @@ func aggregateDailyStats(db *gorm.DB, day time.Time, userFilter uint64) (int, er
 		agg.SessionCount++
 
 		night := nightMinutesForDay(dayStart, session.StartTime, *session.EndTime)
-		morning := minutesInWindow(session.StartTime, *session.EndTime, dayStart, dayStart.Add(8*time.Hour))
+		morning := minutesInWindow(session.StartTime, *session.EndTime, dayStart, usertime.At(dayStart, 8))
 		agg.NightMinutes += night
 		agg.MorningMinutes += morning
 
+		// 番茄钟计入的专注分钟优先；旧的 focus 会话没有番茄钟时整段视为专注
+		focus := session.FocusMinutes
+		if focus == 0 && session.Source == "focus" {
+			focus = duration
+		}
+		if focus > duration {
+			focus = duration
+		}
+		agg.FocusModeMinutes += focus
+
 		switch session.Source {
-		case "focus":
-			agg.FocusModeMinutes += duration
 		case "study_room":
 			agg.StudyRoomMinutes += duration
 			agg.StudyRoomNightMinutes += night
 		}
 	}
 
+	guardCfg := studyguard.CurrentConfig()
 	updated := 0
 	for userID, stat := range aggMap {
+		statDate := usertime.CalendarDate(dayStarts[userID])
+		deducted := studyguard.ClipDaily(guardCfg, stat.Minutes)
+		if deducted > 0 {
+			stat.Minutes -= deducted
+			stat.NightMinutes = minInt(stat.NightMinutes, stat.Minutes)
+			stat.MorningMinutes = minInt(stat.MorningMinutes, stat.Minutes)
+			stat.FocusModeMinutes = minInt(stat.FocusModeMinutes, stat.Minutes)
+			stat.StudyRoomMinutes = minInt(stat.StudyRoomMinutes, stat.Minutes)
+			stat.StudyRoomNightMinutes = minInt(stat.StudyRoomNightMinutes, stat.Minutes)
+		}
+		if err := studyguard.ReplaceDailyCapAdjustment(db, userID, statDate, deducted, guardCfg.MaxDailyMinutes); err != nil {
+			return updated, err
+		}
+
 		record := models.DailyStudyStat{
 			UserID:                userID,
-			Date:                  dayStart,
+			Date:                  statDate,
 			Minutes:               stat.Minutes,
 			SessionCount:          stat.SessionCount,
 			NightMinutes:          stat.NightMinutes,
@@ -490,11 +608,6 @@ func updateStudyAchievementProgress(db *gorm.DB, userID uint64, totals studyTota
 		Updates(updates).Error
 }
 
-func normalizeDay(t time.Time) time.Time {
-	loc := t.Location()
-	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
-}
-
 func minutesInWindow(start, end, windowStart, windowEnd time.Time) int {
 	if end.Before(windowStart) || start.After(windowEnd) {
 		return 0
@@ -515,10 +628,131 @@ func minutesInWindow(start, end, windowStart, windowEnd time.Time) int {
 
 func nightMinutesForDay(dayStart, start, end time.Time) int {
 	earlyStart := dayStart
-	earlyEnd := dayStart.Add(2 * time.Hour)
-	lateStart := dayStart.Add(22 * time.Hour)
-	lateEnd := dayStart.Add(24 * time.Hour)
+	earlyEnd := usertime.At(dayStart, 2)
+	lateStart := usertime.At(dayStart, 22)
+	lateEnd := usertime.AddDays(dayStart, 1)
 
 	return minutesInWindow(start, end, earlyStart, earlyEnd) +
 		minutesInWindow(start, end, lateStart, lateEnd)
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type reviewedStudySession struct {
+	SessionID       uint64                          `json:"session_id"`
+	Source          string                          `json:"source"`
+	StartTime       time.Time                       `json:"start_time"`
+	EndTime         *time.Time                      `json:"end_time"`
+	RawMinutes      int                             `json:"raw_minutes"`
+	CreditedMinutes int                             `json:"credited_minutes"`
+	IdleSeconds     int                             `json:"idle_seconds"`
+	Adjustments     []models.StudySessionAdjustment `json:"adjustments"`
+}
+
+// handleReviewStudySessions 列出用户近期被校验规则扣减的会话及原因
+func handleReviewStudySessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return
+	}
+	if requested := parseUint64(c.Query("user_id")); requested != 0 && requested != userID {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "只能查看自己的校验记录"})
+		return
+	}
+	days := 7
+	if raw := strings.TrimSpace(c.Query("days")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			days = minInt(parsed, 30)
+		}
+	}
+
+	db := database.GetDB()
+	since := usertime.AddDays(usertime.StartOfDay(time.Now(), usertime.ForUser(userID)), -(days - 1))
+
+	var adjustments []models.StudySessionAdjustment
+	if err := db.Where("user_id = ? AND date >= ?", userID, usertime.CalendarDate(since)).
+		Order("date DESC, id ASC").
+		Find(&adjustments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载校验记录失败"})
+		return
+	}
+
+	bySession := make(map[uint64][]models.StudySessionAdjustment)
+	daily := make([]models.StudySessionAdjustment, 0)
+	sessionIDs := make([]uint64, 0)
+	for _, adj := range adjustments {
+		if adj.SessionID == nil {
+			daily = append(daily, adj)
+			continue
+		}
+		if _, ok := bySession[*adj.SessionID]; !ok {
+			sessionIDs = append(sessionIDs, *adj.SessionID)
+		}
+		bySession[*adj.SessionID] = append(bySession[*adj.SessionID], adj)
+	}
+
+	var sessions []models.StudySession
+	if len(sessionIDs) > 0 {
+		if err := db.Where("id IN ?", sessionIDs).Order("start_time DESC").Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "加载学习会话失败"})
+			return
+		}
+	}
+
+	var totals struct {
+		RawMinutes      int
+		CreditedMinutes int
+	}
+	if err := db.Model(&models.StudySession{}).
+		Select("COALESCE(SUM(CASE WHEN raw_minutes > 0 THEN raw_minutes ELSE duration_minutes END),0) as raw_minutes, COALESCE(SUM(duration_minutes),0) as credited_minutes").
+		Where("user_id = ? AND end_time IS NOT NULL AND start_time >= ?", userID, since).
+		Scan(&totals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "统计学习时长失败"})
+		return
+	}
+
+	items := make([]reviewedStudySession, 0, len(sessions))
+	deducted := 0
+	for _, session := range sessions {
+		for _, adj := range bySession[session.ID] {
+			deducted += adj.DeductedMinutes
+		}
+		items = append(items, reviewedStudySession{
+			SessionID:       session.ID,
+			Source:          session.Source,
+			StartTime:       session.StartTime,
+			EndTime:         session.EndTime,
+			RawMinutes:      session.RawMinutes,
+			CreditedMinutes: session.DurationMinutes,
+			IdleSeconds:     session.IdleSeconds,
+			Adjustments:     bySession[session.ID],
+		})
+	}
+	for _, adj := range daily {
+		deducted += adj.DeductedMinutes
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"user_id": userID,
+			"since":   since.Format("2006-01-02"),
+			"rules":   studyguard.CurrentConfig(),
+			"summary": gin.H{
+				"raw_minutes":      totals.RawMinutes,
+				"credited_minutes": totals.CreditedMinutes,
+				"deducted_minutes": deducted,
+				"flagged_sessions": len(items),
+			},
+			"sessions":          items,
+			"daily_adjustments": daily,
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+func TestStudyRoomAwardRespectsDailyCap(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	loc := usertime.ForUser(1)
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, loc)
+	earlierEnd := noon.Add(-3 * time.Hour)
+	db.Create(&models.StudySession{UserID: 1, Source: "focus", StartTime: earlierEnd.Add(-time.Hour), EndTime: &earlierEnd, LastPingAt: earlierEnd, DurationMinutes: 900})
+
+	roomID := uint64(5)
+	session := models.StudySession{UserID: 1, Source: "study_room", SourceID: &roomID, StartTime: noon.Add(-2 * time.Hour), LastPingAt: noon}
+	db.Create(&session)
+	if err := finalizeStudySession(db, &session, noon); err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	if session.DurationMinutes != 120 {
+		t.Fatalf("expected 120 credited minutes, got %d", session.DurationMinutes)
+	}
+
+	// 当天已计入 900 分钟，单日上限 960，积分只按剩余的 60 分钟发放
+	var entry models.PointsLedger
+	if err := db.Where("user_id = ? AND source_type = ?", 1, models.PointsSourceStudyRoom).First(&entry).Error; err != nil {
+		t.Fatalf("load ledger: %v", err)
+	}
+	if entry.Remark != "自习室在线 60 分钟" || entry.Delta != 20 {
+		t.Fatalf("expected award for the 60 minutes left under the daily cap, got %+v", entry)
+	}
+}
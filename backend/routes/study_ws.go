@@ -1,24 +1,41 @@
 package routes
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"gorm.io/gorm"
 
+	"learningAssistant-backend/config"
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/backplane"
+	"learningAssistant-backend/services/directmsg"
+	"learningAssistant-backend/services/pomodoro"
 )
 
-var studyHubRegistry = newStudyHubStore()
+var studyHubRegistry = newStudyHubStore(nil)
+
+const (
+	// 在线状态定期刷新，超过 TTL 未刷新的成员（例如实例崩溃）视为离线
+	hubPresenceRefresh  = 30 * time.Second
+	hubPresenceTTL      = 90 * time.Second
+	hubBackplaneTimeout = 3 * time.Second
+)
 
 type wsEnvelope struct {
 	Type string          `json:"type"`
@@ -33,72 +50,265 @@ type wsMemberState struct {
 	PartnerID   *uint64 `json:"partner_id,omitempty"`
 }
 
+// hubPresence 写入 Backplane 的在线成员信息
+type hubPresence struct {
+	wsMemberState
+	Instance string    `json:"instance"`
+	ConnID   string    `json:"conn_id"`
+	JoinedAt time.Time `json:"joined_at"`
+	SeenAt   time.Time `json:"seen_at"`
+}
+
+// hubRelay 经 Backplane 广播的房间消息，各实例只投递给本机连接中的目标成员
+type hubRelay struct {
+	Origin   string     `json:"origin"`
+	To       []uint64   `json:"to,omitempty"`
+	Exclude  []uint64   `json:"exclude,omitempty"`
+	Envelope wsEnvelope `json:"envelope"`
+}
+
 type studyHubStore struct {
-	mu   sync.Mutex
-	hubs map[uint64]*studyRoomHub
+	mu          sync.Mutex
+	hubs        map[uint64]*studyRoomHub
+	bp          backplane.Backplane
+	bpOnce      sync.Once
+	instanceID  string
+	refreshOnce sync.Once
+
+	directOnce        sync.Once
+	directUnsubscribe func()
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	closed    bool
 }
 
-func newStudyHubStore() *studyHubStore {
+func newStudyHubStore(bp backplane.Backplane) *studyHubStore {
+	host, _ := os.Hostname()
 	return &studyHubStore{
-		hubs: make(map[uint64]*studyRoomHub),
+		hubs:       make(map[uint64]*studyRoomHub),
+		bp:         bp,
+		instanceID: fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		stop:       make(chan struct{}),
 	}
 }
 
+// backplane 返回跨实例消息总线，未注入时按配置创建
+func (m *studyHubStore) backplane() backplane.Backplane {
+	m.bpOnce.Do(func() {
+		if m.bp == nil {
+			m.bp = newConfiguredBackplane()
+		}
+	})
+	return m.bp
+}
+
+func newConfiguredBackplane() backplane.Backplane {
+	if config.AppConfig != nil && strings.EqualFold(config.AppConfig.Backplane.Driver, "redis") {
+		cfg := config.AppConfig.Backplane
+		bp, err := backplane.NewRedis(backplane.RedisOptions{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		if err == nil {
+			log.Printf("[StudyHub] using redis backplane at %s", cfg.RedisAddr)
+			return bp
+		}
+		log.Printf("[StudyHub] redis backplane unavailable, falling back to memory: %v", err)
+	}
+	return backplane.NewMemory()
+}
+
+func backplaneContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), hubBackplaneTimeout)
+}
+
 func (m *studyHubStore) getHub(roomID uint64) *studyRoomHub {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if hub, ok := m.hubs[roomID]; ok {
+	bp := m.backplane()
+	m.ensureDirectSubscription()
+	if hub := m.lookupHub(roomID); hub != nil {
+		hub.restoreOnce.Do(hub.restoreRoomPomodoro)
 		return hub
 	}
-	hub := newStudyRoomHub(roomID)
+
+	// 订阅 Backplane 和恢复番茄钟都要访问外部服务，放在全局锁外进行，避免拖慢其他房间
+	hub := newStudyRoomHub(roomID, bp, m.instanceID)
+	hub.store = m
+	if unsubscribe, err := bp.Subscribe(roomID, hub.deliver); err != nil {
+		log.Printf("[StudyHub] subscribe room %d failed, messages stay local: %v", roomID, err)
+	} else {
+		hub.unsubscribe = unsubscribe
+	}
+
+	m.mu.Lock()
+	if existing, ok := m.hubs[roomID]; ok {
+		// 并发创建时以先登记的为准，放弃本次创建的订阅
+		m.mu.Unlock()
+		existing.touch()
+		if hub.unsubscribe != nil {
+			hub.unsubscribe()
+		}
+		existing.restoreOnce.Do(existing.restoreRoomPomodoro)
+		return existing
+	}
 	m.hubs[roomID] = hub
+	m.mu.Unlock()
+
+	hub.restoreOnce.Do(hub.restoreRoomPomodoro)
+	m.refreshOnce.Do(func() {
+		go m.refreshPresenceLoop()
+	})
 	return hub
 }
 
-func (m *studyHubStore) totalOnline() int {
+func (m *studyHubStore) lookupHub(roomID uint64) *studyRoomHub {
+	m.mu.Lock()
+	hub, ok := m.hubs[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	hub.touch()
+	return hub
+}
+
+func (m *studyHubStore) localHubs() []*studyRoomHub {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	total := 0
+	hubs := make([]*studyRoomHub, 0, len(m.hubs))
 	for _, hub := range m.hubs {
-		total += len(hub.clients)
+		hubs = append(hubs, hub)
 	}
-	return total
+	return hubs
+}
+
+// refreshPresenceLoop 定期刷新本机连接的在线状态，并回收长时间无人连接的房间
+func (m *studyHubStore) refreshPresenceLoop() {
+	ticker := time.NewTicker(hubPresenceRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			for _, hub := range m.localHubs() {
+				hub.refreshPresence()
+			}
+			m.reapIdleHubs(now)
+		}
+	}
+}
+
+// allPresence 汇总所有实例上的在线成员，Backplane 不可用时只统计本机
+func (m *studyHubStore) allPresence() []hubPresence {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	rooms, err := loadAllHubPresence(ctx, m.backplane())
+	if err != nil {
+		log.Printf("[StudyHub] list rooms failed: %v", err)
+		out := make([]hubPresence, 0)
+		for _, hub := range m.localHubs() {
+			out = append(out, hub.localPresence()...)
+		}
+		return out
+	}
+	out := make([]hubPresence, 0)
+	for _, members := range rooms {
+		for _, p := range members {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (m *studyHubStore) totalOnline() int {
+	return len(m.allPresence())
 }
 
 func (m *studyHubStore) activeMinutes() int {
-	m.mu.Lock()
-	defer m.mu.Unlock()
 	total := 0
 	now := time.Now()
-	for _, hub := range m.hubs {
-		for _, cl := range hub.clients {
-			if !cl.sessionStart.IsZero() {
-				mins := int(now.Sub(cl.sessionStart).Minutes())
-				if mins < 0 {
-					mins = 0
-				}
-				total += mins
+	for _, p := range m.allPresence() {
+		if !p.JoinedAt.IsZero() {
+			mins := int(now.Sub(p.JoinedAt).Minutes())
+			if mins < 0 {
+				mins = 0
 			}
+			total += mins
 		}
 	}
 	return total
 }
 
+// loadHubPresence 读取房间在线成员并过滤已过期的记录
+func loadHubPresence(ctx context.Context, bp backplane.Backplane, roomID uint64) (map[uint64]hubPresence, error) {
+	raw, err := bp.Members(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return parseHubPresence(raw, time.Now()), nil
+}
+
+// loadAllHubPresence 一次读取所有房间的在线成员，只保留仍有在线成员的房间
+func loadAllHubPresence(ctx context.Context, bp backplane.Backplane) (map[uint64]map[uint64]hubPresence, error) {
+	raw, err := bp.AllMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rooms := make(map[uint64]map[uint64]hubPresence, len(raw))
+	for roomID, data := range raw {
+		if members := parseHubPresence(data, now); len(members) > 0 {
+			rooms[roomID] = members
+		}
+	}
+	return rooms, nil
+}
+
+// parseHubPresence 解析成员在线信息，丢弃超过 TTL 未刷新的记录
+func parseHubPresence(raw map[uint64][]byte, now time.Time) map[uint64]hubPresence {
+	members := make(map[uint64]hubPresence, len(raw))
+	for userID, data := range raw {
+		var p hubPresence
+		if err := json.Unmarshal(data, &p); err != nil {
+			continue
+		}
+		if now.Sub(p.SeenAt) > hubPresenceTTL {
+			continue
+		}
+		members[userID] = p
+	}
+	return members
+}
+
 type studyRoomHub struct {
-	roomID   uint64
-	clients  map[uint64]*studyClient
-	pending  map[uint64]uint64 // target -> caller
-	busy     map[uint64]uint64 // user -> partner
-	mu       sync.Mutex
-	upgrader websocket.Upgrader
+	roomID      uint64
+	store       *studyHubStore
+	instanceID  string
+	bp          backplane.Backplane
+	unsubscribe func()
+	clients     map[uint64]*studyClient
+	mu          sync.Mutex
+	upgrader    websocket.Upgrader
+	// lastActive 最近一次被获取或有成员离开的时间，用于回收空房间
+	lastActive time.Time
+
+	// 房间同步番茄钟，锁顺序：pomodoroMu -> mu
+	pomodoroMu    sync.Mutex
+	pomodoro      *models.PomodoroSession
+	pomodoroTimer *time.Timer
+	// restoreOnce 保证房间番茄钟只恢复一次，恢复完成前同房间的其他调用方会等待
+	restoreOnce sync.Once
 }
 
-func newStudyRoomHub(roomID uint64) *studyRoomHub {
+func newStudyRoomHub(roomID uint64, bp backplane.Backplane, instanceID string) *studyRoomHub {
 	return &studyRoomHub{
-		roomID:  roomID,
-		clients: make(map[uint64]*studyClient),
-		pending: make(map[uint64]uint64),
-		busy:    make(map[uint64]uint64),
+		roomID:     roomID,
+		instanceID: instanceID,
+		bp:         bp,
+		clients:    make(map[uint64]*studyClient),
+		lastActive: time.Now(),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -113,11 +323,18 @@ type studyClient struct {
 	userID       uint64
 	displayName  string
 	peerID       string
+	connID       string
 	conn         *websocket.Conn
 	hub          *studyRoomHub
 	send         chan wsEnvelope
 	sessionStart time.Time
 	recordID     uint64
+
+	// done 在连接关闭时关闭，finished 在读循环完成清理后关闭
+	done      chan struct{}
+	finished  chan struct{}
+	closeOnce sync.Once
+	drops     atomic.Int32
 }
 
 func (h *studyRoomHub) handleWebSocket(c *gin.Context) {
@@ -128,17 +345,11 @@ func (h *studyRoomHub) handleWebSocket(c *gin.Context) {
 		return
 	}
 
-	userIDParam := c.Query("user_id")
-	displayName := strings.TrimSpace(c.Query("display_name"))
-	if userIDParam == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少用户ID"})
-		return
-	}
-	userID, err := strconv.ParseUint(userIDParam, 10, 64)
-	if err != nil || userID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "用户ID无效"})
+	userID, ok := studyWSUserID(c)
+	if !ok {
 		return
 	}
+	displayName := strings.TrimSpace(c.Query("display_name"))
 	if displayName == "" {
 		displayName = "学习者"
 	}
@@ -149,6 +360,15 @@ func (h *studyRoomHub) handleWebSocket(c *gin.Context) {
 		}
 	}
 
+	if h.store != nil && h.store.isClosed() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "服务正在重启，请稍后重连"})
+		return
+	}
+	if err := checkStudyRoomAdmission(database.GetDB(), roomID, userID, h); err != nil {
+		respondStudyRoomAdmission(c, err)
+		return
+	}
+
 	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println("websocket upgrade failed:", err)
@@ -158,36 +378,183 @@ func (h *studyRoomHub) handleWebSocket(c *gin.Context) {
 	client := &studyClient{
 		userID:      userID,
 		displayName: displayName,
+		connID:      fmt.Sprintf("%s-%d", h.instanceID, time.Now().UnixNano()),
 		conn:        conn,
 		hub:         h,
-		send:        make(chan wsEnvelope, 16),
+		send:        make(chan wsEnvelope, wsSendBuffer),
+		done:        make(chan struct{}),
+		finished:    make(chan struct{}),
 	}
 
-	h.registerClient(client)
+	if replaced := h.registerClient(client); replaced != nil {
+		// 同一用户的新连接替换旧连接，旧连接不再收到消息，直接关闭
+		replaced.closeWith(websocket.CloseNormalClosure, "replaced by a new connection")
+	}
 	h.startSession(client)
+	h.publishPresence(client)
 	go client.writeLoop()
 	go client.readLoop()
 
-	client.send <- wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())}
+	client.enqueue(wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())})
+	h.sendDocumentSnapshot(client)
 	h.broadcast(wsEnvelope{Type: "member_joined", Data: mustMarshal(h.memberState(client))}, client.userID)
 }
 
-func (h *studyRoomHub) registerClient(client *studyClient) {
+// studyWSUserID 从握手携带的访问令牌解析用户身份；浏览器无法为 WebSocket 设置请求头，
+// 因此同时支持 token 查询参数。user_id 参数仅作兼容，必须与令牌一致
+func studyWSUserID(c *gin.Context) (uint64, bool) {
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		token = strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	}
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "缺少授权信息"})
+		return 0, false
+	}
+	userID, err := extractUserIDFromToken(token, "mock-token-")
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "访问令牌已失效"})
+		return 0, false
+	}
+	if raw := c.Query("user_id"); raw != "" && raw != strconv.FormatUint(userID, 10) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "用户身份与令牌不一致"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// registerClient 登记本机连接，返回被替换的同一用户旧连接
+func (h *studyRoomHub) registerClient(client *studyClient) *studyClient {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	previous := h.clients[client.userID]
 	h.clients[client.userID] = client
+	if previous == client {
+		return nil
+	}
+	return previous
 }
 
-func (h *studyRoomHub) unregisterClient(client *studyClient) {
+// unregisterClient 清理连接，返回用户是否因此离开房间（被新连接替换时不算离开）
+func (h *studyRoomHub) unregisterClient(client *studyClient) bool {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	delete(h.clients, client.userID)
-	delete(h.pending, client.userID)
-	if partner, ok := h.busy[client.userID]; ok {
-		delete(h.busy, client.userID)
-		delete(h.busy, partner)
+	current := h.clients[client.userID] == client
+	if current {
+		delete(h.clients, client.userID)
+	}
+	h.lastActive = time.Now()
+	h.mu.Unlock()
+	if !current {
+		h.finishSession(client)
+		return false
+	}
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	h.removePresence(ctx, client)
+	if _, err := h.bp.ReleasePending(ctx, h.roomID, client.userID); err != nil {
+		log.Printf("[StudyHub] release pending call of user %d failed: %v", client.userID, err)
+	}
+	if busy, err := h.bp.BusyPartners(ctx, h.roomID); err == nil {
+		if partner, ok := busy[client.userID]; ok {
+			_ = h.bp.ClearBusy(ctx, h.roomID, client.userID, partner)
+		}
 	}
 	h.finishSession(client)
+	return true
+}
+
+// publishPresence 把本机连接的成员信息写入 Backplane
+func (h *studyRoomHub) publishPresence(client *studyClient) {
+	h.mu.Lock()
+	presence := hubPresence{
+		wsMemberState: wsMemberState{
+			UserID:      client.userID,
+			DisplayName: client.displayName,
+			PeerID:      client.peerID,
+		},
+		Instance: h.instanceID,
+		ConnID:   client.connID,
+		JoinedAt: client.sessionStart,
+		SeenAt:   time.Now(),
+	}
+	h.mu.Unlock()
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	if err := h.bp.SetMember(ctx, h.roomID, client.userID, mustMarshal(presence)); err != nil {
+		log.Printf("[StudyHub] publish presence of user %d failed: %v", client.userID, err)
+	}
+}
+
+// removePresence 仅移除属于该连接的在线记录，避免覆盖同一用户在其他实例上的新连接
+func (h *studyRoomHub) removePresence(ctx context.Context, client *studyClient) {
+	members, err := loadHubPresence(ctx, h.bp, h.roomID)
+	if err != nil {
+		log.Printf("[StudyHub] load presence of room %d failed: %v", h.roomID, err)
+		return
+	}
+	if p, ok := members[client.userID]; ok && p.ConnID != client.connID {
+		return
+	}
+	if err := h.bp.RemoveMember(ctx, h.roomID, client.userID); err != nil {
+		log.Printf("[StudyHub] remove presence of user %d failed: %v", client.userID, err)
+	}
+}
+
+func (h *studyRoomHub) refreshPresence() {
+	for _, client := range h.localClients() {
+		h.publishPresence(client)
+	}
+}
+
+func (h *studyRoomHub) localClients() []*studyClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := make([]*studyClient, 0, len(h.clients))
+	for _, cl := range h.clients {
+		clients = append(clients, cl)
+	}
+	return clients
+}
+
+func (h *studyRoomHub) localPresence() []hubPresence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]hubPresence, 0, len(h.clients))
+	for _, cl := range h.clients {
+		out = append(out, hubPresence{
+			wsMemberState: wsMemberState{UserID: cl.userID, DisplayName: cl.displayName, PeerID: cl.peerID},
+			Instance:      h.instanceID,
+			ConnID:        cl.connID,
+			JoinedAt:      cl.sessionStart,
+			SeenAt:        time.Now(),
+		})
+	}
+	return out
+}
+
+// presence 返回房间在所有实例上的在线成员，Backplane 不可用时退回本机连接
+func (h *studyRoomHub) presence(ctx context.Context) map[uint64]hubPresence {
+	members, err := loadHubPresence(ctx, h.bp, h.roomID)
+	if err == nil {
+		return members
+	}
+	log.Printf("[StudyHub] load presence of room %d failed: %v", h.roomID, err)
+	members = make(map[uint64]hubPresence)
+	for _, p := range h.localPresence() {
+		members[p.UserID] = p
+	}
+	return members
+}
+
+func (h *studyRoomHub) busyPartners(ctx context.Context) map[uint64]uint64 {
+	busy, err := h.bp.BusyPartners(ctx, h.roomID)
+	if err != nil {
+		log.Printf("[StudyHub] load busy state of room %d failed: %v", h.roomID, err)
+		return map[uint64]uint64{}
+	}
+	return busy
 }
 
 func (h *studyRoomHub) startSession(client *studyClient) {
@@ -232,6 +599,10 @@ func (h *studyRoomHub) finishSession(client *studyClient) {
 }
 
 func (h *studyRoomHub) memberState(client *studyClient) wsMemberState {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	busy := h.busyPartners(ctx)
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	member := wsMemberState{
@@ -239,7 +610,7 @@ func (h *studyRoomHub) memberState(client *studyClient) wsMemberState {
 		DisplayName: client.displayName,
 		PeerID:      client.peerID,
 	}
-	if partner, ok := h.busy[client.userID]; ok {
+	if partner, ok := busy[client.userID]; ok {
 		member.IsBusy = true
 		member.PartnerID = &partner
 	}
@@ -247,72 +618,135 @@ func (h *studyRoomHub) memberState(client *studyClient) wsMemberState {
 }
 
 func (h *studyRoomHub) buildStatePayload() map[string]interface{} {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	members := make([]wsMemberState, 0, len(h.clients))
-	for _, cl := range h.clients {
+	pomodoroState := h.roomPomodoroState()
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	presence := h.presence(ctx)
+	busy := h.busyPartners(ctx)
+
+	members := make([]wsMemberState, 0, len(presence))
+	for _, p := range presence {
 		member := wsMemberState{
-			UserID:      cl.userID,
-			DisplayName: cl.displayName,
-			PeerID:      cl.peerID,
+			UserID:      p.UserID,
+			DisplayName: p.DisplayName,
+			PeerID:      p.PeerID,
 		}
-		if partner, ok := h.busy[cl.userID]; ok {
+		if partner, ok := busy[p.UserID]; ok {
 			member.IsBusy = true
 			member.PartnerID = &partner
 		}
 		members = append(members, member)
 	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
 	return map[string]interface{}{
-		"room_id": h.roomID,
-		"members": members,
+		"room_id":    h.roomID,
+		"members":    members,
+		"pomodoro":   pomodoroState,
+		"group_call": h.groupCallState(presence),
 	}
 }
 
+// broadcast 经 Backplane 向房间内所有实例上的成员广播
 func (h *studyRoomHub) broadcast(msg wsEnvelope, exclude ...uint64) {
+	h.publish(hubRelay{Origin: h.instanceID, Exclude: exclude, Envelope: msg})
+}
+
+// sendTo 向指定成员投递消息，成员可能连接在其他实例上
+func (h *studyRoomHub) sendTo(msg wsEnvelope, userIDs ...uint64) {
+	h.publish(hubRelay{Origin: h.instanceID, To: userIDs, Envelope: msg})
+}
+
+func (h *studyRoomHub) publish(relay hubRelay) {
+	payload := mustMarshal(relay)
+	if h.unsubscribe == nil {
+		h.deliver(payload)
+		return
+	}
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	if err := h.bp.Publish(ctx, h.roomID, payload); err != nil {
+		log.Printf("[StudyHub] publish to room %d failed, delivering locally: %v", h.roomID, err)
+		h.deliver(payload)
+	}
+}
+
+// deliver 处理 Backplane 推送的房间消息，投递给本机连接中的目标成员
+func (h *studyRoomHub) deliver(payload []byte) {
+	var relay hubRelay
+	if err := json.Unmarshal(payload, &relay); err != nil {
+		return
+	}
+	if relay.Origin != h.instanceID {
+		h.applyRemoteEvent(relay.Envelope)
+	}
+	h.deliverLocal(relay.Envelope, relay.To, relay.Exclude)
+}
+
+func (h *studyRoomHub) deliverLocal(msg wsEnvelope, to, exclude []uint64) {
 	h.mu.Lock()
 	targets := make([]*studyClient, 0, len(h.clients))
 	for id, client := range h.clients {
-		skip := false
-		for _, ex := range exclude {
-			if id == ex {
-				skip = true
-				break
-			}
+		if len(to) > 0 && !containsUint64(to, id) {
+			continue
 		}
-		if !skip {
-			targets = append(targets, client)
+		if containsUint64(exclude, id) {
+			continue
 		}
+		targets = append(targets, client)
 	}
 	h.mu.Unlock()
 
 	for _, client := range targets {
-		select {
-		case client.send <- msg:
-		default:
-			go client.conn.Close()
+		if msg.Type == "kicked" {
+			client.evict(msg)
+			continue
+		}
+		client.enqueue(msg)
+	}
+}
+
+func containsUint64(list []uint64, val uint64) bool {
+	for _, item := range list {
+		if item == val {
+			return true
 		}
 	}
+	return false
 }
 
 func (h *studyRoomHub) currentOnline() int {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	return len(h.clients)
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	return len(h.presence(ctx))
 }
 
 func (c *studyClient) readLoop() {
 	defer func() {
-		c.hub.unregisterClient(c)
-		c.conn.Close()
+		defer close(c.finished)
+		c.close()
+		if !c.hub.unregisterClient(c) {
+			return
+		}
+		c.hub.handleGroupCallLeave(c.userID)
 		c.hub.broadcast(wsEnvelope{Type: "member_left", Data: mustMarshal(map[string]uint64{"user_id": c.userID})}, c.userID)
 		c.hub.broadcast(wsEnvelope{Type: "state", Data: mustMarshal(c.hub.buildStatePayload())}, c.userID)
 	}()
 
+	c.conn.SetReadLimit(wsMaxMessageBytes)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				hubMetrics.heartbeatTimeouts.Add(1)
+			}
 			return
 		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
 		var env wsEnvelope
 		if err := json.Unmarshal(message, &env); err != nil {
 			continue
@@ -321,14 +755,87 @@ func (c *studyClient) readLoop() {
 	}
 }
 
+// writeLoop 串行写出消息并定期发送 ping，任何写失败都会关闭连接
 func (c *studyClient) writeLoop() {
-	for msg := range c.send {
-		if err := c.conn.WriteJSON(msg); err != nil {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close()
+	}()
+	for {
+		select {
+		case <-c.done:
 			return
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+			if msg.Type == "kicked" {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
 		}
 	}
 }
 
+// handleChatAction 处理消息编辑、删除、表情回应与已读回执
+func (h *studyRoomHub) handleChatAction(client *studyClient, env wsEnvelope) {
+	var payload struct {
+		MessageID uint64 `json:"message_id"`
+		Content   string `json:"content"`
+		Emoji     string `json:"emoji"`
+		Remove    bool   `json:"remove"`
+	}
+	if err := json.Unmarshal(env.Data, &payload); err != nil {
+		return
+	}
+	if payload.MessageID == 0 && env.Type != "chat_read" {
+		return
+	}
+	db := database.GetDB()
+	var err error
+	switch env.Type {
+	case "chat_edit":
+		var msg models.ChatMessage
+		if msg, err = editChatMessage(db, h.roomID, payload.MessageID, client.userID, payload.Content); err == nil {
+			h.broadcast(wsEnvelope{Type: "chat_edited", Data: mustMarshal(buildChatMessageResponse(msg, client.displayName))})
+		}
+	case "chat_delete":
+		if err = deleteChatMessage(db, h.roomID, payload.MessageID, client.userID); err == nil {
+			h.broadcast(wsEnvelope{Type: "chat_deleted", Data: mustMarshal(map[string]uint64{"message_id": payload.MessageID, "deleted_by": client.userID})})
+		}
+	case "chat_react":
+		var reactions []chatReactionSummary
+		if reactions, err = setChatReaction(db, h.roomID, payload.MessageID, client.userID, payload.Emoji, !payload.Remove); err == nil {
+			h.broadcast(wsEnvelope{Type: "chat_reaction", Data: mustMarshal(map[string]interface{}{"message_id": payload.MessageID, "reactions": reactions})})
+		}
+	case "chat_read":
+		var cursor models.ChatReadCursor
+		if cursor, err = markChatRead(db, h.roomID, client.userID, payload.MessageID); err == nil {
+			h.broadcast(wsEnvelope{Type: "chat_read", Data: mustMarshal(chatReadPayload(cursor))}, client.userID)
+		}
+	}
+	if err != nil {
+		_, message := chatActionErrorMessage(err)
+		client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": message})})
+	}
+}
+
+// kick 通知目标成员并由其所在实例关闭连接，同时直接清除 Backplane 上的在线状态，
+// 不依赖客户端配合，也不依赖目标实例仍然存活
+func (h *studyRoomHub) kick(userID uint64, message string) {
+	h.sendTo(wsEnvelope{Type: "kicked", Data: mustMarshal(map[string]string{"message": message})}, userID)
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	if err := h.bp.RemoveMember(ctx, h.roomID, userID); err != nil {
+		log.Printf("[StudyHub] remove presence of kicked user %d failed: %v", userID, err)
+	}
+}
+
 func (h *studyRoomHub) handleEvent(client *studyClient, env wsEnvelope) {
 	switch env.Type {
 	case "register_peer":
@@ -339,6 +846,7 @@ func (h *studyRoomHub) handleEvent(client *studyClient, env wsEnvelope) {
 		h.mu.Lock()
 		client.peerID = strings.TrimSpace(payload.PeerID)
 		h.mu.Unlock()
+		h.publishPresence(client)
 		h.broadcast(wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())}, 0)
 
 	case "call_request":
@@ -377,6 +885,27 @@ func (h *studyRoomHub) handleEvent(client *studyClient, env wsEnvelope) {
 		_ = json.Unmarshal(env.Data, &payload)
 		h.handleCallEnd(client, payload.PartnerID)
 
+	case "group_call_join":
+		var payload struct {
+			CountAsStudy bool `json:"count_as_study"`
+		}
+		_ = json.Unmarshal(env.Data, &payload)
+		h.handleGroupCallJoin(client, payload.CountAsStudy)
+
+	case "group_call_signal":
+		var payload struct {
+			TargetID uint64          `json:"target_id"`
+			Kind     string          `json:"kind"`
+			Payload  json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(env.Data, &payload); err != nil {
+			return
+		}
+		h.handleGroupCallSignal(client, payload.TargetID, payload.Kind, payload.Payload)
+
+	case "group_call_leave":
+		h.handleGroupCallLeave(client.userID)
+
 	case "chat":
 		var payload struct {
 			Content string `json:"content"`
@@ -388,16 +917,20 @@ func (h *studyRoomHub) handleEvent(client *studyClient, env wsEnvelope) {
 		if content == "" {
 			return
 		}
+		if until, muted := studyRoomMutedUntil(database.GetDB(), h.roomID, client.userID, time.Now()); muted {
+			client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": mutedChatMessage(client.userID, until)})})
+			return
+		}
 		sessionID := uint64(0)
 		if room, ok := getTeamChatRoomByRoom(database.GetDB(), h.roomID); ok {
 			if room.TeamID == nil || !canAccessTeam(database.GetDB(), *room.TeamID, client.userID) {
-				client.send <- wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "无权限访问团队聊天室"})}
+				client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "无权限访问团队聊天室"})})
 				return
 			}
 		}
 		if session, ok := getCollaborationSessionByRoom(database.GetDB(), h.roomID); ok {
 			if session.Status == models.TaskCollaborationStatusDismissed || !canAccessCollaborationSession(database.GetDB(), &session, client.userID) {
-				client.send <- wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "协作会话已结束或无权限发送消息"})}
+				client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "协作会话已结束或无权限发送消息"})})
 				return
 			}
 			sessionID = session.ID
@@ -428,131 +961,175 @@ func (h *studyRoomHub) handleEvent(client *studyClient, env wsEnvelope) {
 		}
 		h.broadcast(wsEnvelope{Type: "chat", Data: mustMarshal(msg)}, 0)
 
+	case "chat_edit", "chat_delete", "chat_react", "chat_read":
+		h.handleChatAction(client, env)
+
+	case "doc_sync", "doc_op":
+		h.handleDocumentEvent(client, env)
+
 	case "direct_chat":
 		var payload struct {
 			TargetID uint64 `json:"target_id"`
 			Content  string `json:"content"`
 		}
-		if err := json.Unmarshal(env.Data, &payload); err != nil {
+		if err := json.Unmarshal(env.Data, &payload); err != nil || payload.TargetID == 0 {
 			return
 		}
-		content := strings.TrimSpace(payload.Content)
-		if content == "" || payload.TargetID == 0 {
+		msg, err := directmsg.Send(client.userID, payload.TargetID, payload.Content, time.Now())
+		if err != nil {
+			_, message := directMessageErrorMessage(err)
+			client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": message})})
 			return
 		}
-		target := h.clients[payload.TargetID]
-		if target == nil {
+		deliverDirectMessage(h.store, msg, client.displayName)
+
+	case "pomodoro_start", "pomodoro_stop":
+		if !h.canControlPomodoro(client.userID) {
+			client.enqueue(wsEnvelope{Type: "error", Data: mustMarshal(map[string]string{"message": "只有房主或管理员可以控制番茄钟"})})
 			return
 		}
-		now := time.Now().Format(time.RFC3339)
-		msg := map[string]interface{}{
-			"from_id":      client.userID,
-			"to_id":        payload.TargetID,
-			"display_name": client.displayName,
-			"content":      content,
-			"sent_at":      now,
+		if env.Type == "pomodoro_stop" {
+			h.stopRoomPomodoro(client)
+			return
+		}
+		var payload pomodoro.Config
+		_ = json.Unmarshal(env.Data, &payload)
+		h.startRoomPomodoro(client, payload)
+
+	case "pomodoro_interrupt":
+		var payload struct {
+			Reason string `json:"reason"`
 		}
-		if target != nil {
-			target.send <- wsEnvelope{Type: "direct_chat", Data: mustMarshal(msg)}
+		_ = json.Unmarshal(env.Data, &payload)
+		if _, _, err := h.interruptRoomPomodoro(0, client.userID, payload.Reason); err != nil && !errors.Is(err, pomodoro.ErrPomodoroEnded) {
+			log.Printf("record room %d pomodoro interruption failed: %v", h.roomID, err)
 		}
-		client.send <- wsEnvelope{Type: "direct_chat", Data: mustMarshal(msg)}
 
 	case "state_request":
-		client.send <- wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())}
+		client.enqueue(wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())})
 	}
 }
 
 func (h *studyRoomHub) handleCallRequest(caller *studyClient, targetID uint64) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	if caller.peerID == "" {
-		caller.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "missing_peer_id"})}
+	callerPeer := caller.peerID
+	h.mu.Unlock()
+	if callerPeer == "" {
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "missing_peer_id"})})
+		return
+	}
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	busy := h.busyPartners(ctx)
+	if _, ok := busy[caller.userID]; ok {
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "caller_busy"})})
+		return
+	}
+	if partner, ok := busy[targetID]; ok && partner != 0 {
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_busy"})})
 		return
 	}
-	if _, busy := h.busy[caller.userID]; busy {
-		caller.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "caller_busy"})}
+	// 群组通话中的成员不接受一对一呼叫
+	if inGroupCall(database.GetDB(), h.roomID, caller.userID) {
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "caller_busy"})})
 		return
 	}
-	if partner, ok := h.busy[targetID]; ok && partner != 0 {
-		caller.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_busy"})}
+	if inGroupCall(database.GetDB(), h.roomID, targetID) {
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_busy"})})
 		return
 	}
-	if pendingCaller, ok := h.pending[targetID]; ok && pendingCaller != caller.userID {
-		caller.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_busy"})}
+	if _, online := h.presence(ctx)[targetID]; !online {
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_offline"})})
 		return
 	}
-	target := h.clients[targetID]
-	if target == nil {
-		caller.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_offline"})}
+	claimed, err := h.bp.ClaimPending(ctx, h.roomID, targetID, caller.userID)
+	if err != nil {
+		log.Printf("[StudyHub] claim pending call in room %d failed: %v", h.roomID, err)
+		caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "unavailable"})})
 		return
 	}
-	h.pending[targetID] = caller.userID
-	target.send <- wsEnvelope{Type: "incoming_call", Data: mustMarshal(map[string]interface{}{
+	if !claimed {
+		// 同一主叫重复呼叫时重新推送来电
+		if pendingCaller, ok, _ := h.bp.PendingCaller(ctx, h.roomID, targetID); !ok || pendingCaller != caller.userID {
+			caller.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "target_busy"})})
+			return
+		}
+	}
+	h.sendTo(wsEnvelope{Type: "incoming_call", Data: mustMarshal(map[string]interface{}{
 		"from_id":   caller.userID,
 		"from_name": caller.displayName,
-		"from_peer": caller.peerID,
-	})}
+		"from_peer": callerPeer,
+	})}, targetID)
 }
 
 func (h *studyRoomHub) handleCallAccept(callee *studyClient, fromID uint64) {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	callerID, ok, err := h.bp.PendingCaller(ctx, h.roomID, callee.userID)
+	if err != nil || !ok || callerID != fromID {
+		return
+	}
+	caller, online := h.presence(ctx)[callerID]
+	if !online {
+		_, _ = h.bp.ReleasePending(ctx, h.roomID, callee.userID)
+		return
+	}
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	callerID, ok := h.pending[callee.userID]
-	if !ok || callerID != fromID {
+	calleePeer := callee.peerID
+	h.mu.Unlock()
+	if calleePeer == "" {
+		callee.enqueue(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "missing_peer_id"})})
+		_, _ = h.bp.ReleasePending(ctx, h.roomID, callee.userID)
 		return
 	}
-	caller := h.clients[callerID]
-	if caller == nil {
-		delete(h.pending, callee.userID)
+	// 只有清除了待接听记录的一方继续，避免多实例重复接通
+	if released, err := h.bp.ReleasePending(ctx, h.roomID, callee.userID); err != nil || !released {
 		return
 	}
-	if callee.peerID == "" {
-		callee.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": "missing_peer_id"})}
-		delete(h.pending, callee.userID)
+	if err := h.bp.SetBusy(ctx, h.roomID, callerID, callee.userID); err != nil {
+		log.Printf("[StudyHub] mark call busy in room %d failed: %v", h.roomID, err)
 		return
 	}
-	delete(h.pending, callee.userID)
-	h.busy[callerID] = callee.userID
-	h.busy[callee.userID] = callerID
 
 	callData := map[string]interface{}{
-		"caller_id":      caller.userID,
-		"caller_name":    caller.displayName,
-		"caller_peer_id": caller.peerID,
+		"caller_id":      caller.UserID,
+		"caller_name":    caller.DisplayName,
+		"caller_peer_id": caller.PeerID,
 		"callee_id":      callee.userID,
 		"callee_name":    callee.displayName,
-		"callee_peer_id": callee.peerID,
+		"callee_peer_id": calleePeer,
 	}
-	caller.send <- wsEnvelope{Type: "call_start", Data: mustMarshal(callData)}
-	callee.send <- wsEnvelope{Type: "call_start", Data: mustMarshal(callData)}
+	h.sendTo(wsEnvelope{Type: "call_start", Data: mustMarshal(callData)}, callerID)
+	callee.enqueue(wsEnvelope{Type: "call_start", Data: mustMarshal(callData)})
 	h.broadcast(wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())}, 0)
 }
 
 func (h *studyRoomHub) handleCallReject(callee *studyClient, fromID uint64, reason string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	callerID, ok := h.pending[callee.userID]
-	if !ok || callerID != fromID {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	callerID, ok, err := h.bp.PendingCaller(ctx, h.roomID, callee.userID)
+	if err != nil || !ok || callerID != fromID {
 		return
 	}
-	delete(h.pending, callee.userID)
-	if caller := h.clients[callerID]; caller != nil {
-		caller.send <- wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": reason})}
+	if released, err := h.bp.ReleasePending(ctx, h.roomID, callee.userID); err != nil || !released {
+		return
 	}
+	h.sendTo(wsEnvelope{Type: "call_denied", Data: mustMarshal(map[string]string{"reason": reason})}, callerID)
 }
 
 func (h *studyRoomHub) handleCallEnd(client *studyClient, partnerID uint64) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if currentPartner, ok := h.busy[client.userID]; !ok || currentPartner != partnerID {
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	if currentPartner, ok := h.busyPartners(ctx)[client.userID]; !ok || currentPartner != partnerID {
 		return
 	}
-	delete(h.busy, client.userID)
-	delete(h.busy, partnerID)
-	if partner := h.clients[partnerID]; partner != nil {
-		partner.send <- wsEnvelope{Type: "call_ended", Data: mustMarshal(map[string]uint64{"partner_id": client.userID})}
+	if err := h.bp.ClearBusy(ctx, h.roomID, client.userID, partnerID); err != nil {
+		log.Printf("[StudyHub] clear call state in room %d failed: %v", h.roomID, err)
+		return
 	}
-	client.send <- wsEnvelope{Type: "call_ended", Data: mustMarshal(map[string]uint64{"partner_id": partnerID})}
+	h.sendTo(wsEnvelope{Type: "call_ended", Data: mustMarshal(map[string]uint64{"partner_id": client.userID})}, partnerID)
+	client.enqueue(wsEnvelope{Type: "call_ended", Data: mustMarshal(map[string]uint64{"partner_id": partnerID})})
 	h.broadcast(wsEnvelope{Type: "state", Data: mustMarshal(h.buildStatePayload())}, 0)
 }
 
@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait       = 10 * time.Second
+	wsPongWait        = 60 * time.Second
+	wsPingPeriod      = wsPongWait * 9 / 10
+	wsMaxMessageBytes = 256 << 10
+	wsSendBuffer      = 64
+
+	// 连续丢弃的消息数达到该值时视为慢消费者，断开后由客户端重连并重新同步
+	wsSlowConsumerDrops = 16
+
+	// 本机无连接超过该时长的房间会被回收，再次访问时按需重建
+	hubIdleTimeout = 5 * time.Minute
+)
+
+// droppableWSEvents 可以丢弃的消息：后续的 state 或客户端主动刷新即可补齐。
+// 其余消息（聊天、通话信令、文档编辑等）丢失会导致客户端状态错乱，缓冲区满时直接断开
+var droppableWSEvents = map[string]bool{
+	"state":          true,
+	"member_joined":  true,
+	"member_left":    true,
+	"chat_read":      true,
+	"pomodoro_phase": true,
+	"doc_saved":      true,
+}
+
+// studyHubMetrics 自习室连接健康指标，进程内累计
+type studyHubMetrics struct {
+	droppedMessages         atomic.Int64
+	slowConsumerDisconnects atomic.Int64
+	heartbeatTimeouts       atomic.Int64
+	reapedHubs              atomic.Int64
+}
+
+var hubMetrics studyHubMetrics
+
+// enqueue 非阻塞地投递消息，不会因为单个慢连接阻塞调用方。
+// 缓冲区满时丢弃消息；关键消息被丢弃或持续积压时断开该连接
+func (c *studyClient) enqueue(msg wsEnvelope) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		c.drops.Store(0)
+		return true
+	default:
+	}
+
+	hubMetrics.droppedMessages.Add(1)
+	if drops := c.drops.Add(1); !droppableWSEvents[msg.Type] || drops >= wsSlowConsumerDrops {
+		hubMetrics.slowConsumerDisconnects.Add(1)
+		log.Printf("[StudyHub] disconnect slow consumer user %d in room %d after dropping %s", c.userID, c.hub.roomID, msg.Type)
+		go c.closeWith(websocket.CloseTryAgainLater, "slow consumer")
+	}
+	return false
+}
+
+// close 关闭连接，可重复调用
+func (c *studyClient) close() {
+	c.closeWith(0, "")
+}
+
+// closeWith 发送关闭帧（code 为 0 时不发送）后关闭连接，读写循环随之退出
+func (c *studyClient) closeWith(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if code != 0 {
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+		}
+		_ = c.conn.Close()
+	})
+}
+
+// evict 投递移出通知后由服务端关闭连接；通知无法入队或迟迟写不出去时直接关闭
+func (c *studyClient) evict(msg wsEnvelope) {
+	if !c.enqueue(msg) {
+		c.closeWith(websocket.ClosePolicyViolation, "removed from room")
+		return
+	}
+	time.AfterFunc(wsWriteWait, func() {
+		c.closeWith(websocket.ClosePolicyViolation, "removed from room")
+	})
+}
+
+func (h *studyRoomHub) touch() {
+	h.mu.Lock()
+	h.lastActive = time.Now()
+	h.mu.Unlock()
+}
+
+// idleFor 本机没有连接的时长，有连接时为 0
+func (h *studyRoomHub) idleFor(now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) > 0 {
+		return 0
+	}
+	return now.Sub(h.lastActive)
+}
+
+// shutdown 断开本机连接并等待清理完成，然后退订房间频道、停止本机番茄钟计时
+func (h *studyRoomHub) shutdown(ctx context.Context) {
+	clients := h.localClients()
+	for _, client := range clients {
+		client.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+	for _, client := range clients {
+		select {
+		case <-client.finished:
+		case <-ctx.Done():
+		}
+	}
+	if h.unsubscribe != nil {
+		h.unsubscribe()
+	}
+	h.pomodoroMu.Lock()
+	h.dropRoomPomodoroLocked()
+	h.pomodoroMu.Unlock()
+}
+
+// reapIdleHubs 回收空闲房间，返回回收数量
+func (m *studyHubStore) reapIdleHubs(now time.Time) int {
+	m.mu.Lock()
+	idle := make([]*studyRoomHub, 0)
+	for roomID, hub := range m.hubs {
+		if hub.idleFor(now) >= hubIdleTimeout {
+			delete(m.hubs, roomID)
+			idle = append(idle, hub)
+		}
+	}
+	m.mu.Unlock()
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	for _, hub := range idle {
+		hub.shutdown(ctx)
+	}
+	hubMetrics.reapedHubs.Add(int64(len(idle)))
+	return len(idle)
+}
+
+func (m *studyHubStore) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// Close 停止刷新循环，关闭所有房间的连接并释放 Backplane
+func (m *studyHubStore) Close(ctx context.Context) {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		m.mu.Lock()
+		m.closed = true
+		hubs := make([]*studyRoomHub, 0, len(m.hubs))
+		for _, hub := range m.hubs {
+			hubs = append(hubs, hub)
+		}
+		m.hubs = make(map[uint64]*studyRoomHub)
+		m.mu.Unlock()
+
+		for _, hub := range hubs {
+			hub.shutdown(ctx)
+		}
+		if m.directUnsubscribe != nil {
+			m.directUnsubscribe()
+		}
+		if m.bp != nil {
+			if err := m.bp.Close(); err != nil {
+				log.Printf("[StudyHub] close backplane failed: %v", err)
+			}
+		}
+	})
+}
+
+// ShutdownStudyHubs 优雅关闭自习室 WebSocket：通知客户端重连到其他实例并结束学习记录
+func ShutdownStudyHubs(ctx context.Context) {
+	studyHubRegistry.Close(ctx)
+}
+
+func (m *studyHubStore) connectedClients() int {
+	total := 0
+	for _, hub := range m.localHubs() {
+		total += len(hub.localClients())
+	}
+	return total
+}
+
+func handleStudyHubMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"hubs":                      len(studyHubRegistry.localHubs()),
+			"connections":               studyHubRegistry.connectedClients(),
+			"dropped_messages":          hubMetrics.droppedMessages.Load(),
+			"slow_consumer_disconnects": hubMetrics.slowConsumerDisconnects.Load(),
+			"heartbeat_timeouts":        hubMetrics.heartbeatTimeouts.Load(),
+			"reaped_hubs":               hubMetrics.reapedHubs.Load(),
+		},
+	})
+}
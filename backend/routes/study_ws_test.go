@@ -0,0 +1,278 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"learningAssistant-backend/services/backplane"
+)
+
+// startHubInstance 模拟一个服务实例：独立的 hub 注册表，共享同一个 Backplane
+func startHubInstance(t *testing.T, bp backplane.Backplane) (*studyHubStore, *httptest.Server) {
+	t.Helper()
+	store := newStudyHubStore(bp)
+	r := gin.New()
+	r.GET("/rooms/:roomId/ws", func(c *gin.Context) {
+		roomID, _ := strconv.ParseUint(c.Param("roomId"), 10, 64)
+		store.getHub(roomID).handleWebSocket(c)
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	// 等待连接清理完成，避免遗留的写库操作落到下一个测试的数据库上
+	t.Cleanup(func() {
+		ctx, cancel := backplaneContext()
+		defer cancel()
+		store.Close(ctx)
+	})
+	return store, srv
+}
+
+func dialRoom(t *testing.T, srv *httptest.Server, roomID, userID uint64) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/rooms/" + jsonNumber(roomID) + "/ws?token=mock-token-" + jsonNumber(userID)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitForEvent 读取消息直到出现指定类型
+func waitForEvent(t *testing.T, conn *websocket.Conn, eventType string) wsEnvelope {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		var env wsEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatalf("waiting for %s: %v", eventType, err)
+		}
+		if env.Type == eventType {
+			return env
+		}
+	}
+}
+
+func sendEvent(t *testing.T, conn *websocket.Conn, eventType string, data interface{}) {
+	t.Helper()
+	raw, _ := json.Marshal(data)
+	if err := conn.WriteJSON(wsEnvelope{Type: eventType, Data: raw}); err != nil {
+		t.Fatalf("send %s: %v", eventType, err)
+	}
+}
+
+func TestStudyRoomHubsShareStateAcrossInstances(t *testing.T) {
+	setupTaskCollaborationTest(t)
+	bp := backplane.NewMemory()
+	storeA, srvA := startHubInstance(t, bp)
+	_, srvB := startHubInstance(t, bp)
+
+	alice := dialRoom(t, srvA, 42, 1)
+	waitForEvent(t, alice, "state")
+	bob := dialRoom(t, srvB, 42, 2)
+	waitForEvent(t, bob, "state")
+
+	joined := waitForEvent(t, alice, "member_joined")
+	var member wsMemberState
+	_ = json.Unmarshal(joined.Data, &member)
+	if member.UserID != 2 {
+		t.Fatalf("expected alice to see bob join from the other instance, got %+v", member)
+	}
+	if got := storeA.totalOnline(); got != 2 {
+		t.Fatalf("expected 2 users online across instances, got %d", got)
+	}
+
+	// 聊天按发送顺序送达另一实例
+	for i := 0; i < 5; i++ {
+		sendEvent(t, bob, "chat", map[string]string{"content": "msg-" + strconv.Itoa(i)})
+	}
+	for i := 0; i < 5; i++ {
+		env := waitForEvent(t, alice, "chat")
+		var chat struct {
+			Content string `json:"content"`
+		}
+		_ = json.Unmarshal(env.Data, &chat)
+		if chat.Content != "msg-"+strconv.Itoa(i) {
+			t.Fatalf("expected msg-%d, got %s", i, chat.Content)
+		}
+	}
+
+	// 跨实例通话信令
+	sendEvent(t, alice, "register_peer", map[string]string{"peer_id": "peer-a"})
+	sendEvent(t, bob, "register_peer", map[string]string{"peer_id": "peer-b"})
+	waitForEvent(t, alice, "state")
+	waitForEvent(t, bob, "state")
+	sendEvent(t, alice, "call_request", map[string]uint64{"target_id": 2})
+	incoming := waitForEvent(t, bob, "incoming_call")
+	if !strings.Contains(string(incoming.Data), `"from_peer":"peer-a"`) {
+		t.Fatalf("unexpected incoming call payload %s", incoming.Data)
+	}
+	sendEvent(t, bob, "call_accept", map[string]uint64{"from_id": 1})
+	start := waitForEvent(t, alice, "call_start")
+	if !strings.Contains(string(start.Data), `"callee_peer_id":"peer-b"`) {
+		t.Fatalf("unexpected call start payload %s", start.Data)
+	}
+	busy, _ := bp.BusyPartners(t.Context(), 42)
+	if busy[1] != 2 || busy[2] != 1 {
+		t.Fatalf("expected shared busy state, got %v", busy)
+	}
+
+	// 断开后通话状态与在线状态一并清理
+	bob.Close()
+	waitForEvent(t, alice, "member_left")
+	if busy, _ := bp.BusyPartners(t.Context(), 42); len(busy) != 0 {
+		t.Fatalf("expected busy state cleared after disconnect, got %v", busy)
+	}
+	if got := storeA.totalOnline(); got != 1 {
+		t.Fatalf("expected 1 user online after disconnect, got %d", got)
+	}
+}
+
+func TestSlowConsumerIsDroppedThenDisconnected(t *testing.T) {
+	setupTaskCollaborationTest(t)
+	store, srv := startHubInstance(t, backplane.NewMemory())
+	conn := dialRoom(t, srv, 50, 1)
+	waitForEvent(t, conn, "state")
+
+	slow := &studyClient{
+		userID: 9,
+		conn:   conn,
+		hub:    store.getHub(50),
+		send:   make(chan wsEnvelope, 1),
+		done:   make(chan struct{}),
+	}
+	dropped := hubMetrics.droppedMessages.Load()
+	if !slow.enqueue(wsEnvelope{Type: "state"}) {
+		t.Fatalf("expected first message to be buffered")
+	}
+	if slow.enqueue(wsEnvelope{Type: "state"}) {
+		t.Fatalf("expected droppable message to be dropped on a full buffer")
+	}
+	select {
+	case <-slow.done:
+		t.Fatalf("dropping a droppable message must not disconnect")
+	default:
+	}
+	slow.enqueue(wsEnvelope{Type: "chat"})
+	select {
+	case <-slow.done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected slow consumer to be disconnected after losing a chat message")
+	}
+	if got := hubMetrics.droppedMessages.Load() - dropped; got != 2 {
+		t.Fatalf("expected 2 dropped messages, got %d", got)
+	}
+}
+
+func TestReplacedConnectionAndIdleHubReaping(t *testing.T) {
+	setupTaskCollaborationTest(t)
+	store, srv := startHubInstance(t, backplane.NewMemory())
+	first := dialRoom(t, srv, 51, 1)
+	waitForEvent(t, first, "state")
+	second := dialRoom(t, srv, 51, 1)
+	waitForEvent(t, second, "state")
+
+	// 旧连接被关闭，且不会广播该用户离开
+	_ = first.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		if _, _, err := first.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("expected normal closure of replaced connection, got %v", err)
+			}
+			break
+		}
+	}
+	if got := len(store.getHub(51).localClients()); got != 1 {
+		t.Fatalf("expected the new connection to stay registered, got %d clients", got)
+	}
+
+	later := time.Now().Add(hubIdleTimeout + time.Minute)
+	if reaped := store.reapIdleHubs(later); reaped != 0 {
+		t.Fatalf("hub with a connection must not be reaped")
+	}
+	store.getHub(52)
+	if reaped := store.reapIdleHubs(later); reaped != 1 || len(store.localHubs()) != 1 {
+		t.Fatalf("expected only the empty hub reaped, got %d with %d left", reaped, len(store.localHubs()))
+	}
+
+	ctx, cancel := backplaneContext()
+	defer cancel()
+	store.Close(ctx)
+	_ = second.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		if _, _, err := second.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Fatalf("expected going away on shutdown, got %v", err)
+			}
+			break
+		}
+	}
+	if len(store.localHubs()) != 0 {
+		t.Fatalf("expected all hubs closed")
+	}
+}
+
+func TestStudyRoomHandshakeUsesTokenIdentity(t *testing.T) {
+	setupTaskCollaborationTest(t)
+	_, srv := startHubInstance(t, backplane.NewMemory())
+	base := "ws" + strings.TrimPrefix(srv.URL, "http") + "/rooms/12/ws"
+
+	// 仅凭 user_id 无法冒充他人进入房间
+	if _, resp, err := websocket.DefaultDialer.Dial(base+"?user_id=1", nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected handshake without token to be rejected with 401, got %v", resp)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(base+"?user_id=1&token=mock-token-2", nil); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected mismatched user_id to be rejected with 403, got %v", resp)
+	}
+	conn := dialRoom(t, srv, 12, 2)
+	state := waitForEvent(t, conn, "state")
+	if !strings.Contains(string(state.Data), `"user_id":2`) {
+		t.Fatalf("expected token user in room state, got %s", state.Data)
+	}
+}
+
+// blockingSubscribeBackplane 让指定房间的订阅阻塞，模拟 Redis 响应缓慢
+type blockingSubscribeBackplane struct {
+	backplane.Backplane
+	slowRoom uint64
+	release  chan struct{}
+}
+
+func (b *blockingSubscribeBackplane) Subscribe(roomID uint64, handler backplane.Handler) (func(), error) {
+	if roomID == b.slowRoom {
+		<-b.release
+	}
+	return b.Backplane.Subscribe(roomID, handler)
+}
+
+func TestSlowRoomSubscribeDoesNotBlockOtherRooms(t *testing.T) {
+	setupTaskCollaborationTest(t)
+	bp := &blockingSubscribeBackplane{Backplane: backplane.NewMemory(), slowRoom: 1, release: make(chan struct{})}
+	store := newStudyHubStore(bp)
+
+	slow := make(chan *studyRoomHub, 2)
+	for i := 0; i < 2; i++ {
+		go func() { slow <- store.getHub(1) }()
+	}
+	fast := make(chan *studyRoomHub, 1)
+	go func() { fast <- store.getHub(2) }()
+	select {
+	case <-fast:
+	case <-time.After(2 * time.Second):
+		t.Fatal("getHub for another room blocked behind a slow subscribe")
+	}
+
+	close(bp.release)
+	first, second := <-slow, <-slow
+	if first != second || store.getHub(1) != first {
+		t.Fatal("concurrent getHub calls for the same room must share one hub")
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -613,24 +614,16 @@ func updateTask(c *gin.Context) {
 		return
 	}
 
-	// 检查是否刚刚完成任务
+	// 检查完成状态是否变化：progress 推导出的状态也会写入 updateData
 	newStatus := oldStatus
-	if req.Status != nil {
-		newStatus = *req.Status
-	}
-	// 如果通过 progress 更新导致完成（通常前端会同时传 status=2，但为了保险）
-	if req.Progress != nil && *req.Progress >= 100 {
-		newStatus = 2
+	if status, ok := updateData["status"].(int8); ok {
+		newStatus = status
 	}
 
 	if oldStatus != 2 && newStatus == 2 {
-		rewardUserID := task.CreatedBy
-		if task.OwnerUserID != nil && *task.OwnerUserID > 0 {
-			rewardUserID = *task.OwnerUserID
-		}
-		go func(uid, tid uint64) {
-			_, _ = points.AwardTaskCompletion(uid, tid)
-		}(rewardUserID, task.ID)
+		awardTaskCompletionPoints(task)
+	} else if oldStatus == 2 && newStatus != 2 {
+		reverseTaskCompletionPoints(task.ID, "任务取消完成")
 	}
 
 	// 重新查询更新后的任务
@@ -739,6 +732,7 @@ func deleteTask(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除任务失败"})
 		return
 	}
+	reverseTaskCompletionPoints(task.ID, "任务已删除")
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
@@ -801,13 +795,7 @@ func completeTask(c *gin.Context) {
 	}
 
 	// 积分奖励
-	rewardUserID := task.CreatedBy
-	if task.OwnerUserID != nil && *task.OwnerUserID > 0 {
-		rewardUserID = *task.OwnerUserID
-	}
-	go func(uid, tid uint64) {
-		_, _ = points.AwardTaskCompletion(uid, tid)
-	}(rewardUserID, task.ID)
+	awardTaskCompletionPoints(task)
 
 	// 自动将任务知识点添加到知识库（聚合任务+笔记）
 	if ragService != nil {
@@ -910,13 +898,7 @@ func completeTaskWithNote(c *gin.Context) {
 
 	// 积分奖励
 	if task.Status != 2 { // 只有之前不是完成状态才加分
-		rewardUserID := task.CreatedBy
-		if task.OwnerUserID != nil && *task.OwnerUserID > 0 {
-			rewardUserID = *task.OwnerUserID
-		}
-		go func(uid, tid uint64) {
-			_, _ = points.AwardTaskCompletion(uid, tid)
-		}(rewardUserID, task.ID)
+		awardTaskCompletionPoints(task)
 	}
 
 	// 自动将任务知识点添加到知识库（聚合任务+笔记）
@@ -933,6 +915,25 @@ func completeTaskWithNote(c *gin.Context) {
 	})
 }
 
+// awardTaskCompletionPoints 为任务负责人（无负责人时为创建者）发放完成积分。
+// 同步执行，保证随后的取消完成一定能冲正到这笔积分
+func awardTaskCompletionPoints(task models.Task) {
+	rewardUserID := task.CreatedBy
+	if task.OwnerUserID != nil && *task.OwnerUserID > 0 {
+		rewardUserID = *task.OwnerUserID
+	}
+	if _, err := points.AwardTaskCompletion(rewardUserID, task.ID); err != nil && !errors.Is(err, points.ErrAlreadyAwarded) {
+		log.Printf("award task completion points for task %d failed: %v", task.ID, err)
+	}
+}
+
+// reverseTaskCompletionPoints 冲正任务尚未冲正的完成积分，避免反复切换完成状态刷分
+func reverseTaskCompletionPoints(taskID uint64, reason string) {
+	if _, err := points.ReverseTaskCompletion(taskID, reason); err != nil {
+		log.Printf("reverse task completion points for task %d failed: %v", taskID, err)
+	}
+}
+
 // uncompleteTask 取消完成任务
 func uncompleteTask(c *gin.Context) {
 	taskID, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -975,6 +976,7 @@ func uncompleteTask(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消完成失败"})
 		return
 	}
+	reverseTaskCompletionPoints(task.ID, "任务取消完成")
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
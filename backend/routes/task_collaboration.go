@@ -594,6 +594,7 @@ func buildChatMessageResponse(msg models.ChatMessage, displayName string) map[st
 		"msg_type":     msg.MsgType,
 		"session_id":   msg.SessionID,
 		"sent_at":      msg.SentAt,
+		"edited_at":    msg.EditedAt,
 	}
 }
 
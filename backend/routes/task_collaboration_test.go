@@ -10,10 +10,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"learningAssistant-backend/database"
+	"learningAssistant-backend/internal/testdb"
 	"learningAssistant-backend/models"
 )
 
@@ -22,15 +22,7 @@ func setupTaskCollaborationTest(t *testing.T) (*gin.Engine, *gorm.DB) {
 	t.Setenv("QWEN_API_KEY", "")
 	gin.SetMode(gin.TestMode)
 
-	dsn := "file:" + strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()) + "?mode=memory&cache=shared"
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("open sqlite: %v", err)
-	}
-	database.DB = db
-	if err := db.AutoMigrate(models.GetAllModels()...); err != nil {
-		t.Fatalf("migrate: %v", err)
-	}
+	db := testdb.Open(t)
 
 	r := gin.New()
 	api := r.Group("/api")
@@ -42,8 +34,7 @@ func setupTaskCollaborationTest(t *testing.T) (*gin.Engine, *gorm.DB) {
 	registerStudyRoutes(study)
 	{
 		rooms := study.Group("/rooms")
-		rooms.GET("/:roomId/chat/history", handleGetRoomChatHistory)
-		rooms.POST("/:roomId/chat", handlePostRoomChat)
+		registerStudyChatRoutes(rooms)
 	}
 	return r, db
 }
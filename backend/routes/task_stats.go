@@ -11,7 +11,9 @@ import (
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/streak"
 	taskservice "learningAssistant-backend/services/task"
+	"learningAssistant-backend/services/usertime"
 )
 
 func registerTaskStatRoutes(router *gin.RouterGroup) {
@@ -31,7 +33,7 @@ func handleGetBarStatsWithRange(c *gin.Context, rangeKey string) {
 		return
 	}
 
-	stats, err := taskservice.GetBarStats(normalizeRangeKeyWithDefault(rangeKey, "week"), userID)
+	stats, err := taskservice.GetBarStats(normalizeRangeKeyWithDefault(rangeKey, "week"), userID, usertime.ForUser(userID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取任务统计失败"})
 		return
@@ -211,9 +213,7 @@ func handleGetUserTodayTasks(c *gin.Context) {
 		return
 	}
 
-	now := time.Now().In(time.Local)
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
+	startOfDay, endOfDay := usertime.DayBounds(time.Now(), usertime.ForUser(userID))
 
 	db := database.GetDB()
 	base := db.Model(&models.Task{}).
@@ -472,7 +472,7 @@ type HeatmapStats struct {
 	Days          []HeatmapDay `json:"days"`           // 过去365天的数据
 	TotalTasks    int          `json:"total_tasks"`    // 总任务数
 	CompletedNum  int          `json:"completed_num"`  // 完成任务数
-	CurrentStreak int          `json:"current_streak"` // 当前连续工作日数
+	CurrentStreak int          `json:"current_streak"` // 当前连续活跃天数，与用户档案的连续天数口径一致
 }
 
 func handleGetHeatmapStats(c *gin.Context) {
@@ -481,7 +481,7 @@ func handleGetHeatmapStats(c *gin.Context) {
 		return
 	}
 
-	stats, err := getHeatmapData(userID)
+	stats, err := getHeatmapData(userID, usertime.ForUser(userID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取热力图数据失败"})
 		return
@@ -494,9 +494,9 @@ func handleGetHeatmapStats(c *gin.Context) {
 	})
 }
 
-func getHeatmapData(userID uint64) (*HeatmapStats, error) {
+func getHeatmapData(userID uint64, loc *time.Location) (*HeatmapStats, error) {
 	days := 365
-	endDate := time.Now().In(time.Local)
+	endDate := time.Now().In(loc)
 	startDate := endDate.AddDate(0, 0, -days)
 
 	db := database.GetDB()
@@ -514,7 +514,7 @@ func getHeatmapData(userID uint64) (*HeatmapStats, error) {
 	}
 
 	for _, task := range tasks {
-		dateStr := task.CreatedAt.Format("2006-01-02")
+		dateStr := usertime.DayKey(task.CreatedAt, loc)
 		if heatmapDay, exists := dateMap[dateStr]; exists {
 			heatmapDay.Count++
 		}
@@ -531,7 +531,7 @@ func getHeatmapData(userID uint64) (*HeatmapStats, error) {
 
 	for _, task := range completedTasks {
 		if task.CompletedAt != nil {
-			dateStr := task.CompletedAt.Format("2006-01-02")
+			dateStr := usertime.DayKey(*task.CompletedAt, loc)
 			if heatmapDay, exists := dateMap[dateStr]; exists {
 				heatmapDay.Completed++
 			}
@@ -540,13 +540,16 @@ func getHeatmapData(userID uint64) (*HeatmapStats, error) {
 
 	// 计算热力级别和转换为数组
 	heatmapDays := buildHeatmapDaysArray(startDate, endDate, dateMap)
-	currentStreak := calculateCurrentStreak(heatmapDays)
+	summary, err := streak.Compute(db, userID, loc, time.Now())
+	if err != nil {
+		return nil, err
+	}
 
 	return &HeatmapStats{
 		Days:          heatmapDays,
 		TotalTasks:    len(tasks),
 		CompletedNum:  len(completedTasks),
-		CurrentStreak: currentStreak,
+		CurrentStreak: summary.Current,
 	}, nil
 }
 
@@ -590,22 +593,3 @@ func buildHeatmapDaysArray(startDate, endDate time.Time, dateMap map[string]*Hea
 
 	return heatmapDays
 }
-
-// calculateCurrentStreak 计算当前连续工作日数
-func calculateCurrentStreak(days []HeatmapDay) int {
-	if len(days) == 0 {
-		return 0
-	}
-
-	// 从最后一天开始往前遍历
-	streak := 0
-	for i := len(days) - 1; i >= 0; i-- {
-		if days[i].Count > 0 {
-			streak++
-		} else {
-			break
-		}
-	}
-
-	return streak
-}
@@ -30,6 +30,7 @@ func registerTeamRoutes(r *gin.RouterGroup) {
 	r.GET("/:id/activities", listTeamActivities)
 	r.GET("/:id/requests", listTeamRequests)
 	r.POST("/:id/requests/:requestId/handle", handleTeamRequest)
+	registerTeamChallengeRoutes(r)
 }
 
 func createTeam(c *gin.Context) {
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/challenges"
+	"learningAssistant-backend/services/points"
+)
+
+const notificationTypeTeamChallenge = "TEAM_CHALLENGE"
+
+func registerTeamChallengeRoutes(r *gin.RouterGroup) {
+	r.GET("/:id/challenges", handleListTeamChallenges)
+	r.POST("/:id/challenges", handleCreateTeamChallenge)
+	r.GET("/:id/challenges/:challengeId", handleGetTeamChallengeProgress)
+	r.POST("/:id/challenges/:challengeId/cancel", handleCancelTeamChallenge)
+}
+
+// respondChallengeError 将团队挑战服务的错误映射为响应，fallback 为未知错误时的提示
+func respondChallengeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, challenges.ErrInvalidChallenge):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+	case errors.Is(err, challenges.ErrChallengeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "挑战不存在"})
+	case errors.Is(err, challenges.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅团队负责人可以管理挑战"})
+	case errors.Is(err, challenges.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "仅团队成员可以查看挑战"})
+	case errors.Is(err, challenges.ErrChallengeFinalized):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "挑战已结束"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": fallback})
+	}
+}
+
+// teamChallengeParams 解析当前用户、团队ID与可选的挑战ID
+func teamChallengeParams(c *gin.Context, withChallenge bool) (userID, teamID, challengeID uint64, ok bool) {
+	userID, ok = currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": "未登录"})
+		return 0, 0, 0, false
+	}
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的团队ID"})
+		return 0, 0, 0, false
+	}
+	if withChallenge {
+		challengeID, err = strconv.ParseUint(c.Param("challengeId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的挑战ID"})
+			return 0, 0, 0, false
+		}
+	}
+	return userID, teamID, challengeID, true
+}
+
+func handleListTeamChallenges(c *gin.Context) {
+	userID, teamID, _, ok := teamChallengeParams(c, false)
+	if !ok {
+		return
+	}
+	list, err := challenges.List(database.GetDB(), userID, teamID, c.Query("status"))
+	if err != nil {
+		respondChallengeError(c, err, "获取团队挑战失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": list})
+}
+
+// handleCreateTeamChallenge 团队负责人发布挑战，学习时长目标以分钟计
+func handleCreateTeamChallenge(c *gin.Context) {
+	userID, teamID, _, ok := teamChallengeParams(c, false)
+	if !ok {
+		return
+	}
+	var req challenges.ChallengeInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	db := database.GetDB()
+	challenge, err := challenges.Create(db, userID, teamID, req, time.Now())
+	if err != nil {
+		respondChallengeError(c, err, "发布团队挑战失败")
+		return
+	}
+
+	var memberIDs []uint64
+	db.Model(&models.TeamMember{}).Where("team_id = ? AND user_id <> ?", teamID, userID).Pluck("user_id", &memberIDs)
+	notifyTeamChallenge(db, challenge, memberIDs, "新的团队挑战", fmt.Sprintf("团队发布了新挑战「%s」", challenge.Title))
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "挑战已发布", "data": challenge})
+}
+
+// handleGetTeamChallengeProgress 挑战进度与各成员的贡献明细
+func handleGetTeamChallengeProgress(c *gin.Context) {
+	userID, teamID, challengeID, ok := teamChallengeParams(c, true)
+	if !ok {
+		return
+	}
+	progress, err := challenges.GetProgress(database.GetDB(), userID, teamID, challengeID)
+	if err != nil {
+		respondChallengeError(c, err, "获取挑战进度失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": progress})
+}
+
+func handleCancelTeamChallenge(c *gin.Context) {
+	userID, teamID, challengeID, ok := teamChallengeParams(c, true)
+	if !ok {
+		return
+	}
+	challenge, err := challenges.Cancel(database.GetDB(), userID, teamID, challengeID)
+	if err != nil {
+		respondChallengeError(c, err, "取消挑战失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "挑战已取消", "data": challenge})
+}
+
+// settleTeamChallenges 结算到期或达标的挑战，通知团队成员并发布积分事件
+func settleTeamChallenges(db *gorm.DB, now time.Time) (completed, expired int, err error) {
+	settled, err := challenges.Settle(db, now)
+	for _, s := range settled {
+		switch s.Challenge.Status {
+		case models.TeamChallengeStatusCompleted:
+			completed++
+			content := fmt.Sprintf("团队挑战「%s」已完成", s.Challenge.Title)
+			if s.Challenge.RewardPoints > 0 {
+				content += fmt.Sprintf("，有贡献的成员各获得 %d 积分", s.Challenge.RewardPoints)
+			}
+			notifyTeamChallenge(db, &s.Challenge, s.MemberIDs, "团队挑战完成", content)
+			for _, award := range s.Awards {
+				points.PublishAward(award)
+			}
+		case models.TeamChallengeStatusExpired:
+			expired++
+			notifyTeamChallenge(db, &s.Challenge, s.MemberIDs, "团队挑战已结束", fmt.Sprintf("团队挑战「%s」未在期限内达成", s.Challenge.Title))
+		}
+	}
+	return completed, expired, err
+}
+
+func notifyTeamChallenge(db *gorm.DB, challenge *models.TeamChallenge, userIDs []uint64, title, content string) {
+	relatedData := string(mustMarshal(map[string]uint64{"team_id": challenge.TeamID, "challenge_id": challenge.ID}))
+	for _, userID := range userIDs {
+		notification := models.Notification{
+			UserID:       userID,
+			Title:        title,
+			Content:      content,
+			Type:         notificationTypeTeamChallenge,
+			RelatedID:    challenge.ID,
+			RelatedData:  relatedData,
+			ActionStatus: "NONE",
+		}
+		if err := db.Create(&notification).Error; err != nil {
+			log.Printf("[TeamChallenge] notify user %d of challenge %d failed: %v", userID, challenge.ID, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	taskservice "learningAssistant-backend/services/task"
+	"learningAssistant-backend/services/usertime"
+)
+
+func seedTimezoneUser(t *testing.T, db *gorm.DB, account, timezone string) models.User {
+	t.Helper()
+	user := models.User{Account: account, DisplayName: account, PasswordHash: "x", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.Create(&models.UserSetting{UserID: user.ID, DailyGoalMinutes: 60, Timezone: timezone}).Error; err != nil {
+		t.Fatalf("create setting: %v", err)
+	}
+	return user
+}
+
+func TestAggregateDailyStatsUsesUserTimezoneAcrossDST(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	user := seedTimezoneUser(t, db, "ny-user", "America/New_York")
+	ny, _ := usertime.LoadLocation("America/New_York")
+
+	sessions := []struct {
+		start, end time.Time
+		minutes    int
+	}{
+		// 夏令时切换当天 00:30-03:30（实际 2 小时），前 90 分钟算夜间
+		{time.Date(2025, 3, 9, 0, 30, 0, 0, ny), time.Date(2025, 3, 9, 3, 30, 0, 0, ny), 120},
+		// 当地 22:00-23:30，UTC 已是次日
+		{time.Date(2025, 3, 9, 22, 0, 0, 0, ny), time.Date(2025, 3, 9, 23, 30, 0, 0, ny), 90},
+		// 当地次日凌晨结束，不应计入 3 月 9 日
+		{time.Date(2025, 3, 9, 23, 50, 0, 0, ny), time.Date(2025, 3, 10, 0, 40, 0, 0, ny), 50},
+	}
+	for _, s := range sessions {
+		end := s.end
+		if err := db.Create(&models.StudySession{UserID: user.ID, Source: "manual", StartTime: s.start, EndTime: &end, LastPingAt: end, DurationMinutes: s.minutes}).Error; err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+
+	if _, err := aggregateDailyStats(db, time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC), user.ID); err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+
+	var stat models.DailyStudyStat
+	if err := db.Where("user_id = ?", user.ID).First(&stat).Error; err != nil {
+		t.Fatalf("load stat: %v", err)
+	}
+	if got := stat.Date.Format("2006-01-02"); got != "2025-03-09" {
+		t.Fatalf("expected stat dated 2025-03-09, got %s", got)
+	}
+	if stat.Minutes != 210 || stat.SessionCount != 2 {
+		t.Fatalf("expected 210 minutes over 2 sessions, got %+v", stat)
+	}
+	if stat.NightMinutes != 180 {
+		t.Fatalf("expected 180 night minutes, got %d", stat.NightMinutes)
+	}
+	if stat.MorningMinutes != 120 {
+		t.Fatalf("expected 120 morning minutes, got %d", stat.MorningMinutes)
+	}
+}
+
+func TestDailyCheckInRejectsSecondCheckInSameDay(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	user := seedTimezoneUser(t, db, "checkin-user", "Pacific/Kiritimati")
+
+	r := gin.New()
+	registerUserRoutes(r.Group("/api/users"))
+
+	do := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/users/"+jsonNumber(user.ID)+"/check-in", nil))
+		return rr
+	}
+	if rr := do(); rr.Code != http.StatusOK {
+		t.Fatalf("first check-in: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 on second check-in, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var count int64
+	db.Model(&models.PointsLedger{}).Where("user_id = ? AND source_type = ?", user.ID, models.PointsSourceDailyCheckIn).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected one check-in ledger entry, got %d", count)
+	}
+
+	// 上次签到在用户时区的昨天，连续天数递增
+	yesterday := time.Now().Add(-24 * time.Hour)
+	db.Model(&models.PointsLedger{}).Where("user_id = ?", user.ID).Update("created_at", yesterday)
+	if rr := do(); rr.Code != http.StatusOK {
+		t.Fatalf("next-day check-in: %d %s", rr.Code, rr.Body.String())
+	}
+	var profile models.UserProfile
+	db.Where("user_id = ?", user.ID).First(&profile)
+	if profile.StreakDays != 2 {
+		t.Fatalf("expected streak 2, got %d", profile.StreakDays)
+	}
+}
+
+func TestBarStatsBucketByUserTimezone(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	user := seedTimezoneUser(t, db, "tokyo-user", "Asia/Tokyo")
+	tokyo, _ := usertime.LoadLocation("Asia/Tokyo")
+
+	dayStart, _ := usertime.DayBounds(time.Now(), tokyo)
+	inside := dayStart.Add(time.Minute)
+	before := dayStart.Add(-time.Minute)
+	completed := inside.Add(time.Minute)
+	for _, task := range []models.Task{
+		{Title: "today", OwnerUserID: &user.ID, CreatedBy: user.ID, DueAt: &inside, Status: 2, CompletedAt: &completed},
+		{Title: "yesterday", OwnerUserID: &user.ID, CreatedBy: user.ID, DueAt: &before},
+	} {
+		task := task
+		if err := db.Create(&task).Error; err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+	}
+
+	stats, err := taskservice.GetBarStats("day", user.ID, usertime.ForUser(user.ID))
+	if err != nil {
+		t.Fatalf("bar stats: %v", err)
+	}
+	if len(stats.Data) != 1 || stats.Data[0].Total != 1 || stats.Data[0].Completed != 1 {
+		t.Fatalf("expected one completed task due today in Tokyo, got %+v", stats.Data)
+	}
+	if stats.StartDate != dayStart.Format("2006-01-02") {
+		t.Fatalf("unexpected start date %s", stats.StartDate)
+	}
+}
@@ -16,11 +16,16 @@ import (
 	"gorm.io/gorm/clause"
 
 	"learningAssistant-backend/database"
+	"learningAssistant-backend/middleware"
 	"learningAssistant-backend/models"
 	"learningAssistant-backend/services/achievement"
 	"learningAssistant-backend/services/points"
+	"learningAssistant-backend/services/streak"
+	"learningAssistant-backend/services/usertime"
 )
 
+var errAlreadyCheckedIn = errors.New("already-checked-in")
+
 type userProfileResponse struct {
 	ID          uint64               `json:"id"`
 	Account     string               `json:"account"`
@@ -87,6 +92,8 @@ type userNotificationPreferences struct {
 	SMS     bool `json:"sms"`
 	InApp   bool `json:"in_app"`
 	Summary bool `json:"weekly_summary"`
+	// TeamMilestones 队友里程碑通知，旧客户端不传时保持原值
+	TeamMilestones *bool `json:"team_milestones,omitempty"`
 }
 
 type userPrivacySettings struct {
@@ -99,6 +106,7 @@ type userStudyHabitSettings struct {
 	DailyGoalMinutes int    `json:"daily_goal_minutes"`
 	PreferredPeriod  string `json:"preferred_period"`
 	FocusMode        bool   `json:"focus_mode"`
+	Timezone         string `json:"timezone"`
 }
 
 type userSettingsResponse struct {
@@ -120,6 +128,17 @@ func registerUserRoutes(router *gin.RouterGroup) {
 	router.GET("/:userId", handleGetUserProfile)
 	router.GET("/:userId/study-stats", handleGetUserStudyStats)
 	router.POST("/:userId/check-in", handleUserDailyCheckIn)
+	router.GET("/:userId/streak", handleGetUserStreak)
+	router.POST("/:userId/streak/freezes", middleware.AuthMiddleware(), handlePurchaseStreakFreeze)
+
+	// 成就与等级分享卡片
+	router.GET("/:userId/share-cards", middleware.AuthMiddleware(), handleListShareCards)
+	router.POST("/:userId/share-cards", middleware.AuthMiddleware(), handleCreateShareCard)
+	router.DELETE("/:userId/share-cards/:token", middleware.AuthMiddleware(), handleRevokeShareCard)
+
+	// 学习周报
+	router.GET("/:userId/weekly-reports", middleware.AuthMiddleware(), handleListWeeklyReports)
+	router.GET("/:userId/weekly-reports/:week", middleware.AuthMiddleware(), handleGetWeeklyReport)
 	router.GET("/:userId/points/ledger", handleGetUserPointsLedger)
 	router.GET("/:userId/achievements", handleGetUserAchievements)
 	router.GET("/:userId/skills", handleGetUserSkills)
@@ -210,7 +229,12 @@ func handleUserDailyCheckIn(c *gin.Context) {
 		return
 	}
 
+	loc := usertime.ForUser(userID)
+	now := time.Now()
+	today := usertime.StartOfDay(now, loc)
+
 	var updatedProfile models.UserProfile
+	var pointResult *points.AwardResult
 	err := db.Transaction(func(tx *gorm.DB) error {
 		var profile models.UserProfile
 		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
@@ -225,36 +249,52 @@ func handleUserDailyCheckIn(c *gin.Context) {
 				Level:              1,
 				NextLevelPoints:    200,
 				RankLabel:          "TOP 100%",
-				StreakDays:         1,
 				TaskCompletionRate: 0,
 			}
 			if err := tx.Create(&profile).Error; err != nil {
 				return err
 			}
-			updatedProfile = profile
-			return nil
 		}
 
-		profile.StreakDays++
-		if err := tx.Model(&models.UserProfile{}).
-			Where("id = ?", profile.ID).
-			Update("streak_days", profile.StreakDays).Error; err != nil {
+		// 按用户时区判断上次签到所在日期，同日拒绝
+		var last models.PointsLedger
+		err = tx.Where("user_id = ? AND source_type = ?", userID, models.PointsSourceDailyCheckIn).
+			Order("created_at DESC, id DESC").
+			First(&last).Error
+		if err == nil && usertime.DaysBetween(usertime.StartOfDay(last.CreatedAt, loc), today) == 0 {
+			return errAlreadyCheckedIn
+		} else if err != nil && !errorsIsNotFound(err) {
+			return err
+		}
+
+		// 连续天数由连续活跃服务统一计算，签到本身即算作今天活跃
+		summary, err := streak.RefreshWithTx(tx, userID, loc, now, true)
+		if err != nil {
 			return err
 		}
-		updatedProfile = profile
+
+		// last 未找到时 ID 为 0，对应首次签到的幂等键
+		result, err := points.AwardDailyCheckInTx(tx, userID, summary.Current, last.ID)
+		if err != nil {
+			if errors.Is(err, points.ErrAlreadyAwarded) {
+				return errAlreadyCheckedIn
+			}
+			return err
+		}
+		pointResult = result
+		updatedProfile = *result.Profile
 		return nil
 	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "签到失败"})
+	if errors.Is(err, errAlreadyCheckedIn) {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "今日已签到"})
 		return
 	}
-
-	pointResult, err := points.AwardDailyCheckIn(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "签到积分发放失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "签到失败"})
 		return
 	}
-	updatedProfile = *pointResult.Profile
+
+	points.PublishAward(pointResult)
 
 	if err := achievement.ProcessEvent(achievement.Event{
 		Type:   achievement.EventStreakUpdated,
@@ -415,6 +455,9 @@ func handleUpdateUserSettings(c *gin.Context) {
 		settings.NotifySMS = req.Notifications.SMS
 		settings.NotifyInApp = req.Notifications.InApp
 		settings.NotifySummary = req.Notifications.Summary
+		if req.Notifications.TeamMilestones != nil {
+			settings.NotifyTeamMilestones = *req.Notifications.TeamMilestones
+		}
 	}
 	if req.Privacy != nil {
 		settings.ShowEmail = req.Privacy.ShowEmail
@@ -429,6 +472,13 @@ func handleUpdateUserSettings(c *gin.Context) {
 			settings.PreferredPeriod = req.StudyHabits.PreferredPeriod
 		}
 		settings.FocusMode = req.StudyHabits.FocusMode
+		if tz := strings.TrimSpace(req.StudyHabits.Timezone); tz != "" {
+			if _, ok := usertime.LoadLocation(tz); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "时区无效，请使用 IANA 时区名，如 Asia/Shanghai"})
+				return
+			}
+			settings.Timezone = tz
+		}
 	}
 
 	if err := database.GetDB().Save(settings).Error; err != nil {
@@ -721,12 +771,14 @@ func buildStudyStatsResponse(profile *models.UserProfile) userStudyStatsResponse
 }
 
 func buildSettingsResponse(settings *models.UserSetting) userSettingsResponse {
+	teamMilestones := settings.NotifyTeamMilestones
 	return userSettingsResponse{
 		Notifications: userNotificationPreferences{
-			Email:   settings.NotifyEmail,
-			SMS:     settings.NotifySMS,
-			InApp:   settings.NotifyInApp,
-			Summary: settings.NotifySummary,
+			Email:          settings.NotifyEmail,
+			SMS:            settings.NotifySMS,
+			InApp:          settings.NotifyInApp,
+			Summary:        settings.NotifySummary,
+			TeamMilestones: &teamMilestones,
 		},
 		Privacy: userPrivacySettings{
 			ShowEmail:     settings.ShowEmail,
@@ -737,6 +789,7 @@ func buildSettingsResponse(settings *models.UserSetting) userSettingsResponse {
 			DailyGoalMinutes: settings.DailyGoalMinutes,
 			PreferredPeriod:  settings.PreferredPeriod,
 			FocusMode:        settings.FocusMode,
+			Timezone:         settings.Timezone,
 		},
 	}
 }
@@ -859,7 +912,7 @@ func composeUserSummaryWithDB(db *gorm.DB, userID uint64) (*authUserSummary, err
 	}, nil
 }
 
-func registerUserAccount(username, email, password, displayName string) (*authUserSummary, error) {
+func registerUserAccount(username, email, password, displayName, timezone string) (*authUserSummary, error) {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return nil, fmt.Errorf("用户名不能为空")
@@ -872,6 +925,12 @@ func registerUserAccount(username, email, password, displayName string) (*authUs
 	if display == "" {
 		display = username
 	}
+	timezone = strings.TrimSpace(timezone)
+	if timezone != "" {
+		if _, ok := usertime.LoadLocation(timezone); !ok {
+			return nil, fmt.Errorf("时区无效")
+		}
+	}
 
 	db := database.GetDB()
 	var result *authUserSummary
@@ -901,6 +960,7 @@ func registerUserAccount(username, email, password, displayName string) (*authUs
 			JoinDate:          time.Now().Format("2006年1月"),
 			PreferredLanguage: "zh-CN",
 			PreferredTheme:    "light",
+			Timezone:          timezone,
 		}
 
 		createTx := tx
@@ -938,17 +998,19 @@ func registerUserAccount(username, email, password, displayName string) (*authUs
 		}
 
 		settings := models.UserSetting{
-			UserID:           user.ID,
-			NotifyEmail:      true,
-			NotifySMS:        false,
-			NotifyInApp:      true,
-			NotifySummary:    true,
-			ShowEmail:        false,
-			ShowProfile:      true,
-			ShowStudyData:    true,
-			DailyGoalMinutes: 60,
-			PreferredPeriod:  "evening",
-			FocusMode:        false,
+			UserID:               user.ID,
+			NotifyEmail:          true,
+			NotifySMS:            false,
+			NotifyInApp:          true,
+			NotifySummary:        true,
+			NotifyTeamMilestones: true,
+			ShowEmail:            false,
+			ShowProfile:          true,
+			ShowStudyData:        true,
+			DailyGoalMinutes:     60,
+			PreferredPeriod:      "evening",
+			FocusMode:            false,
+			Timezone:             timezone,
 		}
 		if err := tx.Create(&settings).Error; err != nil {
 			return err
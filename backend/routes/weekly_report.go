@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/config"
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/mailer"
+	"learningAssistant-backend/services/usertime"
+	"learningAssistant-backend/services/weeklyreport"
+)
+
+const notificationTypeWeeklyReport = "WEEKLY_REPORT"
+
+func weeklyReportResponse(report *models.WeeklyReport, details *weeklyreport.Details) gin.H {
+	return gin.H{"report": report, "details": details}
+}
+
+// handleListWeeklyReports 历史周报，按周倒序
+func handleListWeeklyReports(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok || !ensureSelf(c, userID) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "12"))
+	if limit <= 0 || limit > 52 {
+		limit = 12
+	}
+	reports, err := weeklyreport.List(database.GetDB(), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取学习周报失败"})
+		return
+	}
+	list := make([]gin.H, 0, len(reports))
+	for i := range reports {
+		details, err := weeklyreport.ParseDetails(&reports[i])
+		if err != nil {
+			log.Printf("[WeeklyReport] parse report %d failed: %v", reports[i].ID, err)
+			details = &weeklyreport.Details{}
+		}
+		list = append(list, weeklyReportResponse(&reports[i], details))
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": list})
+}
+
+// handleGetWeeklyReport 查看某一周（周内任一日期，YYYY-MM-DD）的周报，week=latest 表示上一个完整周。
+// 上一个完整周的周报尚未生成时当场生成；更早的周只返回已保存的周报，避免用当前的掌握快照补写历史
+func handleGetWeeklyReport(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok || !ensureSelf(c, userID) {
+		return
+	}
+	db := database.GetDB()
+	now := time.Now()
+	loc := usertime.ForUser(userID)
+	lastWeek := weeklyreport.LastCompletedWeek(now, loc)
+
+	week := lastWeek
+	if param := c.Param("week"); param != "latest" {
+		day, err := time.ParseInLocation("2006-01-02", param, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "日期格式应为 YYYY-MM-DD"})
+			return
+		}
+		week = usertime.WeekStart(day, loc)
+	}
+
+	var report *models.WeeklyReport
+	var details *weeklyreport.Details
+	var err error
+	switch {
+	case week.After(lastWeek):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "该周尚未结束"})
+		return
+	case week.Equal(lastWeek):
+		report, details, err = weeklyreport.Generate(db, userID, week, now)
+	default:
+		report, err = weeklyreport.Get(db, userID, week)
+		if err == nil {
+			details, err = weeklyreport.ParseDetails(report)
+		}
+	}
+	if errors.Is(err, weeklyreport.ErrReportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "该周没有学习周报"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取学习周报失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success", "data": weeklyReportResponse(report, details)})
+}
+
+// weeklyReportMailer 按配置创建邮件发送器，未配置 SMTP 时返回 nil
+func weeklyReportMailer() mailer.Mailer {
+	if config.AppConfig == nil {
+		return nil
+	}
+	return mailer.New(config.AppConfig.Mail)
+}
+
+// generateWeeklyReports 为近两周有学习记录的用户生成上一个完整周（用户时区）的周报，
+// 按用户的通知设置发送站内通知和邮件。站内通知与邮件分别记录，已送达的不重复发送，邮件失败时下次任务重试
+func generateWeeklyReports(db *gorm.DB, now time.Time, mail mailer.Mailer) (delivered, emailed int, err error) {
+	candidates, err := weeklyReportCandidates(db, now.AddDate(0, 0, -15))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, userID := range candidates {
+		week := weeklyreport.LastCompletedWeek(now, usertime.ForUser(userID))
+		if !weeklyreport.Ready(week, now) {
+			continue
+		}
+		report, details, err := weeklyreport.Generate(db, userID, week, now)
+		if err != nil {
+			log.Printf("[WeeklyReport] generate for user %d failed: %v", userID, err)
+			continue
+		}
+		if report.NotifiedAt != nil && (report.EmailedAt != nil || mail == nil) {
+			continue
+		}
+		inApp, email, err := weeklyReportPreferences(db, userID)
+		if err != nil {
+			log.Printf("[WeeklyReport] load settings of user %d failed: %v", userID, err)
+			continue
+		}
+
+		if inApp && report.NotifiedAt == nil {
+			notification := models.Notification{
+				UserID:       userID,
+				Title:        "学习周报",
+				Content:      weeklyreport.Summary(report, details),
+				Type:         notificationTypeWeeklyReport,
+				RelatedID:    report.ID,
+				RelatedData:  string(mustMarshal(map[string]string{"week_start": report.WeekStart.Format("2006-01-02")})),
+				ActionStatus: "NONE",
+			}
+			if err := db.Create(&notification).Error; err != nil {
+				log.Printf("[WeeklyReport] notify user %d failed: %v", userID, err)
+			} else {
+				if err := weeklyreport.MarkNotified(db, report, now); err != nil {
+					log.Printf("[WeeklyReport] mark report %d notified failed: %v", report.ID, err)
+				}
+				delivered++
+			}
+		}
+
+		if !email || mail == nil || report.EmailedAt != nil {
+			continue
+		}
+		sent, err := emailWeeklyReport(db, mail, report, details)
+		if err != nil {
+			log.Printf("[WeeklyReport] email report %d failed: %v", report.ID, err)
+			continue
+		}
+		if sent {
+			if err := weeklyreport.MarkEmailed(db, report, now); err != nil {
+				log.Printf("[WeeklyReport] mark report %d emailed failed: %v", report.ID, err)
+			}
+			emailed++
+		}
+	}
+	return delivered, emailed, nil
+}
+
+// weeklyReportPreferences 周报的站内通知与邮件开关：需开启学习总结，并分别开启站内与邮件通知；
+// 未保存过设置的用户按默认开启处理
+func weeklyReportPreferences(db *gorm.DB, userID uint64) (inApp, email bool, err error) {
+	var settings models.UserSetting
+	err = db.Where("user_id = ?", userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, true, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return settings.NotifySummary && settings.NotifyInApp, settings.NotifySummary && settings.NotifyEmail, nil
+}
+
+// emailWeeklyReport 发送周报邮件，用户没有邮箱时跳过
+func emailWeeklyReport(db *gorm.DB, mail mailer.Mailer, report *models.WeeklyReport, details *weeklyreport.Details) (bool, error) {
+	var user models.User
+	if err := db.Select("id", "email", "display_name").First(&user, report.UserID).Error; err != nil {
+		return false, err
+	}
+	if user.Email == "" {
+		return false, nil
+	}
+	subject := fmt.Sprintf("你的学习周报（%s 至 %s）", report.WeekStart.Format("2006-01-02"), details.WeekEnd)
+	if err := mail.Send(user.Email, subject, weeklyreport.EmailBody(user.DisplayName, report, details)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// weeklyReportCandidates 自 since 起有学习时长、完成任务、新增知识点或解锁成就的用户
+func weeklyReportCandidates(db *gorm.DB, since time.Time) ([]uint64, error) {
+	seen := make(map[uint64]struct{})
+	var result []uint64
+	collect := func(query *gorm.DB, column string) error {
+		var ids []uint64
+		if err := query.Distinct().Pluck(column, &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				result = append(result, id)
+			}
+		}
+		return nil
+	}
+	if err := collect(db.Model(&models.DailyStudyStat{}).Where("date >= ? AND minutes > 0", usertime.CalendarDate(since)), "user_id"); err != nil {
+		return nil, err
+	}
+	if err := collect(db.Model(&models.Task{}).Where("status = ? AND completed_at >= ?", 2, since), "COALESCE(owner_user_id, created_by)"); err != nil {
+		return nil, err
+	}
+	if err := collect(db.Model(&models.KnowledgeBaseEntry{}).Where("created_at >= ?", since), "user_id"); err != nil {
+		return nil, err
+	}
+	if err := collect(db.Model(&models.UserAchievement{}).Where("awarded_at >= ?", since), "user_id"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
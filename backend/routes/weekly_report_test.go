@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/models"
+)
+
+type fakeMailer struct {
+	fail bool
+	sent []string
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	if m.fail {
+		return errors.New("smtp unavailable")
+	}
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+func TestGenerateWeeklyReportsRespectsSettingsAndRetriesEmail(t *testing.T) {
+	_, db := setupTaskCollaborationTest(t)
+	reader := models.User{Account: "reader", Email: "reader@example.com", Phone: "1", PasswordHash: "x", DisplayName: "读者"}
+	optedOut := models.User{Account: "quiet", Email: "quiet@example.com", Phone: "2", PasswordHash: "x", DisplayName: "安静"}
+	db.Create(&reader)
+	db.Create(&optedOut)
+	settings := models.UserSetting{UserID: optedOut.ID}
+	db.Create(&settings)
+	db.Model(&settings).Update("notify_summary", false)
+
+	monday := time.Date(2026, 3, 9, 0, 0, 0, 0, time.Local)
+	for _, userID := range []uint64{reader.ID, optedOut.ID} {
+		db.Create(&models.DailyStudyStat{UserID: userID, Date: monday.AddDate(0, 0, 1), Minutes: 45})
+	}
+	now := monday.AddDate(0, 0, 8).Add(12 * time.Hour)
+
+	// 邮件发送失败时站内通知照常送达，邮件留待下次重试
+	mail := &fakeMailer{fail: true}
+	delivered, emailed, err := generateWeeklyReports(db, now, mail)
+	if err != nil || delivered != 1 || emailed != 0 {
+		t.Fatalf("first run: delivered %d emailed %d err %v", delivered, emailed, err)
+	}
+	mail.fail = false
+	delivered, emailed, err = generateWeeklyReports(db, now.Add(time.Hour), mail)
+	if err != nil || delivered != 0 || emailed != 1 || len(mail.sent) != 1 || mail.sent[0] != reader.Email {
+		t.Fatalf("retry run: delivered %d emailed %d sent %v err %v", delivered, emailed, mail.sent, err)
+	}
+	if delivered, emailed, _ := generateWeeklyReports(db, now.Add(2*time.Hour), mail); delivered != 0 || emailed != 0 {
+		t.Fatalf("expected nothing resent, got %d %d", delivered, emailed)
+	}
+
+	var notified []uint64
+	db.Model(&models.Notification{}).Where("type = ?", notificationTypeWeeklyReport).Pluck("user_id", &notified)
+	if len(notified) != 1 || notified[0] != reader.ID {
+		t.Fatalf("expected only the reader to be notified, got %v", notified)
+	}
+	var report models.WeeklyReport
+	db.Where("user_id = ?", reader.ID).First(&report)
+	if report.NotifiedAt == nil || report.EmailedAt == nil {
+		t.Fatalf("expected delivery to be recorded, got %+v", report)
+	}
+}
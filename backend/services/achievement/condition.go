@@ -0,0 +1,336 @@
+package achievement
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 条件表达式示例：
+//
+//	{"metric":"task_total_completed","value":100}
+//	{"all":[
+//	    {"metric":"study_minutes","op":">=","value":600,"window":"7d"},
+//	    {"any":[
+//	        {"metric":"knowledge_entries","value":10,"category":"数学"},
+//	        {"metric":"tasks_completed","value":20,"window":"30d"}
+//	    ]}
+//	]}
+//
+// 旧格式 {"type":"...","value":N} 等价于 {"metric":"...","value":N}。
+const maxConditionDepth = 5
+
+// maxConditionWindow 时间窗口上限
+const maxConditionWindow = 366 * 24 * time.Hour
+
+var ErrInvalidCondition = errors.New("achievement_invalid_condition")
+
+// Condition 成就条件表达式：All/Any 组合子条件，否则为单个指标阈值
+type Condition struct {
+	All []*Condition `json:"all,omitempty"`
+	Any []*Condition `json:"any,omitempty"`
+
+	Metric   string  `json:"metric,omitempty"`
+	Op       string  `json:"op,omitempty"`
+	Value    float64 `json:"value"`
+	Window   string  `json:"window,omitempty"`
+	Category string  `json:"category,omitempty"`
+}
+
+// rawCondition 解析用的宽松结构，兼容旧格式的 type/mode 字段
+type rawCondition struct {
+	All      []json.RawMessage `json:"all"`
+	Any      []json.RawMessage `json:"any"`
+	Metric   string            `json:"metric"`
+	Type     string            `json:"type"`
+	Mode     string            `json:"mode"`
+	Op       string            `json:"op"`
+	Value    json.RawMessage   `json:"value"`
+	Window   string            `json:"window"`
+	Category string            `json:"category"`
+}
+
+// ValidationIssue 条件中的一处错误，Path 形如 $.all[1].window
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Result 条件的求值结果。组合条件的 Current/Target 取最接近达成（any）或最远（all）的子条件
+type Result struct {
+	Met     bool    `json:"met"`
+	Current float64 `json:"current"`
+	Target  float64 `json:"target"`
+}
+
+var comparisonOps = map[string]string{
+	">=": ">=", "gte": ">=",
+	">": ">", "gt": ">",
+	"<=": "<=", "lte": "<=",
+	"<": "<", "lt": "<",
+	"==": "==", "eq": "==",
+}
+
+// ParseCondition 解析并校验条件，存在任何问题时返回 ErrInvalidCondition 及全部问题
+func ParseCondition(raw []byte) (*Condition, []ValidationIssue, error) {
+	issues := make([]ValidationIssue, 0)
+	cond := parseConditionNode(raw, "$", 1, &issues)
+	if len(issues) > 0 {
+		return nil, issues, ErrInvalidCondition
+	}
+	return cond, nil, nil
+}
+
+func parseConditionNode(raw []byte, path string, depth int, issues *[]ValidationIssue) *Condition {
+	report := func(p, format string, args ...interface{}) {
+		*issues = append(*issues, ValidationIssue{Path: p, Message: fmt.Sprintf(format, args...)})
+	}
+	if depth > maxConditionDepth {
+		report(path, "嵌套层级不能超过 %d 层", maxConditionDepth)
+		return nil
+	}
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		report(path, "条件必须是 JSON 对象")
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	var node rawCondition
+	if err := decoder.Decode(&node); err != nil {
+		report(path, "无法解析条件: %v", err)
+		return nil
+	}
+
+	cond := &Condition{}
+	composite := 0
+	if node.All != nil {
+		composite++
+	}
+	if node.Any != nil {
+		composite++
+	}
+	if composite > 0 {
+		if composite > 1 || node.Metric != "" || node.Type != "" {
+			report(path, "all、any 与 metric 只能选择其一")
+			return nil
+		}
+		children, key := node.All, "all"
+		if node.Any != nil {
+			children, key = node.Any, "any"
+		}
+		if len(children) == 0 {
+			report(path+"."+key, "%s 至少需要一个子条件", key)
+			return nil
+		}
+		parsed := make([]*Condition, 0, len(children))
+		for i, child := range children {
+			parsed = append(parsed, parseConditionNode(child, fmt.Sprintf("%s.%s[%d]", path, key, i), depth+1, issues))
+		}
+		if key == "all" {
+			cond.All = parsed
+		} else {
+			cond.Any = parsed
+		}
+		return cond
+	}
+
+	value, err := parseConditionValue(node.Value)
+	if err != nil {
+		report(path+".value", "阈值必须是数字")
+	}
+	if node.Type != "" {
+		// 旧格式：夜间学时的 mode 决定使用总时长还是单次最长
+		if node.Metric != "" {
+			report(path, "type 与 metric 不能同时出现")
+			return nil
+		}
+		if node.Type == "studyroom_night_hours" {
+			switch node.Mode {
+			case "single":
+				node.Type = "studyroom_night_session_hours"
+			case "single_or_total":
+				return &Condition{Any: []*Condition{
+					{Metric: "studyroom_night_session_hours", Op: ">=", Value: value},
+					{Metric: "studyroom_night_hours", Op: ">=", Value: value},
+				}}
+			}
+		}
+		node.Metric = node.Type
+	} else if node.Mode != "" {
+		report(path+".mode", "mode 仅用于旧格式条件")
+	}
+
+	cond.Metric = strings.TrimSpace(node.Metric)
+	cond.Value = value
+	cond.Window = strings.TrimSpace(node.Window)
+	cond.Category = strings.TrimSpace(node.Category)
+	if cond.Metric == "" {
+		report(path, "缺少 metric")
+		return nil
+	}
+	metric, ok := lookupMetric(cond.Metric)
+	if !ok {
+		report(path+".metric", "未知指标 %q", cond.Metric)
+		return cond
+	}
+	cond.Op = ">="
+	if node.Op != "" {
+		op, ok := comparisonOps[strings.ToLower(strings.TrimSpace(node.Op))]
+		if !ok {
+			report(path+".op", "不支持的比较符 %q", node.Op)
+		}
+		cond.Op = op
+	}
+	if cond.Window != "" {
+		if !metric.Windowed {
+			report(path+".window", "指标 %s 不支持时间窗口", metric.Name)
+		} else if _, err := ParseWindow(cond.Window); err != nil {
+			report(path+".window", "%v", err)
+		}
+	}
+	if cond.Category != "" && !metric.Categorized {
+		report(path+".category", "指标 %s 不支持分类过滤", metric.Name)
+	}
+	return cond
+}
+
+func parseConditionValue(raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	var number float64
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number, nil
+	}
+	// 兼容历史数据中以字符串保存的阈值
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(text), 64)
+}
+
+// ParseWindow 解析时间窗口，支持 h（小时）、d（天）、w（周），如 "24h"、"7d"、"4w"
+func ParseWindow(window string) (time.Duration, error) {
+	window = strings.ToLower(strings.TrimSpace(window))
+	if len(window) < 2 {
+		return 0, fmt.Errorf("时间窗口格式应为 24h、7d 或 4w")
+	}
+	n, err := strconv.Atoi(window[:len(window)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("时间窗口格式应为 24h、7d 或 4w")
+	}
+	var unit time.Duration
+	switch window[len(window)-1] {
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("时间窗口格式应为 24h、7d 或 4w")
+	}
+	if d := time.Duration(n) * unit; d <= maxConditionWindow {
+		return d, nil
+	}
+	return 0, fmt.Errorf("时间窗口不能超过 366 天")
+}
+
+// Key 条件的分组键，同一指标、窗口与分类的成就视为同一系列
+func (c *Condition) Key() string {
+	switch {
+	case c.All != nil || c.Any != nil:
+		op, children := "all", c.All
+		if c.Any != nil {
+			op, children = "any", c.Any
+		}
+		keys := make([]string, 0, len(children))
+		for _, child := range children {
+			keys = append(keys, child.Key())
+		}
+		return op + "(" + strings.Join(keys, ",") + ")"
+	default:
+		key := c.Metric
+		if c.Window != "" {
+			key += "@" + c.Window
+		}
+		if c.Category != "" {
+			key += "#" + c.Category
+		}
+		return key
+	}
+}
+
+// Evaluate 对条件求值，同一次求值中相同的指标查询只执行一次
+func (c *Condition) Evaluate(ctx *evalContext) (Result, error) {
+	if c.All != nil || c.Any != nil {
+		children := c.All
+		if c.Any != nil {
+			children = c.Any
+		}
+		var picked Result
+		pickedRatio := -1.0
+		met := c.All != nil
+		for _, child := range children {
+			res, err := child.Evaluate(ctx)
+			if err != nil {
+				return Result{}, err
+			}
+			ratio := completionRatio(res)
+			if c.All != nil {
+				met = met && res.Met
+				if pickedRatio < 0 || ratio < pickedRatio {
+					picked, pickedRatio = res, ratio
+				}
+			} else {
+				met = met || res.Met
+				if ratio > pickedRatio {
+					picked, pickedRatio = res, ratio
+				}
+			}
+		}
+		picked.Met = met
+		return picked, nil
+	}
+
+	value, err := ctx.resolve(c)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Met: compare(value, c.Op, c.Value), Current: value, Target: c.Value}, nil
+}
+
+func completionRatio(res Result) float64 {
+	if res.Met {
+		return 1
+	}
+	if res.Target <= 0 {
+		return 0
+	}
+	ratio := res.Current / res.Target
+	if ratio > 1 {
+		ratio = 1
+	}
+	return ratio
+}
+
+func compare(value float64, op string, target float64) bool {
+	switch op {
+	case ">":
+		return value > target
+	case "<=":
+		return value <= target
+	case "<":
+		return value < target
+	case "==":
+		return value == target
+	default:
+		return value >= target
+	}
+}
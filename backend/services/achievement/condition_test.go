@@ -0,0 +1,84 @@
+package achievement
+
+import (
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestParseConditionReportsAllIssues(t *testing.T) {
+	_, issues, err := ParseCondition([]byte(`{"all":[
+		{"metric":"nope","value":1},
+		{"metric":"task_total_completed","value":1,"window":"7d"},
+		{"metric":"study_minutes","op":"~","value":1,"window":"3y"},
+		{"any":[]}
+	]}`))
+	if err == nil {
+		t.Fatalf("expected invalid condition")
+	}
+	want := []string{"$.all[0].metric", "$.all[1].window", "$.all[2].op", "$.all[2].window", "$.all[3].any"}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %+v", len(want), issues)
+	}
+	for i, path := range want {
+		if issues[i].Path != path {
+			t.Fatalf("issue %d: expected path %s, got %+v", i, path, issues[i])
+		}
+	}
+}
+
+func TestLegacyConditionsStillParse(t *testing.T) {
+	cond, _, err := ParseCondition([]byte(`{"type":"studyroom_night_hours","value":2,"mode":"single_or_total"}`))
+	if err != nil || len(cond.Any) != 2 {
+		t.Fatalf("expected legacy night condition as any(), got %+v err=%v", cond, err)
+	}
+	cond, _, err = ParseCondition([]byte(`{"type":"task_total_completed","value":"5"}`))
+	if err != nil || cond.Metric != "task_total_completed" || cond.Value != 5 || cond.Op != ">=" {
+		t.Fatalf("unexpected legacy condition %+v err=%v", cond, err)
+	}
+}
+
+func TestDataDrivenAchievementUnlocks(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	userID := uint64(7)
+
+	db.Create(&models.Achievement{Code: "weekly_math", Name: "数学周", Condition: `{"all":[
+		{"metric":"study_minutes","value":120,"window":"7d"},
+		{"any":[{"metric":"knowledge_entries","value":2,"category":"数学"},{"metric":"task_total_completed","value":50}]}
+	]}`})
+	db.Create(&models.Achievement{Code: "broken", Name: "坏条件", Condition: `{"metric":"unknown","value":1}`})
+
+	end := now.Add(-time.Hour)
+	old := now.AddDate(0, 0, -10)
+	oldEnd := old.Add(3 * time.Hour)
+	db.Create(&models.StudySession{UserID: userID, Source: "room", StartTime: now.Add(-2 * time.Hour), EndTime: &end, LastPingAt: end, DurationMinutes: 60})
+	db.Create(&models.StudySession{UserID: userID, Source: "room", StartTime: old, EndTime: &oldEnd, LastPingAt: oldEnd, DurationMinutes: 180})
+	db.Create(&models.KnowledgeBaseEntry{UserID: userID, Title: "极限", Category: "数学"})
+	db.Create(&models.KnowledgeBaseEntry{UserID: userID, Title: "导数", Category: "数学"})
+
+	if err := EnsureAchievementsForUser(userID); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	var unlocked int64
+	db.Model(&models.UserAchievement{}).Where("user_id = ?", userID).Count(&unlocked)
+	if unlocked != 0 {
+		t.Fatalf("study outside the 7 day window must not count")
+	}
+
+	end2 := now.Add(-10 * time.Minute)
+	db.Create(&models.StudySession{UserID: userID, Source: "pomodoro", StartTime: now.Add(-70 * time.Minute), EndTime: &end2, LastPingAt: end2, DurationMinutes: 60})
+	result, _, err := PreviewCondition(userID, []byte(`{"metric":"study_minutes","value":60,"window":"7d","category":"pomodoro"}`))
+	if err != nil || !result.Met || result.Current != 60 {
+		t.Fatalf("unexpected preview %+v err=%v", result, err)
+	}
+	if err := EnsureAchievementsForUser(userID); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	db.Model(&models.UserAchievement{}).Where("user_id = ?", userID).Count(&unlocked)
+	if unlocked != 1 {
+		t.Fatalf("expected data-driven achievement unlocked, got %d", unlocked)
+	}
+}
@@ -12,6 +12,8 @@ import (
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/events"
+	"learningAssistant-backend/services/milestone"
 )
 
 // AchievementEventType 支持的触发事件类型
@@ -23,6 +25,8 @@ const (
 	EventStreakUpdated    AchievementEventType = "streak_updated"
 	EventStudyRoomJoin    AchievementEventType = "studyroom_join"
 	EventTeamTaskFinished AchievementEventType = "team_task_finished"
+	// EventStudyRoomReaction 聊天消息收到或送出表情回应
+	EventStudyRoomReaction AchievementEventType = "studyroom_reaction"
 )
 
 // Event 成就事件
@@ -39,8 +43,9 @@ func ProcessEvent(evt Event) error {
 		return fmt.Errorf("achievement event missing user id")
 	}
 
+	var unlocked []models.Achievement
 	db := database.GetDB()
-	return db.Transaction(func(tx *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
 		progress, err := ensureProgressForUpdate(tx, evt.UserID)
 		if err != nil {
 			return err
@@ -56,8 +61,13 @@ func ProcessEvent(evt Event) error {
 			return err
 		}
 
-		return evaluateAchievements(tx, progress)
+		unlocked, err = evaluateAchievements(tx, progress)
+		return err
 	})
+	if err == nil {
+		publishUnlocked(evt.UserID, unlocked)
+	}
+	return err
 }
 
 // EnsureAchievementsForUser 主动检查并解锁成就
@@ -66,8 +76,9 @@ func EnsureAchievementsForUser(userID uint64) error {
 		return fmt.Errorf("invalid user id")
 	}
 
+	var unlocked []models.Achievement
 	db := database.GetDB()
-	return db.Transaction(func(tx *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
 		progress, err := ensureProgressForUpdate(tx, userID)
 		if err != nil {
 			return err
@@ -78,8 +89,13 @@ func EnsureAchievementsForUser(userID uint64) error {
 		if err := tx.Save(progress).Error; err != nil {
 			return err
 		}
-		return evaluateAchievements(tx, progress)
+		unlocked, err = evaluateAchievements(tx, progress)
+		return err
 	})
+	if err == nil {
+		publishUnlocked(userID, unlocked)
+	}
+	return err
 }
 
 func ensureProgressForUpdate(tx *gorm.DB, userID uint64) (*models.UserAchievementProgress, error) {
@@ -110,8 +126,13 @@ func syncProgressFromProfile(tx *gorm.DB, progress *models.UserAchievementProgre
 		if profile.TasksCompleted > progress.TaskCompletedCount {
 			progress.TaskCompletedCount = profile.TasksCompleted
 		}
-		if profile.StreakDays > progress.StreakDays {
-			progress.StreakDays = profile.StreakDays
+		// 连续天数指标取历史最长值，中断后已解锁的进度不回退
+		streakDays := profile.StreakDays
+		if profile.LongestStreakDays > streakDays {
+			streakDays = profile.LongestStreakDays
+		}
+		if streakDays > progress.StreakDays {
+			progress.StreakDays = streakDays
 		}
 	}
 	return nil
@@ -128,10 +149,10 @@ func applyEvent(progress *models.UserAchievementProgress, evt Event) {
 		if streak == 0 {
 			streak = metaInt(evt.Metadata, "streak_days")
 		}
-		if streak < 0 {
-			streak = 0
+		// 与档案同步的口径一致，只记录达到过的最大值
+		if streak > progress.StreakDays {
+			progress.StreakDays = streak
 		}
-		progress.StreakDays = streak
 	case EventStudyRoomJoin:
 		progress.StudyRoomJoinCount++
 		progress.StudyRoomDurationMins += metaInt(evt.Metadata, "duration_minutes")
@@ -147,93 +168,47 @@ func applyEvent(progress *models.UserAchievementProgress, evt Event) {
 		progress.StudyRoomChatCount += metaInt(evt.Metadata, "chat_messages")
 		progress.StudyRoomLikesGiven += metaInt(evt.Metadata, "likes_given")
 		progress.StudyRoomLikesReceived += metaInt(evt.Metadata, "likes_received")
+	case EventStudyRoomReaction:
+		progress.StudyRoomLikesGiven += metaInt(evt.Metadata, "likes_given")
+		progress.StudyRoomLikesReceived += metaInt(evt.Metadata, "likes_received")
 	case EventTeamTaskFinished:
 		progress.TeamTasksCompleted++
 	}
 }
 
-type achievementCondition struct {
-	Type  string
-	Value float64
-	Raw   map[string]interface{}
-}
-
-func parseCondition(raw string) (achievementCondition, error) {
-	result := achievementCondition{
-		Raw: map[string]interface{}{},
-	}
-	if raw == "" {
-		return result, fmt.Errorf("empty condition")
-	}
-	if err := json.Unmarshal([]byte(raw), &result.Raw); err != nil {
-		return result, err
-	}
-
-	typeVal, ok := result.Raw["type"].(string)
-	if !ok || typeVal == "" {
-		return result, fmt.Errorf("condition missing type")
-	}
-	result.Type = typeVal
-	if value, ok := result.Raw["value"]; ok {
-		result.Value = toFloat(value)
-	}
-	return result, nil
-}
-
-func (c achievementCondition) extraString(key string) string {
-	if value, ok := c.Raw[key]; ok {
-		return fmt.Sprint(value)
-	}
-	return ""
-}
-
-func toFloat(value interface{}) float64 {
-	switch v := value.(type) {
-	case float32:
-		return float64(v)
-	case float64:
-		return v
-	case int:
-		return float64(v)
-	case int64:
-		return float64(v)
-	case json.Number:
-		f, _ := v.Float64()
-		return f
-	case string:
-		f, _ := strconv.ParseFloat(v, 64)
-		return f
-	default:
-		return 0
-	}
-}
-
-func evaluateAchievements(tx *gorm.DB, progress *models.UserAchievementProgress) error {
+// evaluateAchievements 对尚未解锁的成就求值并解锁满足条件的成就，返回本次新解锁的成就
+func evaluateAchievements(tx *gorm.DB, progress *models.UserAchievementProgress) ([]models.Achievement, error) {
 	var achievements []models.Achievement
 	if err := tx.Find(&achievements).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	var unlockedIDs []uint
 	if err := tx.Model(&models.UserAchievement{}).
 		Where("user_id = ?", progress.UserID).
 		Pluck("achievement_id", &unlockedIDs).Error; err != nil {
-		return err
+		return nil, err
 	}
 	existing := make(map[uint]struct{}, len(unlockedIDs))
 	for _, id := range unlockedIDs {
 		existing[id] = struct{}{}
 	}
 
+	var unlocked []models.Achievement
+	ctx := newEvalContext(tx, progress, time.Now())
 	for _, ach := range achievements {
 		if _, ok := existing[ach.ID]; ok {
 			continue
 		}
-		cond, err := parseCondition(ach.Condition)
+		cond, _, err := ParseCondition([]byte(ach.Condition))
 		if err != nil {
 			continue
 		}
-		if !checkCondition(progress, cond) {
+		result, err := cond.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Met {
 			continue
 		}
 
@@ -242,49 +217,61 @@ func evaluateAchievements(tx *gorm.DB, progress *models.UserAchievementProgress)
 			AchievementID: ach.ID,
 			AwardedAt:     time.Now(),
 		}
-		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
-			return err
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			if err := milestone.Record(tx, unlockedEvent(progress.UserID, ach)); err != nil {
+				return nil, err
+			}
+			unlocked = append(unlocked, ach)
 		}
 	}
 
-	return nil
+	return unlocked, nil
 }
 
-func checkCondition(progress *models.UserAchievementProgress, cond achievementCondition) bool {
-	switch cond.Type {
-	case "task_total_completed":
-		return float64(progress.TaskCompletedCount) >= cond.Value
-	case "task_total_created":
-		return float64(progress.TaskCreatedCount) >= cond.Value
-	case "streak_task_completion":
-		return float64(progress.StreakDays) >= cond.Value
-	case "studyroom_join_count":
-		return float64(progress.StudyRoomJoinCount) >= cond.Value
-	case "studyroom_duration_hours":
-		return minutesToHours(progress.StudyRoomDurationMins) >= cond.Value
-	case "studyroom_night_hours":
-		mode := cond.extraString("mode")
-		total := minutesToHours(progress.StudyRoomNightMins)
-		single := minutesToHours(progress.NightSessionMaxMins)
-		switch mode {
-		case "single":
-			return single >= cond.Value
-		case "single_or_total":
-			return single >= cond.Value || total >= cond.Value
-		default:
-			return total >= cond.Value
-		}
-	case "studyroom_chat_count":
-		return float64(progress.StudyRoomChatCount) >= cond.Value
-	case "studyroom_likes_given":
-		return float64(progress.StudyRoomLikesGiven) >= cond.Value
-	case "studyroom_likes_received":
-		return float64(progress.StudyRoomLikesReceived) >= cond.Value
-	case "team_task_completed":
-		return float64(progress.TeamTasksCompleted) >= cond.Value
-	default:
-		return false
+func unlockedEvent(userID uint64, ach models.Achievement) events.Event {
+	return events.Event{
+		Type:   events.TypeAchievementUnlocked,
+		UserID: userID,
+		Data:   events.AchievementUnlocked{AchievementID: ach.ID, Code: ach.Code, Name: ach.Name, Icon: ach.Icon},
+	}
+}
+
+// publishUnlocked 在事务提交后为新解锁的成就发布 achievement_unlocked 事件，用于实时推送；
+// 通知记录已在解锁时的事务中写入
+func publishUnlocked(userID uint64, unlocked []models.Achievement) {
+	if len(unlocked) == 0 {
+		return
+	}
+	evts := make([]events.Event, 0, len(unlocked))
+	for _, ach := range unlocked {
+		evts = append(evts, unlockedEvent(userID, ach))
+	}
+	events.Publish(evts...)
+}
+
+// PreviewCondition 按用户当前数据对条件求值，不解锁任何成就，供成就作者调试
+func PreviewCondition(userID uint64, raw []byte) (*Result, []ValidationIssue, error) {
+	cond, issues, err := ParseCondition(raw)
+	if err != nil {
+		return nil, issues, err
+	}
+	db := database.GetDB()
+	progress, err := loadProgress(db, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := syncProgressFromProfile(db, progress); err != nil {
+		return nil, nil, err
+	}
+	result, err := cond.Evaluate(newEvalContext(db, progress, time.Now()))
+	if err != nil {
+		return nil, nil, err
 	}
+	return &result, nil, nil
 }
 
 func minutesToHours(mins int) float64 {
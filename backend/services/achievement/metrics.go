@@ -0,0 +1,287 @@
+package achievement
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+// MetricQuery 指标求值的参数，Since 为空表示不限时间
+type MetricQuery struct {
+	DB       *gorm.DB
+	UserID   uint64
+	Progress *models.UserAchievementProgress
+	Since    *time.Time
+	Category string
+	Now      time.Time
+}
+
+// Metric 可在成就条件中引用的指标
+type Metric struct {
+	Name        string                               `json:"name"`
+	Description string                               `json:"description"`
+	Unit        string                               `json:"unit"`
+	Windowed    bool                                 `json:"windowed"`
+	Categorized bool                                 `json:"categorized"`
+	Resolve     func(q MetricQuery) (float64, error) `json:"-"`
+}
+
+var (
+	metricsMu sync.RWMutex
+	metrics   = make(map[string]Metric)
+)
+
+// RegisterMetric 注册指标，名称重复时返回错误
+func RegisterMetric(metric Metric) error {
+	if metric.Name == "" || metric.Resolve == nil {
+		return fmt.Errorf("achievement metric requires name and resolver")
+	}
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if _, exists := metrics[metric.Name]; exists {
+		return fmt.Errorf("achievement metric %s already registered", metric.Name)
+	}
+	metrics[metric.Name] = metric
+	return nil
+}
+
+func mustRegisterMetric(metric Metric) {
+	if err := RegisterMetric(metric); err != nil {
+		panic(err)
+	}
+}
+
+func lookupMetric(name string) (Metric, bool) {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	metric, ok := metrics[name]
+	return metric, ok
+}
+
+// Metrics 返回全部已注册指标，按名称排序
+func Metrics() []Metric {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	list := make([]Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		list = append(list, metric)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// evalContext 一次成就检查的求值上下文，缓存相同条件的指标值
+type evalContext struct {
+	db       *gorm.DB
+	progress *models.UserAchievementProgress
+	now      time.Time
+	cache    map[string]float64
+}
+
+func newEvalContext(db *gorm.DB, progress *models.UserAchievementProgress, now time.Time) *evalContext {
+	return &evalContext{db: db, progress: progress, now: now, cache: make(map[string]float64)}
+}
+
+func (ctx *evalContext) resolve(c *Condition) (float64, error) {
+	key := c.Key()
+	if value, ok := ctx.cache[key]; ok {
+		return value, nil
+	}
+	metric, ok := lookupMetric(c.Metric)
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown metric %s", ErrInvalidCondition, c.Metric)
+	}
+	query := MetricQuery{
+		DB:       ctx.db,
+		UserID:   ctx.progress.UserID,
+		Progress: ctx.progress,
+		Category: c.Category,
+		Now:      ctx.now,
+	}
+	if c.Window != "" {
+		window, err := ParseWindow(c.Window)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidCondition, err)
+		}
+		since := ctx.now.Add(-window)
+		query.Since = &since
+	}
+	value, err := metric.Resolve(query)
+	if err != nil {
+		return 0, err
+	}
+	ctx.cache[key] = value
+	return value, nil
+}
+
+// counterMetric 由成就进度表中的累计计数提供的指标
+func counterMetric(name, description, unit string, read func(p *models.UserAchievementProgress) float64) Metric {
+	return Metric{
+		Name:        name,
+		Description: description,
+		Unit:        unit,
+		Resolve: func(q MetricQuery) (float64, error) {
+			return read(q.Progress), nil
+		},
+	}
+}
+
+func init() {
+	counters := []Metric{
+		counterMetric("task_total_completed", "累计完成任务数", "个", func(p *models.UserAchievementProgress) float64 { return float64(p.TaskCompletedCount) }),
+		counterMetric("task_total_created", "累计创建任务数", "个", func(p *models.UserAchievementProgress) float64 { return float64(p.TaskCreatedCount) }),
+		counterMetric("streak_task_completion", "连续打卡天数", "天", func(p *models.UserAchievementProgress) float64 { return float64(p.StreakDays) }),
+		counterMetric("studyroom_join_count", "进入自习室次数", "次", func(p *models.UserAchievementProgress) float64 { return float64(p.StudyRoomJoinCount) }),
+		counterMetric("studyroom_duration_hours", "自习室累计学习时长", "小时", func(p *models.UserAchievementProgress) float64 { return minutesToHours(p.StudyRoomDurationMins) }),
+		counterMetric("studyroom_night_hours", "自习室夜间累计学习时长", "小时", func(p *models.UserAchievementProgress) float64 { return minutesToHours(p.StudyRoomNightMins) }),
+		counterMetric("studyroom_night_session_hours", "自习室单次最长夜间学习时长", "小时", func(p *models.UserAchievementProgress) float64 { return minutesToHours(p.NightSessionMaxMins) }),
+		counterMetric("studyroom_chat_count", "自习室发言次数", "条", func(p *models.UserAchievementProgress) float64 { return float64(p.StudyRoomChatCount) }),
+		counterMetric("studyroom_likes_given", "送出的表情回应数", "个", func(p *models.UserAchievementProgress) float64 { return float64(p.StudyRoomLikesGiven) }),
+		counterMetric("studyroom_likes_received", "收到的表情回应数", "个", func(p *models.UserAchievementProgress) float64 { return float64(p.StudyRoomLikesReceived) }),
+		counterMetric("team_task_completed", "完成的团队任务数", "个", func(p *models.UserAchievementProgress) float64 { return float64(p.TeamTasksCompleted) }),
+	}
+	for _, metric := range counters {
+		mustRegisterMetric(metric)
+	}
+
+	mustRegisterMetric(Metric{
+		Name:        "tasks_completed",
+		Description: "完成的任务数（负责人或执行人），category 为任务分类名称",
+		Unit:        "个",
+		Windowed:    true,
+		Categorized: true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.Task{}).
+				Where("tasks.status = ? AND tasks.completed_at IS NOT NULL", 2).
+				Where("tasks.owner_user_id = ? OR tasks.id IN (?)", q.UserID,
+					q.DB.Model(&models.TaskAssignee{}).Select("task_id").Where("user_id = ?", q.UserID))
+			if q.Since != nil {
+				query = query.Where("tasks.completed_at >= ?", *q.Since)
+			}
+			if q.Category != "" {
+				query = query.Joins("JOIN task_categories ON task_categories.id = tasks.category_id").
+					Where("task_categories.name = ?", q.Category)
+			}
+			var count int64
+			err := query.Count(&count).Error
+			return float64(count), err
+		},
+	})
+	mustRegisterMetric(Metric{
+		Name:        "study_minutes",
+		Description: "已结束学习会话的计入时长，category 为会话来源（如 room、pomodoro、group_call）",
+		Unit:        "分钟",
+		Windowed:    true,
+		Categorized: true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.StudySession{}).
+				Where("user_id = ? AND end_time IS NOT NULL", q.UserID)
+			if q.Since != nil {
+				query = query.Where("start_time >= ?", *q.Since)
+			}
+			if q.Category != "" {
+				query = query.Where("source = ?", q.Category)
+			}
+			var total int64
+			err := query.Select("COALESCE(SUM(duration_minutes), 0)").Scan(&total).Error
+			return float64(total), err
+		},
+	})
+	mustRegisterMetric(Metric{
+		Name:        "study_days",
+		Description: "有学习记录的天数（按用户时区），category 为会话来源",
+		Unit:        "天",
+		Windowed:    true,
+		Categorized: true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.StudySession{}).
+				Where("user_id = ? AND end_time IS NOT NULL AND duration_minutes > 0", q.UserID)
+			if q.Since != nil {
+				query = query.Where("start_time >= ?", *q.Since)
+			}
+			if q.Category != "" {
+				query = query.Where("source = ?", q.Category)
+			}
+			var starts []time.Time
+			if err := query.Pluck("start_time", &starts).Error; err != nil {
+				return 0, err
+			}
+			loc := usertime.ForUser(q.UserID)
+			days := make(map[string]struct{}, len(starts))
+			for _, start := range starts {
+				days[usertime.DayKey(start, loc)] = struct{}{}
+			}
+			return float64(len(days)), nil
+		},
+	})
+	mustRegisterMetric(Metric{
+		Name:        "knowledge_entries",
+		Description: "新增的知识库条目数（不含已归档），category 为知识分类",
+		Unit:        "条",
+		Windowed:    true,
+		Categorized: true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.KnowledgeBaseEntry{}).Where("user_id = ? AND status <> ?", q.UserID, 2)
+			if q.Since != nil {
+				query = query.Where("created_at >= ?", *q.Since)
+			}
+			if q.Category != "" {
+				query = query.Where("category = ?", q.Category)
+			}
+			var count int64
+			err := query.Count(&count).Error
+			return float64(count), err
+		},
+	})
+	mustRegisterMetric(Metric{
+		Name:        "knowledge_mastered",
+		Description: "当前已掌握（等级 4）的知识点数，category 为知识分类",
+		Unit:        "个",
+		Categorized: true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.KnowledgeBaseEntry{}).Where("user_id = ? AND status <> ? AND level >= ?", q.UserID, 2, 4)
+			if q.Category != "" {
+				query = query.Where("category = ?", q.Category)
+			}
+			var count int64
+			err := query.Count(&count).Error
+			return float64(count), err
+		},
+	})
+	mustRegisterMetric(Metric{
+		Name:        "notes_created",
+		Description: "创建的学习笔记数",
+		Unit:        "篇",
+		Windowed:    true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.StudyNote{}).Where("user_id = ?", q.UserID)
+			if q.Since != nil {
+				query = query.Where("created_at >= ?", *q.Since)
+			}
+			var count int64
+			err := query.Count(&count).Error
+			return float64(count), err
+		},
+	})
+	mustRegisterMetric(Metric{
+		Name:        "room_messages",
+		Description: "在自习室发送的聊天消息数（不含系统消息）",
+		Unit:        "条",
+		Windowed:    true,
+		Resolve: func(q MetricQuery) (float64, error) {
+			query := q.DB.Model(&models.ChatMessage{}).Where("user_id = ? AND msg_type <> ?", q.UserID, 3)
+			if q.Since != nil {
+				query = query.Where("sent_at >= ?", *q.Since)
+			}
+			var count int64
+			err := query.Count(&count).Error
+			return float64(count), err
+		},
+	})
+}
@@ -0,0 +1,300 @@
+package achievement
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/streak"
+	"learningAssistant-backend/services/usertime"
+)
+
+// recomputeBatchSize 全量重算时每批加载的用户数
+const recomputeBatchSize = 200
+
+// errDryRun 试运行时用于回滚事务
+var errDryRun = errors.New("achievement_recompute_dry_run")
+
+// RecomputeOptions 重算选项。DryRun 只计算并报告结果，不写入进度也不解锁成就
+type RecomputeOptions struct {
+	DryRun bool
+}
+
+// UnlockedAchievement 重算后新解锁的成就
+type UnlockedAchievement struct {
+	ID   uint   `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// FieldChange 进度字段的前后值
+type FieldChange struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+// RecomputeReport 单个用户的重算结果
+type RecomputeReport struct {
+	UserID   uint64                 `json:"user_id"`
+	Changes  map[string]FieldChange `json:"changes"`
+	Unlocked []UnlockedAchievement  `json:"unlocked"`
+}
+
+// RecomputeSummary 全量重算的汇总，Reports 只包含进度有变化或解锁了新成就的用户
+type RecomputeSummary struct {
+	DryRun        bool              `json:"dry_run"`
+	Users         int               `json:"users"`
+	ChangedUsers  int               `json:"changed_users"`
+	UnlockedTotal int               `json:"unlocked_total"`
+	Failed        map[uint64]string `json:"failed,omitempty"`
+	Reports       []RecomputeReport `json:"reports"`
+}
+
+// Recompute 根据任务、学习会话、每日学习统计、聊天消息与表情回应等源数据重建用户的成就进度，
+// 再重新评估成就。增量计数出错或新增成就后用于回填
+func Recompute(db *gorm.DB, userID uint64, opts RecomputeOptions) (*RecomputeReport, error) {
+	var report *RecomputeReport
+	var unlocked []models.Achievement
+	err := db.Transaction(func(tx *gorm.DB) error {
+		progress, err := ensureProgressForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		rebuilt, err := rebuildProgress(tx, userID)
+		if err != nil {
+			return err
+		}
+		rebuilt.ID = progress.ID
+		rebuilt.CreatedAt = progress.CreatedAt
+
+		report = &RecomputeReport{UserID: userID, Changes: diffProgress(progress, rebuilt), Unlocked: []UnlockedAchievement{}}
+		if err := tx.Save(rebuilt).Error; err != nil {
+			return err
+		}
+		// 档案中的完成任务数会在下次事件时同步到进度（取较大值），一并修正以免旧值回写
+		if err := tx.Model(&models.UserProfile{}).Where("user_id = ?", userID).
+			UpdateColumn("tasks_completed", rebuilt.TaskCompletedCount).Error; err != nil {
+			return err
+		}
+
+		unlocked, err = evaluateAchievements(tx, rebuilt)
+		if err != nil {
+			return err
+		}
+		for _, ach := range unlocked {
+			report.Unlocked = append(report.Unlocked, UnlockedAchievement{ID: ach.ID, Code: ach.Code, Name: ach.Name})
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	if !opts.DryRun {
+		publishUnlocked(userID, unlocked)
+	}
+	return report, nil
+}
+
+// RecomputeAll 逐个重算所有有效用户，单个用户失败不影响其他用户
+func RecomputeAll(db *gorm.DB, opts RecomputeOptions) (*RecomputeSummary, error) {
+	summary := &RecomputeSummary{DryRun: opts.DryRun, Reports: []RecomputeReport{}}
+	var lastID uint64
+	for {
+		var ids []uint64
+		if err := db.Model(&models.User{}).
+			Where("status = ? AND id > ?", 1, lastID).
+			Order("id ASC").
+			Limit(recomputeBatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return summary, err
+		}
+		if len(ids) == 0 {
+			return summary, nil
+		}
+		for _, id := range ids {
+			summary.Users++
+			report, err := Recompute(db, id, opts)
+			if err != nil {
+				if summary.Failed == nil {
+					summary.Failed = make(map[uint64]string)
+				}
+				summary.Failed[id] = err.Error()
+				continue
+			}
+			if len(report.Changes) == 0 && len(report.Unlocked) == 0 {
+				continue
+			}
+			if len(report.Changes) > 0 {
+				summary.ChangedUsers++
+			}
+			summary.UnlockedTotal += len(report.Unlocked)
+			summary.Reports = append(summary.Reports, *report)
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// rebuildProgress 从源数据计算进度计数
+func rebuildProgress(tx *gorm.DB, userID uint64) (*models.UserAchievementProgress, error) {
+	progress := &models.UserAchievementProgress{UserID: userID}
+	count := func(query *gorm.DB) (int, error) {
+		var n int64
+		err := query.Count(&n).Error
+		return int(n), err
+	}
+	var err error
+
+	if progress.TaskCreatedCount, err = count(tx.Model(&models.Task{}).Where("created_by = ?", userID)); err != nil {
+		return nil, err
+	}
+	// 完成积分归属负责人，无负责人时归属创建者，与完成计数的口径保持一致
+	completed := func() *gorm.DB {
+		return tx.Model(&models.Task{}).
+			Where("status = ? AND (owner_user_id = ? OR (owner_user_id IS NULL AND created_by = ?))", 2, userID, userID)
+	}
+	if progress.TaskCompletedCount, err = count(completed()); err != nil {
+		return nil, err
+	}
+	if progress.TeamTasksCompleted, err = count(completed().Where("task_type = ?", 2)); err != nil {
+		return nil, err
+	}
+
+	if progress.StreakDays, err = longestStreak(tx, userID); err != nil {
+		return nil, err
+	}
+
+	var totals struct {
+		StudyRoomMinutes      int
+		StudyRoomNightMinutes int
+		NightMinutes          int
+		MorningMinutes        int
+		FocusModeMinutes      int
+	}
+	if err := tx.Model(&models.DailyStudyStat{}).
+		Select("COALESCE(SUM(study_room_minutes),0) AS study_room_minutes, COALESCE(SUM(study_room_night_minutes),0) AS study_room_night_minutes, COALESCE(SUM(night_minutes),0) AS night_minutes, COALESCE(SUM(morning_minutes),0) AS morning_minutes, COALESCE(SUM(focus_mode_minutes),0) AS focus_mode_minutes").
+		Where("user_id = ?", userID).
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	progress.StudyRoomDurationMins = totals.StudyRoomMinutes
+	progress.StudyRoomNightMins = totals.StudyRoomNightMinutes
+	progress.NightStudyMins = totals.NightMinutes
+	progress.MorningStudyMins = totals.MorningMinutes
+	progress.FocusModeMins = totals.FocusModeMinutes
+
+	var sessions []models.StudySession
+	if err := tx.Select("id", "start_time", "end_time", "duration_minutes").
+		Where("user_id = ? AND source = ? AND end_time IS NOT NULL", userID, "study_room").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	progress.StudyRoomJoinCount = len(sessions)
+	loc := usertime.ForUser(userID)
+	for _, session := range sessions {
+		night := sessionNightMinutes(session.StartTime, *session.EndTime, loc)
+		if night > session.DurationMinutes {
+			night = session.DurationMinutes
+		}
+		if night > progress.NightSessionMaxMins {
+			progress.NightSessionMaxMins = night
+		}
+	}
+
+	if progress.StudyRoomChatCount, err = count(tx.Model(&models.ChatMessage{}).Where("user_id = ? AND msg_type <> ?", userID, 3)); err != nil {
+		return nil, err
+	}
+	// 表情回应只在用户首次回应他人的某条消息时计数
+	if progress.StudyRoomLikesGiven, err = count(tx.Model(&models.ChatMessageReaction{}).
+		Joins("JOIN chat_messages ON chat_messages.id = chat_message_reactions.message_id").
+		Where("chat_message_reactions.user_id = ? AND chat_messages.user_id <> ?", userID, userID).
+		Distinct("chat_message_reactions.message_id")); err != nil {
+		return nil, err
+	}
+	var received []struct {
+		MessageID uint64
+		UserID    uint64
+	}
+	if err := tx.Model(&models.ChatMessageReaction{}).
+		Joins("JOIN chat_messages ON chat_messages.id = chat_message_reactions.message_id").
+		Where("chat_messages.user_id = ? AND chat_message_reactions.user_id <> ?", userID, userID).
+		Distinct("chat_message_reactions.message_id", "chat_message_reactions.user_id").
+		Scan(&received).Error; err != nil {
+		return nil, err
+	}
+	progress.StudyRoomLikesReceived = len(received)
+	return progress, nil
+}
+
+// longestStreak 历史最长连续活跃天数（按连续活跃服务的口径），与档案中记录的最长值取较大值
+func longestStreak(tx *gorm.DB, userID uint64) (int, error) {
+	summary, err := streak.Compute(tx, userID, usertime.ForUser(userID), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var recorded int
+	if err := tx.Model(&models.UserProfile{}).Where("user_id = ?", userID).
+		Select("COALESCE(MAX(longest_streak_days), 0)").Scan(&recorded).Error; err != nil {
+		return 0, err
+	}
+	if recorded > summary.Longest {
+		return recorded, nil
+	}
+	return summary.Longest, nil
+}
+
+// sessionNightMinutes 会话落在夜间（22:00-次日 02:00，用户时区）的分钟数
+func sessionNightMinutes(start, end time.Time, loc *time.Location) int {
+	total := 0
+	for day := usertime.StartOfDay(start, loc); day.Before(end); day = usertime.AddDays(day, 1) {
+		total += overlapMinutes(start, end, day, usertime.At(day, 2))
+		total += overlapMinutes(start, end, usertime.At(day, 22), usertime.AddDays(day, 1))
+	}
+	return total
+}
+
+func overlapMinutes(start, end, windowStart, windowEnd time.Time) int {
+	if start.Before(windowStart) {
+		start = windowStart
+	}
+	if end.After(windowEnd) {
+		end = windowEnd
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return int(end.Sub(start).Minutes())
+}
+
+func diffProgress(before, after *models.UserAchievementProgress) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	fields := []struct {
+		name          string
+		before, after int
+	}{
+		{"task_created_count", before.TaskCreatedCount, after.TaskCreatedCount},
+		{"task_completed_count", before.TaskCompletedCount, after.TaskCompletedCount},
+		{"streak_days", before.StreakDays, after.StreakDays},
+		{"study_room_join_count", before.StudyRoomJoinCount, after.StudyRoomJoinCount},
+		{"study_room_duration_mins", before.StudyRoomDurationMins, after.StudyRoomDurationMins},
+		{"study_room_night_mins", before.StudyRoomNightMins, after.StudyRoomNightMins},
+		{"night_session_max_mins", before.NightSessionMaxMins, after.NightSessionMaxMins},
+		{"study_room_chat_count", before.StudyRoomChatCount, after.StudyRoomChatCount},
+		{"study_room_likes_given", before.StudyRoomLikesGiven, after.StudyRoomLikesGiven},
+		{"study_room_likes_received", before.StudyRoomLikesReceived, after.StudyRoomLikesReceived},
+		{"team_tasks_completed", before.TeamTasksCompleted, after.TeamTasksCompleted},
+		{"night_study_mins", before.NightStudyMins, after.NightStudyMins},
+		{"morning_study_mins", before.MorningStudyMins, after.MorningStudyMins},
+		{"focus_mode_mins", before.FocusModeMins, after.FocusModeMins},
+	}
+	for _, f := range fields {
+		if f.before != f.after {
+			changes[f.name] = FieldChange{Before: f.before, After: f.after}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,60 @@
+package achievement
+
+import (
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestRecomputeRebuildsProgressAndUnlocks(t *testing.T) {
+	db := testdb.Open(t)
+	user := models.User{Account: "u", Email: "u@x", Phone: "1", DisplayName: "U", Status: 1, PasswordHash: "x"}
+	db.Create(&user)
+	db.Create(&models.UserSetting{UserID: user.ID, Timezone: "UTC", ShowStudyData: true})
+	db.Create(&models.UserAchievementProgress{UserID: user.ID, TaskCompletedCount: 9, StudyRoomChatCount: 1})
+	db.Create(&models.UserProfile{UserID: user.ID, TasksCompleted: 9})
+	db.Create(&models.Achievement{Code: "tasks_2", Name: "两个任务", Condition: `{"metric":"task_total_completed","value":2}`})
+	db.Create(&models.Achievement{Code: "night_1", Name: "夜猫子", Condition: `{"metric":"studyroom_night_session_hours","value":1}`})
+
+	owner := user.ID
+	db.Create(&models.Task{Title: "a", TaskType: 1, CreatedBy: user.ID, Status: 2})
+	db.Create(&models.Task{Title: "b", TaskType: 2, CreatedBy: 99, OwnerUserID: &owner, Status: 2})
+	db.Create(&models.Task{Title: "c", TaskType: 1, CreatedBy: user.ID, Status: 1})
+	start := time.Date(2026, 3, 1, 22, 30, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	db.Create(&models.StudySession{UserID: user.ID, Source: "study_room", StartTime: start, EndTime: &end, LastPingAt: end, DurationMinutes: 120})
+	for _, day := range []int{1, 2, 3, 5} {
+		entry := models.PointsLedger{UserID: user.ID, SourceType: models.PointsSourceDailyCheckIn, Delta: 2}
+		db.Create(&entry)
+		db.Model(&entry).UpdateColumn("created_at", time.Date(2026, 3, day, 9, 0, 0, 0, time.UTC))
+	}
+
+	report, err := Recompute(db, user.ID, RecomputeOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Changes["task_completed_count"] != (FieldChange{Before: 9, After: 2}) || len(report.Unlocked) != 2 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	var unlocked int64
+	db.Model(&models.UserAchievement{}).Count(&unlocked)
+	if unlocked != 0 {
+		t.Fatalf("dry run must not unlock achievements")
+	}
+
+	summary, err := RecomputeAll(db, RecomputeOptions{})
+	if err != nil || summary.Users != 1 || summary.UnlockedTotal != 2 {
+		t.Fatalf("unexpected summary %+v err=%v", summary, err)
+	}
+	var progress models.UserAchievementProgress
+	db.Where("user_id = ?", user.ID).First(&progress)
+	if progress.TaskCompletedCount != 2 || progress.TeamTasksCompleted != 1 || progress.TaskCreatedCount != 2 ||
+		progress.StreakDays != 3 || progress.StudyRoomJoinCount != 1 || progress.NightSessionMaxMins != 120 || progress.StudyRoomChatCount != 0 {
+		t.Fatalf("unexpected rebuilt progress %+v", progress)
+	}
+	if report, _ := Recompute(db, user.ID, RecomputeOptions{}); len(report.Changes) != 0 || len(report.Unlocked) != 0 {
+		t.Fatalf("rerun must be a no-op, got %+v", report)
+	}
+}
@@ -92,23 +92,27 @@ func BuildOverview(userID uint64) (*Overview, error) {
 	unlockedByType := make(map[string][]unlockedWrap)
 	upcomingByType := make(map[string]AchievementView)
 
+	ctx := newEvalContext(db, progress, time.Now())
 	for _, ach := range achievements {
-		cond, err := parseCondition(ach.Condition)
+		cond, _, err := ParseCondition([]byte(ach.Condition))
 		if err != nil {
 			continue
 		}
-		target := cond.Value
-		current := currentValueForCondition(cond.Type, progress)
+		result, err := cond.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		condType := cond.Key()
 		record := AchievementView{
 			ID:            ach.ID,
 			Code:          ach.Code,
 			Name:          ach.Name,
 			Description:   ach.Description,
 			Category:      ach.Category,
-			ConditionType: cond.Type,
+			ConditionType: condType,
 			Icon:          ach.Icon,
-			TargetValue:   target,
-			CurrentValue:  current,
+			TargetValue:   result.Target,
+			CurrentValue:  result.Current,
 			Completed:     false,
 			AwardedAt:     "",
 		}
@@ -116,15 +120,15 @@ func BuildOverview(userID uint64) (*Overview, error) {
 		if awardedAt, ok := unlockedMap[ach.ID]; ok {
 			record.Completed = true
 			record.AwardedAt = awardedAt.Format("2006-01-02")
-			unlockedByType[cond.Type] = append(unlockedByType[cond.Type], unlockedWrap{
+			unlockedByType[condType] = append(unlockedByType[condType], unlockedWrap{
 				view: record,
 				time: awardedAt,
 			})
 		} else {
 			// 同一类型只保留下一个目标值最低且尚未达成的成就
-			existing, exists := upcomingByType[cond.Type]
+			existing, exists := upcomingByType[condType]
 			if !exists || record.TargetValue < existing.TargetValue {
-				upcomingByType[cond.Type] = record
+				upcomingByType[condType] = record
 			}
 		}
 	}
@@ -184,30 +188,3 @@ func findUnlocked(db *gorm.DB, userID uint64) (map[uint]time.Time, error) {
 	}
 	return result, nil
 }
-
-func currentValueForCondition(condType string, progress *models.UserAchievementProgress) float64 {
-	switch condType {
-	case "task_total_completed":
-		return float64(progress.TaskCompletedCount)
-	case "task_total_created":
-		return float64(progress.TaskCreatedCount)
-	case "streak_task_completion":
-		return float64(progress.StreakDays)
-	case "studyroom_join_count":
-		return float64(progress.StudyRoomJoinCount)
-	case "studyroom_duration_hours":
-		return minutesToHours(progress.StudyRoomDurationMins)
-	case "studyroom_night_hours":
-		return minutesToHours(progress.StudyRoomNightMins)
-	case "studyroom_chat_count":
-		return float64(progress.StudyRoomChatCount)
-	case "studyroom_likes_given":
-		return float64(progress.StudyRoomLikesGiven)
-	case "studyroom_likes_received":
-		return float64(progress.StudyRoomLikesReceived)
-	case "team_task_completed":
-		return float64(progress.TeamTasksCompleted)
-	default:
-		return 0
-	}
-}
@@ -0,0 +1,75 @@
+package backplane
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Handler 接收房间频道消息；同一房间的消息按发布顺序串行回调，实现中不得再次发布。
+// Redis 实现为每个房间单独排队回调，处理较慢只会推迟本房间的消息
+type Handler func(payload []byte)
+
+// Backplane 自习室跨实例共享的消息总线与状态存储：
+// 房间广播、在线成员以及通话信令（等待接听 pending、通话中 busy）都经由它在多个实例间同步
+type Backplane interface {
+	// Publish 向房间频道广播消息
+	Publish(ctx context.Context, roomID uint64, payload []byte) error
+	// Subscribe 订阅房间频道，返回取消订阅函数
+	Subscribe(roomID uint64, handler Handler) (func(), error)
+
+	// SetMember 写入（或刷新）房间在线成员信息
+	SetMember(ctx context.Context, roomID, userID uint64, data []byte) error
+	// RemoveMember 移除房间在线成员
+	RemoveMember(ctx context.Context, roomID, userID uint64) error
+	// Members 返回房间全部在线成员
+	Members(ctx context.Context, roomID uint64) (map[uint64][]byte, error)
+	// Rooms 返回当前有在线成员的房间
+	Rooms(ctx context.Context) ([]uint64, error)
+	// AllMembers 一次读取所有有在线成员的房间及其成员，用于列表等需要全部房间在线情况的场景
+	AllMembers(ctx context.Context) (map[uint64]map[uint64][]byte, error)
+
+	// ClaimPending 仅当被叫没有待接听来电时登记 caller，返回是否登记成功
+	ClaimPending(ctx context.Context, roomID, targetID, callerID uint64) (bool, error)
+	// PendingCaller 返回被叫当前的待接听来电
+	PendingCaller(ctx context.Context, roomID, targetID uint64) (uint64, bool, error)
+	// ReleasePending 清除被叫的待接听来电，返回是否由本次调用清除
+	ReleasePending(ctx context.Context, roomID, targetID uint64) (bool, error)
+	// SetBusy 标记两人进入通话
+	SetBusy(ctx context.Context, roomID, userA, userB uint64) error
+	// BusyPartners 返回房间内通话中的成员及其对端
+	BusyPartners(ctx context.Context, roomID uint64) (map[uint64]uint64, error)
+	// ClearBusy 清除成员的通话状态
+	ClearBusy(ctx context.Context, roomID uint64, userIDs ...uint64) error
+
+	Close() error
+}
+
+const keyPrefix = "studyroom:"
+
+func roomChannel(roomID uint64) string {
+	return fmt.Sprintf("%s%d", keyPrefix, roomID)
+}
+
+func membersKey(roomID uint64) string {
+	return fmt.Sprintf("%s%d:members", keyPrefix, roomID)
+}
+
+func pendingKey(roomID uint64) string {
+	return fmt.Sprintf("%s%d:pending", keyPrefix, roomID)
+}
+
+func busyKey(roomID uint64) string {
+	return fmt.Sprintf("%s%d:busy", keyPrefix, roomID)
+}
+
+const roomsKey = keyPrefix + "rooms"
+
+func formatID(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+func parseID(val string) (uint64, bool) {
+	id, err := strconv.ParseUint(val, 10, 64)
+	return id, err == nil && id != 0
+}
@@ -0,0 +1,188 @@
+package backplane
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory 单实例使用的进程内实现
+type Memory struct {
+	mu      sync.Mutex
+	subs    map[uint64]map[int]Handler
+	nextSub int
+	// 每个房间一把发布锁，保证所有订阅者看到相同的消息顺序
+	publishMu map[uint64]*sync.Mutex
+	members   map[uint64]map[uint64][]byte
+	pending   map[uint64]map[uint64]uint64
+	busy      map[uint64]map[uint64]uint64
+}
+
+// NewMemory 创建进程内 Backplane
+func NewMemory() *Memory {
+	return &Memory{
+		subs:      make(map[uint64]map[int]Handler),
+		publishMu: make(map[uint64]*sync.Mutex),
+		members:   make(map[uint64]map[uint64][]byte),
+		pending:   make(map[uint64]map[uint64]uint64),
+		busy:      make(map[uint64]map[uint64]uint64),
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, roomID uint64, payload []byte) error {
+	m.mu.Lock()
+	lock, ok := m.publishMu[roomID]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.publishMu[roomID] = lock
+	}
+	m.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	m.mu.Lock()
+	handlers := make([]Handler, 0, len(m.subs[roomID]))
+	for _, h := range m.subs[roomID] {
+		handlers = append(handlers, h)
+	}
+	m.mu.Unlock()
+
+	msg := append([]byte(nil), payload...)
+	for _, h := range handlers {
+		h(msg)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(roomID uint64, handler Handler) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subs[roomID] == nil {
+		m.subs[roomID] = make(map[int]Handler)
+	}
+	id := m.nextSub
+	m.nextSub++
+	m.subs[roomID][id] = handler
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subs[roomID], id)
+	}, nil
+}
+
+func (m *Memory) SetMember(ctx context.Context, roomID, userID uint64, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.members[roomID] == nil {
+		m.members[roomID] = make(map[uint64][]byte)
+	}
+	m.members[roomID][userID] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Memory) RemoveMember(ctx context.Context, roomID, userID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.members[roomID], userID)
+	if len(m.members[roomID]) == 0 {
+		delete(m.members, roomID)
+	}
+	return nil
+}
+
+func (m *Memory) Members(ctx context.Context, roomID uint64) (map[uint64][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[uint64][]byte, len(m.members[roomID]))
+	for id, data := range m.members[roomID] {
+		out[id] = append([]byte(nil), data...)
+	}
+	return out, nil
+}
+
+func (m *Memory) AllMembers(ctx context.Context) (map[uint64]map[uint64][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[uint64]map[uint64][]byte, len(m.members))
+	for roomID, members := range m.members {
+		room := make(map[uint64][]byte, len(members))
+		for id, data := range members {
+			room[id] = append([]byte(nil), data...)
+		}
+		out[roomID] = room
+	}
+	return out, nil
+}
+
+func (m *Memory) Rooms(ctx context.Context) ([]uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rooms := make([]uint64, 0, len(m.members))
+	for id := range m.members {
+		rooms = append(rooms, id)
+	}
+	return rooms, nil
+}
+
+func (m *Memory) ClaimPending(ctx context.Context, roomID, targetID, callerID uint64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending[roomID] == nil {
+		m.pending[roomID] = make(map[uint64]uint64)
+	}
+	if _, exists := m.pending[roomID][targetID]; exists {
+		return false, nil
+	}
+	m.pending[roomID][targetID] = callerID
+	return true, nil
+}
+
+func (m *Memory) PendingCaller(ctx context.Context, roomID, targetID uint64) (uint64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	caller, ok := m.pending[roomID][targetID]
+	return caller, ok, nil
+}
+
+func (m *Memory) ReleasePending(ctx context.Context, roomID, targetID uint64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pending[roomID][targetID]; !ok {
+		return false, nil
+	}
+	delete(m.pending[roomID], targetID)
+	return true, nil
+}
+
+func (m *Memory) SetBusy(ctx context.Context, roomID, userA, userB uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.busy[roomID] == nil {
+		m.busy[roomID] = make(map[uint64]uint64)
+	}
+	m.busy[roomID][userA] = userB
+	m.busy[roomID][userB] = userA
+	return nil
+}
+
+func (m *Memory) BusyPartners(ctx context.Context, roomID uint64) (map[uint64]uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[uint64]uint64, len(m.busy[roomID]))
+	for id, partner := range m.busy[roomID] {
+		out[id] = partner
+	}
+	return out, nil
+}
+
+func (m *Memory) ClearBusy(ctx context.Context, roomID uint64, userIDs ...uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range userIDs {
+		delete(m.busy[roomID], id)
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
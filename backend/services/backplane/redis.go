@@ -0,0 +1,660 @@
+package backplane
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisTimeout = 5 * time.Second
+	subscribeRetryDelay = time.Second
+	// 单个房间积压的待分发消息上限，超出后丢弃新消息，避免处理卡住的房间无限占用内存
+	maxPendingPerRoom = 1024
+)
+
+// retryableCommands 重复执行不会改变结果的命令，连接异常后可以重连重试；
+// PUBLISH、HSETNX、HDEL 等重试可能重复投递或误判结果，只在出错时返回
+var retryableCommands = map[string]bool{
+	"PING":     true,
+	"HGET":     true,
+	"HGETALL":  true,
+	"HLEN":     true,
+	"SMEMBERS": true,
+	"HSET":     true,
+	"SADD":     true,
+	"SREM":     true,
+}
+
+var ErrClosed = errors.New("backplane_closed")
+
+// RedisOptions Redis 连接参数
+type RedisOptions struct {
+	Addr        string
+	Password    string
+	DB          int
+	DialTimeout time.Duration
+}
+
+// Redis 基于 Redis（或兼容 RESP 协议的服务）的实现，房间广播走 Pub/Sub，状态存于 Hash
+type Redis struct {
+	opts RedisOptions
+
+	cmdMu sync.Mutex
+	cmd   *respConn
+
+	subMu    sync.Mutex
+	sub      *respConn
+	handlers map[string]map[int]Handler
+	confirms map[string][]chan struct{}
+	queues   map[string]*roomQueue
+	nextSub  int
+	closed   bool
+}
+
+// NewRedis 创建 Redis Backplane，会立即建立命令连接以便尽早暴露配置错误
+func NewRedis(opts RedisOptions) (*Redis, error) {
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaultRedisTimeout
+	}
+	r := &Redis{
+		opts:     opts,
+		handlers: make(map[string]map[int]Handler),
+		confirms: make(map[string][]chan struct{}),
+		queues:   make(map[string]*roomQueue),
+	}
+	if _, err := r.do(context.Background(), "PING"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Redis) Publish(ctx context.Context, roomID uint64, payload []byte) error {
+	_, err := r.do(ctx, "PUBLISH", roomChannel(roomID), string(payload))
+	return err
+}
+
+func (r *Redis) Subscribe(roomID uint64, handler Handler) (func(), error) {
+	channel := roomChannel(roomID)
+
+	r.subMu.Lock()
+	if r.closed {
+		r.subMu.Unlock()
+		return nil, ErrClosed
+	}
+	if r.sub == nil {
+		conn, err := r.dial()
+		if err != nil {
+			r.subMu.Unlock()
+			return nil, err
+		}
+		r.sub = conn
+		go r.readSubscriptions(conn)
+	}
+	id := r.nextSub
+	r.nextSub++
+	var confirmed chan struct{}
+	if r.handlers[channel] == nil {
+		r.handlers[channel] = make(map[int]Handler)
+		confirmed = make(chan struct{})
+		r.confirms[channel] = append(r.confirms[channel], confirmed)
+		if err := r.sub.send("SUBSCRIBE", channel); err != nil {
+			delete(r.handlers, channel)
+			r.subMu.Unlock()
+			return nil, err
+		}
+	}
+	r.handlers[channel][id] = handler
+	r.subMu.Unlock()
+
+	// 等待服务端确认订阅，避免订阅返回后立即发布的消息丢失
+	if confirmed != nil {
+		select {
+		case <-confirmed:
+		case <-time.After(r.opts.DialTimeout):
+			return nil, fmt.Errorf("subscribe %s: timeout", channel)
+		}
+	}
+
+	return func() {
+		r.subMu.Lock()
+		defer r.subMu.Unlock()
+		delete(r.handlers[channel], id)
+		if len(r.handlers[channel]) == 0 {
+			delete(r.handlers, channel)
+			if r.sub != nil {
+				_ = r.sub.send("UNSUBSCRIBE", channel)
+			}
+		}
+	}, nil
+}
+
+// roomQueue 单个频道待分发的消息；同一频道同时只有一个 goroutine 在分发，保证回调顺序
+type roomQueue struct {
+	pending [][]byte
+	running bool
+}
+
+// readSubscriptions 在订阅连接上顺序读取消息并按频道排队分发，连接断开后重连并恢复订阅。
+// 回调不在读取 goroutine 上执行，某个房间处理缓慢不会拖住其他房间
+func (r *Redis) readSubscriptions(conn *respConn) {
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			conn.close()
+			if !r.reconnectSubscriptions(conn) {
+				return
+			}
+			r.subMu.Lock()
+			conn = r.sub
+			r.subMu.Unlock()
+			continue
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) < 3 {
+			continue
+		}
+		kind, _ := asString(items[0])
+		channel, _ := asString(items[1])
+		switch kind {
+		case "subscribe":
+			r.subMu.Lock()
+			waiters := r.confirms[channel]
+			delete(r.confirms, channel)
+			r.subMu.Unlock()
+			for _, ch := range waiters {
+				close(ch)
+			}
+		case "message":
+			payload, _ := items[2].([]byte)
+			r.subMu.Lock()
+			r.enqueueLocked(channel, payload)
+			r.subMu.Unlock()
+		}
+	}
+}
+
+// enqueueLocked 把消息放入频道队列，队列空闲时启动分发 goroutine；调用方需持有 subMu
+func (r *Redis) enqueueLocked(channel string, payload []byte) {
+	if len(r.handlers[channel]) == 0 {
+		return
+	}
+	q := r.queues[channel]
+	if q == nil {
+		q = &roomQueue{}
+		r.queues[channel] = q
+	}
+	if len(q.pending) >= maxPendingPerRoom {
+		log.Printf("[Backplane] channel %s backlog full, dropping message", channel)
+		return
+	}
+	q.pending = append(q.pending, payload)
+	if !q.running {
+		q.running = true
+		go r.dispatch(channel, q)
+	}
+}
+
+// dispatch 依次回调频道队列中的消息，队列清空后退出
+func (r *Redis) dispatch(channel string, q *roomQueue) {
+	for {
+		r.subMu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			if r.queues[channel] == q {
+				delete(r.queues, channel)
+			}
+			r.subMu.Unlock()
+			return
+		}
+		payload := q.pending[0]
+		q.pending = q.pending[1:]
+		handlers := make([]Handler, 0, len(r.handlers[channel]))
+		for _, h := range r.handlers[channel] {
+			handlers = append(handlers, h)
+		}
+		r.subMu.Unlock()
+
+		for _, h := range handlers {
+			h(payload)
+		}
+	}
+}
+
+func (r *Redis) reconnectSubscriptions(broken *respConn) bool {
+	for {
+		r.subMu.Lock()
+		if r.closed || r.sub != broken {
+			r.subMu.Unlock()
+			return false
+		}
+		r.subMu.Unlock()
+
+		conn, err := r.dial()
+		if err != nil {
+			log.Printf("[Backplane] redis subscriber reconnect failed: %v", err)
+			time.Sleep(subscribeRetryDelay)
+			continue
+		}
+
+		r.subMu.Lock()
+		if r.closed {
+			r.subMu.Unlock()
+			conn.close()
+			return false
+		}
+		r.sub = conn
+		for channel := range r.handlers {
+			if err := conn.send("SUBSCRIBE", channel); err != nil {
+				break
+			}
+		}
+		r.subMu.Unlock()
+		return true
+	}
+}
+
+func (r *Redis) SetMember(ctx context.Context, roomID, userID uint64, data []byte) error {
+	if _, err := r.do(ctx, "HSET", membersKey(roomID), formatID(userID), string(data)); err != nil {
+		return err
+	}
+	_, err := r.do(ctx, "SADD", roomsKey, formatID(roomID))
+	return err
+}
+
+func (r *Redis) RemoveMember(ctx context.Context, roomID, userID uint64) error {
+	if _, err := r.do(ctx, "HDEL", membersKey(roomID), formatID(userID)); err != nil {
+		return err
+	}
+	remaining, err := r.do(ctx, "HLEN", membersKey(roomID))
+	if err != nil {
+		return err
+	}
+	if n, _ := remaining.(int64); n == 0 {
+		_, err = r.do(ctx, "SREM", roomsKey, formatID(roomID))
+	}
+	return err
+}
+
+func (r *Redis) Members(ctx context.Context, roomID uint64) (map[uint64][]byte, error) {
+	fields, err := r.hgetall(ctx, membersKey(roomID))
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64][]byte, len(fields))
+	for field, val := range fields {
+		if id, ok := parseID(field); ok {
+			out[id] = val
+		}
+	}
+	return out, nil
+}
+
+// AllMembers 先列出房间，再以流水线一次往返读取各房间的成员
+func (r *Redis) AllMembers(ctx context.Context) (map[uint64]map[uint64][]byte, error) {
+	rooms, err := r.Rooms(ctx)
+	if err != nil || len(rooms) == 0 {
+		return map[uint64]map[uint64][]byte{}, err
+	}
+	cmds := make([][]string, 0, len(rooms))
+	for _, roomID := range rooms {
+		cmds = append(cmds, []string{"HGETALL", membersKey(roomID)})
+	}
+	replies, err := r.pipeline(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64]map[uint64][]byte, len(rooms))
+	for i, roomID := range rooms {
+		if e, ok := replies[i].(redisError); ok {
+			return nil, e
+		}
+		fields := hashFields(replies[i])
+		members := make(map[uint64][]byte, len(fields))
+		for field, val := range fields {
+			if id, ok := parseID(field); ok {
+				members[id] = val
+			}
+		}
+		if len(members) > 0 {
+			out[roomID] = members
+		}
+	}
+	return out, nil
+}
+
+func (r *Redis) Rooms(ctx context.Context) ([]uint64, error) {
+	reply, err := r.do(ctx, "SMEMBERS", roomsKey)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]interface{})
+	rooms := make([]uint64, 0, len(items))
+	for _, item := range items {
+		if s, ok := asString(item); ok {
+			if id, ok := parseID(s); ok {
+				rooms = append(rooms, id)
+			}
+		}
+	}
+	return rooms, nil
+}
+
+func (r *Redis) ClaimPending(ctx context.Context, roomID, targetID, callerID uint64) (bool, error) {
+	reply, err := r.do(ctx, "HSETNX", pendingKey(roomID), formatID(targetID), formatID(callerID))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+func (r *Redis) PendingCaller(ctx context.Context, roomID, targetID uint64) (uint64, bool, error) {
+	reply, err := r.do(ctx, "HGET", pendingKey(roomID), formatID(targetID))
+	if err != nil {
+		return 0, false, err
+	}
+	s, ok := asString(reply)
+	if !ok {
+		return 0, false, nil
+	}
+	caller, ok := parseID(s)
+	return caller, ok, nil
+}
+
+func (r *Redis) ReleasePending(ctx context.Context, roomID, targetID uint64) (bool, error) {
+	reply, err := r.do(ctx, "HDEL", pendingKey(roomID), formatID(targetID))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+func (r *Redis) SetBusy(ctx context.Context, roomID, userA, userB uint64) error {
+	_, err := r.do(ctx, "HSET", busyKey(roomID), formatID(userA), formatID(userB), formatID(userB), formatID(userA))
+	return err
+}
+
+func (r *Redis) BusyPartners(ctx context.Context, roomID uint64) (map[uint64]uint64, error) {
+	fields, err := r.hgetall(ctx, busyKey(roomID))
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64]uint64, len(fields))
+	for field, val := range fields {
+		id, okID := parseID(field)
+		partner, okPartner := parseID(string(val))
+		if okID && okPartner {
+			out[id] = partner
+		}
+	}
+	return out, nil
+}
+
+func (r *Redis) ClearBusy(ctx context.Context, roomID uint64, userIDs ...uint64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	args := []string{"HDEL", busyKey(roomID)}
+	for _, id := range userIDs {
+		args = append(args, formatID(id))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Close() error {
+	r.subMu.Lock()
+	r.closed = true
+	if r.sub != nil {
+		r.sub.close()
+		r.sub = nil
+	}
+	r.subMu.Unlock()
+
+	r.cmdMu.Lock()
+	defer r.cmdMu.Unlock()
+	if r.cmd != nil {
+		r.cmd.close()
+		r.cmd = nil
+	}
+	return nil
+}
+
+func (r *Redis) hgetall(ctx context.Context, key string) (map[string][]byte, error) {
+	reply, err := r.do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	return hashFields(reply), nil
+}
+
+// hashFields 把 HGETALL 的数组回复转换为字段映射
+func hashFields(reply interface{}) map[string][]byte {
+	items, _ := reply.([]interface{})
+	out := make(map[string][]byte, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		field, _ := asString(items[i])
+		val, _ := items[i+1].([]byte)
+		out[field] = val
+	}
+	return out
+}
+
+// do 在命令连接上执行一条命令，服务端返回的错误回复转换为 error
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := r.pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(redisError); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+// pipeline 在命令连接上串行发送一批命令后依次读取回复，错误回复以 redisError 留在对应位置。
+// 连接异常时重建连接；只有整批都是可重复执行的命令才重试一次
+func (r *Redis) pipeline(ctx context.Context, cmds [][]string) ([]interface{}, error) {
+	r.cmdMu.Lock()
+	defer r.cmdMu.Unlock()
+
+	attempts := 2
+	for _, args := range cmds {
+		if !retryableCommands[args[0]] {
+			attempts = 1
+		}
+	}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if r.cmd == nil {
+			conn, err := r.dial()
+			if err != nil {
+				return nil, err
+			}
+			r.cmd = conn
+		}
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(r.opts.DialTimeout)
+		}
+		_ = r.cmd.conn.SetDeadline(deadline)
+		replies, err := r.cmd.exchange(cmds)
+		if err == nil {
+			return replies, nil
+		}
+		r.cmd.close()
+		r.cmd = nil
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (r *Redis) dial() (*respConn, error) {
+	raw, err := net.DialTimeout("tcp", r.opts.Addr, r.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &respConn{conn: raw, r: bufio.NewReader(raw), w: bufio.NewWriter(raw)}
+	_ = raw.SetDeadline(time.Now().Add(r.opts.DialTimeout))
+	if r.opts.Password != "" {
+		if _, err := conn.roundTrip("AUTH", r.opts.Password); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	if r.opts.DB != 0 {
+		if _, err := conn.roundTrip("SELECT", strconv.Itoa(r.opts.DB)); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	_ = raw.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// respConn 最小化的 RESP2 协议连接
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	wmu  sync.Mutex
+}
+
+func (c *respConn) roundTrip(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(redisError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// exchange 一次写出全部命令再按顺序读取回复
+func (c *respConn) exchange(cmds [][]string) ([]interface{}, error) {
+	c.wmu.Lock()
+	for _, args := range cmds {
+		c.write(args)
+	}
+	err := c.w.Flush()
+	c.wmu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		if replies[i], err = c.read(); err != nil {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+func (c *respConn) send(args ...string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.write(args)
+	return c.w.Flush()
+}
+
+func (c *respConn) write(args []string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// read 读取一个回复：简单字符串返回 string，整数返回 int64，批量字符串返回 []byte（空值为 nil），数组返回 []interface{}
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (c *respConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *respConn) close() {
+	_ = c.conn.Close()
+}
+
+func asString(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case []byte:
+		return string(val), true
+	}
+	return "", false
+}
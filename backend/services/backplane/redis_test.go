@@ -0,0 +1,442 @@
+package backplane
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 仅实现 Backplane 用到的命令，用于在测试中替代真实 Redis
+type fakeRedis struct {
+	ln     net.Listener
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	sets   map[string]map[string]struct{}
+	subs   map[string]map[*fakeConn]struct{}
+	// dropReply 中的命令下一次执行后不回复并断开连接，模拟命令已生效但回复丢失
+	dropReply map[string]bool
+}
+
+type fakeConn struct {
+	conn net.Conn
+	w    *bufio.Writer
+	mu   sync.Mutex
+}
+
+func (c *fakeConn) write(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.w, format, args...)
+	_ = c.w.Flush()
+}
+
+func (c *fakeConn) writeBulk(val string) {
+	c.write("$%d\r\n%s\r\n", len(val), val)
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &fakeRedis{
+		ln:     ln,
+		hashes: make(map[string]map[string]string),
+		sets:   make(map[string]map[string]struct{}),
+		subs:   make(map[string]map[*fakeConn]struct{}),
+
+		dropReply: make(map[string]bool),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return srv
+}
+
+func (s *fakeRedis) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeRedis) serve(raw net.Conn) {
+	defer raw.Close()
+	reader := bufio.NewReader(raw)
+	conn := &fakeConn{conn: raw, w: bufio.NewWriter(raw)}
+	defer s.dropSubscriber(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		drop := s.dropReply[args[0]]
+		delete(s.dropReply, args[0])
+		s.mu.Unlock()
+		if drop {
+			s.exec(&fakeConn{w: bufio.NewWriter(io.Discard)}, args)
+			return
+		}
+		s.exec(conn, args)
+	}
+}
+
+func (s *fakeRedis) dropNextReply(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropReply[command] = true
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(header[1 : len(header)-2])
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) exec(c *fakeConn, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch args[0] {
+	case "PING":
+		c.write("+PONG\r\n")
+	case "AUTH", "SELECT":
+		c.write("+OK\r\n")
+	case "SUBSCRIBE":
+		for _, ch := range args[1:] {
+			if s.subs[ch] == nil {
+				s.subs[ch] = make(map[*fakeConn]struct{})
+			}
+			s.subs[ch][c] = struct{}{}
+			c.write("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(ch), ch)
+		}
+	case "UNSUBSCRIBE":
+		for _, ch := range args[1:] {
+			delete(s.subs[ch], c)
+			c.write("*3\r\n$11\r\nunsubscribe\r\n$%d\r\n%s\r\n:0\r\n", len(ch), ch)
+		}
+	case "PUBLISH":
+		ch, payload := args[1], args[2]
+		for sub := range s.subs[ch] {
+			sub.write("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(ch), ch, len(payload), payload)
+		}
+		c.write(":%d\r\n", len(s.subs[ch]))
+	case "HSET":
+		h := s.hash(args[1])
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		c.write(":%d\r\n", added)
+	case "HSETNX":
+		h := s.hash(args[1])
+		if _, ok := h[args[2]]; ok {
+			c.write(":0\r\n")
+			return
+		}
+		h[args[2]] = args[3]
+		c.write(":1\r\n")
+	case "HGET":
+		val, ok := s.hash(args[1])[args[2]]
+		if !ok {
+			c.write("$-1\r\n")
+			return
+		}
+		c.writeBulk(val)
+	case "HDEL":
+		h := s.hash(args[1])
+		removed := 0
+		for _, f := range args[2:] {
+			if _, ok := h[f]; ok {
+				delete(h, f)
+				removed++
+			}
+		}
+		c.write(":%d\r\n", removed)
+	case "HLEN":
+		c.write(":%d\r\n", len(s.hash(args[1])))
+	case "HGETALL":
+		h := s.hash(args[1])
+		c.write("*%d\r\n", len(h)*2)
+		for k, v := range h {
+			c.writeBulk(k)
+			c.writeBulk(v)
+		}
+	case "SADD", "SREM", "SMEMBERS":
+		set := s.sets[args[1]]
+		if set == nil {
+			set = make(map[string]struct{})
+			s.sets[args[1]] = set
+		}
+		switch args[0] {
+		case "SADD":
+			for _, m := range args[2:] {
+				set[m] = struct{}{}
+			}
+			c.write(":1\r\n")
+		case "SREM":
+			for _, m := range args[2:] {
+				delete(set, m)
+			}
+			c.write(":1\r\n")
+		default:
+			c.write("*%d\r\n", len(set))
+			for m := range set {
+				c.writeBulk(m)
+			}
+		}
+	default:
+		c.write("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func (s *fakeRedis) hash(key string) map[string]string {
+	h := s.hashes[key]
+	if h == nil {
+		h = make(map[string]string)
+		s.hashes[key] = h
+	}
+	return h
+}
+
+func (s *fakeRedis) dropSubscriber(c *fakeConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, subs := range s.subs {
+		delete(subs, c)
+	}
+}
+
+// 两个 Redis Backplane 连接同一服务，模拟两个服务实例
+func newRedisPair(t *testing.T) (*Redis, *Redis) {
+	t.Helper()
+	srv := startFakeRedis(t)
+	a, err := NewRedis(RedisOptions{Addr: srv.addr(), Password: "secret", DB: 2})
+	if err != nil {
+		t.Fatalf("connect a: %v", err)
+	}
+	b, err := NewRedis(RedisOptions{Addr: srv.addr()})
+	if err != nil {
+		t.Fatalf("connect b: %v", err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestRedisPublishReachesOtherInstanceInOrder(t *testing.T) {
+	a, b := newRedisPair(t)
+	const total = 200
+
+	var mu sync.Mutex
+	received := make([]string, 0, total)
+	done := make(chan struct{})
+	if _, err := b.Subscribe(7, func(payload []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(payload))
+		if len(received) == total {
+			close(done)
+		}
+	}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	// 其他房间的消息不应被投递
+	_ = a.Publish(context.Background(), 8, []byte("other-room"))
+	for i := 0; i < total; i++ {
+		if err := a.Publish(context.Background(), 7, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out, received %d messages", len(received))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, msg := range received {
+		if msg != strconv.Itoa(i) {
+			t.Fatalf("message %d out of order: %s", i, msg)
+		}
+	}
+}
+
+func TestRedisSlowRoomDoesNotBlockOtherRooms(t *testing.T) {
+	a, b := newRedisPair(t)
+	release := make(chan struct{})
+	defer close(release)
+	slow := make(chan string, 4)
+	if _, err := b.Subscribe(1, func(payload []byte) {
+		slow <- string(payload)
+		<-release
+	}); err != nil {
+		t.Fatalf("subscribe slow room: %v", err)
+	}
+	fast := make(chan string, 4)
+	if _, err := b.Subscribe(2, func(payload []byte) { fast <- string(payload) }); err != nil {
+		t.Fatalf("subscribe fast room: %v", err)
+	}
+
+	ctx := context.Background()
+	_ = a.Publish(ctx, 1, []byte("stuck"))
+	_ = a.Publish(ctx, 1, []byte("queued"))
+	_ = a.Publish(ctx, 2, []byte("hello"))
+	for _, ch := range []chan string{slow, fast} {
+		select {
+		case <-ch:
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected other rooms to be delivered while one handler is blocked")
+		}
+	}
+	select {
+	case msg := <-slow:
+		t.Fatalf("expected the blocked room to stay serialized, got %s", msg)
+	default:
+	}
+}
+
+func TestRedisRetriesOnlyIdempotentCommands(t *testing.T) {
+	srv := startFakeRedis(t)
+	a, err := NewRedis(RedisOptions{Addr: srv.addr()})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer a.Close()
+	b, _ := NewRedis(RedisOptions{Addr: srv.addr()})
+	defer b.Close()
+
+	var mu sync.Mutex
+	received := 0
+	if _, err := b.Subscribe(5, func([]byte) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	ctx := context.Background()
+	srv.dropNextReply("PUBLISH")
+	if err := a.Publish(ctx, 5, []byte("once")); err == nil {
+		t.Fatal("expected publish to report the lost reply instead of retrying")
+	}
+	srv.dropNextReply("HGET")
+	_, _ = a.ClaimPending(ctx, 5, 1, 2)
+	if caller, ok, err := a.PendingCaller(ctx, 5, 1); err != nil || !ok || caller != 2 {
+		t.Fatalf("expected read to be retried after the lost reply, got %d %v %v", caller, ok, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 1 {
+		t.Fatalf("expected the message to be published exactly once, got %d", received)
+	}
+}
+
+func TestRedisPresenceAndCallStateSharedAcrossInstances(t *testing.T) {
+	a, b := newRedisPair(t)
+	ctx := context.Background()
+
+	if err := a.SetMember(ctx, 1, 10, []byte(`{"user_id":10}`)); err != nil {
+		t.Fatalf("set member: %v", err)
+	}
+	_ = b.SetMember(ctx, 1, 11, []byte(`{"user_id":11}`))
+	members, err := b.Members(ctx, 1)
+	if err != nil || len(members) != 2 || string(members[10]) != `{"user_id":10}` {
+		t.Fatalf("expected both members visible, got %v err=%v", members, err)
+	}
+	rooms, _ := a.Rooms(ctx)
+	if len(rooms) != 1 || rooms[0] != 1 {
+		t.Fatalf("expected room 1 listed, got %v", rooms)
+	}
+	_ = a.SetMember(ctx, 2, 12, []byte(`{"user_id":12}`))
+	all, err := b.AllMembers(ctx)
+	if err != nil || len(all) != 2 || len(all[1]) != 2 || string(all[2][12]) != `{"user_id":12}` {
+		t.Fatalf("expected members of every room in one read, got %v err=%v", all, err)
+	}
+	_ = a.RemoveMember(ctx, 2, 12)
+
+	ok, _ := a.ClaimPending(ctx, 1, 11, 10)
+	if !ok {
+		t.Fatalf("expected first caller to claim")
+	}
+	if ok, _ := b.ClaimPending(ctx, 1, 11, 12); ok {
+		t.Fatalf("second caller must not override pending call")
+	}
+	if caller, ok, _ := b.PendingCaller(ctx, 1, 11); !ok || caller != 10 {
+		t.Fatalf("expected pending caller 10, got %d %v", caller, ok)
+	}
+	if released, _ := b.ReleasePending(ctx, 1, 11); !released {
+		t.Fatalf("expected release to succeed")
+	}
+	if released, _ := a.ReleasePending(ctx, 1, 11); released {
+		t.Fatalf("pending call must only be released once")
+	}
+
+	_ = b.SetBusy(ctx, 1, 10, 11)
+	busy, _ := a.BusyPartners(ctx, 1)
+	if busy[10] != 11 || busy[11] != 10 {
+		t.Fatalf("unexpected busy map %v", busy)
+	}
+	_ = a.ClearBusy(ctx, 1, 10, 11)
+	if busy, _ := b.BusyPartners(ctx, 1); len(busy) != 0 {
+		t.Fatalf("expected busy cleared, got %v", busy)
+	}
+
+	_ = a.RemoveMember(ctx, 1, 10)
+	_ = b.RemoveMember(ctx, 1, 11)
+	if rooms, _ := b.Rooms(ctx); len(rooms) != 0 {
+		t.Fatalf("expected empty room to be dropped, got %v", rooms)
+	}
+}
+
+func TestMemoryPublishDeliversToAllSubscribers(t *testing.T) {
+	m := NewMemory()
+	var got []string
+	cancel, _ := m.Subscribe(3, func(p []byte) { got = append(got, "a:"+string(p)) })
+	_, _ = m.Subscribe(3, func(p []byte) { got = append(got, "b:"+string(p)) })
+	_ = m.Publish(context.Background(), 3, []byte("x"))
+	cancel()
+	_ = m.Publish(context.Background(), 3, []byte("y"))
+	if len(got) != 3 || got[2] != "b:y" {
+		t.Fatalf("unexpected deliveries %v", got)
+	}
+}
@@ -0,0 +1,390 @@
+package challenges
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+	"learningAssistant-backend/services/usertime"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// MaxRewardPoints 单个挑战每位成员可获得的积分上限
+	MaxRewardPoints = 10000
+	// MaxWindowDays 挑战时间窗口的最大天数
+	MaxWindowDays = 366
+	// settleGrace 窗口结束后等待学习时长聚合追平的时间，之后仍未达标才判定为过期
+	settleGrace = time.Hour
+)
+
+var (
+	ErrInvalidChallenge   = errors.New("invalid_team_challenge")
+	ErrChallengeNotFound  = errors.New("team_challenge_not_found")
+	ErrChallengeFinalized = errors.New("team_challenge_finalized")
+	ErrNotTeamMember      = errors.New("team_challenge_not_team_member")
+	ErrForbidden          = errors.New("team_challenge_forbidden")
+)
+
+// ChallengeInput 创建挑战的参数，日期格式为 YYYY-MM-DD
+type ChallengeInput struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Metric       string `json:"metric"`
+	Target       int    `json:"target"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+	RewardPoints int    `json:"reward_points"`
+}
+
+// Contribution 单个成员对挑战的贡献
+type Contribution struct {
+	UserID      uint64  `json:"user_id"`
+	DisplayName string  `json:"display_name"`
+	AvatarURL   string  `json:"avatar_url"`
+	Value       int     `json:"value"`
+	Share       float64 `json:"share"`
+}
+
+// Progress 挑战进度与成员贡献明细，贡献按数值降序
+type Progress struct {
+	Challenge     models.TeamChallenge `json:"challenge"`
+	Current       int                  `json:"current"`
+	Percent       float64              `json:"percent"`
+	Contributions []Contribution       `json:"contributions"`
+}
+
+// Settlement 一次结算的结果，Awards 为完成时发放的积分
+type Settlement struct {
+	Challenge models.TeamChallenge
+	MemberIDs []uint64
+	Awards    []*points.AwardResult
+}
+
+// Create 团队负责人发布挑战
+func Create(db *gorm.DB, userID, teamID uint64, in ChallengeInput, now time.Time) (*models.TeamChallenge, error) {
+	if err := requireOwner(db, teamID, userID); err != nil {
+		return nil, err
+	}
+	title := strings.TrimSpace(in.Title)
+	if title == "" || len([]rune(title)) > 64 || len([]rune(in.Description)) > 512 {
+		return nil, fmt.Errorf("%w: 标题不能为空且不超过 64 字", ErrInvalidChallenge)
+	}
+	if in.Metric != models.TeamChallengeMetricStudyMinutes && in.Metric != models.TeamChallengeMetricTasksCompleted {
+		return nil, fmt.Errorf("%w: 不支持的指标 %q", ErrInvalidChallenge, in.Metric)
+	}
+	if in.Target <= 0 {
+		return nil, fmt.Errorf("%w: 目标值必须大于 0", ErrInvalidChallenge)
+	}
+	if in.RewardPoints < 0 || in.RewardPoints > MaxRewardPoints {
+		return nil, fmt.Errorf("%w: 奖励积分需在 0-%d 之间", ErrInvalidChallenge, MaxRewardPoints)
+	}
+	// 日期按发布者时区解释
+	loc := usertime.ForUser(userID)
+	start, err := time.ParseInLocation(dateLayout, in.StartDate, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 开始日期格式应为 YYYY-MM-DD", ErrInvalidChallenge)
+	}
+	end, err := time.ParseInLocation(dateLayout, in.EndDate, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 结束日期格式应为 YYYY-MM-DD", ErrInvalidChallenge)
+	}
+	today := usertime.StartOfDay(now, loc)
+	if end.Before(start) || end.Before(today) {
+		return nil, fmt.Errorf("%w: 结束日期不能早于开始日期或今天", ErrInvalidChallenge)
+	}
+	if usertime.DaysBetween(start, end) > MaxWindowDays {
+		return nil, fmt.Errorf("%w: 时间窗口不能超过 %d 天", ErrInvalidChallenge, MaxWindowDays)
+	}
+
+	challenge := models.TeamChallenge{
+		TeamID:       teamID,
+		Title:        title,
+		Description:  in.Description,
+		Metric:       in.Metric,
+		Target:       in.Target,
+		StartDate:    usertime.CalendarDate(start),
+		EndDate:      usertime.CalendarDate(end),
+		RewardPoints: in.RewardPoints,
+		Status:       models.TeamChallengeStatusActive,
+		CreatedBy:    userID,
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// List 团队成员查看团队的挑战，status 为空时返回全部
+func List(db *gorm.DB, userID, teamID uint64, status string) ([]models.TeamChallenge, error) {
+	if err := requireMember(db, teamID, userID); err != nil {
+		return nil, err
+	}
+	query := db.Where("team_id = ?", teamID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var list []models.TeamChallenge
+	if err := query.Order("id DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetProgress 团队成员查看挑战进度与各成员的贡献
+func GetProgress(db *gorm.DB, userID, teamID, challengeID uint64) (*Progress, error) {
+	if err := requireMember(db, teamID, userID); err != nil {
+		return nil, err
+	}
+	challenge, err := load(db, teamID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	return computeProgress(db, challenge)
+}
+
+// Cancel 团队负责人取消进行中的挑战
+func Cancel(db *gorm.DB, userID, teamID, challengeID uint64) (*models.TeamChallenge, error) {
+	if err := requireOwner(db, teamID, userID); err != nil {
+		return nil, err
+	}
+	challenge, err := load(db, teamID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := transition(db, challenge, models.TeamChallengeStatusCancelled, nil); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Settle 结算进行中的挑战：已达标的标记完成并向有贡献的成员发放积分，
+// 窗口结束且超过宽限期仍未达标的标记过期。返回本次状态发生变化的挑战
+func Settle(db *gorm.DB, now time.Time) ([]Settlement, error) {
+	// 各时区的当前日期最多比 UTC 晚一天，先按此粗筛，再按发布者时区判断是否已开始
+	latestToday := usertime.AddDays(usertime.StartOfDay(now, time.UTC), 1)
+	var active []models.TeamChallenge
+	if err := db.Where("status = ? AND start_date <= ?", models.TeamChallengeStatusActive, usertime.CalendarDate(latestToday)).
+		Order("id ASC").Find(&active).Error; err != nil {
+		return nil, err
+	}
+
+	var settled []Settlement
+	for i := range active {
+		challenge := &active[i]
+		windowStart, windowEnd := window(challenge)
+		if now.Before(windowStart) {
+			continue
+		}
+		progress, err := computeProgress(db, challenge)
+		if err != nil {
+			return settled, err
+		}
+		memberIDs := make([]uint64, 0, len(progress.Contributions))
+		for _, contribution := range progress.Contributions {
+			memberIDs = append(memberIDs, contribution.UserID)
+		}
+
+		if progress.Current >= challenge.Target {
+			awards, err := complete(db, challenge, progress, now)
+			if errors.Is(err, ErrChallengeFinalized) {
+				continue
+			}
+			if err != nil {
+				return settled, err
+			}
+			settled = append(settled, Settlement{Challenge: *challenge, MemberIDs: memberIDs, Awards: awards})
+			continue
+		}
+
+		if now.Before(windowEnd.Add(settleGrace)) {
+			continue
+		}
+		err = transition(db, challenge, models.TeamChallengeStatusExpired, nil)
+		if errors.Is(err, ErrChallengeFinalized) {
+			continue
+		}
+		if err != nil {
+			return settled, err
+		}
+		settled = append(settled, Settlement{Challenge: *challenge, MemberIDs: memberIDs})
+	}
+	return settled, nil
+}
+
+// complete 标记挑战完成并在同一事务内发放奖励，幂等键保证每位成员只获得一次
+func complete(db *gorm.DB, challenge *models.TeamChallenge, progress *Progress, now time.Time) ([]*points.AwardResult, error) {
+	var awards []*points.AwardResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := transition(tx, challenge, models.TeamChallengeStatusCompleted, &now); err != nil {
+			return err
+		}
+		if challenge.RewardPoints <= 0 {
+			return nil
+		}
+		for _, contribution := range progress.Contributions {
+			if contribution.Value <= 0 {
+				continue
+			}
+			res, err := points.AwardBonusWithTx(tx, contribution.UserID, models.PointsSourceTeamChallenge, &challenge.ID,
+				challenge.RewardPoints, fmt.Sprintf("完成团队挑战「%s」", challenge.Title),
+				fmt.Sprintf("team_challenge:%d:user:%d", challenge.ID, contribution.UserID))
+			if errors.Is(err, points.ErrAlreadyAwarded) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			awards = append(awards, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return awards, nil
+}
+
+// transition 以状态为条件将进行中的挑战置为终态，避免并发结算重复处理
+func transition(db *gorm.DB, challenge *models.TeamChallenge, status string, completedAt *time.Time) error {
+	res := db.Model(&models.TeamChallenge{}).
+		Where("id = ? AND status = ?", challenge.ID, models.TeamChallengeStatusActive).
+		Updates(map[string]interface{}{"status": status, "completed_at": completedAt})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrChallengeFinalized
+	}
+	challenge.Status = status
+	challenge.CompletedAt = completedAt
+	return nil
+}
+
+// window 挑战的起止时刻 [start, end)，日历日按发布者时区解释
+func window(challenge *models.TeamChallenge) (time.Time, time.Time) {
+	loc := usertime.ForUser(challenge.CreatedBy)
+	start := time.Date(challenge.StartDate.Year(), challenge.StartDate.Month(), challenge.StartDate.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(challenge.EndDate.Year(), challenge.EndDate.Month(), challenge.EndDate.Day(), 0, 0, 0, 0, loc)
+	return start, usertime.AddDays(end, 1)
+}
+
+type userValue struct {
+	UserID uint64
+	Value  int
+}
+
+// computeProgress 按团队当前成员统计窗口内的指标：学习时长取每日学习聚合（成员各自时区的日期），
+// 任务取发布者时区窗口内完成的任务，归属负责人，无负责人时归属创建者
+func computeProgress(db *gorm.DB, challenge *models.TeamChallenge) (*Progress, error) {
+	var members []struct {
+		UserID      uint64
+		DisplayName string
+		AvatarURL   string
+	}
+	if err := db.Table("team_members").
+		Select("team_members.user_id, users.display_name, users.avatar_url").
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id = ? AND team_members.deleted_at IS NULL", challenge.TeamID).
+		Order("team_members.user_id ASC").
+		Scan(&members).Error; err != nil {
+		return nil, err
+	}
+	memberIDs := make([]uint64, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+
+	var rows []userValue
+	if len(memberIDs) > 0 {
+		var err error
+		switch challenge.Metric {
+		case models.TeamChallengeMetricStudyMinutes:
+			err = db.Model(&models.DailyStudyStat{}).
+				Select("user_id, COALESCE(SUM(minutes), 0) AS value").
+				Where("user_id IN ? AND date >= ? AND date <= ?", memberIDs,
+					usertime.CalendarDate(challenge.StartDate), usertime.CalendarDate(challenge.EndDate)).
+				Group("user_id").Scan(&rows).Error
+		case models.TeamChallengeMetricTasksCompleted:
+			windowStart, windowEnd := window(challenge)
+			err = db.Model(&models.Task{}).
+				Select("COALESCE(owner_user_id, created_by) AS user_id, COUNT(*) AS value").
+				Where("status = ? AND completed_at >= ? AND completed_at < ?", 2, windowStart, windowEnd).
+				Where("COALESCE(owner_user_id, created_by) IN ?", memberIDs).
+				Group("COALESCE(owner_user_id, created_by)").Scan(&rows).Error
+		default:
+			err = fmt.Errorf("%w: 不支持的指标 %q", ErrInvalidChallenge, challenge.Metric)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	values := make(map[uint64]int, len(rows))
+	for _, row := range rows {
+		values[row.UserID] = row.Value
+	}
+
+	progress := &Progress{Challenge: *challenge, Contributions: make([]Contribution, 0, len(members))}
+	for _, member := range members {
+		progress.Current += values[member.UserID]
+	}
+	for _, member := range members {
+		contribution := Contribution{
+			UserID:      member.UserID,
+			DisplayName: member.DisplayName,
+			AvatarURL:   member.AvatarURL,
+			Value:       values[member.UserID],
+		}
+		if progress.Current > 0 {
+			contribution.Share = float64(contribution.Value) / float64(progress.Current)
+		}
+		progress.Contributions = append(progress.Contributions, contribution)
+	}
+	sort.SliceStable(progress.Contributions, func(i, j int) bool {
+		return progress.Contributions[i].Value > progress.Contributions[j].Value
+	})
+	progress.Percent = float64(progress.Current) * 100 / float64(challenge.Target)
+	if progress.Percent > 100 {
+		progress.Percent = 100
+	}
+	return progress, nil
+}
+
+func load(db *gorm.DB, teamID, challengeID uint64) (*models.TeamChallenge, error) {
+	var challenge models.TeamChallenge
+	if err := db.Where("id = ? AND team_id = ?", challengeID, teamID).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func requireOwner(db *gorm.DB, teamID, userID uint64) error {
+	var count int64
+	if err := db.Model(&models.Team{}).Where("id = ? AND owner_user_id = ?", teamID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func requireMember(db *gorm.DB, teamID, userID uint64) error {
+	var count int64
+	if err := db.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", teamID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotTeamMember
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package challenges
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestStudyMinutesChallengeCompletesAndRewardsContributors(t *testing.T) {
+	db := testdb.Open(t)
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		user := models.User{Account: fmt.Sprintf("u%d", i), Email: fmt.Sprintf("u%d@x", i), Phone: fmt.Sprint(i), DisplayName: "u", Status: 1, PasswordHash: "x"}
+		db.Create(&user)
+		ids = append(ids, user.ID)
+	}
+	owner, member, idle := ids[0], ids[1], ids[2]
+	team := models.Team{Name: "t", OwnerUserID: owner}
+	db.Create(&team)
+	for _, id := range ids {
+		db.Create(&models.TeamMember{TeamID: team.ID, UserID: id})
+	}
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+	in := ChallengeInput{Title: "本周学习 2 小时", Metric: models.TeamChallengeMetricStudyMinutes, Target: 120,
+		StartDate: "2026-03-02", EndDate: "2026-03-08", RewardPoints: 20}
+	if _, err := Create(db, member, team.ID, in, now); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("members must not create challenges, got %v", err)
+	}
+	challenge, err := Create(db, owner, team.ID, in, now)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.Local) }
+	db.Create(&models.DailyStudyStat{UserID: owner, Date: day(2), Minutes: 50})
+	db.Create(&models.DailyStudyStat{UserID: member, Date: day(3), Minutes: 30})
+	// 窗口外的学习时长不计入
+	db.Create(&models.DailyStudyStat{UserID: member, Date: day(1), Minutes: 300})
+
+	settled, err := Settle(db, now)
+	if err != nil || len(settled) != 0 {
+		t.Fatalf("expected nothing settled below target, got %v %v", settled, err)
+	}
+
+	db.Create(&models.DailyStudyStat{UserID: member, Date: day(4), Minutes: 40})
+	progress, err := GetProgress(db, idle, team.ID, challenge.ID)
+	if err != nil {
+		t.Fatalf("progress: %v", err)
+	}
+	if progress.Current != 120 || progress.Percent != 100 {
+		t.Fatalf("expected 120 minutes at 100%%, got %d %.1f", progress.Current, progress.Percent)
+	}
+	if len(progress.Contributions) != 3 || progress.Contributions[0].UserID != member || progress.Contributions[0].Value != 70 {
+		t.Fatalf("unexpected contributions %+v", progress.Contributions)
+	}
+
+	settled, err = Settle(db, now)
+	if err != nil || len(settled) != 1 || len(settled[0].Awards) != 2 {
+		t.Fatalf("expected completion with two awards, got %+v %v", settled, err)
+	}
+	var rewarded []uint64
+	db.Model(&models.PointsLedger{}).Where("source_type = ?", models.PointsSourceTeamChallenge).Order("user_id").Pluck("user_id", &rewarded)
+	if len(rewarded) != 2 || rewarded[0] != owner || rewarded[1] != member {
+		t.Fatalf("expected owner and member rewarded, got %v", rewarded)
+	}
+
+	if settled, _ := Settle(db, now); len(settled) != 0 {
+		t.Fatalf("completed challenges must not settle twice")
+	}
+	if _, err := Cancel(db, owner, team.ID, challenge.ID); !errors.Is(err, ErrChallengeFinalized) {
+		t.Fatalf("expected finalized, got %v", err)
+	}
+}
+
+func TestTaskChallengeExpiresAfterWindow(t *testing.T) {
+	db := testdb.Open(t)
+	user := models.User{Account: "u", Email: "u@x", Phone: "1", DisplayName: "u", Status: 1, PasswordHash: "x"}
+	db.Create(&user)
+	team := models.Team{Name: "t", OwnerUserID: user.ID}
+	db.Create(&team)
+	db.Create(&models.TeamMember{TeamID: team.ID, UserID: user.ID})
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.Local)
+	challenge, err := Create(db, user.ID, team.ID, ChallengeInput{Title: "完成 2 个任务", Metric: models.TeamChallengeMetricTasksCompleted,
+		Target: 2, StartDate: "2026-03-02", EndDate: "2026-03-04"}, now)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	completedAt := now.Add(-time.Hour)
+	db.Create(&models.Task{Title: "a", TaskType: 1, CreatedBy: user.ID, Status: 2, CompletedAt: &completedAt})
+
+	if settled, _ := Settle(db, now.Add(12*time.Hour)); len(settled) != 0 {
+		t.Fatalf("expected grace period before expiring")
+	}
+	settled, err := Settle(db, now.Add(14*time.Hour))
+	if err != nil || len(settled) != 1 || settled[0].Challenge.Status != models.TeamChallengeStatusExpired {
+		t.Fatalf("expected expiry, got %+v %v", settled, err)
+	}
+	progress, _ := GetProgress(db, user.ID, team.ID, challenge.ID)
+	if progress.Current != 1 {
+		t.Fatalf("expected 1 completed task, got %d", progress.Current)
+	}
+}
+
+func TestChallengeWindowFollowsCreatorTimezone(t *testing.T) {
+	db := testdb.Open(t)
+	user := models.User{Account: "u", Email: "u@x", Phone: "1", DisplayName: "u", Status: 1, PasswordHash: "x"}
+	db.Create(&user)
+	db.Create(&models.UserSetting{UserID: user.ID, Timezone: "Asia/Shanghai"})
+	team := models.Team{Name: "t", OwnerUserID: user.ID}
+	db.Create(&team)
+	db.Create(&models.TeamMember{TeamID: team.ID, UserID: user.ID})
+
+	// UTC 3 月 1 日 17:00 已是上海 3 月 2 日，窗口已开始
+	now := time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)
+	challenge, err := Create(db, user.ID, team.ID, ChallengeInput{Title: "完成 3 个任务", Metric: models.TeamChallengeMetricTasksCompleted,
+		Target: 3, StartDate: "2026-03-02", EndDate: "2026-03-04"}, now)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if challenge.StartDate.Format(dateLayout) != "2026-03-02" || challenge.EndDate.Format(dateLayout) != "2026-03-04" {
+		t.Fatalf("unexpected stored window %v - %v", challenge.StartDate, challenge.EndDate)
+	}
+	for _, completedAt := range []time.Time{
+		now.Add(time.Hour),                           // 上海 3 月 2 日凌晨，计入
+		time.Date(2026, 3, 4, 15, 0, 0, 0, time.UTC), // 上海 3 月 4 日 23:00，计入
+		time.Date(2026, 3, 4, 17, 0, 0, 0, time.UTC), // 上海 3 月 5 日，不计入
+	} {
+		at := completedAt
+		db.Create(&models.Task{Title: "t", TaskType: 1, CreatedBy: user.ID, Status: 2, CompletedAt: &at})
+	}
+	progress, err := GetProgress(db, user.ID, team.ID, challenge.ID)
+	if err != nil || progress.Current != 2 {
+		t.Fatalf("expected 2 tasks inside the Shanghai window, got %+v %v", progress, err)
+	}
+
+	// 上海 3 月 5 日 00:00 即 UTC 3 月 4 日 16:00 窗口结束，宽限期后过期
+	if settled, _ := Settle(db, time.Date(2026, 3, 4, 16, 30, 0, 0, time.UTC)); len(settled) != 0 {
+		t.Fatalf("expected grace period before expiring, got %+v", settled)
+	}
+	settled, err := Settle(db, time.Date(2026, 3, 4, 17, 30, 0, 0, time.UTC))
+	if err != nil || len(settled) != 1 || settled[0].Challenge.Status != models.TeamChallengeStatusExpired {
+		t.Fatalf("expected expiry after the Shanghai window, got %+v %v", settled, err)
+	}
+}
@@ -0,0 +1,199 @@
+package collabdoc
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+const (
+	MaxContentRunes = 50000
+
+	// 保留的操作日志条数，落后更多版本的客户端需要重新拉取快照
+	historyLimit = 500
+)
+
+var (
+	ErrContentTooLong = errors.New("collabdoc_content_too_long")
+	ErrVersionAhead   = errors.New("collabdoc_version_ahead")
+	ErrHistoryPruned  = errors.New("collabdoc_history_pruned")
+)
+
+// Snapshot 共享文档在某一版本的完整内容
+type Snapshot struct {
+	RoomID    uint64     `json:"room_id"`
+	Content   string     `json:"content"`
+	Version   int64      `json:"version"`
+	UpdatedBy uint64     `json:"updated_by"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// Change 一次已提交的编辑，Version 为应用后的版本号
+type Change struct {
+	Version int64  `json:"version"`
+	UserID  uint64 `json:"user_id"`
+	Op      Op     `json:"op"`
+}
+
+// Load 读取房间文档的最新快照，尚未编辑过时返回空文档
+func Load(roomID uint64) (*Snapshot, error) {
+	var doc models.StudyRoomDocument
+	err := database.GetDB().Where("room_id = ?", roomID).First(&doc).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Snapshot{RoomID: roomID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	updatedAt := doc.UpdatedAt
+	return &Snapshot{RoomID: roomID, Content: doc.Content, Version: doc.Version, UpdatedBy: doc.UpdatedBy, UpdatedAt: &updatedAt}, nil
+}
+
+// Submit 提交基于 baseVersion 的编辑：先与之后已提交的操作逐一变换，再应用到文档上。
+// 返回变换后的操作，其他客户端在各自的最新版本上应用即可
+func Submit(roomID, userID uint64, baseVersion int64, op Op, now time.Time) (*Change, error) {
+	if len(op) == 0 {
+		return nil, ErrInvalidOp
+	}
+	change := &Change{UserID: userID}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		doc := models.StudyRoomDocument{RoomID: roomID}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("room_id = ?", roomID).
+			FirstOrCreate(&doc).Error; err != nil {
+			return err
+		}
+		if baseVersion < 0 || baseVersion > doc.Version {
+			return ErrVersionAhead
+		}
+		if baseVersion < doc.Version {
+			var concurrent []models.StudyRoomDocumentOp
+			if err := tx.Where("room_id = ? AND version > ?", roomID, baseVersion).
+				Order("version ASC").
+				Find(&concurrent).Error; err != nil {
+				return err
+			}
+			if int64(len(concurrent)) != doc.Version-baseVersion {
+				return ErrHistoryPruned
+			}
+			for _, row := range concurrent {
+				var applied Op
+				if err := json.Unmarshal([]byte(row.Operation), &applied); err != nil {
+					return err
+				}
+				transformed, _, err := Transform(op, applied)
+				if err != nil {
+					return ErrInvalidOp
+				}
+				op = transformed
+			}
+		}
+
+		content, err := Apply(doc.Content, op)
+		if err != nil {
+			return ErrInvalidOp
+		}
+		if utf8.RuneCountInString(content) > MaxContentRunes {
+			return ErrContentTooLong
+		}
+		encoded, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		version := doc.Version + 1
+		if err := tx.Model(&doc).Updates(map[string]interface{}{
+			"content":    content,
+			"version":    version,
+			"updated_by": userID,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.StudyRoomDocumentOp{
+			RoomID:    roomID,
+			Version:   version,
+			UserID:    userID,
+			Operation: string(encoded),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.StudyRoomDocumentEditor{RoomID: roomID, UserID: userID}).Error; err != nil {
+			return err
+		}
+		change.Version = version
+		change.Op = op
+		return tx.Unscoped().
+			Where("room_id = ? AND version <= ?", roomID, version-historyLimit).
+			Delete(&models.StudyRoomDocumentOp{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ChangesSince 返回 version 之后的全部编辑，供断线重连的客户端补齐；日志已被裁剪时返回 ErrHistoryPruned
+func ChangesSince(roomID uint64, version int64) ([]Change, error) {
+	db := database.GetDB()
+	var rows []models.StudyRoomDocumentOp
+	if err := db.Where("room_id = ? AND version > ?", roomID, version).Order("version ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	changes := make([]Change, 0, len(rows))
+	for i, row := range rows {
+		if row.Version != version+int64(i)+1 {
+			return nil, ErrHistoryPruned
+		}
+		var op Op
+		if err := json.Unmarshal([]byte(row.Operation), &op); err != nil {
+			return nil, err
+		}
+		changes = append(changes, Change{Version: row.Version, UserID: row.UserID, Op: op})
+	}
+	if len(changes) == 0 {
+		var current int64
+		if err := db.Model(&models.StudyRoomDocument{}).Where("room_id = ?", roomID).Select("version").Scan(&current).Error; err != nil {
+			return nil, err
+		}
+		if current != version {
+			return nil, ErrHistoryPruned
+		}
+	}
+	return changes, nil
+}
+
+// Contributors 编辑过文档的用户，不受操作日志裁剪影响；
+// 同时合并仍保留的操作日志，兼容记录编辑者之前已有的文档
+func Contributors(roomID uint64) ([]uint64, error) {
+	db := database.GetDB()
+	var editors, logged []uint64
+	if err := db.Model(&models.StudyRoomDocumentEditor{}).
+		Where("room_id = ?", roomID).
+		Order("id ASC").
+		Pluck("user_id", &editors).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.StudyRoomDocumentOp{}).
+		Where("room_id = ?", roomID).
+		Distinct("user_id").
+		Pluck("user_id", &logged).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[uint64]bool, len(editors)+len(logged))
+	userIDs := make([]uint64, 0, len(editors)+len(logged))
+	for _, id := range append(editors, logged...) {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs, nil
+}
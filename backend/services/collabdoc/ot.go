@@ -0,0 +1,246 @@
+package collabdoc
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidOp      = errors.New("collabdoc_invalid_op")
+	ErrLengthMismatch = errors.New("collabdoc_length_mismatch")
+)
+
+// Component 操作的一段：保留、插入或删除，三者只取其一。长度均以 Unicode 码点计
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Op 纯文本的操作变换（OT）操作，JSON 格式与 ot.js 的 TextOperation 一致：
+// 正整数表示保留、字符串表示插入、负整数表示删除，例如 [3, "abc", -2]
+type Op []Component
+
+// Retain 追加保留段，与前一个保留段合并
+func (o Op) Retain(n int) Op {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+// Insert 追加插入段。插入总是排在相邻的删除之前，保证同一编辑只有一种表示
+func (o Op) Insert(s string) Op {
+	if s == "" {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && o[last].Insert != "" {
+		o[last].Insert += s
+		return o
+	}
+	if last >= 0 && o[last].Delete > 0 {
+		if last >= 1 && o[last-1].Insert != "" {
+			o[last-1].Insert += s
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Component{Insert: s}
+		return o
+	}
+	return append(o, Component{Insert: s})
+}
+
+// Delete 追加删除段，与前一个删除段合并
+func (o Op) Delete(n int) Op {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// BaseLen 操作要求的原文长度
+func (o Op) BaseLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLen 应用操作后的文本长度
+func (o Op) TargetLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + utf8.RuneCountInString(c.Insert)
+	}
+	return n
+}
+
+// IsNoop 操作不改变文本
+func (o Op) IsNoop() bool {
+	for _, c := range o {
+		if c.Insert != "" || c.Delete > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON 输出 ot.js 兼容的数组格式
+func (o Op) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, 0, len(o))
+	for _, c := range o {
+		switch {
+		case c.Insert != "":
+			out = append(out, c.Insert)
+		case c.Delete > 0:
+			out = append(out, -c.Delete)
+		default:
+			out = append(out, c.Retain)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON 解析 ot.js 兼容的数组格式，并合并相邻的同类段
+func (o *Op) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ErrInvalidOp
+	}
+	var op Op
+	for _, item := range raw {
+		switch v := item.(type) {
+		case string:
+			if v == "" {
+				return ErrInvalidOp
+			}
+			op = op.Insert(v)
+		case float64:
+			if v == 0 || v != math.Trunc(v) || math.Abs(v) > math.MaxInt32 {
+				return ErrInvalidOp
+			}
+			if v > 0 {
+				op = op.Retain(int(v))
+			} else {
+				op = op.Delete(int(-v))
+			}
+		default:
+			return ErrInvalidOp
+		}
+	}
+	*o = op
+	return nil
+}
+
+// Apply 将操作应用到文本上
+func Apply(doc string, op Op) (string, error) {
+	runes := []rune(doc)
+	if op.BaseLen() != len(runes) {
+		return "", ErrLengthMismatch
+	}
+	out := make([]rune, 0, op.TargetLen())
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		case c.Delete > 0:
+			pos += c.Delete
+		default:
+			out = append(out, runes[pos:pos+c.Retain]...)
+			pos += c.Retain
+		}
+	}
+	return string(out), nil
+}
+
+// Transform 对基于同一版本的两个并发操作 a、b 做变换，返回 a'、b'，
+// 满足 apply(apply(doc, a), b') == apply(apply(doc, b), a')。插入位置相同时 a 的插入在前
+func Transform(a, b Op) (Op, Op, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, ErrLengthMismatch
+	}
+	var aPrime, bPrime Op
+	ai, bi := 0, 0
+	var x, y Component
+	hasX, hasY := false, false
+	nextA := func() {
+		hasX = ai < len(a)
+		if hasX {
+			x = a[ai]
+			ai++
+		}
+	}
+	nextB := func() {
+		hasY = bi < len(b)
+		if hasY {
+			y = b[bi]
+			bi++
+		}
+	}
+	nextA()
+	nextB()
+	for hasX || hasY {
+		if hasX && x.Insert != "" {
+			aPrime = aPrime.Insert(x.Insert)
+			bPrime = bPrime.Retain(utf8.RuneCountInString(x.Insert))
+			nextA()
+			continue
+		}
+		if hasY && y.Insert != "" {
+			aPrime = aPrime.Retain(utf8.RuneCountInString(y.Insert))
+			bPrime = bPrime.Insert(y.Insert)
+			nextB()
+			continue
+		}
+		if !hasX || !hasY {
+			return nil, nil, ErrLengthMismatch
+		}
+
+		xLen, yLen := x.Retain+x.Delete, y.Retain+y.Delete
+		n := xLen
+		if yLen < n {
+			n = yLen
+		}
+		switch {
+		case x.Retain > 0 && y.Retain > 0:
+			aPrime = aPrime.Retain(n)
+			bPrime = bPrime.Retain(n)
+		case x.Delete > 0 && y.Retain > 0:
+			aPrime = aPrime.Delete(n)
+		case x.Retain > 0 && y.Delete > 0:
+			bPrime = bPrime.Delete(n)
+		}
+		// 双方都删除的部分已不存在，无需输出
+
+		if shrink(&x, n) {
+			nextA()
+		}
+		if shrink(&y, n) {
+			nextB()
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// shrink 消耗保留或删除段的前 n 个码点，返回该段是否已用完
+func shrink(c *Component, n int) bool {
+	if c.Retain > 0 {
+		c.Retain -= n
+		return c.Retain == 0
+	}
+	c.Delete -= n
+	return c.Delete == 0
+}
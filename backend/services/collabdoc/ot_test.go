@@ -0,0 +1,73 @@
+package collabdoc
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func randomOp(r *rand.Rand, doc string) Op {
+	runes := []rune(doc)
+	var op Op
+	for pos := 0; pos < len(runes); {
+		n := 1 + r.Intn(len(runes)-pos)
+		switch r.Intn(3) {
+		case 0:
+			op = op.Retain(n)
+		case 1:
+			op = op.Delete(n)
+		default:
+			op = op.Insert([]string{"a", "中文", "xy"}[r.Intn(3)]).Retain(n)
+		}
+		pos += n
+	}
+	if r.Intn(2) == 0 {
+		op = op.Insert("尾")
+	}
+	return op
+}
+
+func TestTransformConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	for i := 0; i < 500; i++ {
+		doc := []string{"", "hello", "学习小组 notes", "abcdefghij"}[r.Intn(4)]
+		a, b := randomOp(r, doc), randomOp(r, doc)
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("transform %v %v: %v", a, b, err)
+		}
+		afterA, _ := Apply(doc, a)
+		afterB, _ := Apply(doc, b)
+		left, err := Apply(afterA, bPrime)
+		if err != nil {
+			t.Fatalf("apply b' %v on %q: %v", bPrime, afterA, err)
+		}
+		right, err := Apply(afterB, aPrime)
+		if err != nil {
+			t.Fatalf("apply a' %v on %q: %v", aPrime, afterB, err)
+		}
+		if left != right {
+			t.Fatalf("diverged on %q with a=%v b=%v: %q vs %q", doc, a, b, left, right)
+		}
+	}
+}
+
+func TestOpJSONRoundTrip(t *testing.T) {
+	var op Op
+	if err := json.Unmarshal([]byte(`[2, -1, "ab", 1]`), &op); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// 插入规范化到删除之前
+	raw, _ := json.Marshal(op)
+	if string(raw) != `[2,"ab",-1,1]` {
+		t.Fatalf("unexpected canonical form %s", raw)
+	}
+	if got, _ := Apply("xyzw", op); got != "xyabw" {
+		t.Fatalf("unexpected apply result %q", got)
+	}
+	for _, bad := range []string{`[0]`, `[1.5]`, `[""]`, `[true]`, `{}`} {
+		if err := json.Unmarshal([]byte(bad), &op); err == nil {
+			t.Fatalf("expected %s to be rejected", bad)
+		}
+	}
+}
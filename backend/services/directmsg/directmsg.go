@@ -0,0 +1,265 @@
+package directmsg
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+const (
+	maxContentRunes = 2000
+	defaultPageSize = 30
+	maxPageSize     = 100
+)
+
+var (
+	ErrEmptyContent   = errors.New("direct_message_empty")
+	ErrContentTooLong = errors.New("direct_message_too_long")
+	ErrSelfMessage    = errors.New("direct_message_self")
+	ErrNotAllowed     = errors.New("direct_message_not_allowed")
+)
+
+// Page 一页私信，按消息ID倒序
+type Page struct {
+	Messages   []models.DirectMessage `json:"messages"`
+	NextCursor uint64                 `json:"next_cursor"`
+	HasMore    bool                   `json:"has_more"`
+}
+
+// ConversationSummary 会话列表项
+type ConversationSummary struct {
+	ConversationID uint64                `json:"conversation_id"`
+	PeerID         uint64                `json:"peer_id"`
+	LastMessage    *models.DirectMessage `json:"last_message"`
+	LastMessageAt  *time.Time            `json:"last_message_at"`
+	UnreadCount    int64                 `json:"unread_count"`
+}
+
+func orderedPair(a, b uint64) (uint64, uint64) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+// CanMessage 判断两位用户能否互发私信：任一方添加了对方为学习伙伴，或同属一个团队（含团队所有者）
+func CanMessage(senderID, recipientID uint64) (bool, error) {
+	if senderID == 0 || recipientID == 0 || senderID == recipientID {
+		return false, nil
+	}
+	db := database.GetDB()
+	var buddies int64
+	if err := db.Model(&models.StudyBuddy{}).
+		Where("(user_id = ? AND buddy_id = ?) OR (user_id = ? AND buddy_id = ?)", senderID, recipientID, recipientID, senderID).
+		Count(&buddies).Error; err != nil {
+		return false, err
+	}
+	if buddies > 0 {
+		return true, nil
+	}
+
+	teamsOf := func(userID uint64) (map[uint64]struct{}, error) {
+		var memberTeams []uint64
+		if err := db.Model(&models.TeamMember{}).Where("user_id = ?", userID).Pluck("team_id", &memberTeams).Error; err != nil {
+			return nil, err
+		}
+		var ownedTeams []uint64
+		if err := db.Model(&models.Team{}).Where("owner_user_id = ?", userID).Pluck("id", &ownedTeams).Error; err != nil {
+			return nil, err
+		}
+		set := make(map[uint64]struct{}, len(memberTeams)+len(ownedTeams))
+		for _, id := range append(memberTeams, ownedTeams...) {
+			set[id] = struct{}{}
+		}
+		return set, nil
+	}
+	senderTeams, err := teamsOf(senderID)
+	if err != nil || len(senderTeams) == 0 {
+		return false, err
+	}
+	recipientTeams, err := teamsOf(recipientID)
+	if err != nil {
+		return false, err
+	}
+	for id := range recipientTeams {
+		if _, ok := senderTeams[id]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Send 校验关系后写入私信并更新会话
+func Send(senderID, recipientID uint64, content string, now time.Time) (*models.DirectMessage, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, ErrEmptyContent
+	}
+	if len([]rune(content)) > maxContentRunes {
+		return nil, ErrContentTooLong
+	}
+	if senderID == recipientID {
+		return nil, ErrSelfMessage
+	}
+	allowed, err := CanMessage(senderID, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrNotAllowed
+	}
+
+	msg := &models.DirectMessage{
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Content:     content,
+		SentAt:      now,
+	}
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		low, high := orderedPair(senderID, recipientID)
+		conversation := models.DirectConversation{UserLowID: low, UserHighID: high}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_low_id = ? AND user_high_id = ?", low, high).
+			FirstOrCreate(&conversation).Error; err != nil {
+			return err
+		}
+		msg.ConversationID = conversation.ID
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return tx.Model(&conversation).Updates(map[string]interface{}{
+			"last_message_id": msg.ID,
+			"last_message_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// History 按游标倒序分页读取与某位用户的私信，beforeID 为 0 时从最新一条开始
+func History(userID, peerID, beforeID uint64, limit int) (*Page, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	page := &Page{Messages: []models.DirectMessage{}}
+	low, high := orderedPair(userID, peerID)
+	db := database.GetDB()
+	var conversation models.DirectConversation
+	if err := db.Where("user_low_id = ? AND user_high_id = ?", low, high).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return page, nil
+		}
+		return nil, err
+	}
+
+	query := db.Where("conversation_id = ?", conversation.ID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var messages []models.DirectMessage
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.HasMore = true
+	}
+	if page.HasMore {
+		page.NextCursor = messages[len(messages)-1].ID
+	}
+	page.Messages = messages
+	return page, nil
+}
+
+// MarkRead 将对方发来的私信全部标记为已读，返回会话ID与本次标记的数量
+func MarkRead(userID, peerID uint64, now time.Time) (uint64, int64, error) {
+	low, high := orderedPair(userID, peerID)
+	db := database.GetDB()
+	var conversation models.DirectConversation
+	if err := db.Where("user_low_id = ? AND user_high_id = ?", low, high).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	result := db.Model(&models.DirectMessage{}).
+		Where("conversation_id = ? AND recipient_id = ? AND read_at IS NULL", conversation.ID, userID).
+		Update("read_at", now)
+	return conversation.ID, result.RowsAffected, result.Error
+}
+
+// ListConversations 返回用户的私信会话，按最近消息时间倒序
+func ListConversations(userID uint64) ([]ConversationSummary, error) {
+	db := database.GetDB()
+	var conversations []models.DirectConversation
+	if err := db.Where("user_low_id = ? OR user_high_id = ?", userID, userID).
+		Order("last_message_at DESC").
+		Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return []ConversationSummary{}, nil
+	}
+
+	ids := make([]uint64, 0, len(conversations))
+	lastIDs := make([]uint64, 0, len(conversations))
+	for _, conv := range conversations {
+		ids = append(ids, conv.ID)
+		lastIDs = append(lastIDs, conv.LastMessageID)
+	}
+	var lastMessages []models.DirectMessage
+	if err := db.Where("id IN ?", lastIDs).Find(&lastMessages).Error; err != nil {
+		return nil, err
+	}
+	lastByID := make(map[uint64]models.DirectMessage, len(lastMessages))
+	for _, msg := range lastMessages {
+		lastByID[msg.ID] = msg
+	}
+
+	type unreadRow struct {
+		ConversationID uint64
+		Total          int64
+	}
+	var unreadRows []unreadRow
+	if err := db.Model(&models.DirectMessage{}).
+		Select("conversation_id, COUNT(*) AS total").
+		Where("conversation_id IN ? AND recipient_id = ? AND read_at IS NULL", ids, userID).
+		Group("conversation_id").
+		Scan(&unreadRows).Error; err != nil {
+		return nil, err
+	}
+	unread := make(map[uint64]int64, len(unreadRows))
+	for _, row := range unreadRows {
+		unread[row.ConversationID] = row.Total
+	}
+
+	result := make([]ConversationSummary, 0, len(conversations))
+	for _, conv := range conversations {
+		peerID := conv.UserHighID
+		if peerID == userID {
+			peerID = conv.UserLowID
+		}
+		summary := ConversationSummary{
+			ConversationID: conv.ID,
+			PeerID:         peerID,
+			LastMessageAt:  conv.LastMessageAt,
+			UnreadCount:    unread[conv.ID],
+		}
+		if msg, ok := lastByID[conv.LastMessageID]; ok {
+			summary.LastMessage = &msg
+		}
+		result = append(result, summary)
+	}
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Type 领域事件类型
+type Type string
+
+const (
+	TypeAchievementUnlocked Type = "achievement_unlocked"
+	TypeLevelUp             Type = "level_up"
+	TypePointsAwarded       Type = "points_awarded"
+)
+
+// subscriberBuffer 每个订阅者的待处理事件上限，处理过慢时丢弃新事件而不阻塞发布方
+const subscriberBuffer = 256
+
+// Event 领域事件。发布方须在数据库事务提交后再发布，订阅者看到的一定是已落库的结果
+type Event struct {
+	Type       Type        `json:"type"`
+	UserID     uint64      `json:"user_id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// AchievementUnlocked achievement_unlocked 事件数据
+type AchievementUnlocked struct {
+	AchievementID uint   `json:"achievement_id"`
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	Icon          string `json:"icon"`
+}
+
+// LevelUp level_up 事件数据
+type LevelUp struct {
+	FromLevel       int `json:"from_level"`
+	ToLevel         int `json:"to_level"`
+	TotalPoints     int `json:"total_points"`
+	NextLevelPoints int `json:"next_level_points"`
+}
+
+// PointsAwarded points_awarded 事件数据
+type PointsAwarded struct {
+	LedgerID    uint64 `json:"ledger_id"`
+	SourceType  int8   `json:"source_type"`
+	Delta       int    `json:"delta"`
+	TotalPoints int    `json:"total_points"`
+	Remark      string `json:"remark"`
+}
+
+// Handler 事件处理函数，在订阅者自己的 goroutine 中按发布顺序调用
+type Handler func(Event)
+
+type subscription struct {
+	name  string
+	queue chan Event
+	done  chan struct{}
+}
+
+// Bus 进程内事件总线：每个订阅者拥有独立的缓冲队列和处理 goroutine，互不阻塞。
+// 队列满或进程退出时事件会丢失，只适合实时推送等尽力而为的处理，需要落库的结果由发布方在事务中写入
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[uint64]*subscription
+	nextID uint64
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[uint64]*subscription)}
+}
+
+// Subscribe 注册订阅者，返回的函数用于取消订阅并等待已入队事件处理完毕
+func (b *Bus) Subscribe(name string, handler Handler) func() {
+	sub := &subscription{name: name, queue: make(chan Event, subscriberBuffer), done: make(chan struct{})}
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	go func() {
+		defer close(sub.done)
+		for evt := range sub.queue {
+			dispatch(sub.name, handler, evt)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			close(sub.queue)
+			b.mu.Unlock()
+			<-sub.done
+		})
+	}
+}
+
+// Publish 将事件投递给所有订阅者，不等待处理完成
+func (b *Bus) Publish(events ...Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, evt := range events {
+		if evt.OccurredAt.IsZero() {
+			evt.OccurredAt = time.Now()
+		}
+		for _, sub := range b.subs {
+			select {
+			case sub.queue <- evt:
+			default:
+				log.Printf("[Events] subscriber %s is full, dropping %s for user %d", sub.name, evt.Type, evt.UserID)
+			}
+		}
+	}
+}
+
+func dispatch(name string, handler Handler, evt Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Events] subscriber %s panicked on %s: %v", name, evt.Type, r)
+		}
+	}()
+	handler(evt)
+}
+
+var defaultBus = NewBus()
+
+// Subscribe 订阅全局事件总线
+func Subscribe(name string, handler Handler) func() {
+	return defaultBus.Subscribe(name, handler)
+}
+
+// Publish 向全局事件总线发布事件
+func Publish(events ...Event) {
+	defaultBus.Publish(events...)
+}
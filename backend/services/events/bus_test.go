@@ -0,0 +1,43 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusDeliversInOrderAndRecoversFromPanic(t *testing.T) {
+	bus := NewBus()
+
+	received := make(chan Event, 4)
+	unsubscribe := bus.Subscribe("collector", func(evt Event) { received <- evt })
+	defer unsubscribe()
+	stopPanicking := bus.Subscribe("panicking", func(Event) { panic("boom") })
+	defer stopPanicking()
+
+	bus.Publish(
+		Event{Type: TypePointsAwarded, UserID: 1, Data: PointsAwarded{Delta: 10}},
+		Event{Type: TypeLevelUp, UserID: 1, Data: LevelUp{FromLevel: 1, ToLevel: 2}},
+	)
+
+	for _, want := range []Type{TypePointsAwarded, TypeLevelUp} {
+		select {
+		case evt := <-received:
+			if evt.Type != want {
+				t.Fatalf("expected %s, got %s", want, evt.Type)
+			}
+			if evt.OccurredAt.IsZero() {
+				t.Fatalf("expected occurred_at to be filled")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	unsubscribe()
+	bus.Publish(Event{Type: TypeAchievementUnlocked, UserID: 1})
+	select {
+	case evt := <-received:
+		t.Fatalf("unexpected event after unsubscribe: %s", evt.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleRejectsInvalidExpressions(t *testing.T) {
+	cases := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "@every 10ms", "a * * * *"}
+	for _, expr := range cases {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Fatalf("expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2025, 3, 3, 10, 17, 30, 0, time.UTC) // Monday
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 3, 3, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 3, 3, 10, 30, 0, 0, time.UTC)},
+		{"10 0 * * *", time.Date(2025, 3, 4, 0, 10, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2025, 3, 3, 13, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", time.Date(2025, 3, 9, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2025, 3, 4, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 6 15 * 5", time.Date(2025, 3, 7, 6, 30, 0, 0, time.UTC)},
+		{"@every 5m", time.Date(2025, 3, 3, 10, 20, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := ParseSchedule(tc.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.expr, err)
+		}
+		if got := s.Next(base); !got.Equal(tc.want) {
+			t.Fatalf("%q: expected %v, got %v", tc.expr, tc.want, got)
+		}
+	}
+}
+
+func TestScheduleNextImpossibleDate(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := s.Next(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Fatalf("expected zero time for impossible schedule, got %v", got)
+	}
+}
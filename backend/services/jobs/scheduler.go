@@ -0,0 +1,427 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+const defaultJobTimeout = 10 * time.Minute
+
+var (
+	ErrJobNotFound   = errors.New("job_not_found")
+	ErrJobRegistered = errors.New("job_already_registered")
+	ErrJobLocked     = errors.New("job_locked")
+)
+
+// RunFunc 任务执行函数，返回简短的执行摘要
+type RunFunc func(ctx context.Context) (string, error)
+
+// Job 后台任务定义
+type Job struct {
+	Name        string
+	Schedule    string
+	Description string
+	Timeout     time.Duration
+	Run         RunFunc
+}
+
+// JobInfo 对外展示的任务信息
+type JobInfo struct {
+	Name        string         `json:"name"`
+	Schedule    string         `json:"schedule"`
+	Description string         `json:"description"`
+	NextRunAt   *time.Time     `json:"next_run_at"`
+	Running     bool           `json:"running"`
+	LastRun     *models.JobRun `json:"last_run"`
+}
+
+type registeredJob struct {
+	Job
+	schedule *Schedule
+	running  bool
+	nextRun  time.Time
+}
+
+// Scheduler 进程内的定时任务调度器，借助 job_locks 表保证多实例只执行一次
+type Scheduler struct {
+	mu         sync.Mutex
+	jobs       map[string]*registeredJob
+	instanceID string
+	now        func() time.Time
+	wg         sync.WaitGroup
+	cancel     context.CancelFunc
+	started    bool
+}
+
+// NewScheduler 创建调度器
+func NewScheduler() *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		jobs:       make(map[string]*registeredJob),
+		instanceID: fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		now:        time.Now,
+	}
+}
+
+// Register 注册任务
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job name and run func are required")
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return err
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("%w: %s", ErrJobRegistered, job.Name)
+	}
+	s.jobs[job.Name] = &registeredJob{Job: job, schedule: schedule, nextRun: schedule.Next(s.now())}
+	return nil
+}
+
+// Start 启动调度循环
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.started = true
+	now := s.now()
+	for _, job := range s.jobs {
+		job.nextRun = job.schedule.Next(now)
+	}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.loop(ctx)
+	log.Printf("[Jobs] scheduler started, instance=%s", s.instanceID)
+}
+
+// Stop 停止调度并等待执行中的任务结束
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = false
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		wait := s.nextWakeup()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runDue(ctx)
+	}
+}
+
+func (s *Scheduler) nextWakeup() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	wait := time.Minute
+	for _, job := range s.jobs {
+		if d := job.nextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	type dueJob struct {
+		job  *registeredJob
+		slot time.Time
+	}
+	now := s.now()
+	due := make([]dueJob, 0)
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if !job.nextRun.After(now) {
+			due = append(due, dueJob{job: job, slot: job.nextRun})
+			job.nextRun = job.schedule.Next(now)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, item := range due {
+		s.wg.Add(1)
+		go func(job *registeredJob, slot time.Time) {
+			defer s.wg.Done()
+			if _, err := s.execute(ctx, job, models.JobTriggerSchedule, nil, &slot); err != nil && !errors.Is(err, ErrJobLocked) {
+				log.Printf("[Jobs] %s failed: %v", job.Name, err)
+			}
+		}(item.job, item.slot)
+	}
+}
+
+// Trigger 手动触发任务，异步执行并立即返回运行记录
+func (s *Scheduler) Trigger(name string, triggeredBy *uint64) (*models.JobRun, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	run, release, err := s.begin(job, models.JobTriggerManual, triggeredBy, nil)
+	if err != nil {
+		return run, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.finish(context.Background(), job, run, release)
+	}()
+	return run, nil
+}
+
+// RunNow 同步执行任务，供命令行或测试使用
+func (s *Scheduler) RunNow(ctx context.Context, name string) (*models.JobRun, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return s.execute(ctx, job, models.JobTriggerManual, nil, nil)
+}
+
+func (s *Scheduler) execute(ctx context.Context, job *registeredJob, trigger string, triggeredBy *uint64, slot *time.Time) (*models.JobRun, error) {
+	run, release, err := s.begin(job, trigger, triggeredBy, slot)
+	if err != nil {
+		return run, err
+	}
+	s.finish(ctx, job, run, release)
+	if run.Status == models.JobRunStatusFailed {
+		return run, errors.New(run.Error)
+	}
+	return run, nil
+}
+
+// begin 抢占锁并写入运行记录；锁被其他实例持有时记录为 skipped。
+// 定时触发时运行记录带上调度时刻 slot，借助 (job_name, scheduled_at) 唯一索引认领该时刻，
+// 其他实例稍后才到点时即使锁已释放也不会重复执行同一时刻
+func (s *Scheduler) begin(job *registeredJob, trigger string, triggeredBy *uint64, slot *time.Time) (*models.JobRun, func(), error) {
+	db := database.GetDB()
+	now := s.now()
+
+	s.mu.Lock()
+	if job.running {
+		s.mu.Unlock()
+		return nil, nil, ErrJobLocked
+	}
+	job.running = true
+	s.mu.Unlock()
+	releaseLocal := func() {
+		s.mu.Lock()
+		job.running = false
+		s.mu.Unlock()
+	}
+
+	acquired, err := acquireLock(db, job.Name, s.instanceID, now, job.Timeout)
+	if err != nil {
+		releaseLocal()
+		return nil, nil, err
+	}
+	if !acquired {
+		releaseLocal()
+		finished := now
+		run := &models.JobRun{
+			JobName:     job.Name,
+			Trigger:     trigger,
+			TriggeredBy: triggeredBy,
+			InstanceID:  s.instanceID,
+			Status:      models.JobRunStatusSkipped,
+			StartedAt:   now,
+			FinishedAt:  &finished,
+			Output:      "已有实例在执行该任务",
+		}
+		if trigger == models.JobTriggerManual {
+			_ = db.Create(run).Error
+		}
+		return run, nil, ErrJobLocked
+	}
+
+	run := &models.JobRun{
+		JobName:     job.Name,
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		InstanceID:  s.instanceID,
+		Status:      models.JobRunStatusRunning,
+		ScheduledAt: slot,
+		StartedAt:   now,
+	}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	if res.Error != nil || res.RowsAffected == 0 {
+		releaseLock(db, job.Name, s.instanceID)
+		releaseLocal()
+		if res.Error != nil {
+			return nil, nil, res.Error
+		}
+		// 该调度时刻已被其他实例认领
+		return nil, nil, ErrJobLocked
+	}
+	release := func() {
+		releaseLock(db, job.Name, s.instanceID)
+		releaseLocal()
+	}
+	return run, release, nil
+}
+
+func (s *Scheduler) finish(ctx context.Context, job *registeredJob, run *models.JobRun, release func()) {
+	defer release()
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	output, err := safeRun(runCtx, job.Run)
+	finished := s.now()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(run.StartedAt).Milliseconds()
+	run.Output = truncate(output, 512)
+	run.Status = models.JobRunStatusSuccess
+	if err != nil {
+		run.Status = models.JobRunStatusFailed
+		run.Error = err.Error()
+	}
+	if saveErr := database.GetDB().Model(&models.JobRun{}).
+		Where("id = ?", run.ID).
+		Updates(map[string]interface{}{
+			"status":      run.Status,
+			"finished_at": run.FinishedAt,
+			"duration_ms": run.DurationMs,
+			"output":      run.Output,
+			"error":       run.Error,
+		}).Error; saveErr != nil {
+		log.Printf("[Jobs] save run %d failed: %v", run.ID, saveErr)
+	}
+}
+
+func safeRun(ctx context.Context, fn RunFunc) (output string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// List 返回所有任务及最近一次执行记录
+func (s *Scheduler) List() []JobInfo {
+	s.mu.Lock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := JobInfo{
+			Name:        job.Name,
+			Schedule:    job.schedule.String(),
+			Description: job.Description,
+			Running:     job.running,
+		}
+		if s.started {
+			next := job.nextRun
+			info.NextRunAt = &next
+		}
+		infos = append(infos, info)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	for i := range infos {
+		var last models.JobRun
+		if err := database.GetDB().Where("job_name = ?", infos[i].Name).Order("id DESC").First(&last).Error; err == nil {
+			infos[i].LastRun = &last
+		}
+	}
+	return infos
+}
+
+// Has 判断任务是否已注册
+func (s *Scheduler) Has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.jobs[name]
+	return ok
+}
+
+// ListRuns 查询任务执行历史
+func ListRuns(name string, limit int) ([]models.JobRun, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	var runs []models.JobRun
+	err := database.GetDB().
+		Where("job_name = ?", name).
+		Order("id DESC").
+		Limit(limit).
+		Find(&runs).Error
+	return runs, err
+}
+
+// acquireLock 以条件更新抢占锁，锁过期后允许其他实例接管
+func acquireLock(db *gorm.DB, name, owner string, now time.Time, ttl time.Duration) (bool, error) {
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.JobLock{JobName: name}).Error; err != nil {
+		return false, err
+	}
+	until := now.Add(ttl)
+	res := db.Model(&models.JobLock{}).
+		Where("job_name = ? AND (locked_until IS NULL OR locked_until < ?)", name, now).
+		Updates(map[string]interface{}{"owner": owner, "locked_until": until})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func releaseLock(db *gorm.DB, name, owner string) {
+	if err := db.Model(&models.JobLock{}).
+		Where("job_name = ? AND owner = ?", name, owner).
+		Updates(map[string]interface{}{"owner": "", "locked_until": nil}).Error; err != nil {
+		log.Printf("[Jobs] release lock %s failed: %v", name, err)
+	}
+}
+
+func truncate(val string, max int) string {
+	runes := []rune(val)
+	if len(runes) <= max {
+		return val
+	}
+	return string(runes[:max])
+}
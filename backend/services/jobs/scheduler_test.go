@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestRunNowRecordsSuccessAndFailure(t *testing.T) {
+	db := testdb.Open(t, &models.JobRun{}, &models.JobLock{})
+	s := NewScheduler()
+	_ = s.Register(Job{Name: "ok", Schedule: "@hourly", Run: func(ctx context.Context) (string, error) { return "done", nil }})
+	_ = s.Register(Job{Name: "boom", Schedule: "@hourly", Run: func(ctx context.Context) (string, error) { panic("bad") }})
+
+	run, err := s.RunNow(context.Background(), "ok")
+	if err != nil || run.Status != models.JobRunStatusSuccess || run.Output != "done" {
+		t.Fatalf("expected success run, got %+v err=%v", run, err)
+	}
+	run, err = s.RunNow(context.Background(), "boom")
+	if err == nil || run.Status != models.JobRunStatusFailed || !strings.Contains(run.Error, "panic") {
+		t.Fatalf("expected failed run, got %+v err=%v", run, err)
+	}
+
+	var count int64
+	db.Model(&models.JobRun{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 persisted runs, got %d", count)
+	}
+	var lock models.JobLock
+	db.Where("job_name = ?", "ok").First(&lock)
+	if lock.LockedUntil != nil {
+		t.Fatalf("expected lock released, got %+v", lock)
+	}
+}
+
+func TestLockPreventsConcurrentInstances(t *testing.T) {
+	db := testdb.Open(t, &models.JobRun{}, &models.JobLock{})
+	now := time.Now()
+
+	ok, err := acquireLock(db, "aggregate", "instance-a", now, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected first instance to acquire lock, ok=%v err=%v", ok, err)
+	}
+
+	other := NewScheduler()
+	_ = other.Register(Job{Name: "aggregate", Schedule: "@hourly", Run: func(ctx context.Context) (string, error) {
+		t.Fatalf("job must not run while locked by another instance")
+		return "", nil
+	}})
+	if _, err := other.RunNow(context.Background(), "aggregate"); !errors.Is(err, ErrJobLocked) {
+		t.Fatalf("expected ErrJobLocked, got %v", err)
+	}
+
+	// 锁过期后其他实例可以接管
+	ok, err = acquireLock(db, "aggregate", "instance-b", now.Add(2*time.Minute), time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected expired lock to be taken over, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestScheduledSlotRunsOnceAcrossInstances(t *testing.T) {
+	db := testdb.Open(t, &models.JobRun{}, &models.JobLock{})
+	slot := time.Date(2026, 3, 9, 10, 5, 0, 0, time.Local)
+	runs := 0
+	newInstance := func() *Scheduler {
+		s := NewScheduler()
+		s.now = func() time.Time { return slot.Add(-time.Second) }
+		_ = s.Register(Job{Name: "refresh", Schedule: "5 * * * *", Run: func(ctx context.Context) (string, error) {
+			runs++
+			return "", nil
+		}})
+		return s
+	}
+	a, b := newInstance(), newInstance()
+
+	// 实例 A 到点执行完毕并释放锁后，实例 B 的定时器才触发同一调度时刻
+	a.now = func() time.Time { return slot }
+	a.runDue(context.Background())
+	a.wg.Wait()
+	b.now = func() time.Time { return slot.Add(300 * time.Millisecond) }
+	b.runDue(context.Background())
+	b.wg.Wait()
+	if runs != 1 {
+		t.Fatalf("expected the slot to run once across instances, got %d", runs)
+	}
+
+	// 下一个调度时刻由先到的实例执行
+	next := slot.Add(time.Hour)
+	b.now = func() time.Time { return next }
+	b.runDue(context.Background())
+	b.wg.Wait()
+	a.now = func() time.Time { return next.Add(time.Second) }
+	a.runDue(context.Background())
+	a.wg.Wait()
+	if runs != 2 {
+		t.Fatalf("expected next slot to run once, got %d", runs)
+	}
+	var count int64
+	db.Model(&models.JobRun{}).Where("job_name = ? AND scheduled_at IS NOT NULL", "refresh").Count(&count)
+	if count != 2 {
+		t.Fatalf("expected one run row per slot, got %d", count)
+	}
+}
+
+func TestRegisterRejectsDuplicatesAndBadSchedules(t *testing.T) {
+	s := NewScheduler()
+	run := func(ctx context.Context) (string, error) { return "", nil }
+	if err := s.Register(Job{Name: "a", Schedule: "@daily", Run: run}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := s.Register(Job{Name: "a", Schedule: "@daily", Run: run}); !errors.Is(err, ErrJobRegistered) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	if err := s.Register(Job{Name: "b", Schedule: "bad", Run: run}); err == nil {
+		t.Fatalf("expected schedule error")
+	}
+}
@@ -0,0 +1,315 @@
+package leaderboard
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+type Metric string
+
+const (
+	MetricPoints       Metric = "points"
+	MetricStudyMinutes Metric = "study_minutes"
+	MetricStreak       Metric = "streak"
+)
+
+type Scope string
+
+const (
+	ScopeGlobal  Scope = "global"
+	ScopeTeam    Scope = "team"
+	ScopeSchool  Scope = "school"
+	ScopeBuddies Scope = "buddies"
+)
+
+type Period string
+
+const (
+	PeriodDaily   Period = "daily"
+	PeriodWeekly  Period = "weekly"
+	PeriodMonthly Period = "monthly"
+	PeriodAll     Period = "all"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+var (
+	ErrInvalidQuery  = errors.New("leaderboard_invalid_query")
+	ErrNotTeamMember = errors.New("leaderboard_not_team_member")
+	ErrNoSchool      = errors.New("leaderboard_no_school")
+)
+
+// Query 排行榜查询。周期按查看者的时区划分；连续天数始终取当前值，与周期无关
+type Query struct {
+	Metric   Metric
+	Scope    Scope
+	TeamID   uint64
+	Period   Period
+	ViewerID uint64
+	Limit    int
+	Now      time.Time
+}
+
+// Entry 榜单中的一行，同分者名次相同
+type Entry struct {
+	Rank        int    `json:"rank"`
+	UserID      uint64 `json:"user_id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	School      string `json:"school,omitempty"`
+	Value       int    `json:"value"`
+}
+
+// Board 排行榜结果。Me 为查看者自己的名次，查看者关闭了学习数据展示时为空
+type Board struct {
+	Metric       Metric     `json:"metric"`
+	Scope        Scope      `json:"scope"`
+	Period       Period     `json:"period"`
+	PeriodStart  *time.Time `json:"period_start"`
+	Entries      []Entry    `json:"entries"`
+	Me           *Entry     `json:"me"`
+	Participants int        `json:"participants"`
+	OptedOut     bool       `json:"opted_out"`
+}
+
+// Validate 检查并补全查询参数
+func (q *Query) Validate() error {
+	switch q.Metric {
+	case MetricPoints, MetricStudyMinutes, MetricStreak:
+	default:
+		return fmt.Errorf("%w: unknown metric %q", ErrInvalidQuery, q.Metric)
+	}
+	switch q.Scope {
+	case ScopeGlobal, ScopeSchool, ScopeBuddies:
+	case ScopeTeam:
+		if q.TeamID == 0 {
+			return fmt.Errorf("%w: team scope requires team id", ErrInvalidQuery)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidQuery, q.Scope)
+	}
+	switch q.Period {
+	case PeriodDaily, PeriodWeekly, PeriodMonthly, PeriodAll:
+	default:
+		return fmt.Errorf("%w: unknown period %q", ErrInvalidQuery, q.Period)
+	}
+	if q.Metric == MetricStreak {
+		q.Period = PeriodAll
+	}
+	if q.Limit <= 0 || q.Limit > MaxLimit {
+		q.Limit = DefaultLimit
+	}
+	if q.Now.IsZero() {
+		q.Now = time.Now()
+	}
+	return nil
+}
+
+// PeriodStart 返回周期在 loc 时区的起点，全部时间返回 nil
+func PeriodStart(period Period, now time.Time, loc *time.Location) *time.Time {
+	var start time.Time
+	switch period {
+	case PeriodDaily:
+		start = usertime.StartOfDay(now, loc)
+	case PeriodWeekly:
+		start = usertime.WeekStart(now, loc)
+	case PeriodMonthly:
+		local := now.In(loc)
+		start = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return nil
+	}
+	return &start
+}
+
+// Build 生成排行榜。关闭了"展示学习数据"的用户不参与任何榜单
+func Build(db *gorm.DB, q Query) (*Board, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	board := &Board{Metric: q.Metric, Scope: q.Scope, Period: q.Period, Entries: []Entry{}}
+
+	candidates, err := scopeUsers(db, q)
+	if err != nil {
+		return nil, err
+	}
+	visible := db.Model(&models.User{}).Select("users.id").
+		Where("users.status = ?", 1).
+		Where("users.id NOT IN (?)", db.Model(&models.UserSetting{}).Select("user_id").Where("show_study_data = ?", false))
+	if candidates != nil {
+		visible = visible.Where("users.id IN (?)", candidates)
+	}
+
+	board.PeriodStart = PeriodStart(q.Period, q.Now, usertime.ForUser(q.ViewerID))
+	values, err := metricValues(db, q.Metric, board.PeriodStart, visible)
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := make([]Entry, 0, len(values))
+	for userID, value := range values {
+		if value > 0 {
+			ranked = append(ranked, Entry{UserID: userID, Value: value})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Value != ranked[j].Value {
+			return ranked[i].Value > ranked[j].Value
+		}
+		return ranked[i].UserID < ranked[j].UserID
+	})
+	for i := range ranked {
+		if i > 0 && ranked[i].Value == ranked[i-1].Value {
+			ranked[i].Rank = ranked[i-1].Rank
+		} else {
+			ranked[i].Rank = i + 1
+		}
+	}
+	board.Participants = len(ranked)
+
+	var me *Entry
+	for i := range ranked {
+		if ranked[i].UserID == q.ViewerID {
+			entry := ranked[i]
+			me = &entry
+			break
+		}
+	}
+	if me == nil && q.ViewerID != 0 {
+		var optedOut int64
+		db.Model(&models.UserSetting{}).Where("user_id = ? AND show_study_data = ?", q.ViewerID, false).Count(&optedOut)
+		board.OptedOut = optedOut > 0
+		if !board.OptedOut {
+			// 没有成绩的查看者排在所有有成绩的人之后
+			me = &Entry{UserID: q.ViewerID, Rank: len(ranked) + 1}
+		}
+	}
+
+	if len(ranked) > q.Limit {
+		ranked = ranked[:q.Limit]
+	}
+	board.Entries = ranked
+	board.Me = me
+	if err := fillUsers(db, board); err != nil {
+		return nil, err
+	}
+	return board, nil
+}
+
+// scopeUsers 返回范围内用户 ID 的子查询，全局范围返回 nil
+func scopeUsers(db *gorm.DB, q Query) (*gorm.DB, error) {
+	switch q.Scope {
+	case ScopeTeam:
+		var count int64
+		if err := db.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", q.TeamID, q.ViewerID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrNotTeamMember
+		}
+		return db.Model(&models.TeamMember{}).Select("user_id").Where("team_id = ?", q.TeamID), nil
+	case ScopeSchool:
+		var viewer models.User
+		if err := db.Select("id", "school").First(&viewer, q.ViewerID).Error; err != nil {
+			return nil, err
+		}
+		if viewer.School == "" {
+			return nil, ErrNoSchool
+		}
+		return db.Model(&models.User{}).Select("id").Where("school = ?", viewer.School), nil
+	case ScopeBuddies:
+		// 伙伴榜包含查看者自己
+		return db.Model(&models.User{}).Select("id").Where("id = ? OR id IN (?)", q.ViewerID,
+			db.Model(&models.StudyBuddy{}).Select("buddy_id").Where("user_id = ?", q.ViewerID)), nil
+	default:
+		return nil, nil
+	}
+}
+
+type userValue struct {
+	UserID uint64
+	Value  int
+}
+
+// metricValues 计算可见用户在周期内的指标值
+func metricValues(db *gorm.DB, metric Metric, since *time.Time, visible *gorm.DB) (map[uint64]int, error) {
+	var rows []userValue
+	var err error
+	switch metric {
+	case MetricPoints:
+		// 只统计获得的积分（含被冲正的扣回），兑换消费及其退款不影响排名
+		query := db.Model(&models.PointsLedger{}).
+			Select("user_id, COALESCE(SUM(delta), 0) AS value").
+			Where("source_type <> ? AND (delta > 0 OR reversal_of IS NOT NULL) AND user_id IN (?)", models.PointsSourceRedemption, visible)
+		if since != nil {
+			query = query.Where("created_at >= ?", *since)
+		}
+		err = query.Group("user_id").Scan(&rows).Error
+	case MetricStudyMinutes:
+		query := db.Model(&models.DailyStudyStat{}).
+			Select("user_id, COALESCE(SUM(minutes), 0) AS value").
+			Where("user_id IN (?)", visible)
+		if since != nil {
+			query = query.Where("date >= ?", usertime.CalendarDate(*since))
+		}
+		err = query.Group("user_id").Scan(&rows).Error
+	case MetricStreak:
+		err = db.Model(&models.UserProfile{}).
+			Select("user_id, streak_days AS value").
+			Where("user_id IN (?)", visible).
+			Scan(&rows).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[uint64]int, len(rows))
+	for _, row := range rows {
+		values[row.UserID] = row.Value
+	}
+	return values, nil
+}
+
+func fillUsers(db *gorm.DB, board *Board) error {
+	ids := make([]uint64, 0, len(board.Entries)+1)
+	for _, entry := range board.Entries {
+		ids = append(ids, entry.UserID)
+	}
+	if board.Me != nil {
+		ids = append(ids, board.Me.UserID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var users []models.User
+	if err := db.Select("id", "display_name", "avatar_url", "school").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint64]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	fill := func(entry *Entry) {
+		if user, ok := byID[entry.UserID]; ok {
+			entry.DisplayName = user.DisplayName
+			entry.AvatarURL = user.AvatarURL
+			entry.School = user.School
+		}
+	}
+	for i := range board.Entries {
+		fill(&board.Entries[i])
+	}
+	if board.Me != nil {
+		fill(board.Me)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package leaderboard
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestLeaderboardScopesPeriodsAndOptOut(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	users := []models.User{
+		{Account: "a", Email: "a@x", Phone: "1", DisplayName: "A", School: "北大", Status: 1, PasswordHash: "x"},
+		{Account: "b", Email: "b@x", Phone: "2", DisplayName: "B", School: "北大", Status: 1, PasswordHash: "x"},
+		{Account: "c", Email: "c@x", Phone: "3", DisplayName: "C", School: "清华", Status: 1, PasswordHash: "x"},
+		{Account: "d", Email: "d@x", Phone: "4", DisplayName: "D", School: "北大", Status: 1, PasswordHash: "x"},
+	}
+	db.Create(&users)
+	a, b, c, d := users[0].ID, users[1].ID, users[2].ID, users[3].ID
+	db.Create(&models.UserSetting{UserID: a, Timezone: "UTC", ShowStudyData: true})
+	db.Create(&models.UserSetting{UserID: d, ShowStudyData: true})
+	db.Model(&models.UserSetting{}).Where("user_id = ?", d).Update("show_study_data", false)
+
+	ledger := func(userID uint64, delta int, at time.Time) {
+		entry := models.PointsLedger{UserID: userID, SourceType: models.PointsSourceDailyCheckIn, Delta: delta}
+		db.Create(&entry)
+		db.Model(&entry).UpdateColumn("created_at", at)
+	}
+	ledger(a, 30, now)
+	ledger(b, 50, now.AddDate(0, 0, -40))
+	ledger(b, 30, now)
+	ledger(b, -100, now)
+	ledger(c, 10, now)
+	ledger(d, 500, now)
+
+	board, err := Build(db, Query{Metric: MetricPoints, Scope: ScopeGlobal, Period: PeriodDaily, ViewerID: a, Now: now})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(board.Entries) != 3 || board.Entries[0].Rank != 1 || board.Entries[1].Rank != 1 || board.Entries[2].UserID != c || board.Entries[2].Rank != 3 {
+		t.Fatalf("expected tied leaders without opted-out user, got %+v", board.Entries)
+	}
+	if board.Me == nil || board.Me.UserID != a || board.Me.Rank != 1 || board.Me.DisplayName != "A" {
+		t.Fatalf("unexpected viewer entry %+v", board.Me)
+	}
+
+	board, _ = Build(db, Query{Metric: MetricPoints, Scope: ScopeSchool, Period: PeriodAll, ViewerID: a, Now: now})
+	if len(board.Entries) != 2 || board.Entries[0].UserID != b || board.Entries[0].Value != 80 {
+		t.Fatalf("expected school board with all-time earned points, got %+v", board.Entries)
+	}
+
+	db.Create(&models.StudyBuddy{UserID: a, BuddyID: c})
+	db.Create(&models.DailyStudyStat{UserID: c, Date: now.AddDate(0, 0, -1), Minutes: 90})
+	db.Create(&models.DailyStudyStat{UserID: b, Date: now, Minutes: 300})
+	board, _ = Build(db, Query{Metric: MetricStudyMinutes, Scope: ScopeBuddies, Period: PeriodMonthly, ViewerID: a, Now: now})
+	if len(board.Entries) > 1 || (len(board.Entries) == 1 && board.Entries[0].UserID != c) {
+		t.Fatalf("buddy board must only include viewer and buddies, got %+v", board.Entries)
+	}
+	if board.Me == nil || board.Me.Rank != len(board.Entries)+1 {
+		t.Fatalf("viewer without minutes should rank last, got %+v", board.Me)
+	}
+
+	if _, err := Build(db, Query{Metric: MetricStreak, Scope: ScopeTeam, TeamID: 99, Period: PeriodAll, ViewerID: a}); !errors.Is(err, ErrNotTeamMember) {
+		t.Fatalf("expected team membership check, got %v", err)
+	}
+	board, _ = Build(db, Query{Metric: MetricPoints, Scope: ScopeGlobal, Period: PeriodWeekly, ViewerID: d, Now: now})
+	if !board.OptedOut || board.Me != nil {
+		t.Fatalf("opted-out viewer must not be ranked, got %+v", board)
+	}
+}
+
+func TestUpdateRankLabels(t *testing.T) {
+	db := testdb.Open(t)
+	for i, points := range []int{100, 50, 50, 0} {
+		user := models.User{Account: string(rune('a' + i)), Email: string(rune('a'+i)) + "@x", Phone: string(rune('1' + i)), DisplayName: "u", Status: 1, PasswordHash: "x"}
+		db.Create(&user)
+		db.Create(&models.UserProfile{UserID: user.ID, TotalPoints: points})
+	}
+	if _, err := UpdateRankLabels(db); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	var labels []string
+	db.Model(&models.UserProfile{}).Order("total_points DESC, id ASC").Pluck("rank_label", &labels)
+	want := []string{"TOP 25%", "TOP 50%", "TOP 50%", "TOP 100%"}
+	for i := range want {
+		if labels[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, labels)
+		}
+	}
+	if updated, _ := UpdateRankLabels(db); updated != 0 {
+		t.Fatalf("expected no changes on rerun, got %d", updated)
+	}
+}
@@ -0,0 +1,58 @@
+package leaderboard
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+)
+
+// RankLabel 名次对应的百分位标签，如 "TOP 5%"，向上取整且至少为 1%
+func RankLabel(rank, total int) string {
+	if rank <= 0 || total <= 0 {
+		return "TOP 100%"
+	}
+	percent := (rank*100 + total - 1) / total
+	if percent < 1 {
+		percent = 1
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return fmt.Sprintf("TOP %d%%", percent)
+}
+
+// UpdateRankLabels 按累计积分为所有有效用户的档案重算百分位标签，返回变更的档案数。
+// 没有积分的用户为 TOP 100%；标签只展示给用户本人，关闭学习数据展示的用户同样计算
+func UpdateRankLabels(db *gorm.DB) (int, error) {
+	var profiles []models.UserProfile
+	if err := db.Select("id", "user_id", "total_points", "rank_label").
+		Where("user_id IN (?)", db.Model(&models.User{}).Select("id").Where("status = ?", 1)).
+		Find(&profiles).Error; err != nil {
+		return 0, err
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].TotalPoints > profiles[j].TotalPoints })
+
+	updated := 0
+	rank := 0
+	for i := range profiles {
+		if i == 0 || profiles[i].TotalPoints != profiles[i-1].TotalPoints {
+			rank = i + 1
+		}
+		label := RankLabel(rank, len(profiles))
+		if profiles[i].TotalPoints <= 0 {
+			label = RankLabel(len(profiles), len(profiles))
+		}
+		if label == profiles[i].RankLabel {
+			continue
+		}
+		if err := db.Model(&models.UserProfile{}).Where("id = ?", profiles[i].ID).
+			UpdateColumn("rank_label", label).Error; err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
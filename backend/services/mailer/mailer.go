@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"learningAssistant-backend/config"
+)
+
+// Mailer 发送纯文本邮件
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// New 按配置创建邮件发送器，未配置 SMTP 主机时返回 nil，调用方据此跳过邮件
+func New(cfg config.MailConfig) Mailer {
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+	return &SMTPMailer{addr: cfg.SMTPHost + ":" + cfg.SMTPPort, auth: auth, from: from}
+}
+
+// Send 发送 UTF-8 纯文本邮件
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, BuildMessage(m.from, to, subject, body, time.Now()))
+}
+
+// BuildMessage 组装邮件报文，主题按 RFC 2047 编码以支持中文
+func BuildMessage(from, to, subject, body string, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
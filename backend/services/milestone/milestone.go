@@ -0,0 +1,113 @@
+package milestone
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/events"
+)
+
+const (
+	NotificationTypeAchievement   = "ACHIEVEMENT"
+	NotificationTypeLevelUp       = "LEVEL_UP"
+	NotificationTypeTeamMilestone = "TEAM_MILESTONE"
+)
+
+// Record 在发放成就或升级的同一事务中写入通知：本人一条，另给开启了里程碑提醒的队友各一条。
+// 事件总线只负责尽力而为的实时推送，通知记录不依赖总线送达
+func Record(tx *gorm.DB, evt events.Event) error {
+	if evt.OccurredAt.IsZero() {
+		evt.OccurredAt = time.Now()
+	}
+	// teamFormat 为队友通知的内容模板，%s 为用户昵称
+	var title, content, teamFormat, notificationType string
+	var relatedID uint64
+	switch data := evt.Data.(type) {
+	case events.AchievementUnlocked:
+		notificationType, relatedID = NotificationTypeAchievement, uint64(data.AchievementID)
+		title, content = "解锁新成就", fmt.Sprintf("恭喜你解锁成就「%s」", data.Name)
+		teamFormat = "%s 解锁了成就「" + data.Name + "」"
+	case events.LevelUp:
+		notificationType, relatedID = NotificationTypeLevelUp, uint64(data.ToLevel)
+		title, content = "等级提升", fmt.Sprintf("恭喜你升到 Lv.%d", data.ToLevel)
+		teamFormat = fmt.Sprintf("%%s 升到了 Lv.%d", data.ToLevel)
+	default:
+		return nil
+	}
+
+	relatedData, err := json.Marshal(evt.Data)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&models.Notification{
+		UserID:       evt.UserID,
+		Title:        title,
+		Content:      content,
+		Type:         notificationType,
+		RelatedID:    relatedID,
+		RelatedData:  string(relatedData),
+		ActionStatus: "NONE",
+	}).Error; err != nil {
+		return err
+	}
+
+	teammateIDs, name, err := Teammates(tx, evt.UserID)
+	if err != nil || len(teammateIDs) == 0 {
+		return err
+	}
+	teamData, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	teamContent := strings.Replace(teamFormat, "%s", name, 1)
+	notifications := make([]models.Notification, 0, len(teammateIDs))
+	for _, teammateID := range teammateIDs {
+		notifications = append(notifications, models.Notification{
+			UserID:       teammateID,
+			Title:        "队友里程碑",
+			Content:      teamContent,
+			Type:         NotificationTypeTeamMilestone,
+			RelatedID:    evt.UserID,
+			RelatedData:  string(teamData),
+			ActionStatus: "NONE",
+		})
+	}
+	return tx.Create(&notifications).Error
+}
+
+// Teammates 用户所在团队中开启了里程碑提醒的队友及用户的展示名称；关闭学习数据展示的用户不外发
+func Teammates(db *gorm.DB, userID uint64) ([]uint64, string, error) {
+	var user models.User
+	if err := db.Select("id", "display_name").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	var hidden int64
+	if err := db.Model(&models.UserSetting{}).Where("user_id = ? AND show_study_data = ?", userID, false).Count(&hidden).Error; err != nil {
+		return nil, "", err
+	}
+	if hidden > 0 {
+		return nil, "", nil
+	}
+
+	var teammateIDs []uint64
+	if err := db.Model(&models.TeamMember{}).Distinct("user_id").
+		Where("team_id IN (?) AND user_id <> ?", db.Model(&models.TeamMember{}).Select("team_id").Where("user_id = ?", userID), userID).
+		Where("user_id NOT IN (?)", db.Model(&models.UserSetting{}).Select("user_id").Where("notify_team_milestones = ?", false)).
+		Pluck("user_id", &teammateIDs).Error; err != nil {
+		return nil, "", err
+	}
+	name := user.DisplayName
+	if name == "" {
+		name = fmt.Sprintf("用户%d", user.ID)
+	}
+	return teammateIDs, name, nil
+}
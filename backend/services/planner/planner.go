@@ -0,0 +1,491 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Period 学习时段
+type Period string
+
+const (
+	PeriodMorning   Period = "morning"
+	PeriodAfternoon Period = "afternoon"
+	PeriodEvening   Period = "evening"
+	PeriodNight     Period = "night"
+)
+
+const (
+	BlockTypeStudy = "study"
+	BlockTypeBreak = "break"
+
+	defaultDailyGoalMinutes = 60
+	defaultFocusMinutes     = 45
+	defaultBreakMinutes     = 10
+	defaultTaskMinutes      = 60
+	minTaskMinutes          = 15
+	slotAlignMinutes        = 5
+)
+
+// periodWindow 时段对应的可用时间窗口（距零点的分钟数）
+type periodWindow struct {
+	Period   Period
+	StartMin int
+	EndMin   int
+}
+
+var periodWindows = []periodWindow{
+	{Period: PeriodMorning, StartMin: 8 * 60, EndMin: 12 * 60},
+	{Period: PeriodAfternoon, StartMin: 14 * 60, EndMin: 18 * 60},
+	{Period: PeriodEvening, StartMin: 19 * 60, EndMin: 22 * 60},
+	{Period: PeriodNight, StartMin: 22 * 60, EndMin: 24 * 60},
+}
+
+// TaskInput 参与排程的未完成任务
+type TaskInput struct {
+	ID              uint64
+	Title           string
+	Priority        int8
+	DueAt           *time.Time
+	EstimateMinutes int
+	Progress        int
+	DependsOn       []uint64
+}
+
+// Options 排程参数
+type Options struct {
+	Now              time.Time
+	Days             int
+	DailyGoalMinutes int
+	PreferredPeriod  string
+	PeriodWeights    map[Period]float64
+	FocusMinutes     int
+	BreakMinutes     int
+}
+
+// Block 计划中的一个时间块
+type Block struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Type      string    `json:"type"`
+	Period    Period    `json:"period"`
+	TaskID    uint64    `json:"task_id,omitempty"`
+	TaskTitle string    `json:"task_title,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// DayPlan 单日计划
+type DayPlan struct {
+	Date           string  `json:"date"`
+	GoalMinutes    int     `json:"goal_minutes"`
+	PlannedMinutes int     `json:"planned_minutes"`
+	Blocks         []Block `json:"blocks"`
+}
+
+// UnscheduledTask 未能排入计划的任务
+type UnscheduledTask struct {
+	TaskID           uint64 `json:"task_id"`
+	Title            string `json:"title"`
+	RemainingMinutes int    `json:"remaining_minutes"`
+	Reason           string `json:"reason"`
+}
+
+// Plan 排程结果
+type Plan struct {
+	Days        []DayPlan         `json:"days"`
+	Unscheduled []UnscheduledTask `json:"unscheduled"`
+	PeriodOrder []Period          `json:"period_order"`
+	Warnings    []string          `json:"warnings"`
+}
+
+type pendingTask struct {
+	input     TaskInput
+	remaining int
+	rank      int
+}
+
+type studyInterval struct {
+	dayIndex int
+	start    time.Time
+	end      time.Time
+	period   Period
+}
+
+// Build 根据任务、每日目标与时段偏好生成确定性的时间块计划
+func Build(tasks []TaskInput, opts Options) Plan {
+	opts = normalizeOptions(opts)
+	order := rankPeriods(opts.PreferredPeriod, opts.PeriodWeights)
+
+	plan := Plan{
+		Days:        make([]DayPlan, 0, opts.Days),
+		Unscheduled: []UnscheduledTask{},
+		PeriodOrder: order,
+		Warnings:    []string{},
+	}
+
+	intervals, breaks := layoutDays(opts, order)
+	for i := 0; i < opts.Days; i++ {
+		day := startOfDay(opts.Now).AddDate(0, 0, i)
+		plan.Days = append(plan.Days, DayPlan{
+			Date:        day.Format("2006-01-02"),
+			GoalMinutes: opts.DailyGoalMinutes,
+			Blocks:      []Block{},
+		})
+	}
+
+	queue := orderTasks(tasks, opts.Now)
+	if len(queue) == 0 {
+		return plan
+	}
+
+	lateWarned := make(map[uint64]bool)
+	current := 0
+	for _, interval := range intervals {
+		cursor := interval.start
+		for cursor.Before(interval.end) && current < len(queue) {
+			task := queue[current]
+			available := int(interval.end.Sub(cursor).Minutes())
+			take := task.remaining
+			if take > available {
+				take = available
+			}
+			end := cursor.Add(time.Duration(take) * time.Minute)
+			block := Block{
+				Start:     cursor,
+				End:       end,
+				Type:      BlockTypeStudy,
+				Period:    interval.period,
+				TaskID:    task.input.ID,
+				TaskTitle: task.input.Title,
+			}
+			if task.input.DueAt != nil && end.After(*task.input.DueAt) {
+				block.Notes = "预计晚于截止时间完成"
+				if !lateWarned[task.input.ID] {
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf("任务「%s」按当前容量无法在截止时间前完成", task.input.Title))
+					lateWarned[task.input.ID] = true
+				}
+			}
+			day := &plan.Days[interval.dayIndex]
+			day.Blocks = append(day.Blocks, block)
+			day.PlannedMinutes += take
+
+			task.remaining -= take
+			cursor = end
+			if task.remaining <= 0 {
+				current++
+			}
+		}
+	}
+
+	for i := range plan.Days {
+		plan.Days[i].Blocks = mergeBreaks(plan.Days[i].Blocks, breaks[i])
+	}
+
+	for _, task := range queue[current:] {
+		if task.remaining <= 0 {
+			continue
+		}
+		plan.Unscheduled = append(plan.Unscheduled, UnscheduledTask{
+			TaskID:           task.input.ID,
+			Title:            task.input.Title,
+			RemainingMinutes: task.remaining,
+			Reason:           "超出计划时间容量",
+		})
+	}
+
+	return plan
+}
+
+func normalizeOptions(opts Options) Options {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Days <= 0 {
+		opts.Days = 1
+	}
+	if opts.Days > 7 {
+		opts.Days = 7
+	}
+	if opts.DailyGoalMinutes <= 0 {
+		opts.DailyGoalMinutes = defaultDailyGoalMinutes
+	}
+	if opts.FocusMinutes <= 0 {
+		opts.FocusMinutes = defaultFocusMinutes
+	}
+	if opts.FocusMinutes < 15 {
+		opts.FocusMinutes = 15
+	}
+	if opts.FocusMinutes > 120 {
+		opts.FocusMinutes = 120
+	}
+	if opts.BreakMinutes < 0 {
+		opts.BreakMinutes = 0
+	}
+	if opts.BreakMinutes == 0 {
+		opts.BreakMinutes = defaultBreakMinutes
+	}
+	return opts
+}
+
+// PeriodOf 返回时刻（按 t 所在时区的钟点）所属的学习时段，不在任何时段内时返回 false
+func PeriodOf(t time.Time) (Period, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range periodWindows {
+		if minute >= w.StartMin && minute < w.EndMin {
+			return w.Period, true
+		}
+	}
+	return "", false
+}
+
+// PeriodBounds 返回 dayStart 当天（按其所在时区）指定时段的起止时刻 [start, end)，未知时段返回 false
+func PeriodBounds(period Period, dayStart time.Time) (time.Time, time.Time, bool) {
+	for _, w := range periodWindows {
+		if w.Period == period {
+			start := time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, w.StartMin, 0, 0, dayStart.Location())
+			end := time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, w.EndMin, 0, 0, dayStart.Location())
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// rankPeriods 偏好时段优先，其余按历史学习时长权重排序
+func rankPeriods(preferred string, weights map[Period]float64) []Period {
+	preferredPeriod := Period(strings.ToLower(strings.TrimSpace(preferred)))
+	result := make([]Period, 0, len(periodWindows))
+	for _, w := range periodWindows {
+		result = append(result, w.Period)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i] == preferredPeriod {
+			return true
+		}
+		if result[j] == preferredPeriod {
+			return false
+		}
+		return weights[result[i]] > weights[result[j]]
+	})
+	return result
+}
+
+// layoutDays 按时段优先级为每天分配学习区间（不超过每日目标），并生成区间之间的休息块
+func layoutDays(opts Options, order []Period) ([]studyInterval, [][]Block) {
+	windows := make(map[Period]periodWindow, len(periodWindows))
+	for _, w := range periodWindows {
+		windows[w.Period] = w
+	}
+
+	intervals := make([]studyInterval, 0)
+	breaks := make([][]Block, opts.Days)
+	today := startOfDay(opts.Now)
+	earliest := alignUp(opts.Now)
+
+	for dayIndex := 0; dayIndex < opts.Days; dayIndex++ {
+		day := today.AddDate(0, 0, dayIndex)
+		capacity := opts.DailyGoalMinutes
+		dayIntervals := make([]studyInterval, 0)
+
+		for _, period := range order {
+			if capacity <= 0 {
+				break
+			}
+			w := windows[period]
+			cursor := day.Add(time.Duration(w.StartMin) * time.Minute)
+			windowEnd := day.Add(time.Duration(w.EndMin) * time.Minute)
+			if dayIndex == 0 && cursor.Before(earliest) {
+				cursor = earliest
+			}
+			for capacity > 0 && cursor.Before(windowEnd) {
+				length := opts.FocusMinutes
+				if length > capacity {
+					length = capacity
+				}
+				remain := int(windowEnd.Sub(cursor).Minutes())
+				if length > remain {
+					length = remain
+				}
+				if length < minTaskMinutes && length < capacity {
+					break
+				}
+				end := cursor.Add(time.Duration(length) * time.Minute)
+				dayIntervals = append(dayIntervals, studyInterval{dayIndex: dayIndex, start: cursor, end: end, period: period})
+				capacity -= length
+				cursor = end
+				if capacity > 0 {
+					breakEnd := cursor.Add(time.Duration(opts.BreakMinutes) * time.Minute)
+					if breakEnd.After(windowEnd) {
+						break
+					}
+					breaks[dayIndex] = append(breaks[dayIndex], Block{
+						Start:  cursor,
+						End:    breakEnd,
+						Type:   BlockTypeBreak,
+						Period: period,
+						Notes:  "短休息，补水、伸展",
+					})
+					cursor = breakEnd
+				}
+			}
+		}
+
+		sort.Slice(dayIntervals, func(i, j int) bool {
+			return dayIntervals[i].start.Before(dayIntervals[j].start)
+		})
+		intervals = append(intervals, dayIntervals...)
+	}
+	return intervals, breaks
+}
+
+// orderTasks 按截止时间、优先级排序，并保证依赖任务排在被依赖任务之后
+func orderTasks(tasks []TaskInput, now time.Time) []*pendingTask {
+	pending := make([]*pendingTask, 0, len(tasks))
+	byID := make(map[uint64]*pendingTask, len(tasks))
+	for _, t := range tasks {
+		remaining := remainingMinutes(t)
+		if remaining <= 0 {
+			continue
+		}
+		p := &pendingTask{input: t, remaining: remaining}
+		pending = append(pending, p)
+		if t.ID != 0 {
+			byID[t.ID] = p
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return urgencyLess(pending[i].input, pending[j].input, now)
+	})
+	for idx, p := range pending {
+		p.rank = idx
+	}
+
+	placed := make(map[uint64]bool, len(pending))
+	result := make([]*pendingTask, 0, len(pending))
+	used := make([]bool, len(pending))
+	for len(result) < len(pending) {
+		pick := -1
+		for idx, p := range pending {
+			if used[idx] {
+				continue
+			}
+			if dependenciesPlaced(p.input, byID, placed) {
+				pick = idx
+				break
+			}
+		}
+		if pick == -1 {
+			// 存在循环依赖时按原排序打破循环
+			for idx := range pending {
+				if !used[idx] {
+					pick = idx
+					break
+				}
+			}
+		}
+		used[pick] = true
+		placed[pending[pick].input.ID] = true
+		result = append(result, pending[pick])
+	}
+	return result
+}
+
+func dependenciesPlaced(task TaskInput, byID map[uint64]*pendingTask, placed map[uint64]bool) bool {
+	for _, dep := range task.DependsOn {
+		if _, open := byID[dep]; !open {
+			continue
+		}
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+func urgencyLess(a, b TaskInput, now time.Time) bool {
+	ua, ub := dueUrgency(a.DueAt, now), dueUrgency(b.DueAt, now)
+	if ua != ub {
+		return ua < ub
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.DueAt != nil && b.DueAt != nil && !a.DueAt.Equal(*b.DueAt) {
+		return a.DueAt.Before(*b.DueAt)
+	}
+	return a.ID < b.ID
+}
+
+// dueUrgency 将截止时间分档：已逾期/24小时内/3天内/7天内/更晚/无截止
+func dueUrgency(dueAt *time.Time, now time.Time) int {
+	if dueAt == nil {
+		return 5
+	}
+	hours := dueAt.Sub(now).Hours()
+	switch {
+	case hours < 0:
+		return 0
+	case hours <= 24:
+		return 1
+	case hours <= 72:
+		return 2
+	case hours <= 168:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func remainingMinutes(t TaskInput) int {
+	estimate := t.EstimateMinutes
+	if estimate <= 0 {
+		estimate = defaultTaskMinutes
+	}
+	progress := t.Progress
+	if progress < 0 {
+		progress = 0
+	}
+	if progress >= 100 {
+		return 0
+	}
+	remaining := int(math.Ceil(float64(estimate) * float64(100-progress) / 100))
+	if remaining < minTaskMinutes {
+		remaining = minTaskMinutes
+	}
+	return remaining
+}
+
+// mergeBreaks 只保留位于两个学习块之间的休息块，并按时间排序
+func mergeBreaks(studyBlocks []Block, breaks []Block) []Block {
+	if len(studyBlocks) == 0 {
+		return studyBlocks
+	}
+	result := make([]Block, 0, len(studyBlocks)+len(breaks))
+	result = append(result, studyBlocks...)
+	last := studyBlocks[len(studyBlocks)-1].End
+	for _, b := range breaks {
+		if b.End.After(last) {
+			continue
+		}
+		result = append(result, b)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func alignUp(t time.Time) time.Time {
+	truncated := t.Truncate(slotAlignMinutes * time.Minute)
+	if truncated.Before(t) {
+		truncated = truncated.Add(slotAlignMinutes * time.Minute)
+	}
+	return truncated
+}
@@ -0,0 +1,154 @@
+package planner
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+	if err != nil {
+		t.Fatalf("parse time %q: %v", value, err)
+	}
+	return parsed
+}
+
+func studyBlocks(day DayPlan) []Block {
+	blocks := make([]Block, 0, len(day.Blocks))
+	for _, b := range day.Blocks {
+		if b.Type == BlockTypeStudy {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+func taskOrder(day DayPlan) []uint64 {
+	order := make([]uint64, 0)
+	for _, b := range studyBlocks(day) {
+		if len(order) > 0 && order[len(order)-1] == b.TaskID {
+			continue
+		}
+		order = append(order, b.TaskID)
+	}
+	return order
+}
+
+func TestBuildRespectsDailyGoalAndPreferredPeriod(t *testing.T) {
+	now := mustTime(t, "2025-03-03 07:00")
+	tasks := []TaskInput{{ID: 1, Title: "线代复习", EstimateMinutes: 300}}
+
+	plan := Build(tasks, Options{Now: now, DailyGoalMinutes: 90, PreferredPeriod: "evening"})
+
+	if len(plan.Days) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(plan.Days))
+	}
+	if plan.Days[0].PlannedMinutes != 90 {
+		t.Fatalf("expected 90 planned minutes, got %d", plan.Days[0].PlannedMinutes)
+	}
+	blocks := studyBlocks(plan.Days[0])
+	if len(blocks) == 0 || blocks[0].Period != PeriodEvening {
+		t.Fatalf("expected first study block in evening, got %+v", blocks)
+	}
+	if !blocks[0].Start.Equal(mustTime(t, "2025-03-03 19:00")) {
+		t.Fatalf("unexpected first block start %v", blocks[0].Start)
+	}
+	if len(plan.Unscheduled) != 1 || plan.Unscheduled[0].RemainingMinutes != 210 {
+		t.Fatalf("expected remaining 210 minutes unscheduled, got %+v", plan.Unscheduled)
+	}
+}
+
+func TestBuildOrdersByDueDateThenPriority(t *testing.T) {
+	now := mustTime(t, "2025-03-03 07:00")
+	soon := mustTime(t, "2025-03-03 20:00")
+	later := mustTime(t, "2025-03-10 20:00")
+	tasks := []TaskInput{
+		{ID: 1, Title: "低优先级无截止", Priority: 0, EstimateMinutes: 30},
+		{ID: 2, Title: "高优先级下周", Priority: 3, DueAt: &later, EstimateMinutes: 30},
+		{ID: 3, Title: "今天截止", Priority: 1, DueAt: &soon, EstimateMinutes: 30},
+		{ID: 4, Title: "高优先级无截止", Priority: 3, EstimateMinutes: 30},
+	}
+
+	plan := Build(tasks, Options{Now: now, DailyGoalMinutes: 120, PreferredPeriod: "morning"})
+
+	got := taskOrder(plan.Days[0])
+	want := []uint64{3, 2, 4, 1}
+	if len(got) != len(want) {
+		t.Fatalf("expected order %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected order %v, got %v", want, got)
+		}
+	}
+}
+
+func TestBuildSchedulesDependenciesFirst(t *testing.T) {
+	now := mustTime(t, "2025-03-03 07:00")
+	due := mustTime(t, "2025-03-04 12:00")
+	tasks := []TaskInput{
+		{ID: 10, Title: "期末报告", Priority: 3, DueAt: &due, EstimateMinutes: 30, DependsOn: []uint64{11}},
+		{ID: 11, Title: "收集资料", Priority: 0, EstimateMinutes: 30},
+	}
+
+	plan := Build(tasks, Options{Now: now, DailyGoalMinutes: 60, PreferredPeriod: "morning"})
+
+	got := taskOrder(plan.Days[0])
+	if len(got) != 2 || got[0] != 11 || got[1] != 10 {
+		t.Fatalf("expected dependency 11 before 10, got %v", got)
+	}
+}
+
+func TestBuildSkipsPastWindowsAndWarnsOnLateTasks(t *testing.T) {
+	now := mustTime(t, "2025-03-03 21:10")
+	due := mustTime(t, "2025-03-03 21:30")
+	tasks := []TaskInput{{ID: 1, Title: "作业", EstimateMinutes: 60, DueAt: &due}}
+
+	plan := Build(tasks, Options{Now: now, DailyGoalMinutes: 60, PreferredPeriod: "morning", FocusMinutes: 30, BreakMinutes: 5})
+
+	blocks := studyBlocks(plan.Days[0])
+	if len(blocks) == 0 {
+		t.Fatalf("expected study blocks, got none")
+	}
+	if blocks[0].Start.Before(now) {
+		t.Fatalf("block scheduled in the past: %v", blocks[0].Start)
+	}
+	if len(plan.Warnings) != 1 {
+		t.Fatalf("expected one late warning, got %v", plan.Warnings)
+	}
+}
+
+func TestBuildWeekSpreadsAcrossDays(t *testing.T) {
+	now := mustTime(t, "2025-03-03 07:00")
+	tasks := []TaskInput{{ID: 1, Title: "长任务", EstimateMinutes: 200}}
+
+	plan := Build(tasks, Options{Now: now, Days: 7, DailyGoalMinutes: 60, PreferredPeriod: "afternoon"})
+
+	if len(plan.Days) != 7 {
+		t.Fatalf("expected 7 days, got %d", len(plan.Days))
+	}
+	total := 0
+	for _, day := range plan.Days {
+		if day.PlannedMinutes > 60 {
+			t.Fatalf("day %s exceeds goal: %d", day.Date, day.PlannedMinutes)
+		}
+		total += day.PlannedMinutes
+	}
+	if total != 200 {
+		t.Fatalf("expected 200 minutes scheduled, got %d", total)
+	}
+	if len(plan.Unscheduled) != 0 {
+		t.Fatalf("expected nothing unscheduled, got %+v", plan.Unscheduled)
+	}
+}
+
+func TestRankPeriodsUsesHistoryAfterPreference(t *testing.T) {
+	order := rankPeriods("night", map[Period]float64{PeriodMorning: 300, PeriodAfternoon: 20, PeriodEvening: 100})
+	want := []Period{PeriodNight, PeriodMorning, PeriodEvening, PeriodAfternoon}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+}
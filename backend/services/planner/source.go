@@ -0,0 +1,121 @@
+package planner
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+const (
+	taskStatusCompleted = 2
+	historyLookbackDays = 28
+)
+
+// UserContext 排程所需的用户数据
+type UserContext struct {
+	Tasks            []TaskInput
+	DailyGoalMinutes int
+	PreferredPeriod  string
+	PeriodWeights    map[Period]float64
+}
+
+// LoadUserContext 读取用户未完成任务、学习设置与近 28 天各时段学习分布
+func LoadUserContext(userID uint64, now time.Time) (*UserContext, error) {
+	db := database.GetDB()
+
+	ctx := &UserContext{
+		DailyGoalMinutes: defaultDailyGoalMinutes,
+		PreferredPeriod:  string(PeriodEvening),
+		PeriodWeights:    map[Period]float64{},
+	}
+
+	var setting models.UserSetting
+	if err := db.Where("user_id = ?", userID).First(&setting).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	} else {
+		if setting.DailyGoalMinutes > 0 {
+			ctx.DailyGoalMinutes = setting.DailyGoalMinutes
+		}
+		if setting.PreferredPeriod != "" {
+			ctx.PreferredPeriod = setting.PreferredPeriod
+		}
+	}
+
+	tasks, err := loadOpenTasks(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Tasks = tasks
+
+	weights, err := loadPeriodWeights(db, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	ctx.PeriodWeights = weights
+	return ctx, nil
+}
+
+func loadOpenTasks(db *gorm.DB, userID uint64) ([]TaskInput, error) {
+	var tasks []models.Task
+	if err := db.Where("status <> ?", taskStatusCompleted).
+		Where("owner_user_id = ? OR created_by = ? OR id IN (SELECT task_id FROM task_assignees WHERE user_id = ? AND deleted_at IS NULL)",
+			userID, userID, userID).
+		Order("id ASC").
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	// 子任务未完成时，父任务依赖子任务
+	children := make(map[uint64][]uint64)
+	for _, t := range tasks {
+		if t.ParentID != nil {
+			children[*t.ParentID] = append(children[*t.ParentID], t.ID)
+		}
+	}
+
+	inputs := make([]TaskInput, 0, len(tasks))
+	for _, t := range tasks {
+		estimate := 0
+		if t.EstimateMinutes != nil {
+			estimate = *t.EstimateMinutes
+		}
+		inputs = append(inputs, TaskInput{
+			ID:              t.ID,
+			Title:           t.Title,
+			Priority:        t.Priority,
+			DueAt:           t.DueAt,
+			EstimateMinutes: estimate,
+			Progress:        int(t.Progress),
+			DependsOn:       children[t.ID],
+		})
+	}
+	return inputs, nil
+}
+
+// loadPeriodWeights 用早间/夜间分钟数估算各时段的历史产出，其余时长平分到下午和晚上
+func loadPeriodWeights(db *gorm.DB, userID uint64, now time.Time) (map[Period]float64, error) {
+	from := startOfDay(now).AddDate(0, 0, -historyLookbackDays)
+	var stats []models.DailyStudyStat
+	if err := db.Where("user_id = ? AND date >= ?", userID, from).Find(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	weights := map[Period]float64{}
+	for _, stat := range stats {
+		rest := stat.Minutes - stat.MorningMinutes - stat.NightMinutes
+		if rest < 0 {
+			rest = 0
+		}
+		weights[PeriodMorning] += float64(stat.MorningMinutes)
+		weights[PeriodNight] += float64(stat.NightMinutes)
+		weights[PeriodAfternoon] += float64(rest) / 2
+		weights[PeriodEvening] += float64(rest) / 2
+	}
+	return weights, nil
+}
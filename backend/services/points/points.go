@@ -3,94 +3,281 @@ package points
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
-)
-
-const (
-	taskCompletionReward      = 20
-	checkInReward             = 2
-	studyRoomRewardPerWindow  = 10
-	studyRoomRewardWindowMins = 30
+	"learningAssistant-backend/services/events"
+	"learningAssistant-backend/services/milestone"
 )
 
 var (
 	ErrInsufficientDuration = errors.New("insufficient_studyroom_duration")
 	ErrInvalidPointsDelta   = errors.New("invalid_points_delta")
+	// ErrInsufficientPoints 积分余额不足以完成消费
+	ErrInsufficientPoints = errors.New("insufficient_points")
+	// ErrAlreadyAwarded 该来源已发放过积分且未被冲正
+	ErrAlreadyAwarded = errors.New("points_already_awarded")
 )
 
 // AwardResult 封装积分发放结果
 type AwardResult struct {
 	Ledger  *models.PointsLedger
 	Profile *models.UserProfile
+	// PreviousLevel 入账前的等级，用于判断是否升级
+	PreviousLevel int
+}
+
+// PublishAward 在事务提交后发布 points_awarded 事件，跨过等级门槛时同时发布 level_up 事件，用于实时推送。
+// 在调用方事务中入账的函数（如 AwardDailyCheckInTx）需由调用方在提交后调用
+func PublishAward(res *AwardResult) {
+	if res == nil || res.Ledger == nil || res.Ledger.Delta <= 0 {
+		return
+	}
+	evts := []events.Event{{
+		Type:   events.TypePointsAwarded,
+		UserID: res.Ledger.UserID,
+		Data: events.PointsAwarded{
+			LedgerID:    res.Ledger.ID,
+			SourceType:  int8(res.Ledger.SourceType),
+			Delta:       res.Ledger.Delta,
+			TotalPoints: res.Profile.TotalPoints,
+			Remark:      res.Ledger.Remark,
+		},
+	}}
+	if res.Profile.Level > res.PreviousLevel {
+		evts = append(evts, levelUpEvent(res.Ledger.UserID, res.PreviousLevel, res.Profile))
+	}
+	events.Publish(evts...)
+}
+
+func levelUpEvent(userID uint64, previousLevel int, profile *models.UserProfile) events.Event {
+	return events.Event{
+		Type:   events.TypeLevelUp,
+		UserID: userID,
+		Data: events.LevelUp{
+			FromLevel:       previousLevel,
+			ToLevel:         profile.Level,
+			TotalPoints:     profile.TotalPoints,
+			NextLevelPoints: profile.NextLevelPoints,
+		},
+	}
+}
+
+// grant 一次积分发放请求，Key 为幂等键
+type grant struct {
+	UserID   uint64
+	Source   models.PointsSourceType
+	SourceID *uint64
+	Key      string
+	Remark   string
+	Input    rewardInput
 }
 
-// AwardTaskCompletion 任务完成加分
+// AwardTaskCompletion 任务完成加分，按优先级与工作量加成。
+// 同一任务在未被冲正前只发放一次，冲正后再次完成可重新获得
 func AwardTaskCompletion(userID uint64, taskID uint64) (*AwardResult, error) {
 	// 使用事务确保积分和统计数据的一致性
 	var result *AwardResult
 	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
-		// 1. 发放积分
-		res, err := applyPointsWithTx(tx, userID, models.PointsSourceTaskCompletion, &taskID, taskCompletionReward, fmt.Sprintf("完成任务 #%d", taskID))
+		var task models.Task
+		if err := tx.Select("id", "priority", "effort_points").First(&task, taskID).Error; err != nil {
+			return err
+		}
+		if _, err := loadOrCreateProfile(tx, userID); err != nil {
+			return err
+		}
+		active, err := activeTaskAward(tx, taskID)
 		if err != nil {
 			return err
 		}
-		result = res
-
-		// 2. 更新 UserProfile 统计
-		if err := tx.Model(&models.UserProfile{}).Where("user_id = ?", userID).
-			Updates(map[string]interface{}{
-				"tasks_completed": gorm.Expr("tasks_completed + ?", 1),
-			}).Error; err != nil {
+		if active != nil {
+			return ErrAlreadyAwarded
+		}
+		var reversals int64
+		if err := tx.Model(&models.PointsLedger{}).
+			Where("source_type = ? AND source_id = ? AND reversal_of IS NOT NULL", models.PointsSourceTaskCompletion, taskID).
+			Count(&reversals).Error; err != nil {
 			return err
 		}
 
-		// 3. 更新 UserAchievementProgress 统计
-		// 先尝试查找，如果不存在则创建
-		var progress models.UserAchievementProgress
-		if err := tx.Where("user_id = ?", userID).First(&progress).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				progress = models.UserAchievementProgress{UserID: userID, TaskCompletedCount: 1}
-				if err := tx.Create(&progress).Error; err != nil {
-					return err
-				}
-			} else {
-				return err
-			}
-		} else {
-			if err := tx.Model(&progress).Update("task_completed_count", gorm.Expr("task_completed_count + ?", 1)).Error; err != nil {
-				return err
-			}
+		// 1. 发放积分
+		res, err := grantWithTx(tx, grant{
+			UserID:   userID,
+			Source:   models.PointsSourceTaskCompletion,
+			SourceID: &taskID,
+			Key:      fmt.Sprintf("task_completion:%d:%d", taskID, reversals),
+			Remark:   fmt.Sprintf("完成任务 #%d", taskID),
+			Input:    rewardInput{Priority: int(task.Priority), EffortPoints: task.EffortPoints},
+		}, time.Now())
+		if err != nil {
+			return err
 		}
+		result = res
 
-		return nil
+		// 2. 更新 UserProfile 与 UserAchievementProgress 统计
+		return adjustTaskCompletedCounters(tx, userID, 1)
 	})
+	if err == nil {
+		PublishAward(result)
+	}
 
 	return result, err
 }
 
-// AwardStudyRoomDuration 自习室在线时长加分，按 30 分钟一档
-func AwardStudyRoomDuration(userID uint64, roomID *uint64, durationMinutes int) (*AwardResult, error) {
+// ReverseTaskCompletion 任务被取消完成或删除时，冲正该任务尚未冲正的完成积分并回退完成计数。
+// 没有可冲正的记录时返回 nil, nil
+func ReverseTaskCompletion(taskID uint64, reason string) (*AwardResult, error) {
+	var result *AwardResult
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		award, err := activeTaskAward(tx, taskID)
+		if err != nil || award == nil {
+			return err
+		}
+		if _, err := loadOrCreateProfile(tx, award.UserID); err != nil {
+			return err
+		}
+		// 加锁后重新确认，避免并发冲正
+		if award, err = activeTaskAward(tx, taskID); err != nil || award == nil {
+			return err
+		}
+		key := fmt.Sprintf("reversal:%d", award.ID)
+		if award.IdempotencyKey != nil {
+			key = *award.IdempotencyKey + ":reversal"
+		}
+		res, err := applyLedgerWithTx(tx, award.UserID, award.SourceType, award.SourceID, -award.Delta,
+			fmt.Sprintf("%s，扣回任务 #%d 积分", reason, taskID), &key, &award.ID)
+		if err != nil {
+			return err
+		}
+		result = res
+		return adjustTaskCompletedCounters(tx, award.UserID, -1)
+	})
+	return result, err
+}
+
+// activeTaskAward 任务最近一次尚未冲正的完成积分记录
+func activeTaskAward(tx *gorm.DB, taskID uint64) (*models.PointsLedger, error) {
+	var award models.PointsLedger
+	err := tx.Where("source_type = ? AND source_id = ? AND reversal_of IS NULL AND delta >= 0", models.PointsSourceTaskCompletion, taskID).
+		Where("id NOT IN (?)", tx.Model(&models.PointsLedger{}).Select("reversal_of").Where("reversal_of IS NOT NULL")).
+		Order("id DESC").
+		First(&award).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &award, nil
+}
+
+// adjustTaskCompletedCounters 调整档案与成就进度中的完成任务数，不低于 0
+func adjustTaskCompletedCounters(tx *gorm.DB, userID uint64, delta int) error {
+	if err := tx.Model(&models.UserProfile{}).Where("user_id = ?", userID).
+		Update("tasks_completed", gorm.Expr("CASE WHEN tasks_completed + ? < 0 THEN 0 ELSE tasks_completed + ? END", delta, delta)).Error; err != nil {
+		return err
+	}
+
+	// 先尝试查找，如果不存在则创建
+	var progress models.UserAchievementProgress
+	if err := tx.Where("user_id = ?", userID).First(&progress).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if delta <= 0 {
+			return nil
+		}
+		progress = models.UserAchievementProgress{UserID: userID, TaskCompletedCount: delta}
+		return tx.Create(&progress).Error
+	}
+	return tx.Model(&progress).
+		Update("task_completed_count", gorm.Expr("CASE WHEN task_completed_count + ? < 0 THEN 0 ELSE task_completed_count + ? END", delta, delta)).Error
+}
+
+// AwardStudyRoomDuration 自习室学习会话结束后按时长加分，同一会话只发放一次
+func AwardStudyRoomDuration(userID uint64, sessionID uint64, roomID *uint64, durationMinutes int) (*AwardResult, error) {
 	if durationMinutes <= 0 {
 		return nil, fmt.Errorf("%w: durationMinutes 必须大于 0", ErrInsufficientDuration)
 	}
-	blocks := durationMinutes / studyRoomRewardWindowMins
-	if blocks <= 0 {
-		return nil, fmt.Errorf("%w: 在线时长不足 %d 分钟，未产生积分", ErrInsufficientDuration, studyRoomRewardWindowMins)
+	var result *AwardResult
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		rule, err := LoadRule(tx, models.PointsSourceStudyRoom)
+		if err != nil {
+			return err
+		}
+		if rule.UnitMinutes > 0 && durationMinutes < rule.UnitMinutes {
+			return fmt.Errorf("%w: 在线时长不足 %d 分钟，未产生积分", ErrInsufficientDuration, rule.UnitMinutes)
+		}
+		if _, err := loadOrCreateProfile(tx, userID); err != nil {
+			return err
+		}
+		remark := fmt.Sprintf("自习室在线 %d 分钟", durationMinutes)
+		if rule.UnitMinutes > 0 {
+			remark = fmt.Sprintf("自习室在线 %d 分钟", durationMinutes/rule.UnitMinutes*rule.UnitMinutes)
+		}
+		res, err := grantWithTx(tx, grant{
+			UserID:   userID,
+			Source:   models.PointsSourceStudyRoom,
+			SourceID: roomID,
+			Key:      fmt.Sprintf("study_room:session:%d", sessionID),
+			Remark:   remark,
+			Input:    rewardInput{Units: durationMinutes},
+		}, time.Now())
+		result = res
+		return err
+	})
+	if err == nil {
+		PublishAward(result)
 	}
+	return result, err
+}
 
-	points := blocks * studyRoomRewardPerWindow
-	remark := fmt.Sprintf("自习室在线 %d 分钟", blocks*studyRoomRewardWindowMins)
-	return applyPoints(userID, models.PointsSourceStudyRoom, roomID, points, remark)
+// AwardDailyCheckInTx 在调用方事务中发放签到积分，便于与签到去重校验保持原子性。
+// previousCheckInID 为上一次签到的账本记录 ID（首次签到为 0），作为幂等键防止并发重复签到
+func AwardDailyCheckInTx(tx *gorm.DB, userID uint64, streakDays int, previousCheckInID uint64) (*AwardResult, error) {
+	return grantWithTx(tx, grant{
+		UserID: userID,
+		Source: models.PointsSourceDailyCheckIn,
+		Key:    fmt.Sprintf("daily_check_in:%d:after:%d", userID, previousCheckInID),
+		Remark: "每日签到",
+		Input:  rewardInput{StreakDays: streakDays},
+	}, time.Now())
 }
 
-// AwardDailyCheckIn 签到加分
-func AwardDailyCheckIn(userID uint64) (*AwardResult, error) {
-	return applyPoints(userID, models.PointsSourceDailyCheckIn, nil, checkInReward, "每日签到")
+// grantWithTx 按规则计算积分并入账：幂等键已存在时返回 ErrAlreadyAwarded，
+// 规则停用或超出每日上限的部分不发放（仍记录一条 0 分记录，签到等依赖账本判重的来源照常生效，额度恢复后也不会补发）
+func grantWithTx(tx *gorm.DB, g grant, now time.Time) (*AwardResult, error) {
+	var existing int64
+	if err := tx.Model(&models.PointsLedger{}).Where("idempotency_key = ?", g.Key).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyAwarded
+	}
+	rule, err := LoadRule(tx, g.Source)
+	if err != nil {
+		return nil, err
+	}
+	delta := computeReward(rule, g.Input)
+	if delta < 0 {
+		return nil, fmt.Errorf("%w: 积分变动不能为负", ErrInvalidPointsDelta)
+	}
+	remaining, err := remainingDailyCap(tx, rule, g.UserID, now)
+	if err != nil {
+		return nil, err
+	}
+	remark := g.Remark
+	if !rule.Enabled {
+		remark += "（规则已停用）"
+	} else if remaining >= 0 && delta > remaining {
+		delta = remaining
+		remark += "（已达今日上限）"
+	}
+	return applyLedgerWithTx(tx, g.UserID, g.Source, g.SourceID, delta, remark, &g.Key, nil)
 }
 
 // ListLedger 获取积分账本记录
@@ -109,12 +296,73 @@ func ListLedger(userID uint64, limit int) ([]models.PointsLedger, error) {
 	return records, nil
 }
 
-// applyPointsWithTx 支持传入事务的积分应用函数
-func applyPointsWithTx(tx *gorm.DB, userID uint64, sourceType models.PointsSourceType, sourceID *uint64, delta int, remark string) (*AwardResult, error) {
-	if delta <= 0 {
-		return nil, fmt.Errorf("%w: 积分变动必须大于 0", ErrInvalidPointsDelta)
+// SpendWithTx 在调用方事务中扣除积分（如兑换奖励），余额不足时返回 ErrInsufficientPoints。
+// 档案行加锁后再校验余额，并发消费不会透支
+func SpendWithTx(tx *gorm.DB, userID uint64, sourceType models.PointsSourceType, sourceID *uint64, amount int, remark, key string) (*AwardResult, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: 消费积分必须大于 0", ErrInvalidPointsDelta)
+	}
+	profile, err := loadOrCreateProfile(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.TotalPoints < amount {
+		return nil, ErrInsufficientPoints
+	}
+	var existing int64
+	if err := tx.Model(&models.PointsLedger{}).Where("idempotency_key = ?", key).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyAwarded
+	}
+	return applyLedgerWithTx(tx, userID, sourceType, sourceID, -amount, remark, &key, nil)
+}
+
+// AwardBonusWithTx 在调用方事务中发放固定数额的奖励积分（如团队挑战奖励），不受积分规则约束，
+// 幂等键已存在时返回 ErrAlreadyAwarded
+func AwardBonusWithTx(tx *gorm.DB, userID uint64, sourceType models.PointsSourceType, sourceID *uint64, amount int, remark, key string) (*AwardResult, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: 奖励积分必须大于 0", ErrInvalidPointsDelta)
+	}
+	var existing int64
+	if err := tx.Model(&models.PointsLedger{}).Where("idempotency_key = ?", key).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyAwarded
+	}
+	return applyLedgerWithTx(tx, userID, sourceType, sourceID, amount, remark, &key, nil)
+}
+
+// RefundWithTx 在调用方事务中全额退回一笔消费，退款记录指向原扣分记录，重复退款返回 ErrAlreadyAwarded
+func RefundWithTx(tx *gorm.DB, debitLedgerID uint64, remark string) (*AwardResult, error) {
+	var debit models.PointsLedger
+	if err := tx.First(&debit, debitLedgerID).Error; err != nil {
+		return nil, err
+	}
+	if debit.Delta >= 0 || debit.ReversalOf != nil {
+		return nil, fmt.Errorf("%w: 只能退回消费记录", ErrInvalidPointsDelta)
+	}
+	if _, err := loadOrCreateProfile(tx, debit.UserID); err != nil {
+		return nil, err
+	}
+	var refunded int64
+	if err := tx.Model(&models.PointsLedger{}).Where("reversal_of = ?", debit.ID).Count(&refunded).Error; err != nil {
+		return nil, err
+	}
+	if refunded > 0 {
+		return nil, ErrAlreadyAwarded
 	}
+	key := fmt.Sprintf("refund:%d", debit.ID)
+	if debit.IdempotencyKey != nil {
+		key = *debit.IdempotencyKey + ":refund"
+	}
+	return applyLedgerWithTx(tx, debit.UserID, debit.SourceType, debit.SourceID, -debit.Delta, remark, &key, &debit.ID)
+}
 
+// applyLedgerWithTx 写入账本并更新档案积分与等级，delta 的正负由调用方保证
+func applyLedgerWithTx(tx *gorm.DB, userID uint64, sourceType models.PointsSourceType, sourceID *uint64, delta int, remark string, key *string, reversalOf *uint64) (*AwardResult, error) {
 	var ledger models.PointsLedger
 	var profile models.UserProfile
 
@@ -131,6 +379,7 @@ func applyPointsWithTx(tx *gorm.DB, userID uint64, sourceType models.PointsSourc
 		return nil, err
 	}
 
+	previousLevel := profile.Level
 	profile.TotalPoints = newTotal
 	profile.Level = level
 	profile.NextLevelPoints = nextLevel
@@ -140,34 +389,38 @@ func applyPointsWithTx(tx *gorm.DB, userID uint64, sourceType models.PointsSourc
 	}
 
 	ledger = models.PointsLedger{
-		UserID:       userID,
-		SourceType:   sourceType,
-		SourceID:     sourceID,
-		Delta:        delta,
-		BalanceAfter: newTotal,
-		Remark:       remark,
+		UserID:         userID,
+		SourceType:     sourceType,
+		SourceID:       sourceID,
+		Delta:          delta,
+		BalanceAfter:   newTotal,
+		Remark:         truncateRemark(remark),
+		IdempotencyKey: key,
+		ReversalOf:     reversalOf,
 	}
 	if err := tx.Create(&ledger).Error; err != nil {
 		return nil, err
 	}
+	// 升级通知与入账在同一事务中写入，PublishAward 只负责实时推送
+	if level > previousLevel {
+		if err := milestone.Record(tx, levelUpEvent(userID, previousLevel, &profile)); err != nil {
+			return nil, err
+		}
+	}
 
 	return &AwardResult{
-		Ledger:  &ledger,
-		Profile: &profile,
+		Ledger:        &ledger,
+		Profile:       &profile,
+		PreviousLevel: previousLevel,
 	}, nil
 }
 
-func applyPoints(userID uint64, sourceType models.PointsSourceType, sourceID *uint64, delta int, remark string) (*AwardResult, error) {
-	var result *AwardResult
-	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
-		res, err := applyPointsWithTx(tx, userID, sourceType, sourceID, delta, remark)
-		if err != nil {
-			return err
-		}
-		result = res
-		return nil
-	})
-	return result, err
+func truncateRemark(remark string) string {
+	runes := []rune(remark)
+	if len(runes) > 256 {
+		return string(runes[:256])
+	}
+	return remark
 }
 
 func loadOrCreateProfile(tx *gorm.DB, userID uint64) (models.UserProfile, error) {
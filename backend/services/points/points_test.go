@@ -0,0 +1,154 @@
+package points
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestTaskCompletionRewardIsIdempotentAndReversible(t *testing.T) {
+	db := testdb.Open(t)
+	task := models.Task{Title: "t", CreatedBy: 1, Priority: 2, EffortPoints: 3}
+	db.Create(&task)
+
+	res, err := AwardTaskCompletion(1, task.ID)
+	if err != nil {
+		t.Fatalf("award: %v", err)
+	}
+	// 20 * (1 + 2*25%) + 3*2
+	if res.Ledger.Delta != 36 || res.Profile.TotalPoints != 36 {
+		t.Fatalf("unexpected reward %+v", res.Ledger)
+	}
+	if _, err := AwardTaskCompletion(1, task.ID); !errors.Is(err, ErrAlreadyAwarded) {
+		t.Fatalf("expected duplicate award to be rejected, got %v", err)
+	}
+
+	rev, err := ReverseTaskCompletion(task.ID, "任务取消完成")
+	if err != nil || rev == nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if rev.Ledger.Delta != -36 || rev.Profile.TotalPoints != 0 || rev.Ledger.ReversalOf == nil || *rev.Ledger.ReversalOf != res.Ledger.ID {
+		t.Fatalf("unexpected reversal %+v", rev.Ledger)
+	}
+	if again, err := ReverseTaskCompletion(task.ID, "任务已删除"); err != nil || again != nil {
+		t.Fatalf("second reversal must be a no-op, got %+v %v", again, err)
+	}
+
+	if _, err := AwardTaskCompletion(1, task.ID); err != nil {
+		t.Fatalf("re-award after reversal: %v", err)
+	}
+	var progress models.UserAchievementProgress
+	db.Where("user_id = ?", 1).First(&progress)
+	if progress.TaskCompletedCount != 1 {
+		t.Fatalf("expected completed count to follow reversals, got %d", progress.TaskCompletedCount)
+	}
+}
+
+func TestDailyCapAndRuleOverride(t *testing.T) {
+	db := testdb.Open(t)
+	if _, err := SaveRule(models.PointsRule{SourceType: models.PointsSourceStudyRoom, Enabled: true, BasePoints: 10, UnitMinutes: 30, DailyCap: 25}); err != nil {
+		t.Fatalf("save rule: %v", err)
+	}
+	first, err := AwardStudyRoomDuration(1, 1, nil, 60)
+	if err != nil || first.Ledger.Delta != 20 {
+		t.Fatalf("expected 20 points, got %+v %v", first, err)
+	}
+	second, err := AwardStudyRoomDuration(1, 2, nil, 60)
+	if err != nil || second.Ledger.Delta != 5 || !strings.Contains(second.Ledger.Remark, "上限") {
+		t.Fatalf("expected award capped to 5, got %+v %v", second, err)
+	}
+	if _, err := AwardStudyRoomDuration(1, 2, nil, 60); !errors.Is(err, ErrAlreadyAwarded) {
+		t.Fatalf("expected same session to pay once, got %v", err)
+	}
+	if _, err := AwardStudyRoomDuration(1, 3, nil, 20); !errors.Is(err, ErrInsufficientDuration) {
+		t.Fatalf("expected insufficient duration, got %v", err)
+	}
+
+	if _, err := SaveRule(models.PointsRule{SourceType: models.PointsSourceDailyCheckIn, Enabled: false}); err != nil {
+		t.Fatalf("disable rule: %v", err)
+	}
+	rule, _ := LoadRule(db, models.PointsSourceDailyCheckIn)
+	if rule.Enabled {
+		t.Fatalf("expected rule to be disabled")
+	}
+	res, err := AwardDailyCheckInTx(db, 1, 3, 0)
+	if err != nil || res.Ledger.Delta != 0 {
+		t.Fatalf("disabled rule must record a zero entry, got %+v %v", res, err)
+	}
+	if _, err := SaveRule(models.PointsRule{SourceType: 9}); !errors.Is(err, ErrInvalidRule) {
+		t.Fatalf("expected unknown source to be rejected, got %v", err)
+	}
+}
+
+func TestCheckInStreakBonus(t *testing.T) {
+	rule := defaultRules[models.PointsSourceDailyCheckIn]
+	if got := computeReward(rule, rewardInput{StreakDays: 5}); got != 3 {
+		t.Fatalf("expected 2 * 150%% = 3, got %d", got)
+	}
+	if got := computeReward(rule, rewardInput{StreakDays: 30}); got != 4 {
+		t.Fatalf("expected bonus capped at 100%%, got %d", got)
+	}
+}
+
+func TestLevelUpNotificationsAreWrittenWithTheAward(t *testing.T) {
+	db := testdb.Open(t)
+	db.Create(&models.LevelRule{Level: 1, MinPoints: 0})
+	db.Create(&models.LevelRule{Level: 2, MinPoints: 100})
+	user := models.User{Account: "u", Email: "u@x", Phone: "1", DisplayName: "小明", Status: 1, PasswordHash: "x"}
+	mate := models.User{Account: "m", Email: "m@x", Phone: "2", DisplayName: "小红", Status: 1, PasswordHash: "x"}
+	db.Create(&user)
+	db.Create(&mate)
+	db.Create(&models.TeamMember{TeamID: 1, UserID: user.ID})
+	db.Create(&models.TeamMember{TeamID: 1, UserID: mate.ID})
+
+	// 不订阅事件总线，通知也必须随入账一起落库
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := AwardBonusWithTx(tx, user.ID, models.PointsSourceTeamChallenge, nil, 120, "挑战奖励", "bonus:1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("award: %v", err)
+	}
+	var own, team []models.Notification
+	db.Where("user_id = ? AND type = ?", user.ID, "LEVEL_UP").Find(&own)
+	db.Where("user_id = ? AND type = ?", mate.ID, "TEAM_MILESTONE").Find(&team)
+	if len(own) != 1 || own[0].RelatedID != 2 {
+		t.Fatalf("expected one level-up notification, got %+v", own)
+	}
+	if len(team) != 1 || !strings.Contains(team[0].Content, "小明 升到了 Lv.2") {
+		t.Fatalf("expected one teammate milestone notification, got %+v", team)
+	}
+}
+
+func TestDailyCapIgnoresReversalsOfEarlierDays(t *testing.T) {
+	db := testdb.Open(t)
+	now := time.Now()
+	rule, _ := LoadRule(db, models.PointsSourceTaskCompletion)
+
+	entry := func(delta int, at time.Time, reversalOf *uint64) models.PointsLedger {
+		row := models.PointsLedger{UserID: 1, SourceType: models.PointsSourceTaskCompletion, Delta: delta, ReversalOf: reversalOf}
+		row.CreatedAt = at
+		db.Create(&row)
+		return row
+	}
+	yesterday := entry(150, now.AddDate(0, 0, -1), nil)
+	entry(-150, now, &yesterday.ID)
+	entry(40, now, nil)
+	sameDay := entry(30, now, nil)
+	entry(-30, now, &sameDay.ID)
+
+	// 撤销昨天的发放不释放今天的额度，当天发放当天冲正则互相抵消
+	remaining, err := remainingDailyCap(db, rule, 1, now)
+	if err != nil {
+		t.Fatalf("remaining: %v", err)
+	}
+	if remaining != rule.DailyCap-40 {
+		t.Fatalf("expected %d left today, got %d", rule.DailyCap-40, remaining)
+	}
+}
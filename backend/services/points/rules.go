@@ -0,0 +1,160 @@
+package points
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+var ErrInvalidRule = errors.New("invalid_points_rule")
+
+// defaultRules 未在 points_rules 表中配置时使用的内置规则
+var defaultRules = map[models.PointsSourceType]models.PointsRule{
+	models.PointsSourceTaskCompletion: {
+		SourceType:       models.PointsSourceTaskCompletion,
+		Enabled:          true,
+		BasePoints:       20,
+		DailyCap:         200,
+		PriorityBonusPct: 25,
+		EffortPointRate:  2,
+	},
+	models.PointsSourceStudyRoom: {
+		SourceType:  models.PointsSourceStudyRoom,
+		Enabled:     true,
+		BasePoints:  10,
+		UnitMinutes: 30,
+		DailyCap:    160,
+	},
+	models.PointsSourceDailyCheckIn: {
+		SourceType:        models.PointsSourceDailyCheckIn,
+		Enabled:           true,
+		BasePoints:        2,
+		StreakBonusPct:    10,
+		StreakBonusMaxPct: 100,
+	},
+}
+
+// LoadRule 读取来源的发放规则，未配置时返回内置默认值
+func LoadRule(tx *gorm.DB, source models.PointsSourceType) (models.PointsRule, error) {
+	var rule models.PointsRule
+	err := tx.Where("source_type = ?", source).First(&rule).Error
+	if err == nil {
+		return rule, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return rule, err
+	}
+	if def, ok := defaultRules[source]; ok {
+		return def, nil
+	}
+	return models.PointsRule{SourceType: source}, nil
+}
+
+// ListRules 返回所有来源当前生效的规则
+func ListRules() ([]models.PointsRule, error) {
+	db := database.GetDB()
+	sources := []models.PointsSourceType{models.PointsSourceTaskCompletion, models.PointsSourceStudyRoom, models.PointsSourceDailyCheckIn}
+	rules := make([]models.PointsRule, 0, len(sources))
+	for _, source := range sources {
+		rule, err := LoadRule(db, source)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// SaveRule 新增或覆盖来源的发放规则
+func SaveRule(rule models.PointsRule) (*models.PointsRule, error) {
+	if _, ok := defaultRules[rule.SourceType]; !ok {
+		return nil, fmt.Errorf("%w: unknown source type %d", ErrInvalidRule, rule.SourceType)
+	}
+	if rule.BasePoints < 0 || rule.UnitMinutes < 0 || rule.DailyCap < 0 || rule.PriorityBonusPct < 0 ||
+		rule.EffortPointRate < 0 || rule.StreakBonusPct < 0 || rule.StreakBonusMaxPct < 0 {
+		return nil, fmt.Errorf("%w: values must not be negative", ErrInvalidRule)
+	}
+	rule.ID = 0
+	err := database.GetDB().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "source_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"enabled", "base_points", "unit_minutes", "daily_cap", "priority_bonus_pct",
+			"effort_point_rate", "streak_bonus_pct", "streak_bonus_max_pct", "updated_at",
+		}),
+	}).Create(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	saved, err := LoadRule(database.GetDB(), rule.SourceType)
+	return &saved, err
+}
+
+// rewardInput 计算发放积分所需的来源信息
+type rewardInput struct {
+	Units        int
+	Priority     int
+	EffortPoints int
+	StreakDays   int
+}
+
+// computeReward 按规则计算发放积分：基础分（按单位计）叠加优先级加成与工作量奖励，再乘以连续打卡加成
+func computeReward(rule models.PointsRule, in rewardInput) int {
+	if !rule.Enabled {
+		return 0
+	}
+	units := 1
+	if rule.UnitMinutes > 0 {
+		units = in.Units / rule.UnitMinutes
+	}
+	points := float64(units * rule.BasePoints)
+	if in.Priority > 0 {
+		points *= 1 + float64(in.Priority*rule.PriorityBonusPct)/100
+	}
+	if in.EffortPoints > 0 {
+		points += float64(in.EffortPoints * rule.EffortPointRate)
+	}
+	if bonus := in.StreakDays * rule.StreakBonusPct; bonus > 0 {
+		if rule.StreakBonusMaxPct > 0 && bonus > rule.StreakBonusMaxPct {
+			bonus = rule.StreakBonusMaxPct
+		}
+		points *= 1 + float64(bonus)/100
+	}
+	return int(math.Round(points))
+}
+
+// remainingDailyCap 用户今天（按用户时区）从该来源还能获得的积分；冲正只释放原发放当天的额度，
+// 撤销前几天的发放不会抬高今天的上限。不限时返回 -1
+func remainingDailyCap(tx *gorm.DB, rule models.PointsRule, userID uint64, now time.Time) (int, error) {
+	if rule.DailyCap <= 0 {
+		return -1, nil
+	}
+	start, end := usertime.DayBounds(now, usertime.ForUser(userID))
+	todayAwards := tx.Model(&models.PointsLedger{}).
+		Where("user_id = ? AND source_type = ? AND created_at >= ? AND created_at < ?", userID, rule.SourceType, start, end).
+		Where("delta > 0 AND reversal_of IS NULL")
+	var earned, reversed int64
+	if err := todayAwards.Session(&gorm.Session{}).
+		Select("COALESCE(SUM(delta), 0)").
+		Scan(&earned).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&models.PointsLedger{}).
+		Where("reversal_of IN (?)", todayAwards.Session(&gorm.Session{}).Select("id")).
+		Select("COALESCE(SUM(delta), 0)").
+		Scan(&reversed).Error; err != nil {
+		return 0, err
+	}
+	remaining := rule.DailyCap - int(earned+reversed)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, nil
+}
@@ -0,0 +1,324 @@
+package pomodoro
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+const (
+	defaultWorkMinutes       = 25
+	defaultShortBreakMinutes = 5
+	defaultLongBreakMinutes  = 15
+	defaultLongBreakEvery    = 4
+
+	// 单次推进的最大阶段数，防止长时间未同步时空转
+	maxTransitionsPerAdvance = 64
+)
+
+var (
+	ErrPomodoroNotFound = errors.New("pomodoro_not_found")
+	ErrPomodoroEnded    = errors.New("pomodoro_ended")
+)
+
+// Config 番茄钟节奏配置
+type Config struct {
+	WorkMinutes       int `json:"work_minutes"`
+	ShortBreakMinutes int `json:"short_break_minutes"`
+	LongBreakMinutes  int `json:"long_break_minutes"`
+	LongBreakEvery    int `json:"long_break_every"`
+}
+
+// Transition 一次阶段切换
+type Transition struct {
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	At            time.Time `json:"at"`
+	CreditMinutes int       `json:"credit_minutes"`
+}
+
+// State 番茄钟对外展示的状态
+type State struct {
+	ID                 uint64    `json:"id"`
+	Phase              string    `json:"phase"`
+	PhaseStartedAt     time.Time `json:"phase_started_at"`
+	PhaseEndsAt        time.Time `json:"phase_ends_at"`
+	RemainingSeconds   int       `json:"remaining_seconds"`
+	CompletedPomodoros int       `json:"completed_pomodoros"`
+	FocusMinutes       int       `json:"focus_minutes"`
+	InterruptionCount  int       `json:"interruption_count"`
+	Ended              bool      `json:"ended"`
+	Config             Config    `json:"config"`
+}
+
+// NormalizeConfig 补齐默认值并限制在合理范围内
+func NormalizeConfig(cfg Config) Config {
+	cfg.WorkMinutes = clamp(cfg.WorkMinutes, defaultWorkMinutes, 5, 120)
+	cfg.ShortBreakMinutes = clamp(cfg.ShortBreakMinutes, defaultShortBreakMinutes, 1, 30)
+	cfg.LongBreakMinutes = clamp(cfg.LongBreakMinutes, defaultLongBreakMinutes, 5, 60)
+	cfg.LongBreakEvery = clamp(cfg.LongBreakEvery, defaultLongBreakEvery, 2, 8)
+	return cfg
+}
+
+func clamp(val, def, min, max int) int {
+	if val <= 0 {
+		return def
+	}
+	if val < min {
+		return min
+	}
+	if val > max {
+		return max
+	}
+	return val
+}
+
+// ConfigOf 读取会话上的配置
+func ConfigOf(p *models.PomodoroSession) Config {
+	return NormalizeConfig(Config{
+		WorkMinutes:       p.WorkMinutes,
+		ShortBreakMinutes: p.ShortBreakMinutes,
+		LongBreakMinutes:  p.LongBreakMinutes,
+		LongBreakEvery:    p.LongBreakEvery,
+	})
+}
+
+// PhaseDuration 当前阶段时长
+func PhaseDuration(p *models.PomodoroSession) time.Duration {
+	cfg := ConfigOf(p)
+	switch p.Phase {
+	case models.PomodoroPhaseShortBreak:
+		return time.Duration(cfg.ShortBreakMinutes) * time.Minute
+	case models.PomodoroPhaseLongBreak:
+		return time.Duration(cfg.LongBreakMinutes) * time.Minute
+	default:
+		return time.Duration(cfg.WorkMinutes) * time.Minute
+	}
+}
+
+// PhaseEndsAt 当前阶段结束时间
+func PhaseEndsAt(p *models.PomodoroSession) time.Time {
+	return p.PhaseStartedAt.Add(PhaseDuration(p))
+}
+
+// Advance 将番茄钟推进到 now，返回期间发生的阶段切换；完成的工作阶段计入专注分钟
+func Advance(p *models.PomodoroSession, now time.Time) []Transition {
+	if p.Status == models.PomodoroStatusEnded {
+		return nil
+	}
+	cfg := ConfigOf(p)
+	transitions := make([]Transition, 0)
+	for i := 0; i < maxTransitionsPerAdvance; i++ {
+		end := PhaseEndsAt(p)
+		if now.Before(end) {
+			break
+		}
+		t := Transition{From: p.Phase, At: end}
+		if p.Phase == models.PomodoroPhaseWork {
+			p.CompletedPomodoros++
+			p.FocusMinutes += cfg.WorkMinutes
+			t.CreditMinutes = cfg.WorkMinutes
+			if p.CompletedPomodoros%cfg.LongBreakEvery == 0 {
+				p.Phase = models.PomodoroPhaseLongBreak
+			} else {
+				p.Phase = models.PomodoroPhaseShortBreak
+			}
+		} else {
+			p.Phase = models.PomodoroPhaseWork
+		}
+		p.PhaseStartedAt = end
+		t.To = p.Phase
+		transitions = append(transitions, t)
+	}
+	return transitions
+}
+
+// Snapshot 生成当前状态
+func Snapshot(p *models.PomodoroSession, now time.Time) State {
+	endsAt := PhaseEndsAt(p)
+	remaining := int(endsAt.Sub(now).Seconds())
+	if remaining < 0 || p.Status == models.PomodoroStatusEnded {
+		remaining = 0
+	}
+	return State{
+		ID:                 p.ID,
+		Phase:              p.Phase,
+		PhaseStartedAt:     p.PhaseStartedAt,
+		PhaseEndsAt:        endsAt,
+		RemainingSeconds:   remaining,
+		CompletedPomodoros: p.CompletedPomodoros,
+		FocusMinutes:       p.FocusMinutes,
+		InterruptionCount:  p.InterruptionCount,
+		Ended:              p.Status == models.PomodoroStatusEnded,
+		Config:             ConfigOf(p),
+	}
+}
+
+// Start 创建番茄钟会话，从工作阶段开始计时
+func Start(userID uint64, studySessionID, roomID *uint64, cfg Config, now time.Time) (*models.PomodoroSession, error) {
+	cfg = NormalizeConfig(cfg)
+	session := models.PomodoroSession{
+		UserID:            userID,
+		StudySessionID:    studySessionID,
+		RoomID:            roomID,
+		WorkMinutes:       cfg.WorkMinutes,
+		ShortBreakMinutes: cfg.ShortBreakMinutes,
+		LongBreakMinutes:  cfg.LongBreakMinutes,
+		LongBreakEvery:    cfg.LongBreakEvery,
+		Phase:             models.PomodoroPhaseWork,
+		PhaseStartedAt:    now,
+		Status:            models.PomodoroStatusRunning,
+	}
+	if err := database.GetDB().Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindActiveByStudySession 查找学习会话上仍在运行的番茄钟
+func FindActiveByStudySession(studySessionID uint64) (*models.PomodoroSession, error) {
+	return findActive("study_session_id = ?", studySessionID)
+}
+
+// FindActiveByRoom 查找房间内仍在运行的同步番茄钟
+func FindActiveByRoom(roomID uint64) (*models.PomodoroSession, error) {
+	return findActive("room_id = ?", roomID)
+}
+
+func findActive(query string, arg uint64) (*models.PomodoroSession, error) {
+	var session models.PomodoroSession
+	err := database.GetDB().
+		Where(query, arg).
+		Where("status = ?", models.PomodoroStatusRunning).
+		Order("id DESC").
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPomodoroNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Load 按 ID 读取番茄钟
+func Load(id uint64) (*models.PomodoroSession, error) {
+	var session models.PomodoroSession
+	err := database.GetDB().First(&session, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPomodoroNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Sync 推进番茄钟并持久化，返回阶段切换记录
+func Sync(p *models.PomodoroSession, now time.Time) ([]Transition, error) {
+	transitions := Advance(p, now)
+	if len(transitions) == 0 {
+		return transitions, nil
+	}
+	if err := save(database.GetDB(), p); err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// Interrupt 记录一次中断；工作阶段被打断时作废当前番茄并重新计时
+func Interrupt(p *models.PomodoroSession, userID uint64, reason string, now time.Time) (*models.PomodoroInterruption, []Transition, error) {
+	if p.Status == models.PomodoroStatusEnded {
+		return nil, nil, ErrPomodoroEnded
+	}
+	transitions := Advance(p, now)
+
+	elapsed := int(now.Sub(p.PhaseStartedAt).Minutes())
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	record := models.PomodoroInterruption{
+		PomodoroID:     p.ID,
+		UserID:         userID,
+		Phase:          p.Phase,
+		OccurredAt:     now,
+		ElapsedMinutes: elapsed,
+		Reason:         truncateReason(reason),
+	}
+
+	// 房间番茄钟由个人中断时不影响整个房间的节奏
+	personal := p.RoomID == nil || p.UserID == userID
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		p.InterruptionCount++
+		if personal && p.Phase == models.PomodoroPhaseWork {
+			p.PhaseStartedAt = now
+		}
+		return save(tx, p)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &record, transitions, nil
+}
+
+// Finish 结束番茄钟；进行中的工作阶段按已专注分钟计入
+func Finish(p *models.PomodoroSession, now time.Time) ([]Transition, int, error) {
+	if p.Status == models.PomodoroStatusEnded {
+		return nil, 0, nil
+	}
+	transitions := Advance(p, now)
+	partial := 0
+	if p.Phase == models.PomodoroPhaseWork {
+		partial = int(now.Sub(p.PhaseStartedAt).Minutes())
+		if partial < 0 {
+			partial = 0
+		}
+		p.FocusMinutes += partial
+	}
+	p.Status = models.PomodoroStatusEnded
+	p.EndedAt = &now
+	if err := save(database.GetDB(), p); err != nil {
+		return nil, 0, err
+	}
+	return transitions, partial, nil
+}
+
+// CreditedMinutes 汇总阶段切换中计入的专注分钟
+func CreditedMinutes(transitions []Transition) int {
+	total := 0
+	for _, t := range transitions {
+		total += t.CreditMinutes
+	}
+	return total
+}
+
+func save(db *gorm.DB, p *models.PomodoroSession) error {
+	return db.Model(&models.PomodoroSession{}).
+		Where("id = ?", p.ID).
+		Updates(map[string]interface{}{
+			"phase":               p.Phase,
+			"phase_started_at":    p.PhaseStartedAt,
+			"completed_pomodoros": p.CompletedPomodoros,
+			"focus_minutes":       p.FocusMinutes,
+			"interruption_count":  p.InterruptionCount,
+			"status":              p.Status,
+			"ended_at":            p.EndedAt,
+		}).Error
+}
+
+func truncateReason(reason string) string {
+	reason = strings.TrimSpace(reason)
+	runes := []rune(reason)
+	if len(runes) > 128 {
+		return string(runes[:128])
+	}
+	return reason
+}
@@ -0,0 +1,161 @@
+package pomodoro
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+var pomodoroStart = time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time { return pomodoroStart.Add(time.Duration(minutes) * time.Minute) }
+
+func TestAdvanceFollowsLongBreakCadence(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         Config
+		minutes     int
+		phase       string
+		completed   int
+		focus       int
+		transitions int
+	}{
+		{"work not finished", Config{}, 24, models.PomodoroPhaseWork, 0, 0, 0},
+		{"first short break", Config{}, 25, models.PomodoroPhaseShortBreak, 1, 25, 1},
+		{"back to work", Config{}, 30, models.PomodoroPhaseWork, 1, 25, 2},
+		{"third short break", Config{}, 85, models.PomodoroPhaseShortBreak, 3, 75, 5},
+		{"long break after fourth", Config{}, 115, models.PomodoroPhaseLongBreak, 4, 100, 7},
+		{"long break lasts its own length", Config{}, 129, models.PomodoroPhaseLongBreak, 4, 100, 7},
+		{"next cycle starts", Config{}, 130, models.PomodoroPhaseWork, 4, 100, 8},
+		{"custom cadence", Config{WorkMinutes: 50, ShortBreakMinutes: 10, LongBreakMinutes: 30, LongBreakEvery: 2}, 110, models.PomodoroPhaseLongBreak, 2, 100, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NormalizeConfig(tc.cfg)
+			p := &models.PomodoroSession{
+				WorkMinutes:       cfg.WorkMinutes,
+				ShortBreakMinutes: cfg.ShortBreakMinutes,
+				LongBreakMinutes:  cfg.LongBreakMinutes,
+				LongBreakEvery:    cfg.LongBreakEvery,
+				Phase:             models.PomodoroPhaseWork,
+				PhaseStartedAt:    pomodoroStart,
+			}
+			transitions := Advance(p, at(tc.minutes))
+			if p.Phase != tc.phase || p.CompletedPomodoros != tc.completed || p.FocusMinutes != tc.focus || len(transitions) != tc.transitions {
+				t.Fatalf("got phase %s completed %d focus %d transitions %d", p.Phase, p.CompletedPomodoros, p.FocusMinutes, len(transitions))
+			}
+			if CreditedMinutes(transitions) != tc.focus {
+				t.Fatalf("expected transitions to credit %d minutes, got %d", tc.focus, CreditedMinutes(transitions))
+			}
+		})
+	}
+}
+
+func TestInterruptRecordsElapsedMinutesAndResetsPersonalWork(t *testing.T) {
+	testdb.Open(t)
+	roomID := uint64(7)
+	cases := []struct {
+		name      string
+		room      bool
+		by        uint64
+		minutes   int
+		phase     string
+		elapsed   int
+		credited  int
+		startedAt time.Time
+	}{
+		// 个人工作阶段被打断：当前番茄作废，已专注的分钟只记在中断记录里，不计入专注时长
+		{"personal work is reset", false, 1, 10, models.PomodoroPhaseWork, 10, 0, at(10)},
+		// 休息阶段被打断不重新计时，中断前完成的番茄照常计入
+		{"personal break keeps rhythm", false, 1, 27, models.PomodoroPhaseShortBreak, 2, 25, at(25)},
+		{"room member keeps rhythm", true, 2, 10, models.PomodoroPhaseWork, 10, 0, pomodoroStart},
+		{"room owner resets", true, 1, 10, models.PomodoroPhaseWork, 10, 0, at(10)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var room *uint64
+			if tc.room {
+				room = &roomID
+			}
+			p, err := Start(1, nil, room, Config{}, pomodoroStart)
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+			record, transitions, err := Interrupt(p, tc.by, "  电话  ", at(tc.minutes))
+			if err != nil {
+				t.Fatalf("interrupt: %v", err)
+			}
+			if record.Phase != tc.phase || record.ElapsedMinutes != tc.elapsed || record.UserID != tc.by || record.Reason != "电话" {
+				t.Fatalf("unexpected interruption %+v", record)
+			}
+			if CreditedMinutes(transitions) != tc.credited || p.FocusMinutes != tc.credited || p.InterruptionCount != 1 {
+				t.Fatalf("expected %d credited minutes, got transitions %d focus %d count %d", tc.credited, CreditedMinutes(transitions), p.FocusMinutes, p.InterruptionCount)
+			}
+			stored, _ := Load(p.ID)
+			if !p.PhaseStartedAt.Equal(tc.startedAt) || !stored.PhaseStartedAt.Equal(tc.startedAt) || stored.InterruptionCount != 1 {
+				t.Fatalf("expected phase to start at %v, got %v (stored %+v)", tc.startedAt, p.PhaseStartedAt, stored)
+			}
+		})
+	}
+
+	p, _ := Start(1, nil, nil, Config{}, pomodoroStart)
+	if _, _, err := Finish(p, at(5)); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if _, _, err := Interrupt(p, 1, "", at(6)); !errors.Is(err, ErrPomodoroEnded) {
+		t.Fatalf("expected ended pomodoro to reject interrupts, got %v", err)
+	}
+}
+
+func TestFinishCreditsPartialWork(t *testing.T) {
+	testdb.Open(t)
+	cases := []struct {
+		name       string
+		interrupt  int
+		minutes    int
+		phase      string
+		partial    int
+		focus      int
+		pomodoros  int
+		interrupts int
+	}{
+		{"mid work", -1, 10, models.PomodoroPhaseWork, 10, 10, 0, 0},
+		{"during break", -1, 27, models.PomodoroPhaseShortBreak, 0, 25, 1, 0},
+		{"second work", -1, 42, models.PomodoroPhaseWork, 12, 37, 1, 0},
+		// 中断重新计时后，部分分钟从中断时刻起算
+		{"after interrupt reset", 10, 18, models.PomodoroPhaseWork, 8, 8, 0, 1},
+		// 自动结束失联的个人番茄钟时按最后一次心跳结束，之后的时间不计入
+		{"stale session closed at last ping", -1, 40, models.PomodoroPhaseWork, 10, 35, 1, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Start(1, nil, nil, Config{}, pomodoroStart)
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+			if tc.interrupt >= 0 {
+				if _, _, err := Interrupt(p, 1, "", at(tc.interrupt)); err != nil {
+					t.Fatalf("interrupt: %v", err)
+				}
+			}
+			transitions, partial, err := Finish(p, at(tc.minutes))
+			if err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+			if p.Phase != tc.phase || partial != tc.partial || CreditedMinutes(transitions)+partial != tc.focus {
+				t.Fatalf("got phase %s partial %d credited %d", p.Phase, partial, CreditedMinutes(transitions))
+			}
+			stored, _ := Load(p.ID)
+			if stored.Status != models.PomodoroStatusEnded || stored.EndedAt == nil || !stored.EndedAt.Equal(at(tc.minutes)) ||
+				stored.FocusMinutes != tc.focus || stored.CompletedPomodoros != tc.pomodoros || stored.InterruptionCount != tc.interrupts {
+				t.Fatalf("unexpected stored pomodoro %+v", stored)
+			}
+			if _, again, _ := Finish(p, at(tc.minutes+60)); again != 0 || p.FocusMinutes != tc.focus {
+				t.Fatalf("expected finishing twice to credit nothing, got %d", again)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package rewards
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var (
+	ErrInvalidReward       = errors.New("invalid_reward")
+	ErrRewardNotFound      = errors.New("reward_not_found")
+	ErrRewardUnavailable   = errors.New("reward_unavailable")
+	ErrOutOfStock          = errors.New("reward_out_of_stock")
+	ErrNotTeamMember       = errors.New("reward_not_team_member")
+	ErrForbidden           = errors.New("reward_forbidden")
+	ErrRedemptionNotFound  = errors.New("redemption_not_found")
+	ErrRedemptionFinalized = errors.New("redemption_finalized")
+)
+
+// Actor 操作者身份，管理员可以维护全站奖励并审核任意兑换
+type Actor struct {
+	UserID  uint64
+	IsAdmin bool
+}
+
+// RewardInput 创建或修改奖励的参数，修改时为空的字段保持不变
+type RewardInput struct {
+	TeamID           *uint64 `json:"team_id"`
+	Name             *string `json:"name"`
+	Description      *string `json:"description"`
+	Cost             *int    `json:"cost"`
+	Stock            *int    `json:"stock"`
+	UnlimitedStock   bool    `json:"unlimited_stock"`
+	RequiresApproval *bool   `json:"requires_approval"`
+	Active           *bool   `json:"active"`
+}
+
+// RedemptionFilter 兑换记录查询条件，UserID 与 TeamID 至少指定一个
+type RedemptionFilter struct {
+	UserID uint64
+	TeamID uint64
+	Status string
+	Limit  int
+}
+
+// CanManage 判断操作者能否维护某个范围的奖励：全站奖励仅管理员，团队奖励为团队负责人或管理员
+func CanManage(db *gorm.DB, actor Actor, teamID *uint64) (bool, error) {
+	if actor.IsAdmin {
+		return true, nil
+	}
+	if teamID == nil {
+		return false, nil
+	}
+	var count int64
+	if err := db.Model(&models.Team{}).Where("id = ? AND owner_user_id = ?", *teamID, actor.UserID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateReward 发布奖励，新奖励默认上架
+func CreateReward(db *gorm.DB, actor Actor, in RewardInput) (*models.Reward, error) {
+	ok, err := CanManage(db, actor, in.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrForbidden
+	}
+	reward := models.Reward{TeamID: in.TeamID, Active: true, CreatedBy: actor.UserID}
+	if err := applyInput(&reward, in); err != nil {
+		return nil, err
+	}
+	if err := db.Create(&reward).Error; err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// UpdateReward 修改奖励，奖励的所属范围不可变更
+func UpdateReward(db *gorm.DB, actor Actor, rewardID uint64, in RewardInput) (*models.Reward, error) {
+	var reward models.Reward
+	if err := db.First(&reward, rewardID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRewardNotFound
+		}
+		return nil, err
+	}
+	ok, err := CanManage(db, actor, reward.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrForbidden
+	}
+	if err := applyInput(&reward, in); err != nil {
+		return nil, err
+	}
+	if err := db.Model(&reward).Select("name", "description", "cost", "stock", "requires_approval", "active").
+		Updates(&reward).Error; err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+func applyInput(reward *models.Reward, in RewardInput) error {
+	if in.Name != nil {
+		reward.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Description != nil {
+		reward.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.Cost != nil {
+		reward.Cost = *in.Cost
+	}
+	if in.UnlimitedStock {
+		reward.Stock = nil
+	} else if in.Stock != nil {
+		stock := *in.Stock
+		reward.Stock = &stock
+	}
+	if in.RequiresApproval != nil {
+		reward.RequiresApproval = *in.RequiresApproval
+	}
+	if in.Active != nil {
+		reward.Active = *in.Active
+	}
+
+	switch {
+	case reward.Name == "" || len([]rune(reward.Name)) > 64:
+		return fmt.Errorf("%w: name must be 1-64 characters", ErrInvalidReward)
+	case len([]rune(reward.Description)) > 512:
+		return fmt.Errorf("%w: description too long", ErrInvalidReward)
+	case reward.Cost <= 0:
+		return fmt.Errorf("%w: cost must be positive", ErrInvalidReward)
+	case reward.Stock != nil && *reward.Stock < 0:
+		return fmt.Errorf("%w: stock must not be negative", ErrInvalidReward)
+	}
+	return nil
+}
+
+// ListRewards 列出用户可见的奖励：全站奖励与其所在团队的奖励。
+// teamID 非 0 时只列该团队的奖励；includeInactive 仅对有维护权限的范围生效
+func ListRewards(db *gorm.DB, actor Actor, teamID uint64, includeInactive bool) ([]models.Reward, error) {
+	query := db.Model(&models.Reward{})
+	if teamID > 0 {
+		member, err := isTeamMember(db, teamID, actor.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !member && !actor.IsAdmin {
+			return nil, ErrNotTeamMember
+		}
+		query = query.Where("team_id = ?", teamID)
+		if includeInactive {
+			ok, err := CanManage(db, actor, &teamID)
+			if err != nil {
+				return nil, err
+			}
+			includeInactive = ok
+		}
+	} else {
+		query = query.Where("team_id IS NULL OR team_id IN (?)",
+			db.Model(&models.TeamMember{}).Select("team_id").Where("user_id = ?", actor.UserID))
+		includeInactive = includeInactive && actor.IsAdmin
+	}
+	if !includeInactive {
+		query = query.Where("active = ?", true)
+	}
+	var list []models.Reward
+	if err := query.Order("cost ASC, id ASC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Redeem 兑换奖励：扣减库存、写入扣分账本与兑换记录在同一事务内完成。
+// 需要审核的奖励进入待审核状态，否则直接通过
+func Redeem(db *gorm.DB, userID, rewardID uint64) (*models.RewardRedemption, error) {
+	var redemption models.RewardRedemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var reward models.Reward
+		if err := tx.First(&reward, rewardID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRewardNotFound
+			}
+			return err
+		}
+		if !reward.Active {
+			return ErrRewardUnavailable
+		}
+		if reward.TeamID != nil {
+			member, err := isTeamMember(tx, *reward.TeamID, userID)
+			if err != nil {
+				return err
+			}
+			if !member {
+				return ErrNotTeamMember
+			}
+		}
+		if reward.Stock != nil {
+			// 条件更新保证并发兑换不会超卖
+			res := tx.Model(&models.Reward{}).Where("id = ? AND stock > 0", reward.ID).
+				UpdateColumn("stock", gorm.Expr("stock - 1"))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrOutOfStock
+			}
+		}
+
+		status := models.RedemptionStatusApproved
+		if reward.RequiresApproval {
+			status = models.RedemptionStatusPending
+		}
+		redemption = models.RewardRedemption{
+			RewardID:   reward.ID,
+			TeamID:     reward.TeamID,
+			UserID:     userID,
+			RewardName: reward.Name,
+			Cost:       reward.Cost,
+			Status:     status,
+		}
+		if err := tx.Create(&redemption).Error; err != nil {
+			return err
+		}
+		res, err := points.SpendWithTx(tx, userID, models.PointsSourceRedemption, &redemption.ID, reward.Cost,
+			fmt.Sprintf("兑换「%s」", reward.Name), fmt.Sprintf("redemption:%d", redemption.ID))
+		if err != nil {
+			return err
+		}
+		redemption.DebitLedgerID = res.Ledger.ID
+		return tx.Model(&redemption).UpdateColumn("debit_ledger_id", res.Ledger.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// Review 审核待处理的兑换，驳回时退回积分与库存
+func Review(db *gorm.DB, actor Actor, redemptionID uint64, approve bool, note string) (*models.RewardRedemption, error) {
+	var redemption models.RewardRedemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&redemption, redemptionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRedemptionNotFound
+			}
+			return err
+		}
+		ok, err := CanManage(tx, actor, redemption.TeamID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrForbidden
+		}
+		status := models.RedemptionStatusApproved
+		if !approve {
+			status = models.RedemptionStatusRejected
+		}
+		return closeRedemption(tx, &redemption, status, actor.UserID, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// Cancel 用户撤回自己尚未审核的兑换
+func Cancel(db *gorm.DB, userID, redemptionID uint64) (*models.RewardRedemption, error) {
+	var redemption models.RewardRedemption
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", redemptionID, userID).First(&redemption).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRedemptionNotFound
+			}
+			return err
+		}
+		return closeRedemption(tx, &redemption, models.RedemptionStatusCancelled, userID, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// closeRedemption 将待审核兑换置为终态；非通过的终态退回积分并恢复库存
+func closeRedemption(tx *gorm.DB, redemption *models.RewardRedemption, status string, reviewerID uint64, note string) error {
+	now := time.Now()
+	// 以状态为条件更新，避免同一兑换被并发审核两次
+	res := tx.Model(&models.RewardRedemption{}).
+		Where("id = ? AND status = ?", redemption.ID, models.RedemptionStatusPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": reviewerID,
+			"reviewed_at": now,
+			"review_note": truncate(note, 256),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRedemptionFinalized
+	}
+	redemption.Status = status
+	redemption.ReviewedBy = &reviewerID
+	redemption.ReviewedAt = &now
+	redemption.ReviewNote = truncate(note, 256)
+	if status == models.RedemptionStatusApproved {
+		return nil
+	}
+
+	remark := fmt.Sprintf("兑换「%s」被驳回，退回积分", redemption.RewardName)
+	if status == models.RedemptionStatusCancelled {
+		remark = fmt.Sprintf("撤回兑换「%s」，退回积分", redemption.RewardName)
+	}
+	refund, err := points.RefundWithTx(tx, redemption.DebitLedgerID, remark)
+	if err != nil {
+		return err
+	}
+	redemption.RefundLedgerID = &refund.Ledger.ID
+	if err := tx.Model(redemption).UpdateColumn("refund_ledger_id", refund.Ledger.ID).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Reward{}).Where("id = ? AND stock IS NOT NULL", redemption.RewardID).
+		UpdateColumn("stock", gorm.Expr("stock + 1")).Error
+}
+
+// ListRedemptions 按用户或团队查询兑换记录，按时间倒序
+func ListRedemptions(db *gorm.DB, filter RedemptionFilter) ([]models.RewardRedemption, error) {
+	if filter.UserID == 0 && filter.TeamID == 0 {
+		return nil, fmt.Errorf("%w: user or team required", ErrInvalidReward)
+	}
+	if filter.Limit <= 0 || filter.Limit > MaxLimit {
+		filter.Limit = DefaultLimit
+	}
+	query := db.Model(&models.RewardRedemption{})
+	if filter.UserID > 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.TeamID > 0 {
+		query = query.Where("team_id = ?", filter.TeamID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	var list []models.RewardRedemption
+	if err := query.Order("id DESC").Limit(filter.Limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Reviewers 返回有权审核该兑换的用户：团队奖励为团队负责人，全站奖励为所有管理员
+func Reviewers(db *gorm.DB, redemption *models.RewardRedemption) ([]uint64, error) {
+	var ids []uint64
+	var err error
+	if redemption.TeamID != nil {
+		err = db.Model(&models.Team{}).Where("id = ?", *redemption.TeamID).Pluck("owner_user_id", &ids).Error
+	} else {
+		err = db.Model(&models.User{}).Where("role = ? AND status = ?", 1, 1).Pluck("id", &ids).Error
+	}
+	return ids, err
+}
+
+func isTeamMember(db *gorm.DB, teamID, userID uint64) (bool, error) {
+	var count int64
+	if err := db.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", teamID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package rewards
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+)
+
+func intPtr(v int) *int       { return &v }
+func strPtr(v string) *string { return &v }
+func boolPtr(v bool) *bool    { return &v }
+
+func balance(db *gorm.DB, userID uint64) int {
+	var profile models.UserProfile
+	db.Where("user_id = ?", userID).First(&profile)
+	return profile.TotalPoints
+}
+
+func TestTeamRewardRedemptionWithApproval(t *testing.T) {
+	db := testdb.Open(t)
+	owner, member, outsider := uint64(1), uint64(2), uint64(3)
+	team := models.Team{Name: "t", OwnerUserID: owner}
+	db.Create(&team)
+	db.Create(&models.TeamMember{TeamID: team.ID, UserID: owner})
+	db.Create(&models.TeamMember{TeamID: team.ID, UserID: member})
+	db.Create(&models.UserProfile{UserID: member, TotalPoints: 50})
+
+	if _, err := CreateReward(db, Actor{UserID: member}, RewardInput{TeamID: &team.ID, Name: strPtr("x"), Cost: intPtr(10)}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("members must not create team rewards, got %v", err)
+	}
+	reward, err := CreateReward(db, Actor{UserID: owner}, RewardInput{
+		TeamID: &team.ID, Name: strPtr("奶茶"), Cost: intPtr(30), Stock: intPtr(1), RequiresApproval: boolPtr(true),
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := Redeem(db, outsider, reward.ID); !errors.Is(err, ErrNotTeamMember) {
+		t.Fatalf("expected outsider to be rejected, got %v", err)
+	}
+	redemption, err := Redeem(db, member, reward.ID)
+	if err != nil || redemption.Status != models.RedemptionStatusPending || balance(db, member) != 20 {
+		t.Fatalf("expected pending redemption with debit, got %+v %v balance=%d", redemption, err, balance(db, member))
+	}
+	if _, err := Redeem(db, member, reward.ID); !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("expected stock to be exhausted, got %v", err)
+	}
+
+	if _, err := Review(db, Actor{UserID: member}, redemption.ID, false, ""); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("only the team owner may review, got %v", err)
+	}
+	rejected, err := Review(db, Actor{UserID: owner}, redemption.ID, false, "暂时缺货")
+	if err != nil || rejected.Status != models.RedemptionStatusRejected || rejected.RefundLedgerID == nil {
+		t.Fatalf("reject: %+v %v", rejected, err)
+	}
+	if balance(db, member) != 50 {
+		t.Fatalf("expected refund, balance=%d", balance(db, member))
+	}
+	if _, err := Review(db, Actor{UserID: owner}, redemption.ID, true, ""); !errors.Is(err, ErrRedemptionFinalized) {
+		t.Fatalf("expected finalized redemption, got %v", err)
+	}
+	var stock int
+	db.Model(&models.Reward{}).Where("id = ?", reward.ID).Pluck("stock", &stock)
+	if stock != 1 {
+		t.Fatalf("expected stock restored, got %d", stock)
+	}
+
+	list, err := ListRedemptions(db, RedemptionFilter{TeamID: team.ID})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("team history: %+v %v", list, err)
+	}
+}
+
+func TestGlobalRewardRequiresBalance(t *testing.T) {
+	db := testdb.Open(t)
+	if _, err := CreateReward(db, Actor{UserID: 1}, RewardInput{Name: strPtr("x"), Cost: intPtr(10)}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("global rewards require admin, got %v", err)
+	}
+	reward, err := CreateReward(db, Actor{UserID: 1, IsAdmin: true}, RewardInput{Name: strPtr("贴纸"), Cost: intPtr(10)})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	db.Create(&models.UserProfile{UserID: 5, TotalPoints: 15})
+	redemption, err := Redeem(db, 5, reward.ID)
+	if err != nil || redemption.Status != models.RedemptionStatusApproved {
+		t.Fatalf("expected immediate approval, got %+v %v", redemption, err)
+	}
+	if _, err := Redeem(db, 5, reward.ID); !errors.Is(err, points.ErrInsufficientPoints) {
+		t.Fatalf("expected insufficient points, got %v", err)
+	}
+	var count int64
+	db.Model(&models.RewardRedemption{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("failed redemption must roll back, got %d rows", count)
+	}
+
+	if _, err := UpdateReward(db, Actor{UserID: 1, IsAdmin: true}, reward.ID, RewardInput{Active: boolPtr(false)}); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if _, err := Redeem(db, 5, reward.ID); !errors.Is(err, ErrRewardUnavailable) {
+		t.Fatalf("expected inactive reward, got %v", err)
+	}
+	list, _ := ListRewards(db, Actor{UserID: 5}, 0, false)
+	if len(list) != 0 {
+		t.Fatalf("inactive rewards must be hidden, got %+v", list)
+	}
+}
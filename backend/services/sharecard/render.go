@@ -0,0 +1,162 @@
+package sharecard
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// RenderVersion 渲染样式的版本，修改卡片样式时递增，已缓存的卡片会按快照重新渲染
+const RenderVersion = 1
+
+const (
+	cardWidth  = 1200
+	cardHeight = 630
+	fontFamily = "'PingFang SC','Microsoft YaHei','Noto Sans CJK SC',sans-serif"
+)
+
+// palettes 卡片背景渐变与徽章配色，按成就分类或等级选择
+var palettes = []struct{ From, To, Accent string }{
+	{"#4f46e5", "#7c3aed", "#fbbf24"},
+	{"#0ea5e9", "#2563eb", "#fde047"},
+	{"#059669", "#0d9488", "#fef08a"},
+	{"#ea580c", "#db2777", "#fef3c7"},
+	{"#475569", "#1e293b", "#fcd34d"},
+	{"#9333ea", "#c026d3", "#a7f3d0"},
+}
+
+// Stat 卡片底部展示的一项统计
+type Stat struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// CardData 渲染卡片所需的全部数据，同时作为快照持久化
+type CardData struct {
+	Kind        string `json:"kind"`
+	Heading     string `json:"heading"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Badge 徽章中央的字符：成就名称前的表情、名称首字或等级
+	Badge       string `json:"badge"`
+	PaletteKey  string `json:"palette_key"`
+	DisplayName string `json:"display_name"`
+	Date        string `json:"date"`
+	Stats       []Stat `json:"stats"`
+}
+
+// Render 以纯 Go 生成 1200x630 的 SVG 卡片：左侧为徽章，右侧为标题、用户与统计
+func Render(data CardData) []byte {
+	palette := palettes[paletteIndex(data.PaletteKey)]
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s">`,
+		cardWidth, cardHeight, cardWidth, cardHeight, fontFamily)
+	fmt.Fprintf(&b, `<defs><linearGradient id="bg" x1="0" y1="0" x2="1" y2="1"><stop offset="0" stop-color="%s"/><stop offset="1" stop-color="%s"/></linearGradient>`,
+		palette.From, palette.To)
+	fmt.Fprintf(&b, `<radialGradient id="medal" cx="0.35" cy="0.3" r="0.8"><stop offset="0" stop-color="#ffffff"/><stop offset="1" stop-color="%s"/></radialGradient></defs>`,
+		palette.Accent)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" rx="32" fill="url(#bg)"/>`, cardWidth, cardHeight)
+	b.WriteString(`<circle cx="1100" cy="80" r="180" fill="#ffffff" fill-opacity="0.06"/><circle cx="120" cy="600" r="140" fill="#ffffff" fill-opacity="0.05"/>`)
+
+	writeBadge(&b, data.Badge, palette.Accent)
+
+	const left = 540
+	fmt.Fprintf(&b, `<text x="%d" y="150" font-size="30" fill="#ffffff" fill-opacity="0.8" letter-spacing="4">%s</text>`, left, esc(truncate(data.Heading, 16)))
+	fmt.Fprintf(&b, `<text x="%d" y="225" font-size="60" font-weight="700" fill="#ffffff">%s</text>`, left, esc(truncate(data.Title, 12)))
+	if data.Description != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="280" font-size="28" fill="#ffffff" fill-opacity="0.85">%s</text>`, left, esc(truncate(data.Description, 22)))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="345" font-size="32" font-weight="600" fill="#ffffff">%s</text>`, left, esc(truncate(data.DisplayName, 16)))
+	if data.Date != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="385" font-size="24" fill="#ffffff" fill-opacity="0.7">%s</text>`, left, esc(data.Date))
+	}
+
+	stats := data.Stats
+	if len(stats) > 4 {
+		stats = stats[:4]
+	}
+	for i, stat := range stats {
+		x := left + i*150
+		fmt.Fprintf(&b, `<rect x="%d" y="425" width="136" height="110" rx="16" fill="#ffffff" fill-opacity="0.14"/>`, x)
+		fmt.Fprintf(&b, `<text x="%d" y="480" font-size="36" font-weight="700" fill="#ffffff" text-anchor="middle">%s</text>`, x+68, esc(truncate(stat.Value, 6)))
+		fmt.Fprintf(&b, `<text x="%d" y="515" font-size="20" fill="#ffffff" fill-opacity="0.75" text-anchor="middle">%s</text>`, x+68, esc(truncate(stat.Label, 6)))
+	}
+
+	fmt.Fprintf(&b, `<text x="%d" y="595" font-size="22" fill="#ffffff" fill-opacity="0.6" text-anchor="end">学习助手 · Learning Assistant</text>`, cardWidth-48)
+	b.WriteString(`</svg>`)
+	return []byte(b.String())
+}
+
+// writeBadge 绘制徽章：外圈缎带、齿状边框与中央字符
+func writeBadge(b *strings.Builder, badge, accent string) {
+	const cx, cy = 280, 300
+	for _, dir := range []int{-1, 1} {
+		fmt.Fprintf(b, `<polygon points="%d,%d %d,%d %d,%d %d,%d %d,%d" fill="%s" fill-opacity="0.75"/>`,
+			cx+dir*100, cy+90, cx+dir*150, cy+300, cx+dir*105, cy+275, cx+dir*80, cy+320, cx+dir*30, cy+130, accent)
+	}
+	// 24 个齿的星形外框
+	var points []string
+	for i := 0; i < 48; i++ {
+		r := 190.0
+		if i%2 == 1 {
+			r = 172
+		}
+		x, y := polar(float64(cx), float64(cy), r, float64(i)*7.5)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	fmt.Fprintf(b, `<polygon points="%s" fill="%s"/>`, strings.Join(points, " "), accent)
+	fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="150" fill="url(#medal)" stroke="#ffffff" stroke-width="6"/>`, cx, cy)
+	fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="128" fill="none" stroke="#ffffff" stroke-opacity="0.6" stroke-width="2" stroke-dasharray="6 8"/>`, cx, cy)
+	// 表情可能由多个码点组成，只有文字徽章按长度缩小字号
+	size := 120
+	if runes := []rune(badge); len(runes) > 2 && !unicode.Is(unicode.So, runes[0]) {
+		size = 240 / len(runes)
+	}
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="%d" font-weight="700" fill="#1f2937" text-anchor="middle" dominant-baseline="central">%s</text>`,
+		cx, cy, size, esc(badge))
+}
+
+// SplitBadge 拆分成就名称前的表情作为徽章字符，没有表情时取名称首字
+func SplitBadge(name string) (badge, title string) {
+	name = strings.TrimSpace(name)
+	runes := []rune(name)
+	if len(runes) == 0 {
+		return "★", ""
+	}
+	if !unicode.Is(unicode.So, runes[0]) {
+		return string(runes[0]), name
+	}
+	end := strings.IndexFunc(name, unicode.IsSpace)
+	if end < 0 {
+		return name, name
+	}
+	return name[:end], strings.TrimSpace(name[end:])
+}
+
+func polar(cx, cy, r, deg float64) (float64, float64) {
+	rad := deg * math.Pi / 180
+	return cx + r*math.Cos(rad), cy + r*math.Sin(rad)
+}
+
+func paletteIndex(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(palettes)))
+}
+
+func esc(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,240 @@
+package sharecard
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
+)
+
+var (
+	ErrInvalidKind     = errors.New("share_card_invalid_kind")
+	ErrNotUnlocked     = errors.New("share_card_achievement_not_unlocked")
+	ErrCardNotFound    = errors.New("share_card_not_found")
+	ErrProfileNotFound = errors.New("share_card_profile_not_found")
+)
+
+// tokenBytes 访问凭证的随机字节数，十六进制编码后为 32 个字符
+const tokenBytes = 16
+
+// Issue 为用户生成成就卡或等级卡。同一成就（等级）重复分享时返回已有卡片，保持链接不变；
+// 等级卡的 subjectID 忽略，取用户当前等级
+func Issue(db *gorm.DB, userID uint64, kind string, subjectID uint64, now time.Time) (*models.ShareCard, error) {
+	var data *CardData
+	var err error
+	switch kind {
+	case models.ShareCardKindAchievement:
+		data, err = achievementCard(db, userID, subjectID)
+	case models.ShareCardKindLevel:
+		data, subjectID, err = levelCard(db, userID, now)
+	default:
+		return nil, ErrInvalidKind
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.ShareCard
+	err = db.Where("user_id = ? AND kind = ? AND subject_id = ?", userID, kind, subjectID).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	card := models.ShareCard{
+		UserID:        userID,
+		Kind:          kind,
+		SubjectID:     subjectID,
+		Token:         token,
+		Snapshot:      string(snapshot),
+		SVG:           string(Render(*data)),
+		RenderVersion: RenderVersion,
+	}
+	if err := db.Create(&card).Error; err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// Load 按访问凭证读取卡片的 SVG。缓存的渲染结果版本过旧时按快照重新渲染并回写
+func Load(db *gorm.DB, token string) (*models.ShareCard, error) {
+	var card models.ShareCard
+	if err := db.Where("token = ?", token).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+	if card.RenderVersion < RenderVersion || card.SVG == "" {
+		var data CardData
+		if err := json.Unmarshal([]byte(card.Snapshot), &data); err != nil {
+			return nil, err
+		}
+		card.SVG = string(Render(data))
+		card.RenderVersion = RenderVersion
+		if err := db.Model(&card).Updates(map[string]interface{}{"svg": card.SVG, "render_version": card.RenderVersion}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &card, nil
+}
+
+// RecordView 累加卡片的浏览次数，只在实际返回图片内容时调用，命中协商缓存的请求不计入
+func RecordView(db *gorm.DB, card *models.ShareCard) error {
+	return db.Model(card).UpdateColumn("view_count", gorm.Expr("view_count + 1")).Error
+}
+
+// List 用户已生成的分享卡片，按时间倒序
+func List(db *gorm.DB, userID uint64) ([]models.ShareCard, error) {
+	var cards []models.ShareCard
+	if err := db.Omit("svg", "snapshot").Where("user_id = ?", userID).Order("id DESC").Find(&cards).Error; err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// Revoke 撤销分享，原链接立即失效；再次分享会生成新的链接
+func Revoke(db *gorm.DB, userID uint64, token string) error {
+	res := db.Unscoped().Where("user_id = ? AND token = ?", userID, token).Delete(&models.ShareCard{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCardNotFound
+	}
+	return nil
+}
+
+func achievementCard(db *gorm.DB, userID, achievementID uint64) (*CardData, error) {
+	var unlocked models.UserAchievement
+	if err := db.Where("user_id = ? AND achievement_id = ?", userID, achievementID).First(&unlocked).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotUnlocked
+		}
+		return nil, err
+	}
+	var ach models.Achievement
+	if err := db.First(&ach, achievementID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotUnlocked
+		}
+		return nil, err
+	}
+	user, profile, err := loadUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	unlockedCount, err := countUnlocked(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	badge, title := SplitBadge(ach.Name)
+	return &CardData{
+		Kind:        models.ShareCardKindAchievement,
+		Heading:     "解锁成就",
+		Title:       title,
+		Description: ach.Description,
+		Badge:       badge,
+		PaletteKey:  ach.Category,
+		DisplayName: user.DisplayName,
+		Date:        unlocked.AwardedAt.In(usertime.ForUser(userID)).Format("2006年01月02日 解锁"),
+		Stats: []Stat{
+			{Label: "等级", Value: "Lv." + strconv.Itoa(profile.Level)},
+			{Label: "积分", Value: strconv.Itoa(profile.TotalPoints)},
+			{Label: "已获成就", Value: strconv.FormatInt(unlockedCount, 10)},
+			{Label: "最长连续", Value: fmt.Sprintf("%d天", longest(profile))},
+		},
+	}, nil
+}
+
+func levelCard(db *gorm.DB, userID uint64, now time.Time) (*CardData, uint64, error) {
+	user, profile, err := loadUser(db, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	unlockedCount, err := countUnlocked(db, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var studyMinutes int64
+	if err := db.Model(&models.DailyStudyStat{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(minutes), 0)").Scan(&studyMinutes).Error; err != nil {
+		return nil, 0, err
+	}
+
+	level := profile.Level
+	if level < 1 {
+		level = 1
+	}
+	return &CardData{
+		Kind:        models.ShareCardKindLevel,
+		Heading:     "等级提升",
+		Title:       fmt.Sprintf("升到 Lv.%d", level),
+		Description: fmt.Sprintf("累计获得 %d 积分", profile.TotalPoints),
+		Badge:       "Lv." + strconv.Itoa(level),
+		PaletteKey:  "level-" + strconv.Itoa(level),
+		DisplayName: user.DisplayName,
+		Date:        now.In(usertime.ForUser(userID)).Format("2006年01月02日"),
+		Stats: []Stat{
+			{Label: "学习时长", Value: fmt.Sprintf("%d时", studyMinutes/60)},
+			{Label: "完成任务", Value: strconv.Itoa(profile.TasksCompleted)},
+			{Label: "已获成就", Value: strconv.FormatInt(unlockedCount, 10)},
+			{Label: "最长连续", Value: fmt.Sprintf("%d天", longest(profile))},
+		},
+	}, uint64(level), nil
+}
+
+func loadUser(db *gorm.DB, userID uint64) (*models.User, *models.UserProfile, error) {
+	var user models.User
+	if err := db.Select("id", "display_name").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrProfileNotFound
+		}
+		return nil, nil, err
+	}
+	var profile models.UserProfile
+	if err := db.Where("user_id = ?", userID).First(&profile).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	return &user, &profile, nil
+}
+
+func countUnlocked(db *gorm.DB, userID uint64) (int64, error) {
+	var count int64
+	err := db.Model(&models.UserAchievement{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func longest(profile *models.UserProfile) int {
+	if profile.StreakDays > profile.LongestStreakDays {
+		return profile.StreakDays
+	}
+	return profile.LongestStreakDays
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
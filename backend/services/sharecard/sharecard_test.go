@@ -0,0 +1,64 @@
+package sharecard
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestIssueAchievementCardIsStableAndRevocable(t *testing.T) {
+	db := testdb.Open(t)
+	user := models.User{Account: "u", Email: "u@x", Phone: "1", DisplayName: "<小明&>", Status: 1, PasswordHash: "x"}
+	db.Create(&user)
+	db.Create(&models.UserProfile{UserID: user.ID, Level: 3, TotalPoints: 420, LongestStreakDays: 12})
+	ach := models.Achievement{Code: "task_starter_5", Name: "🎯 新手任务者", Description: "完成 5 个任务", Category: "task_master_basic", Condition: "{}"}
+	db.Create(&ach)
+
+	if _, err := Issue(db, user.ID, models.ShareCardKindAchievement, uint64(ach.ID), time.Now()); !errors.Is(err, ErrNotUnlocked) {
+		t.Fatalf("expected locked achievement to be rejected, got %v", err)
+	}
+	db.Create(&models.UserAchievement{UserID: user.ID, AchievementID: ach.ID, AwardedAt: time.Now()})
+
+	card, err := Issue(db, user.ID, models.ShareCardKindAchievement, uint64(ach.ID), time.Now())
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if len(card.Token) != 2*tokenBytes {
+		t.Fatalf("unexpected token %q", card.Token)
+	}
+	again, _ := Issue(db, user.ID, models.ShareCardKindAchievement, uint64(ach.ID), time.Now())
+	if again.Token != card.Token {
+		t.Fatalf("re-sharing must keep the same link")
+	}
+
+	// 渲染版本落后时按快照重新渲染
+	db.Model(card).Updates(map[string]interface{}{"svg": "", "render_version": 0})
+	loaded, err := Load(db, card.Token)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := xml.Unmarshal([]byte(loaded.SVG), new(struct{})); err != nil {
+		t.Fatalf("svg must be well-formed: %v", err)
+	}
+	for _, want := range []string{"新手任务者", "🎯", "&lt;小明&amp;&gt;", "Lv.3", "12天"} {
+		if !strings.Contains(loaded.SVG, want) {
+			t.Fatalf("svg missing %q", want)
+		}
+	}
+
+	if err := Revoke(db, user.ID, card.Token); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := Load(db, card.Token); !errors.Is(err, ErrCardNotFound) {
+		t.Fatalf("revoked link must stop working, got %v", err)
+	}
+	reissued, _ := Issue(db, user.ID, models.ShareCardKindAchievement, uint64(ach.ID), time.Now())
+	if reissued.Token == card.Token {
+		t.Fatalf("re-sharing after revoke must issue a new link")
+	}
+}
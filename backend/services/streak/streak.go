@@ -0,0 +1,384 @@
+package streak
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+	"learningAssistant-backend/services/usertime"
+)
+
+const dayLayout = "2006-01-02"
+
+// MaxRuns 摘要中返回的历史连续记录条数
+const MaxRuns = 10
+
+var (
+	ErrInvalidRule     = errors.New("invalid_streak_rule")
+	ErrFreezeDisabled  = errors.New("streak_freeze_disabled")
+	ErrFreezeLimit     = errors.New("streak_freeze_limit_reached")
+	ErrProfileNotFound = errors.New("streak_profile_not_found")
+)
+
+// DefaultRule 未配置时的判定规则：签到、学习满 15 分钟或完成任务任一满足即为活跃
+var DefaultRule = models.StreakRule{
+	CountCheckIn:        true,
+	MinStudyMinutes:     15,
+	CountTaskCompletion: true,
+	FreezeCost:          100,
+	MaxFreezes:          2,
+}
+
+// Run 一段连续活跃记录，日期为用户时区的日历日；保护卡覆盖的日期计入区间但不计入天数
+type Run struct {
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Days        int    `json:"days"`
+	FreezesUsed int    `json:"freezes_used"`
+}
+
+// Summary 用户的连续活跃情况
+type Summary struct {
+	Current          int      `json:"current"`
+	Longest          int      `json:"longest"`
+	TodayActive      bool     `json:"today_active"`
+	LastActiveDate   string   `json:"last_active_date,omitempty"`
+	FreezesAvailable int      `json:"freezes_available"`
+	FrozenDates      []string `json:"frozen_dates"`
+	// Runs 历史连续记录，按天数降序，最多 MaxRuns 条
+	Runs []Run `json:"runs"`
+}
+
+// LoadRule 读取判定规则，未配置时返回 DefaultRule
+func LoadRule(db *gorm.DB) (models.StreakRule, error) {
+	var rule models.StreakRule
+	err := db.Order("id ASC").First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultRule, nil
+	}
+	return rule, err
+}
+
+// SaveRule 覆盖判定规则
+func SaveRule(db *gorm.DB, rule models.StreakRule) (*models.StreakRule, error) {
+	if rule.MinStudyMinutes < 0 || rule.FreezeCost < 0 || rule.MaxFreezes < 0 {
+		return nil, fmt.Errorf("%w: values must not be negative", ErrInvalidRule)
+	}
+	if !rule.CountCheckIn && !rule.CountTaskCompletion && rule.MinStudyMinutes == 0 {
+		return nil, fmt.Errorf("%w: at least one activity source is required", ErrInvalidRule)
+	}
+	var existing models.StreakRule
+	err := db.Order("id ASC").First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	rule.ID = existing.ID
+	rule.CreatedAt = existing.CreatedAt
+	if err := db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Compute 按当前规则计算连续活跃情况，不修改任何数据
+func Compute(db *gorm.DB, userID uint64, loc *time.Location, now time.Time) (*Summary, error) {
+	rule, err := LoadRule(db)
+	if err != nil {
+		return nil, err
+	}
+	active, err := activeDays(db, rule, userID, loc)
+	if err != nil {
+		return nil, err
+	}
+	frozen, available, err := freezes(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	summary := summarize(active, frozen, usertime.StartOfDay(now, loc))
+	summary.FreezesAvailable = available
+	return summary, nil
+}
+
+// Refresh 在独立事务中执行 RefreshWithTx
+func Refresh(db *gorm.DB, userID uint64, now time.Time) (*Summary, error) {
+	loc := usertime.ForUser(userID)
+	var summary *Summary
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		summary, err = RefreshWithTx(tx, userID, loc, now, false)
+		return err
+	})
+	return summary, err
+}
+
+// RefreshWithTx 重新计算连续活跃天数并写回用户档案。昨天之前有未覆盖的空档且持有的保护卡足够时，
+// 自动使用保护卡补上空档。assumeActiveToday 用于签到等在同一事务中即将记为活跃的场景
+func RefreshWithTx(tx *gorm.DB, userID uint64, loc *time.Location, now time.Time, assumeActiveToday bool) (*Summary, error) {
+	var profile models.UserProfile
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProfileNotFound
+		}
+		return nil, err
+	}
+	rule, err := LoadRule(tx)
+	if err != nil {
+		return nil, err
+	}
+	active, err := activeDays(tx, rule, userID, loc)
+	if err != nil {
+		return nil, err
+	}
+	today := usertime.StartOfDay(now, loc)
+	if assumeActiveToday {
+		active[today.Format(dayLayout)] = true
+	}
+	frozen, available, err := freezes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if gap := uncoveredGap(active, frozen, today); len(gap) > 0 && len(gap) <= available {
+		var cards []models.StreakFreeze
+		if err := tx.Where("user_id = ? AND status = ?", userID, models.StreakFreezeStatusAvailable).
+			Order("id ASC").Limit(len(gap)).Find(&cards).Error; err != nil {
+			return nil, err
+		}
+		for i, day := range gap {
+			date := usertime.CalendarDate(day)
+			if err := tx.Model(&cards[i]).Updates(map[string]interface{}{
+				"status":    models.StreakFreezeStatusUsed,
+				"used_date": date,
+			}).Error; err != nil {
+				return nil, err
+			}
+			frozen[day.Format(dayLayout)] = true
+		}
+		available -= len(gap)
+	}
+
+	summary := summarize(active, frozen, today)
+	summary.FreezesAvailable = available
+	longest := summary.Longest
+	if profile.LongestStreakDays > longest {
+		longest = profile.LongestStreakDays
+	}
+	if err := tx.Model(&models.UserProfile{}).Where("id = ?", profile.ID).Updates(map[string]interface{}{
+		"streak_days":         summary.Current,
+		"longest_streak_days": longest,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// PurchaseFreeze 用积分购买一张保护卡，持有数量达到上限时返回 ErrFreezeLimit
+func PurchaseFreeze(db *gorm.DB, userID uint64) (*models.StreakFreeze, *points.AwardResult, error) {
+	var freeze models.StreakFreeze
+	var spent *points.AwardResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		rule, err := LoadRule(tx)
+		if err != nil {
+			return err
+		}
+		if rule.MaxFreezes <= 0 {
+			return ErrFreezeDisabled
+		}
+		var held int64
+		if err := tx.Model(&models.StreakFreeze{}).
+			Where("user_id = ? AND status = ?", userID, models.StreakFreezeStatusAvailable).
+			Count(&held).Error; err != nil {
+			return err
+		}
+		if held >= int64(rule.MaxFreezes) {
+			return ErrFreezeLimit
+		}
+		freeze = models.StreakFreeze{UserID: userID, Status: models.StreakFreezeStatusAvailable}
+		if err := tx.Create(&freeze).Error; err != nil {
+			return err
+		}
+		if rule.FreezeCost == 0 {
+			return nil
+		}
+		spent, err = points.SpendWithTx(tx, userID, models.PointsSourceStreakFreeze, &freeze.ID, rule.FreezeCost,
+			"购买连续打卡保护卡", fmt.Sprintf("streak_freeze:%d", freeze.ID))
+		if err != nil {
+			return err
+		}
+		freeze.LedgerID = spent.Ledger.ID
+		return tx.Model(&freeze).UpdateColumn("ledger_id", spent.Ledger.ID).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &freeze, spent, nil
+}
+
+// activeDays 按规则汇总用户所有活跃日期（用户时区的日历日）
+func activeDays(db *gorm.DB, rule models.StreakRule, userID uint64, loc *time.Location) (map[string]bool, error) {
+	days := make(map[string]bool)
+	if rule.CountCheckIn {
+		var times []time.Time
+		if err := db.Model(&models.PointsLedger{}).
+			Where("user_id = ? AND source_type = ? AND reversal_of IS NULL", userID, models.PointsSourceDailyCheckIn).
+			Pluck("created_at", &times).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range times {
+			days[usertime.DayKey(t, loc)] = true
+		}
+	}
+	if rule.MinStudyMinutes > 0 {
+		var dates []time.Time
+		if err := db.Model(&models.DailyStudyStat{}).
+			Where("user_id = ? AND minutes >= ?", userID, rule.MinStudyMinutes).
+			Pluck("date", &dates).Error; err != nil {
+			return nil, err
+		}
+		// DATE 列保存的即为用户时区的日历日
+		for _, d := range dates {
+			days[d.Format(dayLayout)] = true
+		}
+	}
+	if rule.CountTaskCompletion {
+		// 完成归属负责人，无负责人时归属创建者，与完成计数的口径保持一致
+		var times []time.Time
+		if err := db.Model(&models.Task{}).
+			Where("status = ? AND completed_at IS NOT NULL AND (owner_user_id = ? OR (owner_user_id IS NULL AND created_by = ?))", 2, userID, userID).
+			Pluck("completed_at", &times).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range times {
+			days[usertime.DayKey(t, loc)] = true
+		}
+	}
+	return days, nil
+}
+
+// freezes 返回已使用保护卡覆盖的日期与可用保护卡数量
+func freezes(db *gorm.DB, userID uint64) (map[string]bool, int, error) {
+	var cards []models.StreakFreeze
+	if err := db.Select("status", "used_date").Where("user_id = ?", userID).Find(&cards).Error; err != nil {
+		return nil, 0, err
+	}
+	frozen := make(map[string]bool)
+	available := 0
+	for _, card := range cards {
+		switch {
+		case card.Status == models.StreakFreezeStatusAvailable:
+			available++
+		case card.UsedDate != nil:
+			frozen[card.UsedDate.Format(dayLayout)] = true
+		}
+	}
+	return frozen, available, nil
+}
+
+// uncoveredGap 返回最近一次活跃（或已保护）日期之后、昨天及以前未被覆盖的日期，按日期倒序。
+// 今天尚未结束不计入空档
+func uncoveredGap(active, frozen map[string]bool, today time.Time) []time.Time {
+	earliest := earliestDay(active, today.Location())
+	if earliest.IsZero() {
+		return nil
+	}
+	var gap []time.Time
+	// earliest 本身是活跃日，扫描必然在它之前停止
+	for day := usertime.AddDays(today, -1); day.After(earliest); day = usertime.AddDays(day, -1) {
+		key := day.Format(dayLayout)
+		if active[key] || frozen[key] {
+			break
+		}
+		gap = append(gap, day)
+	}
+	return gap
+}
+
+// summarize 从最早的活跃日逐日扫描到今天，划分连续记录。今天尚未活跃时不中断当前记录
+func summarize(active, frozen map[string]bool, today time.Time) *Summary {
+	summary := &Summary{FrozenDates: make([]string, 0, len(frozen)), Runs: []Run{}}
+	for key := range frozen {
+		summary.FrozenDates = append(summary.FrozenDates, key)
+	}
+	sort.Strings(summary.FrozenDates)
+	todayKey := today.Format(dayLayout)
+	summary.TodayActive = active[todayKey]
+
+	earliest := earliestDay(active, today.Location())
+	if earliest.IsZero() {
+		return summary
+	}
+
+	var runs []Run
+	var current *Run
+	// pendingFreezes 记录末尾连续的保护日，之后出现活跃日才计入当前记录
+	pendingFreezes, pendingEnd := 0, ""
+	for day := earliest; !day.After(today); day = usertime.AddDays(day, 1) {
+		key := day.Format(dayLayout)
+		switch {
+		case active[key]:
+			summary.LastActiveDate = key
+			if current == nil {
+				runs = append(runs, Run{StartDate: key})
+				current = &runs[len(runs)-1]
+			}
+			current.Days++
+			current.FreezesUsed += pendingFreezes
+			current.EndDate = key
+			pendingFreezes, pendingEnd = 0, ""
+		case frozen[key] && current != nil:
+			pendingFreezes++
+			pendingEnd = key
+		case key == todayKey:
+			// 今天还没有活跃记录，不视为中断
+		default:
+			current, pendingFreezes, pendingEnd = nil, 0, ""
+		}
+	}
+	if current != nil && pendingFreezes > 0 {
+		current.FreezesUsed += pendingFreezes
+		current.EndDate = pendingEnd
+	}
+
+	if current != nil {
+		summary.Current = current.Days
+	}
+	for _, run := range runs {
+		if run.Days > summary.Longest {
+			summary.Longest = run.Days
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].Days != runs[j].Days {
+			return runs[i].Days > runs[j].Days
+		}
+		return runs[i].StartDate > runs[j].StartDate
+	})
+	if len(runs) > MaxRuns {
+		runs = runs[:MaxRuns]
+	}
+	summary.Runs = runs
+	return summary
+}
+
+func earliestDay(active map[string]bool, loc *time.Location) time.Time {
+	var earliest string
+	for key := range active {
+		if earliest == "" || key < earliest {
+			earliest = key
+		}
+	}
+	if earliest == "" {
+		return time.Time{}
+	}
+	day, err := time.ParseInLocation(dayLayout, earliest, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return day
+}
@@ -0,0 +1,76 @@
+package streak
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/points"
+)
+
+func TestSummarizeBridgesFrozenDaysAndKeepsTodayOpen(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	active := map[string]bool{"2026-03-01": true, "2026-03-02": true, "2026-03-04": true, "2026-03-05": true, "2026-03-06": true,
+		"2026-03-09": true}
+	frozen := map[string]bool{"2026-03-03": true}
+
+	summary := summarize(active, frozen, day(10))
+	if summary.Current != 1 || summary.Longest != 5 || summary.TodayActive {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if len(summary.Runs) != 2 || summary.Runs[0] != (Run{StartDate: "2026-03-01", EndDate: "2026-03-06", Days: 5, FreezesUsed: 1}) {
+		t.Fatalf("unexpected runs %+v", summary.Runs)
+	}
+	if summary := summarize(active, frozen, day(11)); summary.Current != 0 {
+		t.Fatalf("a missed day must break the streak, got %d", summary.Current)
+	}
+}
+
+func TestRefreshUsesFreezesAcrossSources(t *testing.T) {
+	db := testdb.Open(t)
+	userID := uint64(7)
+	db.Create(&models.UserSetting{UserID: userID, Timezone: "UTC"})
+	db.Create(&models.UserProfile{UserID: userID, TotalPoints: 150})
+	db.Create(&models.StreakRule{CountCheckIn: true, MinStudyMinutes: 20, CountTaskCompletion: true, FreezeCost: 100, MaxFreezes: 1})
+
+	at := func(d int) time.Time { return time.Date(2026, 3, d, 9, 0, 0, 0, time.UTC) }
+	checkIn := models.PointsLedger{UserID: userID, SourceType: models.PointsSourceDailyCheckIn, Delta: 2}
+	db.Create(&checkIn)
+	db.Model(&checkIn).UpdateColumn("created_at", at(1))
+	db.Create(&models.DailyStudyStat{UserID: userID, Date: time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local), Minutes: 30})
+	// 未达到学习时长门槛的日期不算活跃
+	db.Create(&models.DailyStudyStat{UserID: userID, Date: time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local), Minutes: 5})
+	completedAt := at(3)
+	db.Create(&models.Task{Title: "t", TaskType: 1, CreatedBy: userID, Status: 2, CompletedAt: &completedAt})
+
+	if _, _, err := PurchaseFreeze(db, userID); err != nil {
+		t.Fatalf("purchase: %v", err)
+	}
+	if _, _, err := PurchaseFreeze(db, userID); !errors.Is(err, ErrFreezeLimit) {
+		t.Fatalf("expected freeze limit, got %v", err)
+	}
+
+	summary, err := Refresh(db, userID, at(5))
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if summary.Current != 3 || summary.FreezesAvailable != 0 || len(summary.FrozenDates) != 1 || summary.FrozenDates[0] != "2026-03-04" {
+		t.Fatalf("expected the freeze to cover 03-04, got %+v", summary)
+	}
+	var profile models.UserProfile
+	db.Where("user_id = ?", userID).First(&profile)
+	if profile.StreakDays != 3 || profile.LongestStreakDays != 3 || profile.TotalPoints != 50 {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+
+	if _, _, err := PurchaseFreeze(db, userID); !errors.Is(err, points.ErrInsufficientPoints) {
+		t.Fatalf("expected insufficient points, got %v", err)
+	}
+	summary, _ = Refresh(db, userID, at(7))
+	db.Where("user_id = ?", userID).First(&profile)
+	if summary.Current != 0 || profile.StreakDays != 0 || profile.LongestStreakDays != 3 {
+		t.Fatalf("expected broken streak keeping the longest, got %+v %+v", summary, profile)
+	}
+}
@@ -0,0 +1,252 @@
+package studyguard
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"learningAssistant-backend/config"
+	"learningAssistant-backend/models"
+)
+
+const (
+	RuleIdleGap    = "idle_gap"
+	RuleMaxSession = "max_session"
+	RuleOverlap    = "overlap"
+	RuleDailyCap   = "daily_cap"
+
+	defaultMaxSessionMinutes = 240
+	defaultPingGapSeconds    = 90
+	defaultMaxDailyMinutes   = 960
+)
+
+// Adjustment 单条扣减说明
+type Adjustment struct {
+	Rule            string `json:"rule"`
+	DeductedMinutes int    `json:"deducted_minutes"`
+	Detail          string `json:"detail"`
+}
+
+// Interval 同一用户已计入的其他会话时间段
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// SessionInput 待校验的会话
+type SessionInput struct {
+	Start       time.Time
+	End         time.Time
+	IdleSeconds int
+	Others      []Interval
+}
+
+// Result 会话校验结果
+type Result struct {
+	RawMinutes      int          `json:"raw_minutes"`
+	CreditedMinutes int          `json:"credited_minutes"`
+	Adjustments     []Adjustment `json:"adjustments"`
+}
+
+// CurrentConfig 读取校验配置，未加载配置时使用默认值
+func CurrentConfig() config.StudyConfig {
+	cfg := config.StudyConfig{}
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.Study
+	}
+	if cfg.MaxSessionMinutes <= 0 {
+		cfg.MaxSessionMinutes = defaultMaxSessionMinutes
+	}
+	if cfg.PingGapSeconds <= 0 {
+		cfg.PingGapSeconds = defaultPingGapSeconds
+	}
+	if cfg.MaxDailyMinutes <= 0 {
+		cfg.MaxDailyMinutes = defaultMaxDailyMinutes
+	}
+	return cfg
+}
+
+// IsGap 判断两次心跳之间是否出现了可疑的长时间间隔
+func IsGap(cfg config.StudyConfig, lastPing, now time.Time) bool {
+	return now.Sub(lastPing) > time.Duration(cfg.PingGapSeconds)*time.Second
+}
+
+// EvaluateSession 按离开时长、与其他会话重叠、单次时长上限依次扣减
+func EvaluateSession(cfg config.StudyConfig, in SessionInput) Result {
+	raw := durationMinutes(in.Start, in.End)
+	result := Result{RawMinutes: raw, CreditedMinutes: raw, Adjustments: []Adjustment{}}
+	if raw == 0 {
+		return result
+	}
+
+	if idle := in.IdleSeconds / 60; idle > 0 {
+		deduct := minInt(idle, result.CreditedMinutes)
+		result.CreditedMinutes -= deduct
+		result.Adjustments = append(result.Adjustments, Adjustment{
+			Rule:            RuleIdleGap,
+			DeductedMinutes: deduct,
+			Detail:          fmt.Sprintf("心跳中断或无操作累计 %d 分钟", idle),
+		})
+	}
+
+	if overlap := overlapMinutes(in.Start, in.End, in.Others); overlap > 0 && result.CreditedMinutes > 0 {
+		deduct := minInt(overlap, result.CreditedMinutes)
+		result.CreditedMinutes -= deduct
+		result.Adjustments = append(result.Adjustments, Adjustment{
+			Rule:            RuleOverlap,
+			DeductedMinutes: deduct,
+			Detail:          fmt.Sprintf("与同时进行的其他学习会话重叠 %d 分钟", overlap),
+		})
+	}
+
+	if result.CreditedMinutes > cfg.MaxSessionMinutes {
+		deduct := result.CreditedMinutes - cfg.MaxSessionMinutes
+		result.CreditedMinutes = cfg.MaxSessionMinutes
+		result.Adjustments = append(result.Adjustments, Adjustment{
+			Rule:            RuleMaxSession,
+			DeductedMinutes: deduct,
+			Detail:          fmt.Sprintf("单次会话最多计入 %d 分钟", cfg.MaxSessionMinutes),
+		})
+	}
+	return result
+}
+
+// ClipDaily 单日总时长超过上限时返回需要扣减的分钟数
+func ClipDaily(cfg config.StudyConfig, minutes int) int {
+	if minutes <= cfg.MaxDailyMinutes {
+		return 0
+	}
+	return minutes - cfg.MaxDailyMinutes
+}
+
+// DailyRemaining 扣除同一天内已结束的其他会话后，当日还可计入的分钟数，
+// 与日聚合按结束时间归属日期、按 ClipDaily 截断的口径一致
+func DailyRemaining(db *gorm.DB, cfg config.StudyConfig, userID, sessionID uint64, dayStart, dayEnd time.Time) (int, error) {
+	var used int
+	if err := db.Model(&models.StudySession{}).
+		Select("COALESCE(SUM(duration_minutes),0)").
+		Where("user_id = ? AND id <> ? AND end_time >= ? AND end_time < ?", userID, sessionID, dayStart, dayEnd).
+		Scan(&used).Error; err != nil {
+		return 0, err
+	}
+	if used >= cfg.MaxDailyMinutes {
+		return 0, nil
+	}
+	return cfg.MaxDailyMinutes - used, nil
+}
+
+// LoadOtherIntervals 读取同一用户与给定时间段相交、且已计入时长的其他会话
+func LoadOtherIntervals(db *gorm.DB, userID, sessionID uint64, start, end time.Time) ([]Interval, error) {
+	var sessions []models.StudySession
+	if err := db.Where("user_id = ? AND id <> ? AND end_time IS NOT NULL AND duration_minutes > 0", userID, sessionID).
+		Where("start_time < ? AND end_time > ?", end, start).
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	intervals := make([]Interval, 0, len(sessions))
+	for _, s := range sessions {
+		intervals = append(intervals, Interval{Start: s.StartTime, End: *s.EndTime})
+	}
+	return intervals, nil
+}
+
+// RecordSessionAdjustments 保存单个会话的扣减记录
+func RecordSessionAdjustments(db *gorm.DB, session *models.StudySession, day time.Time, adjustments []Adjustment) error {
+	if len(adjustments) == 0 {
+		return nil
+	}
+	sessionID := session.ID
+	records := make([]models.StudySessionAdjustment, 0, len(adjustments))
+	for _, adj := range adjustments {
+		records = append(records, models.StudySessionAdjustment{
+			UserID:          session.UserID,
+			Date:            day,
+			SessionID:       &sessionID,
+			Rule:            adj.Rule,
+			DeductedMinutes: adj.DeductedMinutes,
+			Detail:          adj.Detail,
+		})
+	}
+	return db.Create(&records).Error
+}
+
+// ReplaceDailyCapAdjustment 重新聚合时覆盖当日的日上限扣减记录
+func ReplaceDailyCapAdjustment(db *gorm.DB, userID uint64, day time.Time, deducted, limit int) error {
+	if err := db.Where("user_id = ? AND date = ? AND rule = ?", userID, day, RuleDailyCap).
+		Delete(&models.StudySessionAdjustment{}).Error; err != nil {
+		return err
+	}
+	if deducted <= 0 {
+		return nil
+	}
+	return db.Create(&models.StudySessionAdjustment{
+		UserID:          userID,
+		Date:            day,
+		Rule:            RuleDailyCap,
+		DeductedMinutes: deducted,
+		Detail:          fmt.Sprintf("单日最多计入 %d 分钟", limit),
+	}).Error
+}
+
+// overlapMinutes 计算 [start,end) 与其他时间段并集的重叠分钟数
+func overlapMinutes(start, end time.Time, others []Interval) int {
+	if len(others) == 0 {
+		return 0
+	}
+	clipped := make([]Interval, 0, len(others))
+	for _, o := range others {
+		s, e := o.Start, o.End
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			clipped = append(clipped, Interval{Start: s, End: e})
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool { return clipped[i].Start.Before(clipped[j].Start) })
+
+	var total time.Duration
+	var cur *Interval
+	for i := range clipped {
+		iv := clipped[i]
+		if cur == nil {
+			cur = &Interval{Start: iv.Start, End: iv.End}
+			continue
+		}
+		if !iv.Start.After(cur.End) {
+			if iv.End.After(cur.End) {
+				cur.End = iv.End
+			}
+			continue
+		}
+		total += cur.End.Sub(cur.Start)
+		cur = &Interval{Start: iv.Start, End: iv.End}
+	}
+	if cur != nil {
+		total += cur.End.Sub(cur.Start)
+	}
+	return int(total.Minutes())
+}
+
+func durationMinutes(start, end time.Time) int {
+	if end.Before(start) {
+		return 0
+	}
+	duration := int(end.Sub(start).Minutes())
+	if duration == 0 && !end.Equal(start) {
+		return 1
+	}
+	return duration
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
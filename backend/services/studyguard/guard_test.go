@@ -0,0 +1,69 @@
+package studyguard
+
+import (
+	"testing"
+	"time"
+
+	"learningAssistant-backend/config"
+)
+
+var guardStart = time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC)
+
+func clock(minutes int) time.Time { return guardStart.Add(time.Duration(minutes) * time.Minute) }
+
+func span(from, to int) Interval { return Interval{Start: clock(from), End: clock(to)} }
+
+func TestEvaluateSessionAppliesRulesInOrder(t *testing.T) {
+	cfg := config.StudyConfig{MaxSessionMinutes: 120, PingGapSeconds: 90, MaxDailyMinutes: 300}
+	cases := []struct {
+		name     string
+		in       SessionInput
+		raw      int
+		credited int
+		rules    []string
+		deducted []int
+	}{
+		{"clean session", SessionInput{Start: clock(0), End: clock(60)}, 60, 60, nil, nil},
+		{"sub-minute session counts as one", SessionInput{Start: clock(0), End: clock(0).Add(20 * time.Second)}, 1, 1, nil, nil},
+		{"end before start", SessionInput{Start: clock(10), End: clock(0)}, 0, 0, nil, nil},
+		{"idle seconds round down", SessionInput{Start: clock(0), End: clock(60), IdleSeconds: 15*60 + 59}, 60, 45, []string{RuleIdleGap}, []int{15}},
+		{"idle longer than session", SessionInput{Start: clock(0), End: clock(10), IdleSeconds: 3600}, 10, 0, []string{RuleIdleGap}, []int{10}},
+		{"overlap clipped to session", SessionInput{Start: clock(0), End: clock(60), Others: []Interval{span(-30, 20)}}, 60, 40, []string{RuleOverlap}, []int{20}},
+		// 互相重叠的其他会话按并集计算，不重复扣减
+		{"overlapping others merged", SessionInput{Start: clock(0), End: clock(60), Others: []Interval{span(30, 50), span(10, 40), span(55, 90)}}, 60, 15, []string{RuleOverlap}, []int{45}},
+		{"disjoint others ignored", SessionInput{Start: clock(0), End: clock(60), Others: []Interval{span(-60, 0), span(60, 90)}}, 60, 60, nil, nil},
+		{"max session after other rules", SessionInput{Start: clock(0), End: clock(200), IdleSeconds: 30 * 60}, 200, 120, []string{RuleIdleGap, RuleMaxSession}, []int{30, 50}},
+		{"overlap leaves nothing to clip", SessionInput{Start: clock(0), End: clock(200), Others: []Interval{span(0, 100)}}, 200, 100, []string{RuleOverlap}, nil},
+		{"all rules", SessionInput{Start: clock(0), End: clock(300), IdleSeconds: 20 * 60, Others: []Interval{span(100, 140)}}, 300, 120, []string{RuleIdleGap, RuleOverlap, RuleMaxSession}, []int{20, 40, 120}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := EvaluateSession(cfg, tc.in)
+			if result.RawMinutes != tc.raw || result.CreditedMinutes != tc.credited || len(result.Adjustments) != len(tc.rules) {
+				t.Fatalf("got raw %d credited %d adjustments %+v", result.RawMinutes, result.CreditedMinutes, result.Adjustments)
+			}
+			total := 0
+			for i, adj := range result.Adjustments {
+				if adj.Rule != tc.rules[i] || (tc.deducted != nil && adj.DeductedMinutes != tc.deducted[i]) {
+					t.Fatalf("unexpected adjustment %d: %+v", i, adj)
+				}
+				total += adj.DeductedMinutes
+			}
+			if result.RawMinutes-total != result.CreditedMinutes {
+				t.Fatalf("adjustments %+v do not explain %d -> %d", result.Adjustments, result.RawMinutes, result.CreditedMinutes)
+			}
+		})
+	}
+}
+
+func TestClipDailyAndGapDetection(t *testing.T) {
+	cfg := config.StudyConfig{MaxSessionMinutes: 120, PingGapSeconds: 90, MaxDailyMinutes: 300}
+	for minutes, want := range map[int]int{0: 0, 299: 0, 300: 0, 301: 1, 960: 660} {
+		if got := ClipDaily(cfg, minutes); got != want {
+			t.Fatalf("ClipDaily(%d) = %d, want %d", minutes, got, want)
+		}
+	}
+	if IsGap(cfg, clock(0), clock(0).Add(90*time.Second)) || !IsGap(cfg, clock(0), clock(0).Add(91*time.Second)) {
+		t.Fatal("expected gaps longer than the ping window only to be flagged")
+	}
+}
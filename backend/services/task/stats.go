@@ -7,6 +7,7 @@ import (
 
 	"learningAssistant-backend/database"
 	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/usertime"
 )
 
 // DailyBarStat 封装单个时间粒度的任务统计
@@ -33,137 +34,111 @@ type MonthlyCompletionStat struct {
 	Rate      int    `json:"rate"`
 }
 
-// GetBarStats 统计当前自然日/周/月/季度的任务到期完成情况
-func GetBarStats(rangeKey string, userID uint64) (*BarStats, error) {
+// GetBarStats 统计用户时区下当前自然日/周/月/季度的任务到期完成情况
+func GetBarStats(rangeKey string, userID uint64, loc *time.Location) (*BarStats, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	now := time.Now().In(loc)
 	switch rangeKey {
 	case "day":
-		return calcDailyStats(userID)
+		return calcDailyStats(userID, now)
 	case "month":
-		return calcMonthlyStats(userID)
+		return calcMonthlyStats(userID, now)
 	case "quarter":
-		return calcQuarterStats(userID)
+		return calcQuarterStats(userID, now)
 	default:
-		return calcWeeklyStats(userID)
+		return calcWeeklyStats(userID, now)
 	}
 }
 
 // GetWeeklyBarStats 为兼容保留的周统计方法
-func GetWeeklyBarStats(userID uint64) (*BarStats, error) {
-	return calcWeeklyStats(userID)
+func GetWeeklyBarStats(userID uint64, loc *time.Location) (*BarStats, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	return calcWeeklyStats(userID, time.Now().In(loc))
 }
 
 // GetRecentMonthlyCompletion 返回最近 N 个月（含当月）的截止任务完成率
-func GetRecentMonthlyCompletion(userID uint64, months int) ([]MonthlyCompletionStat, error) {
+func GetRecentMonthlyCompletion(userID uint64, months int, loc *time.Location) ([]MonthlyCompletionStat, error) {
 	if months <= 0 {
 		months = 3
 	}
+	if loc == nil {
+		loc = time.Local
+	}
 
-	now := time.Now().In(time.Local)
+	now := time.Now().In(loc)
 	stats := make([]MonthlyCompletionStat, 0, months)
 
 	for i := months - 1; i >= 0; i-- {
-		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -i, 0)
-		monthEnd := monthStart.AddDate(0, 1, 0)
+		monthStart := time.Date(now.Year(), now.Month()-time.Month(i), 1, 0, 0, 0, 0, loc)
+		monthEnd := time.Date(monthStart.Year(), monthStart.Month()+1, 1, 0, 0, 0, 0, loc)
 
-		stat, err := queryMonthlyCompletion(userID, monthStart, monthEnd)
+		buckets, err := bucketDueTasks(userID, monthStart, monthEnd, 1, func(time.Time) int { return 0 })
 		if err != nil {
 			return nil, err
 		}
-		stats = append(stats, *stat)
+		stats = append(stats, MonthlyCompletionStat{
+			Month:     monthStart.Format("2006-01"),
+			TotalDue:  buckets[0].total,
+			Completed: buckets[0].completed,
+			Rate:      calcRate(buckets[0].completed, buckets[0].total),
+		})
 	}
 
 	return stats, nil
 }
 
-func queryMonthlyCompletion(userID uint64, start, end time.Time) (*MonthlyCompletionStat, error) {
-	var total, completed int64
+type dueBucket struct {
+	total     int64
+	completed int64
+}
 
-	db := database.GetDB()
-	if err := db.Model(&models.Task{}).
-		Where("owner_user_id = ? AND deleted_at IS NULL AND due_at IS NOT NULL AND due_at >= ? AND due_at < ?", userID, start, end).
-		Count(&total).Error; err != nil {
+// bucketDueTasks 读取 [start, end) 内到期的任务，并按 indexOf 返回的下标在用户时区内分桶
+func bucketDueTasks(userID uint64, start, end time.Time, size int, indexOf func(due time.Time) int) ([]dueBucket, error) {
+	var tasks []models.Task
+	if err := database.GetDB().
+		Select("id", "status", "due_at", "completed_at").
+		Where("owner_user_id = ? AND due_at IS NOT NULL AND due_at >= ? AND due_at < ?", userID, start, end).
+		Find(&tasks).Error; err != nil {
 		return nil, err
 	}
 
-	if err := db.Model(&models.Task{}).
-		Where("owner_user_id = ? AND status = 2 AND completed_at IS NOT NULL AND deleted_at IS NULL AND due_at IS NOT NULL AND due_at >= ? AND due_at < ?", userID, start, end).
-		Count(&completed).Error; err != nil {
-		return nil, err
+	buckets := make([]dueBucket, size)
+	for _, t := range tasks {
+		idx := indexOf(t.DueAt.In(start.Location()))
+		if idx < 0 || idx >= size {
+			continue
+		}
+		buckets[idx].total++
+		if t.Status == 2 && t.CompletedAt != nil {
+			buckets[idx].completed++
+		}
 	}
-
-	return &MonthlyCompletionStat{
-		Month:     start.Format("2006-01"),
-		TotalDue:  total,
-		Completed: completed,
-		Rate:      calcRate(completed, total),
-	}, nil
+	return buckets, nil
 }
 
-func calcWeeklyStats(userID uint64) (*BarStats, error) {
-	startOfWeek := getWeekStart(time.Now().In(time.Local))
-	endOfWeek := startOfWeek.AddDate(0, 0, 7)
+func calcWeeklyStats(userID uint64, now time.Time) (*BarStats, error) {
+	startOfWeek := getWeekStart(now)
+	endOfWeek := usertime.AddDays(startOfWeek, 7)
 
-	var rows []struct {
-		Offset    int    `gorm:"column:offset"`
-		Day       string `gorm:"column:day"`
-		Total     int64  `gorm:"column:total"`
-		Completed int64  `gorm:"column:completed"`
-	}
-
-	sql := `WITH RECURSIVE week_days AS (
-                SELECT 0 AS offset
-                UNION ALL
-                SELECT offset + 1 FROM week_days WHERE offset < 6
-            ),
-            due_stats AS (
-                SELECT DATE(due_at) AS day_date, COUNT(*) AS total
-                FROM tasks
-                WHERE owner_user_id = ?
-                  AND deleted_at IS NULL
-                  AND due_at IS NOT NULL
-                  AND due_at >= ?
-                  AND due_at < ?
-                GROUP BY DATE(due_at)
-            ),
-            completed_due AS (
-                SELECT DATE(due_at) AS day_date, COUNT(*) AS completed
-                FROM tasks
-                WHERE owner_user_id = ?
-                  AND status = 2
-                  AND completed_at IS NOT NULL
-                  AND deleted_at IS NULL
-                  AND due_at IS NOT NULL
-                  AND due_at >= ?
-                  AND due_at < ?
-                GROUP BY DATE(due_at)
-            )
-            SELECT
-                w.offset,
-                DATE_FORMAT(DATE_ADD(?, INTERVAL w.offset DAY), '%Y-%m-%d') AS day,
-                COALESCE(ds.total, 0) AS total,
-                COALESCE(cd.completed, 0) AS completed
-            FROM week_days w
-            LEFT JOIN due_stats ds ON ds.day_date = DATE_ADD(?, INTERVAL w.offset DAY)
-            LEFT JOIN completed_due cd ON cd.day_date = DATE_ADD(?, INTERVAL w.offset DAY)
-            ORDER BY w.offset;`
-
-	if err := database.GetDB().Raw(sql,
-		userID, startOfWeek, endOfWeek,
-		userID, startOfWeek, endOfWeek,
-		startOfWeek, startOfWeek, startOfWeek,
-	).Scan(&rows).Error; err != nil {
+	buckets, err := bucketDueTasks(userID, startOfWeek, endOfWeek, 7, func(due time.Time) int {
+		return usertime.DaysBetween(startOfWeek, due)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	dayLabels := []string{"周一", "周二", "周三", "周四", "周五", "周六", "周日"}
 	data := make([]DailyBarStat, 0, len(dayLabels))
-
-	for _, row := range rows {
+	for offset, bucket := range buckets {
 		data = append(data, DailyBarStat{
-			Day:       safeLabel(dayLabels, row.Offset, row.Day),
-			Total:     row.Total,
-			Completed: row.Completed,
-			Rate:      calcRate(row.Completed, row.Total),
+			Day:       safeLabel(dayLabels, offset, usertime.AddDays(startOfWeek, offset).Format("2006-01-02")),
+			Total:     bucket.total,
+			Completed: bucket.completed,
+			Rate:      calcRate(bucket.completed, bucket.total),
 		})
 	}
 
@@ -176,35 +151,19 @@ func calcWeeklyStats(userID uint64) (*BarStats, error) {
 	}, nil
 }
 
-func calcDailyStats(userID uint64) (*BarStats, error) {
-	now := time.Now().In(time.Local)
-	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	end := start.AddDate(0, 0, 1)
-
-	var row struct {
-		Day       string `gorm:"column:day"`
-		Total     int64  `gorm:"column:total"`
-		Completed int64  `gorm:"column:completed"`
-	}
-
-	sql := `SELECT
-				DATE_FORMAT(?, '%Y-%m-%d') AS day,
-				(SELECT COUNT(*) FROM tasks WHERE owner_user_id = ? AND deleted_at IS NULL AND due_at IS NOT NULL AND due_at >= ? AND due_at < ?) AS total,
-				(SELECT COUNT(*) FROM tasks WHERE owner_user_id = ? AND status = 2 AND completed_at IS NOT NULL AND deleted_at IS NULL AND due_at IS NOT NULL AND due_at >= ? AND due_at < ?) AS completed`
+func calcDailyStats(userID uint64, now time.Time) (*BarStats, error) {
+	start, end := usertime.DayBounds(now, now.Location())
 
-	if err := database.GetDB().Raw(sql,
-		start,
-		userID, start, end,
-		userID, start, end,
-	).Scan(&row).Error; err != nil {
+	buckets, err := bucketDueTasks(userID, start, end, 1, func(time.Time) int { return 0 })
+	if err != nil {
 		return nil, err
 	}
 
 	stat := DailyBarStat{
 		Day:       "今日",
-		Total:     row.Total,
-		Completed: row.Completed,
-		Rate:      calcRate(row.Completed, row.Total),
+		Total:     buckets[0].total,
+		Completed: buckets[0].completed,
+		Rate:      calcRate(buckets[0].completed, buckets[0].total),
 	}
 
 	return &BarStats{
@@ -214,73 +173,25 @@ func calcDailyStats(userID uint64) (*BarStats, error) {
 	}, nil
 }
 
-func calcMonthlyStats(userID uint64) (*BarStats, error) {
-	now := time.Now().In(time.Local)
+func calcMonthlyStats(userID uint64, now time.Time) (*BarStats, error) {
 	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	end := start.AddDate(0, 1, 0)
-	daysInMonth := end.AddDate(0, 0, -1).Day()
-
-	var rows []struct {
-		Offset    int    `gorm:"column:offset"`
-		Day       string `gorm:"column:day"`
-		Total     int64  `gorm:"column:total"`
-		Completed int64  `gorm:"column:completed"`
-	}
+	end := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	daysInMonth := usertime.DaysBetween(start, end)
 
-	sql := `WITH RECURSIVE month_days AS (
-                SELECT 0 AS offset
-                UNION ALL
-                SELECT offset + 1 FROM month_days WHERE offset + 1 < ?
-            ),
-            due_stats AS (
-                SELECT DATE(due_at) AS day_date, COUNT(*) AS total
-                FROM tasks
-                WHERE owner_user_id = ?
-                  AND deleted_at IS NULL
-                  AND due_at IS NOT NULL
-                  AND due_at >= ?
-                  AND due_at < ?
-                GROUP BY DATE(due_at)
-            ),
-            completed_due AS (
-                SELECT DATE(due_at) AS day_date, COUNT(*) AS completed
-                FROM tasks
-                WHERE owner_user_id = ?
-                  AND status = 2
-                  AND completed_at IS NOT NULL
-                  AND deleted_at IS NULL
-                  AND due_at IS NOT NULL
-                  AND due_at >= ?
-                  AND due_at < ?
-                GROUP BY DATE(due_at)
-            )
-            SELECT
-                d.offset,
-                DATE_FORMAT(DATE_ADD(?, INTERVAL d.offset DAY), '%Y-%m-%d') AS day,
-                COALESCE(ds.total, 0) AS total,
-                COALESCE(cd.completed, 0) AS completed
-            FROM month_days d
-            LEFT JOIN due_stats ds ON ds.day_date = DATE_ADD(?, INTERVAL d.offset DAY)
-            LEFT JOIN completed_due cd ON cd.day_date = DATE_ADD(?, INTERVAL d.offset DAY)
-            ORDER BY d.offset;`
-
-	if err := database.GetDB().Raw(sql,
-		daysInMonth,
-		userID, start, end,
-		userID, start, end,
-		start, start, start,
-	).Scan(&rows).Error; err != nil {
+	buckets, err := bucketDueTasks(userID, start, end, daysInMonth, func(due time.Time) int {
+		return due.Day() - 1
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	data := make([]DailyBarStat, 0, daysInMonth)
-	for _, row := range rows {
-		label := fmt.Sprintf("%d日", row.Offset+1)
+	for offset, bucket := range buckets {
 		data = append(data, DailyBarStat{
-			Day:       label,
-			Total:     row.Total,
-			Completed: row.Completed,
-			Rate:      calcRate(row.Completed, row.Total),
+			Day:       fmt.Sprintf("%d日", offset+1),
+			Total:     bucket.total,
+			Completed: bucket.completed,
+			Rate:      calcRate(bucket.completed, bucket.total),
 		})
 	}
 
@@ -291,73 +202,25 @@ func calcMonthlyStats(userID uint64) (*BarStats, error) {
 	}, nil
 }
 
-func calcQuarterStats(userID uint64) (*BarStats, error) {
-	now := time.Now().In(time.Local)
+func calcQuarterStats(userID uint64, now time.Time) (*BarStats, error) {
 	quarterStartMonth := ((int(now.Month())-1)/3)*3 + 1
 	start := time.Date(now.Year(), time.Month(quarterStartMonth), 1, 0, 0, 0, 0, now.Location())
-	end := start.AddDate(0, 3, 0)
-
-	var rows []struct {
-		Offset    int    `gorm:"column:offset"`
-		Day       string `gorm:"column:day"`
-		Total     int64  `gorm:"column:total"`
-		Completed int64  `gorm:"column:completed"`
-	}
+	end := time.Date(start.Year(), start.Month()+3, 1, 0, 0, 0, 0, now.Location())
 
-	sql := `WITH RECURSIVE months AS (
-                SELECT 0 AS offset
-                UNION ALL
-                SELECT offset + 1 FROM months WHERE offset + 1 < 3
-            ),
-            due_stats AS (
-                SELECT DATE_FORMAT(due_at, '%Y-%m-01') AS month_date, COUNT(*) AS total
-                FROM tasks
-                WHERE owner_user_id = ?
-                  AND deleted_at IS NULL
-                  AND due_at IS NOT NULL
-                  AND due_at >= ?
-                  AND due_at < ?
-                GROUP BY YEAR(due_at), MONTH(due_at)
-            ),
-            completed_due AS (
-                SELECT DATE_FORMAT(due_at, '%Y-%m-01') AS month_date, COUNT(*) AS completed
-                FROM tasks
-                WHERE owner_user_id = ?
-                  AND status = 2
-                  AND completed_at IS NOT NULL
-                  AND deleted_at IS NULL
-                  AND due_at IS NOT NULL
-                  AND due_at >= ?
-                  AND due_at < ?
-                GROUP BY YEAR(due_at), MONTH(due_at)
-            )
-            SELECT
-                m.offset,
-                DATE_FORMAT(DATE_ADD(?, INTERVAL m.offset MONTH), '%Y-%m-01') AS day,
-                COALESCE(ds.total, 0) AS total,
-                COALESCE(cd.completed, 0) AS completed
-            FROM months m
-            LEFT JOIN due_stats ds ON ds.month_date = DATE_ADD(?, INTERVAL m.offset MONTH)
-            LEFT JOIN completed_due cd ON cd.month_date = DATE_ADD(?, INTERVAL m.offset MONTH)
-            ORDER BY m.offset;`
-
-	if err := database.GetDB().Raw(sql,
-		userID, start, end,
-		userID, start, end,
-		start, start, start,
-	).Scan(&rows).Error; err != nil {
+	buckets, err := bucketDueTasks(userID, start, end, 3, func(due time.Time) int {
+		return int(due.Month()) - quarterStartMonth
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	data := make([]DailyBarStat, 0, 3)
-	for _, row := range rows {
-		monthLabel := start.AddDate(0, row.Offset, 0).Month()
-		label := fmt.Sprintf("%d月", monthLabel)
+	for offset, bucket := range buckets {
 		data = append(data, DailyBarStat{
-			Day:       label,
-			Total:     row.Total,
-			Completed: row.Completed,
-			Rate:      calcRate(row.Completed, row.Total),
+			Day:       fmt.Sprintf("%d月", start.AddDate(0, offset, 0).Month()),
+			Total:     bucket.total,
+			Completed: bucket.completed,
+			Rate:      calcRate(bucket.completed, bucket.total),
 		})
 	}
 
@@ -370,14 +233,7 @@ func calcQuarterStats(userID uint64) (*BarStats, error) {
 
 // getWeekStart 返回本周周一的零点时间
 func getWeekStart(now time.Time) time.Time {
-	weekday := int(now.Weekday())
-	if weekday == 0 {
-		weekday = 7
-	}
-	delta := weekday - 1
-
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	return startOfDay.AddDate(0, 0, -delta)
+	return usertime.WeekStart(now, now.Location())
 }
 
 func calcRate(completed, total int64) int {
@@ -0,0 +1,100 @@
+package usertime
+
+import (
+	"strings"
+	"time"
+	// 内嵌 IANA 时区数据库，避免部署环境缺少 zoneinfo 时无法解析用户时区
+	_ "time/tzdata"
+
+	"learningAssistant-backend/database"
+	"learningAssistant-backend/models"
+)
+
+// LoadLocation 解析 IANA 时区名，空值或无法识别时返回 false
+func LoadLocation(name string) (*time.Location, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "local") {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// ForUser 返回用户的时区：优先用户设置，其次账号注册时记录的时区，最后退回服务器时区
+func ForUser(userID uint64) *time.Location {
+	db := database.GetDB()
+	if db == nil || userID == 0 {
+		return time.Local
+	}
+	var setting models.UserSetting
+	if err := db.Select("timezone").Where("user_id = ?", userID).First(&setting).Error; err == nil {
+		if loc, ok := LoadLocation(setting.Timezone); ok {
+			return loc
+		}
+	}
+	var user models.User
+	if err := db.Select("timezone").Where("id = ?", userID).First(&user).Error; err == nil {
+		if loc, ok := LoadLocation(user.Timezone); ok {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// StartOfDay 返回 t 在 loc 时区所在日的零点
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// AddDays 按日历日偏移，夏令时切换日不会因为 23/25 小时而错位
+func AddDays(dayStart time.Time, days int) time.Time {
+	return time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day()+days, 0, 0, 0, 0, dayStart.Location())
+}
+
+// DayBounds 返回 t 所在日的起止时间 [start, end)
+func DayBounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	start := StartOfDay(t, loc)
+	return start, AddDays(start, 1)
+}
+
+// At 返回 dayStart 当天某个整点的时刻；该整点落在夏令时跳过的区间内时取切换时刻
+func At(dayStart time.Time, hour int) time.Time {
+	t := time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), hour, 0, 0, 0, dayStart.Location())
+	if t.Hour() < hour && t.Day() == dayStart.Day() {
+		if _, end := t.ZoneBounds(); !end.IsZero() {
+			return end
+		}
+	}
+	return t
+}
+
+// WeekStart 返回 t 所在周周一的零点
+func WeekStart(t time.Time, loc *time.Location) time.Time {
+	day := StartOfDay(t, loc)
+	weekday := int(day.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	return AddDays(day, -(weekday - 1))
+}
+
+// DayKey 返回 t 在 loc 时区的日期字符串
+func DayKey(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// DaysBetween 返回两个日期之间相差的日历天数
+func DaysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// CalendarDate 将某个时区的日期转换为 DATE 列使用的存储值（服务器时区零点）
+func CalendarDate(dayStart time.Time) time.Time {
+	return time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,59 @@
+package usertime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDayBoundsAcrossDST(t *testing.T) {
+	ny, ok := LoadLocation("America/New_York")
+	if !ok {
+		t.Fatalf("load America/New_York")
+	}
+	// 2025-03-09 美东切换夏令时，当天只有 23 小时
+	start, end := DayBounds(time.Date(2025, 3, 9, 15, 0, 0, 0, time.UTC), ny)
+	if got := end.Sub(start); got != 23*time.Hour {
+		t.Fatalf("expected 23h day, got %v", got)
+	}
+	if got := At(start, 2).Sub(start); got != 2*time.Hour {
+		t.Fatalf("expected skipped 02:00 to resolve to the transition instant, got %v after midnight", got)
+	}
+	if got := At(start, 22).Sub(start); got != 21*time.Hour {
+		t.Fatalf("expected 22:00 to be 21h after midnight on DST day, got %v", got)
+	}
+	// 2025-11-02 切回冬令时，当天 25 小时
+	start, end = DayBounds(time.Date(2025, 11, 2, 15, 0, 0, 0, time.UTC), ny)
+	if got := end.Sub(start); got != 25*time.Hour {
+		t.Fatalf("expected 25h day, got %v", got)
+	}
+}
+
+func TestDayKeyAndWeekStartUseUserZone(t *testing.T) {
+	shanghai, _ := LoadLocation("Asia/Shanghai")
+	ny, _ := LoadLocation("America/New_York")
+	instant := time.Date(2025, 3, 2, 20, 30, 0, 0, time.UTC) // 上海已是周一凌晨，纽约仍是周日下午
+
+	if got := DayKey(instant, shanghai); got != "2025-03-03" {
+		t.Fatalf("shanghai day key: %s", got)
+	}
+	if got := DayKey(instant, ny); got != "2025-03-02" {
+		t.Fatalf("new york day key: %s", got)
+	}
+	if got := WeekStart(instant, shanghai).Format("2006-01-02"); got != "2025-03-03" {
+		t.Fatalf("shanghai week start: %s", got)
+	}
+	if got := WeekStart(instant, ny).Format("2006-01-02"); got != "2025-02-24" {
+		t.Fatalf("new york week start: %s", got)
+	}
+	if got := DaysBetween(StartOfDay(instant, ny), AddDays(StartOfDay(instant, ny), 7)); got != 7 {
+		t.Fatalf("expected 7 calendar days across DST start, got %d", got)
+	}
+}
+
+func TestLoadLocationRejectsUnknownZones(t *testing.T) {
+	for _, name := range []string{"", "Local", "Mars/Olympus"} {
+		if _, ok := LoadLocation(name); ok {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package weeklyreport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"learningAssistant-backend/models"
+	"learningAssistant-backend/services/streak"
+	"learningAssistant-backend/services/usertime"
+)
+
+const dayLayout = "2006-01-02"
+
+// DeliveryDelay 周结束后等待的时间，留给每日学习时长聚合任务补齐周日的数据
+const DeliveryDelay = time.Hour
+
+// maxCategories 周报中展示的新增知识分类数
+const maxCategories = 5
+
+var (
+	ErrWeekNotOver    = errors.New("weekly_report_week_not_over")
+	ErrReportNotFound = errors.New("weekly_report_not_found")
+)
+
+// DayMinutes 某一天的学习分钟数
+type DayMinutes struct {
+	Date    string `json:"date"`
+	Minutes int    `json:"minutes"`
+}
+
+// AchievementItem 本周解锁的成就
+type AchievementItem struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// CategoryCount 本周新增知识点按分类的计数
+type CategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// Comparison 与前一周相比的变化量（本周减前一周）
+type Comparison struct {
+	PreviousWeekStart    string `json:"previous_week_start"`
+	StudyMinutes         int    `json:"study_minutes"`
+	StudyDays            int    `json:"study_days"`
+	TasksCompleted       int    `json:"tasks_completed"`
+	KnowledgeAdded       int    `json:"knowledge_added"`
+	AchievementsUnlocked int    `json:"achievements_unlocked"`
+	// MasteredChange 与前一周周报的掌握快照相比的变化，前一周没有周报时为 nil
+	MasteredChange *int `json:"mastered_change"`
+	// StudyMinutesPercent 学习时长环比百分比，前一周没有学习时为 nil
+	StudyMinutesPercent *float64 `json:"study_minutes_percent"`
+}
+
+// Details 周报明细，序列化后保存在 WeeklyReport.Details
+type Details struct {
+	WeekEnd             string            `json:"week_end"`
+	DailyMinutes        []DayMinutes      `json:"daily_minutes"`
+	Achievements        []AchievementItem `json:"achievements"`
+	KnowledgeCategories []CategoryCount   `json:"knowledge_categories"`
+	Comparison          Comparison        `json:"comparison"`
+}
+
+// weekMetrics 可以从历史数据还原的一周指标
+type weekMetrics struct {
+	StudyMinutes         int
+	StudyDays            int
+	TasksCompleted       int
+	KnowledgeAdded       int
+	AchievementsUnlocked int
+}
+
+// LastCompletedWeek 返回 now 之前最近一个完整周的周一零点（loc 时区）
+func LastCompletedWeek(now time.Time, loc *time.Location) time.Time {
+	return usertime.AddDays(usertime.WeekStart(now, loc), -7)
+}
+
+// Ready 周报是否可以生成：该周已结束且过了 DeliveryDelay
+func Ready(weekStart, now time.Time) bool {
+	return !now.Before(usertime.AddDays(weekStart, 7).Add(DeliveryDelay))
+}
+
+// Generate 生成用户 weekStart 所在周（用户时区）的周报。已生成的周报直接返回，
+// 保证知识掌握快照只在首次生成时记录一次
+func Generate(db *gorm.DB, userID uint64, weekStart, now time.Time) (*models.WeeklyReport, *Details, error) {
+	loc := usertime.ForUser(userID)
+	start := usertime.WeekStart(weekStart, loc)
+	end := usertime.AddDays(start, 7)
+	if now.Before(end) {
+		return nil, nil, ErrWeekNotOver
+	}
+	if existing, err := Get(db, userID, start); err == nil {
+		details, err := ParseDetails(existing)
+		return existing, details, err
+	} else if !errors.Is(err, ErrReportNotFound) {
+		return nil, nil, err
+	}
+
+	current, daily, err := collect(db, userID, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	prevStart := usertime.AddDays(start, -7)
+	previous, _, err := collect(db, userID, prevStart, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	achievements, err := unlockedAchievements(db, userID, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	categories, err := knowledgeCategories(db, userID, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	mastered, learning, toLearn, err := masterySnapshot(db, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 以周日作为“今天”计算，周日未活跃时不视为中断
+	summary, err := streak.Compute(db, userID, loc, usertime.AddDays(start, 6))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comparison := Comparison{
+		PreviousWeekStart:    prevStart.Format(dayLayout),
+		StudyMinutes:         current.StudyMinutes - previous.StudyMinutes,
+		StudyDays:            current.StudyDays - previous.StudyDays,
+		TasksCompleted:       current.TasksCompleted - previous.TasksCompleted,
+		KnowledgeAdded:       current.KnowledgeAdded - previous.KnowledgeAdded,
+		AchievementsUnlocked: current.AchievementsUnlocked - previous.AchievementsUnlocked,
+	}
+	if previous.StudyMinutes > 0 {
+		percent := float64(comparison.StudyMinutes) * 100 / float64(previous.StudyMinutes)
+		comparison.StudyMinutesPercent = &percent
+	}
+	if prevReport, err := Get(db, userID, prevStart); err == nil {
+		change := mastered - prevReport.MasteredCount
+		comparison.MasteredChange = &change
+	} else if !errors.Is(err, ErrReportNotFound) {
+		return nil, nil, err
+	}
+
+	details := &Details{
+		WeekEnd:             usertime.AddDays(start, 6).Format(dayLayout),
+		DailyMinutes:        daily,
+		Achievements:        achievements,
+		KnowledgeCategories: categories,
+		Comparison:          comparison,
+	}
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := models.WeeklyReport{
+		UserID:               userID,
+		WeekStart:            usertime.CalendarDate(start),
+		StudyMinutes:         current.StudyMinutes,
+		StudyDays:            current.StudyDays,
+		TasksCompleted:       current.TasksCompleted,
+		KnowledgeAdded:       current.KnowledgeAdded,
+		MasteredCount:        mastered,
+		LearningCount:        learning,
+		ToLearnCount:         toLearn,
+		AchievementsUnlocked: current.AchievementsUnlocked,
+		StreakDays:           summary.Current,
+		LongestStreakDays:    summary.Longest,
+		Details:              string(encoded),
+	}
+	// 并发生成同一份周报时以先写入的为准
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		existing, err := Get(db, userID, start)
+		if err != nil {
+			return nil, nil, err
+		}
+		details, err := ParseDetails(existing)
+		return existing, details, err
+	}
+	return &report, details, nil
+}
+
+// Get 读取用户 weekStart 所在周的周报
+func Get(db *gorm.DB, userID uint64, weekStart time.Time) (*models.WeeklyReport, error) {
+	start := usertime.WeekStart(weekStart, weekStart.Location())
+	var report models.WeeklyReport
+	err := db.Where("user_id = ? AND week_start = ?", userID, usertime.CalendarDate(start)).First(&report).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// List 用户的历史周报，按周倒序
+func List(db *gorm.DB, userID uint64, limit int) ([]models.WeeklyReport, error) {
+	var reports []models.WeeklyReport
+	err := db.Where("user_id = ?", userID).Order("week_start DESC").Limit(limit).Find(&reports).Error
+	return reports, err
+}
+
+// ParseDetails 解析周报明细
+func ParseDetails(report *models.WeeklyReport) (*Details, error) {
+	details := &Details{}
+	if report.Details == "" {
+		return details, nil
+	}
+	if err := json.Unmarshal([]byte(report.Details), details); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// MarkNotified 记录站内通知已发送
+func MarkNotified(db *gorm.DB, report *models.WeeklyReport, now time.Time) error {
+	report.NotifiedAt = &now
+	return db.Model(report).Update("notified_at", now).Error
+}
+
+// MarkEmailed 记录邮件已发送
+func MarkEmailed(db *gorm.DB, report *models.WeeklyReport, now time.Time) error {
+	report.EmailedAt = &now
+	return db.Model(report).Update("emailed_at", now).Error
+}
+
+// Summary 一句话概括周报，用于站内通知
+func Summary(report *models.WeeklyReport, details *Details) string {
+	parts := []string{fmt.Sprintf("学习 %d 分钟（%s）", report.StudyMinutes, signed(details.Comparison.StudyMinutes))}
+	parts = append(parts, fmt.Sprintf("完成 %d 个任务", report.TasksCompleted))
+	parts = append(parts, fmt.Sprintf("新增 %d 个知识点", report.KnowledgeAdded))
+	if change := details.Comparison.MasteredChange; change != nil && *change != 0 {
+		parts = append(parts, fmt.Sprintf("掌握知识点 %s", signed(*change)))
+	}
+	if report.AchievementsUnlocked > 0 {
+		parts = append(parts, fmt.Sprintf("解锁 %d 个成就", report.AchievementsUnlocked))
+	}
+	if report.StreakDays > 0 {
+		parts = append(parts, fmt.Sprintf("已连续活跃 %d 天", report.StreakDays))
+	}
+	return "上周" + strings.Join(parts, "，")
+}
+
+// EmailBody 周报邮件正文
+func EmailBody(displayName string, report *models.WeeklyReport, details *Details) string {
+	cmp := details.Comparison
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s，你好：\n\n以下是你 %s 至 %s 的学习周报。\n\n", displayName, report.WeekStart.Format(dayLayout), details.WeekEnd)
+	fmt.Fprintf(&b, "学习时长：%d 分钟，学习 %d 天（较前一周 %s 分钟）\n", report.StudyMinutes, report.StudyDays, signed(cmp.StudyMinutes))
+	fmt.Fprintf(&b, "完成任务：%d 个（较前一周 %s）\n", report.TasksCompleted, signed(cmp.TasksCompleted))
+	fmt.Fprintf(&b, "新增知识点：%d 个（较前一周 %s）\n", report.KnowledgeAdded, signed(cmp.KnowledgeAdded))
+	fmt.Fprintf(&b, "知识掌握：已掌握 %d，学习中 %d，待学习 %d", report.MasteredCount, report.LearningCount, report.ToLearnCount)
+	if cmp.MasteredChange != nil {
+		fmt.Fprintf(&b, "（已掌握较前一周 %s）", signed(*cmp.MasteredChange))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "连续活跃：%d 天，最长 %d 天\n", report.StreakDays, report.LongestStreakDays)
+	if len(details.Achievements) > 0 {
+		names := make([]string, 0, len(details.Achievements))
+		for _, item := range details.Achievements {
+			names = append(names, item.Name)
+		}
+		fmt.Fprintf(&b, "解锁成就：%s\n", strings.Join(names, "、"))
+	}
+	b.WriteString("\n不想再收到周报邮件，可以在个人设置中关闭“学习总结”通知。\n")
+	return b.String()
+}
+
+// collect 统计 [start, end) 区间内的学习时长、完成任务、新增知识点与解锁成就，并返回逐日学习分钟
+func collect(db *gorm.DB, userID uint64, start, end time.Time) (weekMetrics, []DayMinutes, error) {
+	var m weekMetrics
+	var stats []models.DailyStudyStat
+	if err := db.Select("date", "minutes").
+		Where("user_id = ? AND date >= ? AND date < ?", userID, usertime.CalendarDate(start), usertime.CalendarDate(end)).
+		Find(&stats).Error; err != nil {
+		return m, nil, err
+	}
+	// DATE 列保存的即为用户时区的日历日
+	byDay := make(map[string]int, len(stats))
+	for _, stat := range stats {
+		byDay[stat.Date.Format(dayLayout)] += stat.Minutes
+	}
+	var daily []DayMinutes
+	for day := start; day.Before(end); day = usertime.AddDays(day, 1) {
+		minutes := byDay[day.Format(dayLayout)]
+		daily = append(daily, DayMinutes{Date: day.Format(dayLayout), Minutes: minutes})
+		m.StudyMinutes += minutes
+		if minutes > 0 {
+			m.StudyDays++
+		}
+	}
+
+	var count int64
+	// 完成归属负责人，无负责人时归属创建者，与完成计数的口径保持一致
+	if err := db.Model(&models.Task{}).
+		Where("status = ? AND completed_at >= ? AND completed_at < ? AND (owner_user_id = ? OR (owner_user_id IS NULL AND created_by = ?))", 2, start, end, userID, userID).
+		Count(&count).Error; err != nil {
+		return m, nil, err
+	}
+	m.TasksCompleted = int(count)
+	if err := db.Model(&models.KnowledgeBaseEntry{}).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+		Count(&count).Error; err != nil {
+		return m, nil, err
+	}
+	m.KnowledgeAdded = int(count)
+	if err := db.Model(&models.UserAchievement{}).
+		Where("user_id = ? AND awarded_at >= ? AND awarded_at < ?", userID, start, end).
+		Count(&count).Error; err != nil {
+		return m, nil, err
+	}
+	m.AchievementsUnlocked = int(count)
+	return m, daily, nil
+}
+
+func unlockedAchievements(db *gorm.DB, userID uint64, start, end time.Time) ([]AchievementItem, error) {
+	items := []AchievementItem{}
+	err := db.Table("user_achievements AS ua").
+		Select("a.id AS id, a.name AS name, ua.awarded_at AS awarded_at").
+		Joins("JOIN achievements AS a ON a.id = ua.achievement_id").
+		Where("ua.user_id = ? AND ua.awarded_at >= ? AND ua.awarded_at < ? AND ua.deleted_at IS NULL", userID, start, end).
+		Order("ua.awarded_at").
+		Scan(&items).Error
+	return items, err
+}
+
+func knowledgeCategories(db *gorm.DB, userID uint64, start, end time.Time) ([]CategoryCount, error) {
+	var rows []CategoryCount
+	if err := db.Model(&models.KnowledgeBaseEntry{}).
+		Select("category, COUNT(*) AS count").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+		Group("category").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if rows[i].Category == "" {
+			rows[i].Category = "未分类"
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Category < rows[j].Category
+	})
+	if len(rows) > maxCategories {
+		rows = rows[:maxCategories]
+	}
+	return rows, nil
+}
+
+// masterySnapshot 当前未归档知识点的掌握分布：等级 4 为已掌握，1-3 为学习中，0 为待学习
+func masterySnapshot(db *gorm.DB, userID uint64) (mastered, learning, toLearn int, err error) {
+	var rows []struct {
+		Level int8
+		Count int
+	}
+	if err = db.Model(&models.KnowledgeBaseEntry{}).
+		Select("level, COUNT(*) AS count").
+		Where("user_id = ? AND status <> ?", userID, 2).
+		Group("level").
+		Scan(&rows).Error; err != nil {
+		return
+	}
+	for _, row := range rows {
+		switch {
+		case row.Level >= 4:
+			mastered += row.Count
+		case row.Level > 0:
+			learning += row.Count
+		default:
+			toLearn += row.Count
+		}
+	}
+	return
+}
+
+func signed(n int) string {
+	if n > 0 {
+		return fmt.Sprintf("+%d", n)
+	}
+	return fmt.Sprintf("%d", n)
+}
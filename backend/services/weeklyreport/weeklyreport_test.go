@@ -0,0 +1,84 @@
+package weeklyreport
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"learningAssistant-backend/internal/testdb"
+	"learningAssistant-backend/models"
+)
+
+func TestGenerateSummarizesWeekAndComparesWithPreviousWeek(t *testing.T) {
+	db := testdb.Open(t)
+	user := models.User{Account: "u", Email: "u@x", Phone: "1", DisplayName: "小明", Status: 1, PasswordHash: "x"}
+	db.Create(&user)
+	db.Create(&models.UserProfile{UserID: user.ID})
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.Local) }
+	weekStart := day(9) // 周一
+	// 上一周：学习 60 分钟，留有周报作为掌握快照的基准
+	db.Create(&models.DailyStudyStat{UserID: user.ID, Date: day(4), Minutes: 60})
+	db.Create(&models.WeeklyReport{UserID: user.ID, WeekStart: day(2), MasteredCount: 1})
+	// 本周：两天共学习 90 分钟，完成 1 个任务，新增 2 个知识点，解锁 1 个成就
+	db.Create(&models.DailyStudyStat{UserID: user.ID, Date: day(9), Minutes: 40})
+	db.Create(&models.DailyStudyStat{UserID: user.ID, Date: day(11), Minutes: 50})
+	completedAt := day(10).Add(20 * time.Hour)
+	db.Create(&models.Task{Title: "t", TaskType: 1, CreatedBy: user.ID, Status: 2, CompletedAt: &completedAt})
+	lateTask := day(16).Add(time.Hour)
+	db.Create(&models.Task{Title: "下周", TaskType: 1, CreatedBy: user.ID, Status: 2, CompletedAt: &lateTask})
+	for _, level := range []int8{4, 4, 2} {
+		entry := models.KnowledgeBaseEntry{UserID: user.ID, Title: "k", Category: "数学", Level: level, Status: 1}
+		db.Create(&entry)
+	}
+	db.Model(&models.KnowledgeBaseEntry{}).Where("level = ?", 2).Update("created_at", day(1))
+	ach := models.Achievement{Code: "a", Name: "🎯 新手", Description: "d", Category: "c", Condition: "{}"}
+	db.Create(&ach)
+	db.Create(&models.UserAchievement{UserID: user.ID, AchievementID: uint(ach.ID), AwardedAt: day(12).Add(9 * time.Hour)})
+	db.Model(&models.KnowledgeBaseEntry{}).Where("level = ?", 4).Update("created_at", day(13))
+
+	if _, _, err := Generate(db, user.ID, weekStart, day(15).Add(12*time.Hour)); !errors.Is(err, ErrWeekNotOver) {
+		t.Fatalf("expected unfinished week to be rejected, got %v", err)
+	}
+
+	now := day(16).Add(2 * time.Hour)
+	report, details, err := Generate(db, user.ID, day(12), now)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if report.StudyMinutes != 90 || report.StudyDays != 2 || report.TasksCompleted != 1 ||
+		report.KnowledgeAdded != 2 || report.AchievementsUnlocked != 1 {
+		t.Fatalf("unexpected metrics %+v", report)
+	}
+	if report.MasteredCount != 2 || report.LearningCount != 1 || report.ToLearnCount != 0 {
+		t.Fatalf("unexpected mastery snapshot %+v", report)
+	}
+	cmp := details.Comparison
+	if cmp.StudyMinutes != 30 || cmp.TasksCompleted != 1 || cmp.KnowledgeAdded != 2 || cmp.PreviousWeekStart != "2026-03-02" {
+		t.Fatalf("unexpected comparison %+v", cmp)
+	}
+	if cmp.MasteredChange == nil || *cmp.MasteredChange != 1 || cmp.StudyMinutesPercent == nil || *cmp.StudyMinutesPercent != 50 {
+		t.Fatalf("unexpected mastery change or percent %+v", cmp)
+	}
+	if len(details.DailyMinutes) != 7 || details.DailyMinutes[2].Minutes != 50 || details.WeekEnd != "2026-03-15" {
+		t.Fatalf("unexpected daily breakdown %+v", details)
+	}
+	if len(details.Achievements) != 1 || details.Achievements[0].Name != ach.Name {
+		t.Fatalf("unexpected achievements %+v", details.Achievements)
+	}
+	if !strings.Contains(Summary(report, details), "学习 90 分钟（+30）") {
+		t.Fatalf("unexpected summary %q", Summary(report, details))
+	}
+
+	// 再次生成返回已保存的周报，掌握快照不随之后的变化改写
+	db.Model(&models.KnowledgeBaseEntry{}).Where("level = ?", 2).Update("level", 4)
+	again, _, err := Generate(db, user.ID, weekStart, now.Add(time.Hour))
+	if err != nil || again.ID != report.ID || again.MasteredCount != 2 {
+		t.Fatalf("expected stored report to be returned, got %+v, %v", again, err)
+	}
+	history, err := List(db, user.ID, 10)
+	if err != nil || len(history) != 2 || history[0].ID != report.ID {
+		t.Fatalf("unexpected history %+v, %v", history, err)
+	}
+}